@@ -0,0 +1,93 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestCLICheckoutCommitPrefix(t *testing.T) {
+	tmpDir := t.TempDir()
+	binName := "kitcat"
+	if runtime.GOOS == "windows" {
+		binName += ".exe"
+	}
+	binPath := filepath.Join(tmpDir, binName)
+	buildCmd := exec.Command("go", "build", "-o", binPath, "main.go")
+	if output, err := buildCmd.CombinedOutput(); err != nil {
+		t.Fatalf("Failed to build kitcat binary: %v\nOutput: %s", err, output)
+	}
+
+	repo := t.TempDir()
+	kitcat := func(args ...string) (string, error) {
+		cmd := exec.Command(binPath, args...)
+		cmd.Dir = repo
+		output, err := cmd.CombinedOutput()
+		return string(output), err
+	}
+	run := func(args ...string) string {
+		t.Helper()
+		output, err := kitcat(args...)
+		if err != nil {
+			t.Fatalf("kitcat %v: %v\n%s", args, err, output)
+		}
+		return output
+	}
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(repo, "f.txt"), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	run("init")
+	run("config", "user.name", "Test")
+	run("config", "user.email", "test@example.com")
+	write("first\n")
+	run("add", "f.txt")
+	run("commit", "-m", "first")
+	write("second version\n")
+	run("add", "f.txt")
+	run("commit", "-m", "second")
+
+	hashes := strings.Fields(run("log", "--oneline"))
+	var first string
+	for _, field := range hashes {
+		if len(field) >= 7 && strings.Trim(field, "0123456789abcdef") == "" {
+			first = field
+		}
+	}
+	if first == "" {
+		t.Fatalf("no commit hash in log output %q", hashes)
+	}
+
+	// Too short, or not hex: never taken as a commit
+	for _, name := range []string{first[:1], first[:3], "zzzz"} {
+		output, err := kitcat("checkout", name)
+		if err == nil || !strings.Contains(output, "does not exist on disk") {
+			t.Errorf("checkout %s = %v %q, want a missing-file error", name, err, output)
+		}
+	}
+
+	// Uncommitted edits are kept unless --force is given
+	write("uncommitted edit\n")
+	output, err := kitcat("checkout", first[:4])
+	if err == nil || !strings.Contains(output, "would be lost") {
+		t.Errorf("checkout over uncommitted changes = %v %q, want a refusal", err, output)
+	}
+	if data, _ := os.ReadFile(filepath.Join(repo, "f.txt")); string(data) != "uncommitted edit\n" {
+		t.Errorf("f.txt after refused checkout = %q", data)
+	}
+	run("checkout", "--force", first[:4])
+	if data, _ := os.ReadFile(filepath.Join(repo, "f.txt")); string(data) != "first\n" {
+		t.Errorf("f.txt after checkout --force = %q", data)
+	}
+
+	// A valid prefix that matches nothing reports the lookup error
+	output, err = kitcat("checkout", "0000000")
+	if err == nil || !strings.Contains(output, "not found") {
+		t.Errorf("checkout of an unknown hash = %v %q, want a not-found error", err, output)
+	}
+}
@@ -1,12 +1,17 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strings"
 
 	"github.com/LeeFred3042U/kitcat/internal/core"
 	"github.com/LeeFred3042U/kitcat/internal/models"
+	"github.com/LeeFred3042U/kitcat/internal/storage"
 )
 
 type CommandFunc func(args []string)
@@ -20,35 +25,160 @@ var commands = map[string]CommandFunc{
 		}
 	},
 	"add": func(args []string) {
-		if len(args) < 1 {
-			fmt.Println("Usage: kitcat add <file-path>")
+		var opts core.AddOptions
+		all := false
+		var paths []string
+		usage := "Usage: kitcat add [--force] [--no-binary] [--keep-going] [--follow-symlinks] [--stats] [--exclude <pattern>]... <file-path>"
+		for i := 0; i < len(args); i++ {
+			arg := args[i]
+			switch arg {
+			case "-f", "--force":
+				opts.Force = true
+			case "--no-binary":
+				opts.ExcludeBinary = true
+			case "-k", "--keep-going":
+				opts.KeepGoing = true
+			case "--follow-symlinks":
+				opts.FollowSymlinks = true
+			case "--stats":
+				opts.Stats = &core.AddStats{}
+			case "-A", "--all":
+				all = true
+			case "--exclude":
+				if i+1 >= len(args) {
+					fmt.Println(usage)
+					os.Exit(2)
+				}
+				i++
+				opts.Exclude = append(opts.Exclude, args[i])
+			default:
+				paths = append(paths, arg)
+			}
+		}
+		if !all && len(paths) < 1 {
+			fmt.Println(usage)
 			os.Exit(2)
 		}
-		if args[0] == "-A" || args[0] == "--all" {
+		if all {
 			fmt.Println("Staging all changes...")
-			if err := core.AddAll(); err != nil {
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			err := core.AddAllWithOptions(ctx, opts)
+			stop()
+			if opts.Stats != nil {
+				fmt.Println(opts.Stats)
+			}
+			if err != nil {
 				fmt.Println("Error:", err)
 				os.Exit(1)
 			}
 			os.Exit(0)
 		}
+		// Resolve every path against the caller's directory up front: AddFile moves
+		// to the repository root, which would change how later relative paths resolve.
+		targets := make([]string, len(paths))
+		for i, path := range paths {
+			targets[i] = path
+			if abs, err := filepath.Abs(path); err == nil {
+				targets[i] = abs
+			}
+		}
 		exitCode := 0
-		for _, path := range args {
-			if err := core.AddFile(path); err != nil {
+		for i, path := range paths {
+			if err := core.AddFileWithOptions(targets[i], opts); err != nil {
 				fmt.Printf("Error adding %s: %v\n", path, err)
 				exitCode = 1
 			}
+			if opts.Stats != nil {
+				fmt.Printf("%s:\n%s\n", path, opts.Stats)
+			}
 		}
 		os.Exit(exitCode)
 	},
 	"grep": func(args []string) {
-		if err := core.Grep(args); err != nil {
+		const usage = "Usage: kitcat grep [-n] [-i] <pattern> [<commit>] [-- <path>]"
+		showLineNumber := false
+		var opts core.GrepOptions
+		var positional []string
+		for i := 0; i < len(args); i++ {
+			switch args[i] {
+			case "-n", "--line-number":
+				showLineNumber = true
+			case "-i", "--ignore-case":
+				opts.IgnoreCase = true
+			case "--":
+				if i+2 != len(args) {
+					fmt.Println(usage)
+					os.Exit(2)
+				}
+				opts.PathPrefix = args[i+1]
+				i++
+			default:
+				positional = append(positional, args[i])
+			}
+		}
+		if len(positional) < 1 || len(positional) > 2 {
+			fmt.Println(usage)
+			os.Exit(2)
+		}
+		ref := ""
+		if len(positional) == 2 {
+			ref = positional[1]
+		}
+		matches, err := core.Grep(positional[0], ref, opts)
+		if err != nil {
 			fmt.Println("Error:", err)
 			os.Exit(1)
 		}
+		for _, m := range matches {
+			if showLineNumber {
+				fmt.Printf("%s:%d:%s\n", m.Path, m.Line, m.Text)
+			} else {
+				fmt.Printf("%s:%s\n", m.Path, m.Text)
+			}
+		}
 		os.Exit(0)
 	},
 
+	"restore": func(args []string) {
+		source := ""
+		var paths []string
+		for i := 0; i < len(args); i++ {
+			switch {
+			case strings.HasPrefix(args[i], "--source="):
+				source = strings.TrimPrefix(args[i], "--source=")
+			case args[i] == "-s" || args[i] == "--source":
+				if i+1 >= len(args) {
+					fmt.Println("Usage: kitcat restore [--source=<commit>] <path>...")
+					os.Exit(2)
+				}
+				i++
+				source = args[i]
+			default:
+				paths = append(paths, args[i])
+			}
+		}
+		if len(paths) == 0 {
+			fmt.Println("Usage: kitcat restore [--source=<commit>] <path>...")
+			os.Exit(2)
+		}
+		// Resolve paths against the caller's directory before moving to the repository root.
+		for i, path := range paths {
+			if abs, err := filepath.Abs(path); err == nil {
+				paths[i] = abs
+			}
+		}
+		if !core.IsRepoInitialized() {
+			fmt.Println("Error: not a kitcat repository (or any of the parent directories): .kitcat")
+			os.Exit(1)
+		}
+		for _, path := range paths {
+			if err := core.Restore(path, source); err != nil {
+				fmt.Println("Error:", err)
+				os.Exit(1)
+			}
+		}
+		os.Exit(0)
+	},
 	"rm": func(args []string) {
 		if len(args) < 1 {
 			fmt.Println("Usage: kitcat rm [-r] <file>")
@@ -75,6 +205,12 @@ var commands = map[string]CommandFunc{
 			os.Exit(2)
 		}
 
+		// RemoveFile moves to the repository root; resolve every path before the first call.
+		for i, filename := range filesToRemove {
+			if abs, err := filepath.Abs(filename); err == nil {
+				filesToRemove[i] = abs
+			}
+		}
 		exitCode := 0
 		for _, filename := range filesToRemove {
 			if err := core.RemoveFile(filename, recursive); err != nil {
@@ -92,7 +228,7 @@ var commands = map[string]CommandFunc{
 			os.Exit(1)
 		}
 
-		if len(args) < 2 {
+		if len(args) < 2 && !(len(args) == 1 && args[0] == "--amend") {
 			fmt.Println("Usage: kitcat commit <-m | -am | --amend> <message>")
 			os.Exit(2)
 		}
@@ -100,15 +236,32 @@ var commands = map[string]CommandFunc{
 		var isAmend bool
 		var message string
 
+		// Pathspecs after "--" limit the commit to those staged paths.
+		var pathspecs []string
+		for i, arg := range args {
+			if arg == "--" {
+				pathspecs = args[i+1:]
+				args = args[:i]
+				break
+			}
+		}
+		if pathspecs != nil && (len(args) < 2 || args[0] != "-m" || len(pathspecs) == 0) {
+			fmt.Println("Usage: kitcat commit -m <message> -- <path>...")
+			os.Exit(2)
+		}
+
 		switch args[0] {
 		// Checks for amending
 		case "--amend":
-			if len(args) < 3 || args[1] != "-m" {
-				fmt.Println("Usage: kitcat commit --amend -m <message>")
+			// Without -m the original message is kept.
+			if len(args) > 1 && (len(args) < 3 || args[1] != "-m") {
+				fmt.Println("Usage: kitcat commit --amend [-m <message>]")
 				os.Exit(2)
 			}
 			isAmend = true
-			message = strings.Join(args[2:], " ")
+			if len(args) > 2 {
+				message = strings.Join(args[2:], " ")
+			}
 		// Normal commit flow
 		case "-am":
 			message = strings.Join(args[1:], " ")
@@ -135,18 +288,18 @@ var commands = map[string]CommandFunc{
 
 		// Handle amend or normal commit
 		if isAmend {
-			if strings.TrimSpace(message) == "" {
+			if len(args) > 2 && strings.TrimSpace(message) == "" {
 				fmt.Println("Error: commit message cannot be empty")
 				os.Exit(1)
 			}
-			newCommit, err := core.AmendCommit(message)
+			newCommit, err := core.CommitAmend(message)
 			if err != nil {
 				fmt.Println("Error:", err)
 				os.Exit(1)
 			}
 			headState, err := core.GetHeadState()
 			if err != nil {
-				headData, _ := os.ReadFile(".kitcat/HEAD")
+				headData, _ := os.ReadFile(core.HeadPath())
 				ref := strings.TrimSpace(string(headData))
 				headState = strings.TrimPrefix(ref, "ref: refs/heads/")
 			}
@@ -157,7 +310,14 @@ var commands = map[string]CommandFunc{
 				fmt.Println("Error: commit message cannot be empty")
 				os.Exit(1)
 			}
-			newCommit, summary, err := core.Commit(message)
+			var newCommit models.Commit
+			var summary string
+			var err error
+			if pathspecs != nil {
+				newCommit, summary, err = core.CommitPaths(message, pathspecs)
+			} else {
+				newCommit, summary, err = core.Commit(message)
+			}
 			if err != nil {
 				if err.Error() == "nothing to commit, working tree clean" {
 					fmt.Println(err.Error())
@@ -210,32 +370,70 @@ var commands = map[string]CommandFunc{
 		}
 	},
 	"status": func(args []string) {
+		asJSON, showIgnored := false, false
+		for _, arg := range args {
+			switch arg {
+			case "--json":
+				asJSON = true
+			case "--ignored":
+				showIgnored = true
+			default:
+				fmt.Println("Usage: kitcat status [--ignored] [--json]")
+				os.Exit(2)
+			}
+		}
 
 		if !core.IsRepoInitialized() {
 			fmt.Println("Error: not a kitcat repository (or any of the parent directories): .kitcat")
 			os.Exit(1)
 		}
 
-		if err := core.Status(); err != nil {
+		if asJSON {
+			result, err := core.GetStatus()
+			if err != nil {
+				fmt.Println("Error:", err)
+				os.Exit(1)
+			}
+			printJSON(result)
+			return
+		}
+		if err := core.Status(showIgnored); err != nil {
 			fmt.Println("Error:", err)
 			os.Exit(1)
 		}
 	},
 	"diff": func(args []string) {
-		staged := false
-		stat := false
+		var opts core.DiffOptions
+		asJSON := false
 		for _, arg := range args {
 			switch arg {
 			case "--cached", "--staged":
-				staged = true
+				opts.Staged = true
 			case "--stat":
-				stat = true
+				opts.Stat = true
+			case "--json":
+				asJSON = true
+			case "-w", "--ignore-all-space":
+				opts.Whitespace.IgnoreAll = true
+			case "--ignore-space-at-eol":
+				opts.Whitespace.IgnoreTrailing = true
+			case "--ignore-blank-lines":
+				opts.Whitespace.IgnoreBlankLines = true
 			default:
 				fmt.Println("Path filtering not supported")
 				os.Exit(2)
 			}
 		}
-		if err := core.Diff(staged, stat); err != nil {
+		if asJSON {
+			files, err := core.DiffFilesWithOptions(opts)
+			if err != nil {
+				fmt.Println("Error:", err)
+				os.Exit(1)
+			}
+			printJSON(files)
+			return
+		}
+		if err := core.DiffWithOptions(opts); err != nil {
 			fmt.Println("Error:", err)
 			os.Exit(1)
 		}
@@ -243,11 +441,38 @@ var commands = map[string]CommandFunc{
 	"checkout": func(args []string) {
 		if len(args) < 1 {
 			fmt.Println(
-				"Usage: kitcat checkout [-b] <branch-name> | <file-path> | <branch> -- <file-path>",
+				"Usage: kitcat checkout [-b] <branch-name> | [--force] <commit> | <file-path> | <branch> -- <file-path> | --dry-run <branch|commit>",
 			)
 			os.Exit(2)
 		}
 
+		// Preview: kitcat checkout --dry-run <branch|commit>
+		if args[0] == "--dry-run" || args[0] == "-n" {
+			if len(args) != 2 {
+				fmt.Println("Usage: kitcat checkout --dry-run <branch|commit>")
+				os.Exit(2)
+			}
+			actions, err := core.CheckoutPlan(args[1])
+			if err != nil {
+				fmt.Println("Error:", err)
+				os.Exit(1)
+			}
+			lost := 0
+			for _, a := range actions {
+				if a.LosesLocalChanges {
+					lost++
+					fmt.Printf("%-9s %s (local changes would be lost)\n", a.Op, a.Path)
+				} else {
+					fmt.Printf("%-9s %s\n", a.Op, a.Path)
+				}
+			}
+			if lost > 0 {
+				fmt.Printf("%d file(s) with local changes would be overwritten or deleted\n", lost)
+				os.Exit(1)
+			}
+			os.Exit(0)
+		}
+
 		// Handle branch creation: kitcat checkout -b <branch-name>
 		if args[0] == "-b" {
 			if len(args) != 2 {
@@ -320,6 +545,15 @@ var commands = map[string]CommandFunc{
 		}
 
 		// No -- separator: fallback to old logic
+		force := false
+		if args[0] == "--force" || args[0] == "-f" {
+			force = true
+			args = args[1:]
+		}
+		if len(args) != 1 {
+			fmt.Println("Usage: kitcat checkout [--force] <branch> | <commit> | <file-path>")
+			os.Exit(2)
+		}
 		name := args[0]
 		if core.IsBranch(name) {
 			if err := core.CheckoutBranch(name); err != nil {
@@ -328,8 +562,22 @@ var commands = map[string]CommandFunc{
 			}
 		} else {
 			if _, err := os.Stat(name); err != nil {
-				fmt.Printf("Error: file '%s' does not exist on disk\n", name)
-				os.Exit(1)
+				if !storage.IsHashPrefix(name) {
+					fmt.Printf("Error: file '%s' does not exist on disk\n", name)
+					os.Exit(1)
+				}
+				// Not a file: a (possibly abbreviated) commit hash for a detached checkout
+				commit, err := storage.FindCommit(strings.ToLower(strings.TrimSpace(name)))
+				if err != nil {
+					fmt.Println("Error:", err)
+					os.Exit(1)
+				}
+				if err := core.CheckoutCommitWithOptions(commit.ID, core.CheckoutOptions{Force: force}); err != nil {
+					fmt.Println("Error:", err)
+					os.Exit(1)
+				}
+				fmt.Printf("HEAD is now at %s\n", commit.ID[:7])
+				os.Exit(0)
 			}
 			if err := core.CheckoutFile(name); err != nil {
 				fmt.Println("Error:", err)
@@ -351,6 +599,7 @@ var commands = map[string]CommandFunc{
 	"reset": func(args []string) {
 		// Phase 1: Parse mode flags and collect positional args
 		mode := core.ResetMixed // default
+		var opts core.ResetOptions
 		positionalArgs := []string{}
 
 		for _, arg := range args {
@@ -361,6 +610,8 @@ var commands = map[string]CommandFunc{
 				mode = core.ResetMixed
 			case "--" + core.ResetHard:
 				mode = core.ResetHard
+			case "--force", "-f":
+				opts.Force = true
 			default:
 				positionalArgs = append(positionalArgs, arg)
 			}
@@ -369,13 +620,13 @@ var commands = map[string]CommandFunc{
 		// Phase 2: Validate positional arguments
 		if len(positionalArgs) == 0 {
 			fmt.Println("Error: commit reference required")
-			fmt.Println("Usage: kitcat reset [--soft | --mixed | --hard] <commit-hash>")
+			fmt.Println("Usage: kitcat reset [--soft | --mixed | --hard [--force]] <commit-hash>")
 			os.Exit(2)
 		}
 
 		if len(positionalArgs) > 1 {
 			fmt.Println("Error: too many arguments")
-			fmt.Println("Usage: kitcat reset [--soft | --mixed | --hard] <commit-hash>")
+			fmt.Println("Usage: kitcat reset [--soft | --mixed | --hard [--force]] <commit-hash>")
 			os.Exit(2)
 		}
 
@@ -390,7 +641,7 @@ var commands = map[string]CommandFunc{
 		commitHash = resolvedHash
 
 		// Phase 3: Execute reset
-		if err := core.Reset(commitHash, mode); err != nil {
+		if err := core.ResetWithOptions(commitHash, mode, opts); err != nil {
 			fmt.Println("Error:", err)
 			os.Exit(1)
 		}
@@ -432,7 +683,7 @@ var commands = map[string]CommandFunc{
 		}
 	},
 	"ls-files": func(args []string) {
-		core.EnsureArgs(args, 0, 0, "ls-files")
+		core.EnsureArgs(args, 0, -1, "ls-files")
 		if !core.IsRepoInitialized() {
 			fmt.Println(
 				"Error: not a kitcat repository (or any of the parent directories): .kitcat",
@@ -440,17 +691,131 @@ var commands = map[string]CommandFunc{
 			os.Exit(1)
 		}
 
-		entries, err := core.LoadIndex()
+		var opts core.LsFilesOptions
+		showDetails := false
+		asJSON := false
+		for _, arg := range args {
+			switch arg {
+			case "-s", "--stage":
+				showDetails = true
+			case "--json":
+				asJSON = true
+			case "--staged":
+				opts.Staged = true
+			case "-m", "--modified":
+				opts.Modified = true
+			case "--skip-worktree":
+				opts.Flags |= storage.FlagSkipWorktree
+			case "--assume-unchanged":
+				opts.Flags |= storage.FlagAssumeUnchanged
+			default:
+				if strings.HasPrefix(arg, "-") {
+					fmt.Printf("Error: unknown flag %s\n", arg)
+					os.Exit(2)
+				}
+				opts.Prefix = arg
+			}
+		}
+
+		entries, err := core.LsFiles(opts)
 		if err != nil {
 			fmt.Println("Error loading index:", err)
 			os.Exit(1)
 		}
 
-		for _, entry := range entries {
-			fmt.Println(entry.Path)
+		if asJSON {
+			printJSON(entries)
+			os.Exit(0)
+		}
+		for _, e := range entries {
+			if showDetails {
+				fmt.Printf("%s %d\t%s\n", e.Entry.Hash, e.Entry.Size, e.Path)
+			} else {
+				fmt.Println(e.Path)
+			}
 		}
 		os.Exit(0)
 	},
+	"update-index": func(args []string) {
+		// Flags to set and to clear; when one is given both ways the last one wins
+		var set, unset uint8
+		var paths []string
+		for _, arg := range args {
+			switch arg {
+			case "--assume-unchanged":
+				set, unset = set|storage.FlagAssumeUnchanged, unset&^storage.FlagAssumeUnchanged
+			case "--no-assume-unchanged":
+				set, unset = set&^storage.FlagAssumeUnchanged, unset|storage.FlagAssumeUnchanged
+			case "--skip-worktree":
+				set, unset = set|storage.FlagSkipWorktree, unset&^storage.FlagSkipWorktree
+			case "--no-skip-worktree":
+				set, unset = set&^storage.FlagSkipWorktree, unset|storage.FlagSkipWorktree
+			default:
+				if strings.HasPrefix(arg, "-") {
+					fmt.Printf("Error: unknown flag %s\n", arg)
+					os.Exit(2)
+				}
+				paths = append(paths, arg)
+			}
+		}
+		if set|unset == 0 || len(paths) == 0 {
+			fmt.Println("Usage: kitcat update-index (--[no-]assume-unchanged | --[no-]skip-worktree) <path>...")
+			os.Exit(2)
+		}
+
+		// UpdateIndexFlags moves to the repository root; resolve every path before the first call.
+		for i, path := range paths {
+			if abs, err := filepath.Abs(path); err == nil {
+				paths[i] = abs
+			}
+		}
+		exitCode := 0
+		for _, path := range paths {
+			if err := core.UpdateIndexFlags(path, set, unset); err != nil {
+				fmt.Println("Error:", err)
+				exitCode = 1
+			}
+		}
+		os.Exit(exitCode)
+	},
+	"ls-tree": func(args []string) {
+		asJSON := false
+		var positional []string
+		for _, arg := range args {
+			switch {
+			case arg == "--json":
+				asJSON = true
+			case strings.HasPrefix(arg, "-"):
+				fmt.Printf("Error: unknown flag %s\n", arg)
+				os.Exit(2)
+			default:
+				positional = append(positional, arg)
+			}
+		}
+		if len(positional) > 2 {
+			fmt.Println("Usage: kitcat ls-tree [--json] [<commit> [<path>]]")
+			os.Exit(2)
+		}
+		ref, prefix := "HEAD", ""
+		if len(positional) > 0 {
+			ref = positional[0]
+		}
+		if len(positional) > 1 {
+			prefix = positional[1]
+		}
+		files, err := core.ListTree(ref, prefix)
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		if asJSON {
+			printJSON(files)
+			return
+		}
+		for _, f := range files {
+			fmt.Printf("%06o %s %d\t%s\n", f.Mode, f.Hash, f.Size, f.Path)
+		}
+	},
 	"clean": func(args []string) {
 		dryRun := false
 		force := false
@@ -586,6 +951,324 @@ var commands = map[string]CommandFunc{
 		fmt.Println("Usage: kitcat config [--global] <key> [<value>]")
 		os.Exit(2)
 	},
+	"repack": func(args []string) {
+		core.EnsureArgs(args, 0, 0, "repack")
+		if !core.IsRepoInitialized() {
+			fmt.Println("Error: not a kitcat repository (or any of the parent directories): .kitcat")
+			os.Exit(1)
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		stats, err := core.RepackContext(ctx)
+		stop()
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Packed %d objects (%d deltas) into %s\n", stats.Objects, stats.Deltas, stats.Name)
+		removed, err := storage.CompactIndex()
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		if removed > 0 {
+			fmt.Printf("Removed %d stale index entries\n", removed)
+		}
+		os.Exit(0)
+	},
+	"downgrade-index": func(args []string) {
+		core.EnsureArgs(args, 0, 0, "downgrade-index")
+		if err := core.DowngradeIndex(); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	},
+	"normalize-index": func(args []string) {
+		core.EnsureArgs(args, 0, 0, "normalize-index")
+		report, err := core.NormalizeIndexFormat()
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		if !report.Changed() {
+			fmt.Println("Index is already in the current format")
+			os.Exit(0)
+		}
+		fmt.Printf("Upgraded %d legacy entries and %d backslash keys", report.Legacy, report.BackslashKeys)
+		if report.Dropped > 0 {
+			fmt.Printf(", dropped %d unreadable entries", report.Dropped)
+		}
+		fmt.Println()
+		os.Exit(0)
+	},
+	"watch": func(args []string) {
+		core.EnsureArgs(args, 0, 0, "watch")
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		events, err := core.Watch(ctx, core.WatchOptions{
+			OnError: func(err error) { fmt.Fprintln(os.Stderr, "warning:", err) },
+		})
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		for event := range events {
+			fmt.Printf("%s\t%s\n", event.Kind, event.Path)
+		}
+		os.Exit(0)
+	},
+	"write-tree": func(args []string) {
+		if len(args) > 1 || (len(args) == 1 && args[0] != "--dry-run") {
+			fmt.Println("Usage: kitcat write-tree [--dry-run]")
+			os.Exit(2)
+		}
+		if !core.IsRepoInitialized() {
+			fmt.Println("Error: not a kitcat repository (or any of the parent directories): .kitcat")
+			os.Exit(1)
+		}
+		var treeHash string
+		var err error
+		if len(args) == 1 {
+			treeHash, err = storage.ComputeTreeHash()
+		} else {
+			treeHash, err = storage.CreateTree()
+		}
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		fmt.Println(treeHash)
+		os.Exit(0)
+	},
+	"verify-index": func(args []string) {
+		core.EnsureArgs(args, 0, 0, "verify-index")
+		report, err := core.VerifyIndex()
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		core.WriteIndexReport(os.Stdout, report)
+		os.Exit(0)
+	},
+	"replay-index-ops": func(args []string) {
+		core.EnsureArgs(args, 1, 1, "replay-index-ops")
+		applied, err := core.ReplayIndexOps(args[0])
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Replayed %d index operations\n", applied)
+		os.Exit(0)
+	},
+	"expire-oplog": func(args []string) {
+		usage := "Usage: kitcat expire-oplog [--older-than <age>] [--unreachable]"
+		var expiry core.OpLogExpiry
+		for i := 0; i < len(args); i++ {
+			switch args[i] {
+			case "--unreachable":
+				expiry.Unreachable = true
+			case "--older-than":
+				if i+1 >= len(args) {
+					fmt.Println(usage)
+					os.Exit(2)
+				}
+				i++
+				age, err := core.ParseExpiryAge(args[i])
+				if err != nil {
+					fmt.Println("Error:", err)
+					os.Exit(2)
+				}
+				expiry.OlderThan = age
+			default:
+				fmt.Println(usage)
+				os.Exit(2)
+			}
+		}
+		if expiry.OlderThan == 0 && !expiry.Unreachable {
+			fmt.Println(usage)
+			os.Exit(2)
+		}
+		dropped, err := core.ExpireOpLog(expiry)
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Expired %d operation log entries\n", dropped)
+	},
+	"verify-objects": func(args []string) {
+		core.EnsureArgs(args, 0, 0, "verify-objects")
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		checked, corrupt, err := core.VerifyObjects(ctx)
+		stop()
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		for _, c := range corrupt {
+			fmt.Printf("corrupt object %s: %s\n", c.Hash, c.Reason)
+		}
+		fmt.Printf("%d objects checked, %d corrupt\n", checked, len(corrupt))
+		if len(corrupt) > 0 {
+			os.Exit(1)
+		}
+	},
+	"verify-history": func(args []string) {
+		core.EnsureArgs(args, 0, 1, "verify-history")
+		ref := "HEAD"
+		if len(args) == 1 {
+			ref = args[0]
+		}
+		checked, err := core.VerifyHistory(ref)
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("history of %s is intact (%d commits)\n", ref, checked)
+	},
+	"verify-commit": func(args []string) {
+		core.EnsureArgs(args, 0, 1, "verify-commit")
+		ref := "HEAD"
+		if len(args) == 1 {
+			ref = args[0]
+		}
+		fingerprint, err := core.VerifyCommit(ref)
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Good signature on %s from key %s\n", ref, fingerprint)
+	},
+	"duplicates": func(args []string) {
+		core.EnsureArgs(args, 0, 0, "duplicates")
+		groups, err := core.FindDuplicates()
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		for _, g := range groups {
+			fmt.Printf("%d copies of %s, %d bytes wasted\n", len(g.Paths), g.Hash[:7], g.Wasted())
+			for _, p := range g.Paths {
+				fmt.Printf("  %s\n", p)
+			}
+		}
+	},
+	"show": func(args []string) {
+		if len(args) > 1 {
+			fmt.Println("Usage: kitcat show [<ref>]")
+			os.Exit(2)
+		}
+		ref := "HEAD"
+		if len(args) == 1 {
+			ref = args[0]
+		}
+		out, err := core.Show(ref)
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		fmt.Print(out)
+		os.Exit(0)
+	},
+	"extract": func(args []string) {
+		if len(args) < 2 || len(args) > 3 {
+			fmt.Println("Usage: kitcat extract <ref> <path> [<dest>]")
+			os.Exit(2)
+		}
+		if len(args) == 3 {
+			if err := core.ExtractFile(args[0], args[1], args[2]); err != nil {
+				fmt.Println("Error:", err)
+				os.Exit(1)
+			}
+			os.Exit(0)
+		}
+		content, _, err := core.FileAtCommit(args[0], args[1])
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		os.Stdout.Write(content)
+		os.Exit(0)
+	},
+	"merge-tree": func(args []string) {
+		if len(args) != 2 {
+			fmt.Println("Usage: kitcat merge-tree <ours> <theirs>")
+			os.Exit(2)
+		}
+		result, err := core.PreviewMerge(args[0], args[1])
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		fmt.Println(result.TreeHash)
+		for _, c := range result.Conflicts {
+			fmt.Printf("CONFLICT (%s): %s\n", c.Kind, c.Path)
+		}
+		if !result.Clean() {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	},
+	"for-each-ref": func(args []string) {
+		if len(args) > 1 {
+			fmt.Println("Usage: kitcat for-each-ref [<pattern>]")
+			os.Exit(2)
+		}
+		pattern := ""
+		if len(args) == 1 {
+			pattern = args[0]
+		}
+		refs, err := core.ListRefs(pattern)
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		for _, ref := range refs {
+			fmt.Printf("%s %s\n", ref.Hash, ref.Name)
+		}
+		os.Exit(0)
+	},
+	"format-patch": func(args []string) {
+		if len(args) < 1 || len(args) > 2 {
+			fmt.Println("Usage: kitcat format-patch <ref> [<file>]")
+			os.Exit(2)
+		}
+		out := os.Stdout
+		if len(args) == 2 {
+			f, err := os.Create(args[1])
+			if err != nil {
+				fmt.Println("Error:", err)
+				os.Exit(1)
+			}
+			defer f.Close()
+			out = f
+		}
+		if err := core.ExportPatch(args[0], out); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+	},
+	"apply-patch": func(args []string) {
+		if len(args) != 1 {
+			fmt.Println("Usage: kitcat apply-patch <file>")
+			os.Exit(2)
+		}
+		result, err := applyPatchFile(args[0], false)
+		if err != nil {
+			os.Exit(1)
+		}
+		fmt.Printf("Applied patch to %d file(s); changes are staged\n", len(result.Changed))
+		os.Exit(0)
+	},
+	"am": func(args []string) {
+		if len(args) != 1 {
+			fmt.Println("Usage: kitcat am <file>")
+			os.Exit(2)
+		}
+		if _, err := applyPatchFile(args[0], true); err != nil {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	},
 	"show-object": func(args []string) {
 		if len(args) != 1 {
 			fmt.Println("Usage: kitcat show-object <hash>")
@@ -613,6 +1296,22 @@ var commands = map[string]CommandFunc{
 				os.Exit(1)
 			}
 			os.Exit(0)
+		case "-v", "--verbose":
+			if len(args) > 2 {
+				fmt.Fprintln(os.Stderr, "Usage: kitcat branch -v [<base>]")
+				os.Exit(2)
+			}
+			base := ""
+			if len(args) == 2 {
+				base = args[1]
+			} else if core.IsBranch(core.DefaultBranch()) {
+				base = core.DefaultBranch()
+			}
+			if err := core.ListBranchesVerbose(base); err != nil {
+				fmt.Println("Error:", err)
+				os.Exit(1)
+			}
+			os.Exit(0)
 		case "-r", "-m", "--move":
 			if len(args) < 2 {
 				fmt.Fprintln(os.Stderr, "Usage: kitcat branch -r|-m|--move <branch-name>")
@@ -654,29 +1353,98 @@ var commands = map[string]CommandFunc{
 		}
 	},
 	"mv": func(args []string) {
-		force := false
+		var opts core.MoveOptions
 		paths := make([]string, 0, 2)
 
 		for _, arg := range args {
-			if arg == "-f" || arg == "--force" {
-				force = true
+			switch arg {
+			case "-f", "--force":
+				opts.Force = true
+				continue
+			case "--cached":
+				opts.Cached = true
 				continue
 			}
 			paths = append(paths, arg)
 		}
 
 		if len(paths) != 2 {
-			fmt.Println("Usage: kitcat mv [-f|--force] <old_path> <new_path>")
+			fmt.Println("Usage: kitcat mv [-f|--force] [--cached] <old_path> <new_path>")
 			os.Exit(2)
 		}
 
-		if err := core.MoveFile(paths[0], paths[1], force); err != nil {
+		if err := core.MoveFileWithOptions(paths[0], paths[1], opts); err != nil {
 			fmt.Println("Error:", err)
 			os.Exit(1)
 		}
 
 		os.Exit(0)
 	},
+	"submodule": func(args []string) {
+		if len(args) == 3 && args[0] == "add" {
+			if err := core.SubmoduleAdd(args[1], args[2]); err != nil {
+				fmt.Println("Error:", err)
+				os.Exit(1)
+			}
+			os.Exit(0)
+		}
+		if len(args) != 0 {
+			fmt.Println("Usage: kitcat submodule [add <path> <url>]")
+			os.Exit(2)
+		}
+		subs, err := core.ReadSubmodules()
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		for _, sub := range subs {
+			commit := sub.Commit
+			if commit == "" {
+				commit = "(not staged)"
+			}
+			fmt.Printf("%s %s (%s)\n", commit, sub.Path, sub.URL)
+		}
+		os.Exit(0)
+	},
+	"snapshot": func(args []string) {
+		usage := "Usage: kitcat snapshot save <name> | restore <name> | delete <name> | list"
+		if len(args) == 0 {
+			fmt.Println(usage)
+			os.Exit(2)
+		}
+		switch {
+		case args[0] == "list" && len(args) == 1:
+			snapshots, err := core.ListSnapshots()
+			if err != nil {
+				fmt.Println("Error:", err)
+				os.Exit(1)
+			}
+			for _, s := range snapshots {
+				fmt.Printf("%s\t%s\n", s.Name, s.Created.Local().Format("2006-01-02 15:04:05"))
+			}
+		case args[0] == "save" && len(args) == 2:
+			if _, err := core.Snapshot(args[1]); err != nil {
+				fmt.Println("Error:", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Saved snapshot %s\n", args[1])
+		case args[0] == "restore" && len(args) == 2:
+			if err := core.RestoreSnapshot(args[1]); err != nil {
+				fmt.Println("Error:", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Restored snapshot %s\n", args[1])
+		case args[0] == "delete" && len(args) == 2:
+			if err := core.DeleteSnapshot(args[1]); err != nil {
+				fmt.Println("Error:", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Deleted snapshot %s\n", args[1])
+		default:
+			fmt.Println(usage)
+			os.Exit(2)
+		}
+	},
 	"stash": func(args []string) {
 		if !core.IsRepoInitialized() {
 			fmt.Println(
@@ -768,11 +1536,61 @@ func parseStashIndex(s string) (int, error) {
 	return idx, nil
 }
 
+// applyPatchFile applies the patch in path ("-" for standard input) with core.ApplyPatch,
+// or commits it too with core.AmPatch, printing what went wrong, rejected hunks included.
+func applyPatchFile(path string, commit bool) (core.PatchResult, error) {
+	in := os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return core.PatchResult{}, err
+		}
+		defer f.Close()
+		in = f
+	}
+	var result core.PatchResult
+	var err error
+	if commit {
+		var newCommit models.Commit
+		newCommit, result, err = core.AmPatch(in)
+		if err == nil {
+			fmt.Printf("Applying: %s\n", strings.SplitN(newCommit.Message, "\n", 2)[0])
+		}
+	} else {
+		result, err = core.ApplyPatch(in)
+	}
+	for _, path := range result.Merged {
+		fmt.Printf("Applied %s with a three-way merge\n", path)
+	}
+	for _, rejected := range result.Rejected {
+		if rejected.Header != "" {
+			fmt.Printf("Rejected hunk %s in %s: %s\n", rejected.Header, rejected.Path, rejected.Reason)
+		} else {
+			fmt.Printf("Rejected %s: %s\n", rejected.Path, rejected.Reason)
+		}
+	}
+	if err != nil {
+		fmt.Println("Error:", err)
+	}
+	return result, err
+}
+
 // printCommitResult formats and prints the commit result with summary
+// printJSON writes v as indented JSON for the --json output modes.
+func printJSON(v any) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+}
+
 func printCommitResult(newCommit models.Commit, summary string) {
 	headState, err := core.GetHeadState()
 	if err != nil {
-		headData, _ := os.ReadFile(".kitcat/HEAD")
+		headData, _ := os.ReadFile(core.HeadPath())
 		ref := strings.TrimSpace(string(headData))
 		headState = strings.TrimPrefix(ref, "ref: refs/heads/")
 	}
@@ -784,7 +1602,28 @@ func main() {
 		fmt.Println("Usage: kitcat <command> [args]")
 		os.Exit(2)
 	}
-	cmd, args := os.Args[1], os.Args[2:]
+	args := os.Args[1:]
+	// -c key=value overrides a config value for this invocation only.
+	overrides := make(map[string]string)
+	for len(args) > 0 && args[0] == "-c" {
+		if len(args) < 2 {
+			fmt.Println("Usage: kitcat [-c <key>=<value>]... <command> [args]")
+			os.Exit(2)
+		}
+		key, value, err := core.ParseConfigOverride(args[1])
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(2)
+		}
+		overrides[key] = value
+		args = args[2:]
+	}
+	if len(args) == 0 {
+		fmt.Println("Usage: kitcat [-c <key>=<value>]... <command> [args]")
+		os.Exit(2)
+	}
+	core.SetConfigOverrides(overrides)
+	cmd, args := args[0], args[1:]
 	if handler, ok := commands[cmd]; ok {
 		handler(args)
 	} else {
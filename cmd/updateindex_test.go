@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestCLIUpdateIndexMixedFlags(t *testing.T) {
+	tmpDir := t.TempDir()
+	binName := "kitcat"
+	if runtime.GOOS == "windows" {
+		binName += ".exe"
+	}
+	binPath := filepath.Join(tmpDir, binName)
+	buildCmd := exec.Command("go", "build", "-o", binPath, "main.go")
+	if output, err := buildCmd.CombinedOutput(); err != nil {
+		t.Fatalf("Failed to build kitcat binary: %v\nOutput: %s", err, output)
+	}
+
+	repo := t.TempDir()
+	run := func(args ...string) []byte {
+		t.Helper()
+		cmd := exec.Command(binPath, args...)
+		cmd.Dir = repo
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("kitcat %v: %v\n%s", args, err, output)
+		}
+		return output
+	}
+	run("init")
+	if err := os.WriteFile(filepath.Join(repo, "f.txt"), []byte("f\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	run("add", "f.txt")
+
+	flags := func() (assumeUnchanged, skipWorktree bool) {
+		t.Helper()
+		var entries []struct {
+			AssumeUnchanged bool `json:"assumeUnchanged"`
+			SkipWorktree    bool `json:"skipWorktree"`
+		}
+		if err := json.Unmarshal(run("ls-files", "--json"), &entries); err != nil || len(entries) != 1 {
+			t.Fatalf("ls-files --json = %v, %v", entries, err)
+		}
+		return entries[0].AssumeUnchanged, entries[0].SkipWorktree
+	}
+
+	// Each flag goes its own way, whatever the order
+	run("update-index", "--skip-worktree", "f.txt")
+	run("update-index", "--assume-unchanged", "--no-skip-worktree", "f.txt")
+	if au, sw := flags(); !au || sw {
+		t.Errorf("after --assume-unchanged --no-skip-worktree: assumeUnchanged=%v skipWorktree=%v, want true false", au, sw)
+	}
+	run("update-index", "--no-assume-unchanged", "--skip-worktree", "f.txt")
+	if au, sw := flags(); au || !sw {
+		t.Errorf("after --no-assume-unchanged --skip-worktree: assumeUnchanged=%v skipWorktree=%v, want false true", au, sw)
+	}
+	// The same flag given both ways: the last one wins
+	run("update-index", "--skip-worktree", "--no-skip-worktree", "f.txt")
+	if _, sw := flags(); sw {
+		t.Error("after --skip-worktree --no-skip-worktree the flag is still set")
+	}
+}
@@ -1,18 +1,22 @@
 package core
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"maps"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
+	"unicode"
 
 	"github.com/LeeFred3042U/kitcat/internal/storage"
 )
 
 // AddFile stages a file or directory.
 // If inputPath is a directory, it recursively stages all files inside.
-// Expects a repo-relative path (or a path that passes IsSafePath).
+// inputPath is relative to the current directory, which may be anywhere inside the repository.
 // Stores metadata (mtime, size) so future `AddAll` can avoid re-hashing unchanged files.
 //
 // Behaviour and invariants:
@@ -23,63 +27,130 @@ import (
 //     to avoid races and to keep metadata consistent.
 //   - Uses size+modtime as a fast-path to avoid re-hashing unchanged files.
 //   - Honors ignore rules and repository safety checks (IsSafePath).
+//   - Refuses files larger than add.maxFileSize: a file named directly is an error, files
+//     found while walking a directory are skipped with a warning. Binary files are
+//     treated the same way when add.excludeBinary is set.
 func AddFile(inputPath string) error {
-	// Step 1: Ensure we are inside a kitcat repository.
-	if _, err := os.Stat(RepoDir); os.IsNotExist(err) {
-		return errors.New("not a kitcat repository (run `kitcat init`)")
+	return AddFileWithOptions(inputPath, AddOptions{})
+}
+
+// AddFileWithOptions is AddFile with explicit options, e.g. Force to bypass add.maxFileSize
+// or KeepGoing to collect per-file errors instead of aborting on the first one.
+func AddFileWithOptions(inputPath string, opts AddOptions) error {
+	return addPaths([]string{inputPath}, opts)
+}
+
+// addPaths stages every input path, file or directory, in a single index transaction.
+func addPaths(inputPaths []string, opts AddOptions) error {
+	// Step 1: Resolve each input against the caller's directory, before moving to the
+	// repo root, to its absolute path for the walk and its repo-relative key.
+	absInputPaths := make([]string, len(inputPaths))
+	inputKeys := make([]string, len(inputPaths))
+	for i, inputPath := range inputPaths {
+		absInputPath, err := filepath.Abs(inputPath)
+		if err != nil {
+			return fmt.Errorf("failed to resolve absolute path: %w", err)
+		}
+		key, err := RepoRelPath(absInputPath)
+		if err != nil {
+			return err
+		}
+		absInputPaths[i], inputKeys[i] = absInputPath, key
 	}
 
-	// Step 2: Resolve the absolute path of the input.
-	absInputPath, err := filepath.Abs(inputPath)
+	// Step 2: Discover the repository by walking up from the current directory,
+	// then make its root the working directory. Paths are stored relative to it.
+	absRepoRoot, err := enterRepoRoot()
+	if err != nil {
+		return errors.New("not a kitcat repository (run `kitcat init`)")
+	}
+	// Objects written here are unreferenced until the index update; keep repack out.
+	repoLock, err := opts.locks.lockRepoShared()
 	if err != nil {
-		return fmt.Errorf("failed to resolve absolute path: %w", err)
+		return err
 	}
+	defer repoLock.Unlock()
 
-	// Step 3: Resolve the absolute path of the repo root.
-	absRepoRoot, err := filepath.Abs(".")
+	limits, err := loadAddLimits(opts)
 	if err != nil {
-		return fmt.Errorf("failed to resolve repo root: %w", err)
+		return err
 	}
+	for i, inputPath := range inputPaths {
+		absInputPath := absInputPaths[i]
+		// Check if the file exists
+		inputInfo, err := os.Stat(absInputPath)
+		if os.IsNotExist(err) {
+			return fmt.Errorf("path does not exist: %s", inputPath)
+		}
+		if err != nil {
+			return err
+		}
 
-	// Check if the file exists
-	if _, err := os.Stat(absInputPath); os.IsNotExist(err) {
-		return fmt.Errorf("path does not exist: %s", inputPath)
+		if !inputInfo.IsDir() && limits.tooLarge(inputInfo.Size()) {
+			return errors.New(limits.sizeMessage(inputPath, inputInfo.Size()))
+		}
+		if !inputInfo.IsDir() && limits.refusesBinary(absInputPath) {
+			return fmt.Errorf("%s is a binary file and %s is set", inputPath, excludeBinaryKey)
+		}
 	}
 
-	// Step 4: Open the Index Transaction ONCE.
+	// Per-file failures collected in KeepGoing mode, and the paths whose content changed.
+	var fileErrs []error
+	var staged []string
+
+	// Step 3: Open the Index Transaction ONCE.
 	// We do the walking and hashing inside the lock to ensure consistency.
-	return storage.UpdateIndexWithMeta(func(index map[string]storage.IndexEntry) error {
-		ignorePatterns, err := LoadIgnorePatterns()
+	stats := opts.Stats
+	begin := stats.start()
+	err = opts.locks.updateIndex(func(index map[string]storage.IndexEntry) error {
+		fileErrs, staged = nil, nil
+		stats.reset()
+		defer stats.walkedSince(stats.start())
+		filePatterns, err := LoadIgnorePatterns()
 		if err != nil {
 			return err
 		}
+		ignorePatterns := limits.withExcludes(filePatterns)
 
 		// Build a simple proxy for legacy ShouldIgnore behaviour.
 		proxyIndex := make(map[string]string, len(index))
 		for k, v := range index {
 			proxyIndex[k] = v.Hash
 		}
+		byFold := indexPathsByFold(index)
 
-		// Step 5: Walk the target (File or Directory).
+		// rootKey is the current input as typed, rootDisk as spelled on disk; they differ
+		// only when the input was typed in another case on a case-insensitive filesystem.
+		var rootKey, rootDisk string
+
+		// Step 4: Walk each target (File or Directory).
 		// filepath.Walk works for both. If absInputPath is a file, the func runs once.
-		return filepath.Walk(absInputPath, func(fullPath string, info os.FileInfo, err error) error {
+		walk := func(fullPath string, info os.FileInfo, err error) error {
 			if err != nil {
+				if opts.KeepGoing {
+					fileErrs = append(fileErrs, err)
+					return nil
+				}
 				return err // Permission errors, etc.
 			}
 
-			// Step 6: Convert absolute file path → repo-relative path.
+			// Step 5: Convert absolute file path → repo-relative path.
 			// This is CRITICAL for portability and tree determinism.
 			relPath, err := filepath.Rel(absRepoRoot, fullPath)
 			if err != nil {
 				return fmt.Errorf("file %s is outside repository", fullPath)
 			}
-			cleanPath := filepath.Clean(relPath)
+			// Index keys always use forward slashes, whatever the OS.
+			cleanPath := storage.IndexKey(relPath)
+			if rootKey != rootDisk && (cleanPath == rootKey || strings.HasPrefix(cleanPath, rootKey+"/")) {
+				cleanPath = rootDisk + strings.TrimPrefix(cleanPath, rootKey)
+			}
 
 			// Skip the repo root itself and .kitcat directory
 			if cleanPath == "." {
 				return nil
 			}
-			if strings.HasPrefix(cleanPath, RepoDir+string(os.PathSeparator)) || cleanPath == RepoDir {
+			if inRepoDir(cleanPath) {
 				if info.IsDir() {
 					return filepath.SkipDir
 				}
@@ -88,64 +159,184 @@ func AddFile(inputPath string) error {
 
 			// We only care about files
 			if info.IsDir() {
+				if entry, ok := index[cleanPath]; ok && entry.Mode == storage.SubmoduleMode {
+					index[cleanPath], _ = refreshGitlink(fullPath, entry)
+					return filepath.SkipDir
+				}
+				if isNestedRepo(fullPath) {
+					fmt.Printf("warning: skipping nested repository %s\n", cleanPath)
+					return filepath.SkipDir
+				}
 				return nil
 			}
+			stats.walked()
 
-			// Step 7: Enforce repository safety rules.
+			// Step 6: Enforce repository safety rules.
 			if !IsSafePath(cleanPath) {
 				return nil // Skip unsafe paths during walk
 			}
 
 			// Check ignore rules
-			if ShouldIgnore(cleanPath, ignorePatterns, proxyIndex) {
+			if ShouldIgnoreInfo(cleanPath, info, ignorePatterns, proxyIndex) {
 				return nil
 			}
 
-			// Step 8: Metadata Check (Optimization).
-			// If size & mtime match index, skip hashing.
-			if entry, exists := index[cleanPath]; exists {
-				if entry.Size == info.Size() && entry.ModTime == info.ModTime().Unix() {
-					return nil
-				}
+			if limits.tooLarge(info.Size()) {
+				fmt.Printf("warning: skipping %s\n", limits.sizeMessage(cleanPath, info.Size()))
+				return nil
+			}
+
+			// A file tracked under another case keeps its tracked name.
+			cleanPath = indexPathForDisk(index, byFold, cleanPath, info)
+
+			// Step 7: Metadata Check (Optimization).
+			// If size & mtime match index, skip hashing (unless core.trustMtime is off).
+			if entry, exists := index[cleanPath]; limits.unchanged(entry, exists, info) {
+				stats.fastPath()
+				return nil
 			}
 
-			// Step 9: Hash and store the file content.
+			if limits.refusesBinary(fullPath) {
+				fmt.Printf("warning: skipping binary file %s\n", cleanPath)
+				return nil
+			}
+
+			// Step 8: Hash and store the file content.
 			// We use fullPath (absolute) to read, ensuring we find the file correctly.
+			hashStart := stats.start()
 			hash, err := storage.HashAndStoreFile(fullPath)
 			if err != nil {
-				return fmt.Errorf("failed to hash %s: %w", fullPath, err)
+				err = fmt.Errorf("failed to hash %s: %w", fullPath, err)
+				if opts.KeepGoing {
+					fileErrs = append(fileErrs, err)
+					return nil
+				}
+				return err
 			}
+			stats.hashed(hashStart, info.Size())
 
-			// Step 10: Update the index using ONLY the repo-relative path.
+			// Step 9: Update the index using ONLY the repo-relative path.
+			if index[cleanPath].Hash != hash {
+				staged = append(staged, cleanPath)
+			}
+			modTime, size := hashedFileMeta(fullPath, info)
 			index[cleanPath] = storage.IndexEntry{
-				Hash:    hash,
-				ModTime: info.ModTime().Unix(),
-				Size:    info.Size(),
+				Hash:        hash,
+				ModTime:     modTime,
+				Size:        size,
+				Flags:       index[cleanPath].Flags,
+				Mode:        limits.mode(info),
+				DisplayPath: index[cleanPath].DisplayPath,
 			}
 
 			return nil
-		})
+		}
+		for i, absInputPath := range absInputPaths {
+			rootKey = inputKeys[i]
+			rootDisk = onDiskCase(absRepoRoot, rootKey)
+			if err := walkTree(absInputPath, limits.followSymlinks, walk); err != nil {
+				return err
+			}
+		}
+		return nil
 	})
+	stats.finish(begin)
+	if err != nil {
+		return err
+	}
+	recordOp("add", nil, staged)
+	return errors.Join(fileErrs...)
 }
 
 // AddAll scans the working tree and updates the index:
 //   - skips files matching ignore patterns
-//   - skips files whose (size, mtime) match index metadata (fast path)
+//   - skips files whose (size, mtime) match index metadata (fast path; see core.trustMtime)
 //   - hashes and stores changed/new files
 //   - deletes index entries for files no longer present in the walk root
 //
 // Behaviour and invariants:
-//   - Walks the canonical repo root (absolute), computes repo-relative paths,
+//   - Walks the canonical repo root (discovered from any subdirectory), computes repo-relative paths,
 //     and updates the index using those repo-relative keys.
 //   - Skips files matching ignore rules and paths failing IsSafePath.
-//   - Uses (size, mtime) as a fast-path to avoid re-hashing unchanged files.
+//   - Uses (size, mtime) as a fast-path to avoid re-hashing unchanged files. A file that
+//     changes while it is hashed is recorded with zeroed metadata so it is re-verified later.
 //   - Removes index entries for files that are not present under the walked root.
+//   - Keeps the tracked name of files whose on-disk name differs only in case
+//     (case-insensitive filesystems), recording the on-disk spelling as DisplayPath,
+//     so they do not show up as phantom changes.
+//   - When add.trackEmptyDirs is enabled, records each empty directory as a
+//     zero-byte EmptyDirPlaceholder entry of mode storage.EmptyDirMode so checkout can recreate it.
+//   - Skips files larger than add.maxFileSize with a warning, leaving any existing index
+//     entry for them untouched. Likewise for changed binary files when add.excludeBinary is set.
+//   - Warns about tracked files that match .kitignore (see ListTrackedIgnored).
+//   - Skips nested repositories, directories holding their own .kitcat or .git. For a
+//     submodule (see SubmoduleAdd) the recorded commit follows the nested HEAD instead.
 func AddAll() error {
-	return storage.UpdateIndexWithMeta(func(index map[string]storage.IndexEntry) error {
-		ignorePatterns, err := LoadIgnorePatterns()
+	return AddAllContext(context.Background())
+}
+
+// AddAllContext is AddAll with cancellation. The context is checked for every walked
+// path; once it is done the walk stops and ctx.Err() is returned without writing the index.
+func AddAllContext(ctx context.Context) error {
+	return AddAllWithOptions(ctx, AddOptions{})
+}
+
+// AddAllWithOptions is AddAllContext with explicit options, e.g. Force to bypass add.maxFileSize.
+// With opts.LowMemory or add.lowMemory the index is streamed rather than loaded into
+// memory; an index that is not sorted, as only older or hand-edited ones are, falls back
+// to the regular path, whose write sorts it. So does following symlinks, which the
+// streaming walk does not support, running in a Batch, whose index lock the streaming
+// rewrite cannot reuse, and a case-insensitive filesystem, where a file whose name changed
+// case must keep its tracked entry, which the sorted merge-join of the streaming walk
+// cannot find.
+func AddAllWithOptions(ctx context.Context, opts AddOptions) error {
+	following := opts.FollowSymlinks || GetConfigBool(followSymlinksKey, false)
+	lowMemory := opts.LowMemory || GetConfigBool(lowMemoryKey, false)
+	if lowMemory && !following && opts.locks == nil && !caseInsensitiveRoot() {
+		if err := addAllStreaming(ctx, opts); !errors.Is(err, storage.ErrIndexUnsorted) {
+			return err
+		}
+	}
+	return addAll(ctx, opts, nil)
+}
+
+// addAll implements AddAllWithOptions. When report is not nil it receives the entries the
+// walk added, updated, deleted or merely refreshed.
+func addAll(ctx context.Context, opts AddOptions, report *ReconcileReport) error {
+	limits, err := loadAddLimits(opts)
+	if err != nil {
+		return err
+	}
+
+	// Walk the canonical absolute root, found from anywhere inside the repository.
+	rootDir, err := enterRepoRoot()
+	if err != nil {
+		return err
+	}
+	repoLock, err := opts.locks.lockRepoShared()
+	if err != nil {
+		return err
+	}
+	defer repoLock.Unlock()
+
+	var dirs *dirWalkCache
+	var finalIndex map[string]storage.IndexEntry
+	var staged []string
+	stats := opts.Stats
+	begin := stats.start()
+	err = opts.locks.updateIndex(func(index map[string]storage.IndexEntry) error {
+		finalIndex = index
+		stats.reset()
+		defer stats.walkedSince(stats.start())
+		var before map[string]storage.IndexEntry
+		if report != nil {
+			before = maps.Clone(index)
+		}
+		filePatterns, err := LoadIgnorePatterns()
 		if err != nil {
 			return err
 		}
+		ignorePatterns := limits.withExcludes(filePatterns)
 
 		seen := make(map[string]bool, len(index))
 
@@ -155,23 +346,56 @@ func AddAll() error {
 			proxyIndex[k] = v.Hash
 		}
 
-		// Walk the canonical absolute root to avoid "works on my machine" path bugs.
-		rootDir, err := filepath.Abs(".")
-		if err != nil {
-			return fmt.Errorf("failed to resolve absolute path: %w", err)
+		byFold := indexPathsByFold(index)
+		trackEmptyDirs := GetConfigBool(trackEmptyDirsKey, false)
+		if GetConfigBool(dirCacheConfigKey, false) {
+			dirs = newDirWalkCache(index, limits, trackEmptyDirs)
+		}
+
+		var visit filepath.WalkFunc
+		// visitCachedDir handles a directory whose entries are unchanged since the last run:
+		// instead of reading it, only its tracked files and known subdirectories are visited.
+		visitCachedDir := func(dir string) error {
+			for _, p := range dirs.children[dir] {
+				if isEmptyDirPlaceholder(index[p].Mode) {
+					seen[p] = true
+					continue
+				}
+				fullPath := filepath.Join(rootDir, filepath.FromSlash(p))
+				info, err := os.Lstat(fullPath)
+				if err != nil {
+					continue // gone after all; dropped as unseen
+				}
+				if err := visit(fullPath, info, nil); err != nil {
+					return err
+				}
+			}
+			for _, sub := range dirs.prev.Dirs[dir].Subdirs {
+				subPath := filepath.Join(rootDir, filepath.FromSlash(path.Join(dir, sub)))
+				if _, err := os.Lstat(subPath); err != nil {
+					continue
+				}
+				if err := walkTree(subPath, limits.followSymlinks, visit); err != nil {
+					return err
+				}
+			}
+			return nil
 		}
 
-		err = filepath.Walk(rootDir, func(fullPath string, info os.FileInfo, err error) error {
+		visit = func(fullPath string, info os.FileInfo, err error) error {
 			if err != nil {
 				return err // propagate I/O errors
 			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
 
 			// Convert to repo-relative, normalized path.
 			relPath, err := filepath.Rel(rootDir, fullPath)
 			if err != nil {
 				return nil
 			}
-			cleanPath := filepath.Clean(relPath)
+			cleanPath := storage.IndexKey(relPath)
 			if cleanPath == "." {
 				return nil
 			}
@@ -180,61 +404,263 @@ func AddAll() error {
 			if !IsSafePath(cleanPath) {
 				return nil
 			}
-			if strings.HasPrefix(cleanPath, RepoDir+string(os.PathSeparator)) || cleanPath == RepoDir {
+			if inRepoDir(cleanPath) {
 				if info.IsDir() {
 					return filepath.SkipDir
 				}
 				return nil
 			}
 			if info.IsDir() {
+				// Submodules are refreshed after the walk, whether initialized or not.
+				if index[cleanPath].Mode == storage.SubmoduleMode || isNestedRepo(fullPath) {
+					return filepath.SkipDir
+				}
+				if dirs != nil {
+					unchanged := dirs.unchanged(cleanPath, info)
+					dirs.record(cleanPath, info)
+					if unchanged {
+						if err := visitCachedDir(cleanPath); err != nil {
+							return err
+						}
+						return filepath.SkipDir
+					}
+				}
+				// Opt-in: record genuinely empty directories with a placeholder entry.
+				if trackEmptyDirs && isEmptyDir(fullPath) && !ShouldIgnore(cleanPath, ignorePatterns, proxyIndex) {
+					placeholder := cleanPath + "/" + EmptyDirPlaceholder
+					seen[placeholder] = true
+					if !isEmptyDirPlaceholder(index[placeholder].Mode) {
+						entry, err := emptyDirEntry()
+						if err != nil {
+							return fmt.Errorf("failed to record empty directory %s: %w", cleanPath, err)
+						}
+						index[placeholder] = entry
+					}
+				}
 				return nil
 			}
 
+			stats.walked()
+
 			// Check ignore rules (using proxy for legacy compatibility).
-			if ShouldIgnore(cleanPath, ignorePatterns, proxyIndex) {
+			if ShouldIgnoreInfo(cleanPath, info, ignorePatterns, proxyIndex) {
 				return nil
 			}
 
+			// A file tracked under another case keeps its tracked name.
+			cleanPath = indexPathForDisk(index, byFold, cleanPath, info)
+
 			// Mark as seen for later deletion-detection.
 			seen[cleanPath] = true
+			if limits.tooLarge(info.Size()) {
+				fmt.Printf("warning: skipping %s\n", limits.sizeMessage(cleanPath, info.Size()))
+				return nil
+			}
 
-			// Fast path: if size & mtime match, assume unchanged.
-			if entry, exists := index[cleanPath]; exists {
-				if entry.Size == info.Size() && entry.ModTime == info.ModTime().Unix() {
-					return nil
-				}
+			// Fast path: if size & mtime match, assume unchanged (unless core.trustMtime is off).
+			if entry, exists := index[cleanPath]; limits.unchanged(entry, exists, info) {
+				stats.fastPath()
+				return nil
+			}
+
+			if limits.refusesBinary(fullPath) {
+				fmt.Printf("warning: skipping binary file %s\n", cleanPath)
+				return nil
 			}
 
 			// Slow path: hash & store file.
 			// Use fullPath (absolute) to ensure correct file reading.
+			hashStart := stats.start()
 			hash, err := storage.HashAndStoreFile(fullPath)
 			if err != nil {
 				fmt.Printf("warning: could not add file %s: %v\n", cleanPath, err)
 				return nil
 			}
+			stats.hashed(hashStart, info.Size())
 
+			modTime, size := hashedFileMeta(fullPath, info)
 			index[cleanPath] = storage.IndexEntry{
-				Hash:    hash,
-				ModTime: info.ModTime().Unix(),
-				Size:    info.Size(),
+				Hash:        hash,
+				ModTime:     modTime,
+				Size:        size,
+				Flags:       index[cleanPath].Flags,
+				Mode:        limits.mode(info),
+				DisplayPath: index[cleanPath].DisplayPath,
 			}
 			return nil
-		})
-		if err != nil {
+		}
+		if err := walkTree(rootDir, limits.followSymlinks, visit); err != nil {
 			return err
 		}
 
 		// Delete index entries that were not seen during the walk.
+		// A submodule stays while its directory exists.
 		var toDelete []string
-		for pathInIndex := range index {
-			if !seen[pathInIndex] {
-				toDelete = append(toDelete, pathInIndex)
+		for pathInIndex, entry := range index {
+			if seen[pathInIndex] {
+				continue
 			}
+			if entry.Mode == storage.SubmoduleMode {
+				fullPath := filepath.Join(rootDir, filepath.FromSlash(pathInIndex))
+				if refreshed, exists := refreshGitlink(fullPath, entry); exists {
+					index[pathInIndex] = refreshed
+					continue
+				}
+			}
+			toDelete = append(toDelete, pathInIndex)
 		}
 		for _, path := range toDelete {
 			delete(index, path)
 		}
 
+		// proxyIndex still holds the hashes from before the walk.
+		after := make(map[string]string, len(index))
+		for k, v := range index {
+			after[k] = v.Hash
+		}
+		staged = changedPaths(proxyIndex, after)
+		if report != nil {
+			*report = compareIndexes(before, index)
+		}
+
+		if ignored := trackedIgnored(index, filePatterns); len(ignored) > 0 {
+			fmt.Println("warning: the following tracked files match .kitignore and stay tracked:")
+			for _, path := range ignored {
+				fmt.Printf("\t%s\n", path)
+			}
+		}
+
 		return nil
 	})
+	stats.finish(begin)
+	if err != nil {
+		return err
+	}
+	recordOp("add", nil, staged)
+	if dirs == nil {
+		return nil
+	}
+	// Only once the index is written may the cache vouch for it.
+	return dirs.save(finalIndex)
+}
+
+// hashedFileMeta returns the mtime and size to record for a file that was just hashed, given
+// its stat from before hashing. If the file changed while it was read, the hash may not match
+// either stat, so zeroed metadata is returned instead: it never satisfies the fast path, and
+// the next add or status re-verifies the content.
+func hashedFileMeta(fullPath string, before os.FileInfo) (int64, int64) {
+	after, err := os.Lstat(fullPath)
+	if err != nil || after.Size() != before.Size() || !after.ModTime().Equal(before.ModTime()) {
+		return 0, 0
+	}
+	return before.ModTime().Unix(), before.Size()
+}
+
+// indexPathsByFold maps the lower-cased form of every index path to the path itself.
+func indexPathsByFold(index map[string]storage.IndexEntry) map[string]string {
+	byFold := make(map[string]string, len(index))
+	for path := range index {
+		byFold[strings.ToLower(path)] = path
+	}
+	return byFold
+}
+
+// indexPathForDisk returns the index key that tracks the file found at diskPath. It is
+// diskPath itself unless the index holds a path that matches it only case-insensitively, e.g.
+// `Src/Main.go` for `src/main.go` on disk, and both names resolve to the same file (a
+// case-insensitive filesystem). Such an entry keeps its tracked name, so the change of case
+// does not reach commits seen on case-sensitive systems, and records the on-disk spelling in
+// its DisplayPath; a warning is printed when that spelling is new. An entry found under
+// diskPath itself has any stale DisplayPath cleared.
+func indexPathForDisk(index map[string]storage.IndexEntry, byFold map[string]string, diskPath string, info os.FileInfo) string {
+	if entry, exists := index[diskPath]; exists {
+		if entry.DisplayPath != "" {
+			entry.DisplayPath = ""
+			index[diskPath] = entry
+		}
+		return diskPath
+	}
+	indexPath, ok := byFold[strings.ToLower(diskPath)]
+	if !ok || indexPath == diskPath {
+		return diskPath
+	}
+	indexInfo, err := os.Lstat(indexPath)
+	if err != nil || !os.SameFile(info, indexInfo) {
+		return diskPath
+	}
+
+	entry := index[indexPath]
+	if entry.DisplayPath != diskPath {
+		fmt.Printf("warning: '%s' is tracked as '%s'; keeping the tracked name (use mv to rename it)\n", diskPath, indexPath)
+		entry.DisplayPath = diskPath
+		index[indexPath] = entry
+	}
+	return indexPath
+}
+
+// caseInsensitiveRoot reports whether the working tree is on a case-insensitive filesystem,
+// as caseInsensitiveFS sees its root.
+func caseInsensitiveRoot() bool {
+	root, err := findRepoRoot()
+	return err != nil || caseInsensitiveFS(root)
+}
+
+// caseInsensitiveFS reports whether names in dir are looked up case-insensitively: an
+// entry whose name contains a letter is found again under its name with every letter's
+// case swapped. When no entry has one there is nothing to go by, and it reports true.
+func caseInsensitiveFS(dir string) bool {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return true
+	}
+	for _, e := range entries {
+		swapped := strings.Map(func(r rune) rune {
+			if unicode.IsUpper(r) {
+				return unicode.ToLower(r)
+			}
+			return unicode.ToUpper(r)
+		}, e.Name())
+		if swapped == e.Name() {
+			continue
+		}
+		info, err := os.Lstat(filepath.Join(dir, e.Name()))
+		if err != nil {
+			continue
+		}
+		other, err := os.Lstat(filepath.Join(dir, swapped))
+		return err == nil && os.SameFile(info, other)
+	}
+	return true
+}
+
+// onDiskCase returns key, a repo-relative path under root, with each component spelled as
+// its directory lists it, e.g. `README.md` for `readme.md` typed on a case-insensitive
+// filesystem. Components that match exactly, or cannot be listed, are kept as given.
+func onDiskCase(root, key string) string {
+	if key == "." {
+		return key
+	}
+	parts := strings.Split(key, "/")
+	dir := root
+	for i, part := range parts {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			break
+		}
+		match := ""
+		for _, e := range entries {
+			if e.Name() == part {
+				match = ""
+				break
+			}
+			if match == "" && strings.EqualFold(e.Name(), part) {
+				match = e.Name()
+			}
+		}
+		if match != "" {
+			parts[i] = match
+		}
+		dir = filepath.Join(dir, parts[i])
+	}
+	return strings.Join(parts, "/")
 }
@@ -0,0 +1,268 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+// lowMemoryKey makes AddAll stream the index instead of loading it (see addAllStreaming).
+// Meant for working trees with millions of files; off by default.
+const lowMemoryKey = "add.lowMemory"
+
+// addAllStreaming is the low-memory AddAll. The map-based AddAll holds the whole index, a
+// proxy copy of it and a `seen` set, so its memory grows with the size of the tree. Here
+// nothing proportional to the tree is kept:
+//
+//   - The working tree is walked in index order: every directory's entries are visited
+//     sorted as their index keys sort, a subdirectory `d` as if it were named `d/`, which
+//     makes the sequence of visited paths globally sorted.
+//   - The current index, sorted as kitcat writes it, is read in step through a
+//     storage.IndexCursor. Walk and index are merge-joined: index entries that sort before
+//     the next visited path are gone from the tree and dropped, an equal one is the file's
+//     tracked entry, and a visited path with no match is new.
+//   - Each resulting entry is appended to the new index through storage.RewriteIndex,
+//     which swaps it in atomically when the walk completes.
+//
+// Only the paths that changed are collected, for the operation log. The result matches
+// AddAll's except that the directory cache (add.dirCache) is not used. Names are matched
+// exactly, so AddAllWithOptions does not stream on a case-insensitive filesystem, where a
+// file whose name changed case keeps its tracked entry (see indexPathForDisk). An index
+// that is not sorted yields storage.ErrIndexUnsorted before anything is written.
+func addAllStreaming(ctx context.Context, opts AddOptions) error {
+	limits, err := loadAddLimits(opts)
+	if err != nil {
+		return err
+	}
+	rootDir, err := enterRepoRoot()
+	if err != nil {
+		return err
+	}
+	repoLock, err := storage.LockRepoShared()
+	if err != nil {
+		return err
+	}
+	defer repoLock.Unlock()
+	filePatterns, err := LoadIgnorePatterns()
+	if err != nil {
+		return err
+	}
+	ignorePatterns := limits.withExcludes(filePatterns)
+	trackEmptyDirs := GetConfigBool(trackEmptyDirsKey, false)
+
+	var staged, ignoredTracked []string
+	stats := opts.Stats
+	begin := stats.start()
+	err = storage.RewriteIndex(func(cur *storage.IndexCursor, w *storage.IndexStreamWriter) error {
+		staged, ignoredTracked = nil, nil
+		stats.reset()
+		defer stats.walkedSince(stats.start())
+
+		// The cursor's current entry; ok is false once the index is exhausted.
+		next, entry, ok, err := cur.Next()
+		if err != nil {
+			return err
+		}
+		advance := func() error {
+			next, entry, ok, err = cur.Next()
+			return err
+		}
+		// passed consumes the current entry, which the walk went past without visiting:
+		// a submodule whose directory still exists is kept, anything else is gone.
+		passed := func() error {
+			if entry.Mode == storage.SubmoduleMode {
+				fullPath := filepath.Join(rootDir, filepath.FromSlash(next))
+				if e, exists := refreshGitlink(fullPath, entry); exists {
+					if e.Hash != entry.Hash {
+						staged = append(staged, next)
+					}
+					if err := w.Write(next, e); err != nil {
+						return err
+					}
+					return advance()
+				}
+			}
+			staged = append(staged, next) // no longer in the working tree
+			return advance()
+		}
+		// passTo consumes the index entries that sort before path.
+		passTo := func(path string) error {
+			for ok && next < path {
+				if err := passed(); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		// tracked consumes the entries up to path and returns path's entry.
+		tracked := func(path string) (storage.IndexEntry, bool, error) {
+			if err := passTo(path); err != nil {
+				return storage.IndexEntry{}, false, err
+			}
+			if !ok || next != path {
+				return storage.IndexEntry{}, false, nil
+			}
+			e := entry
+			return e, true, advance()
+		}
+		keep := func(path string, e storage.IndexEntry) error {
+			if matchesAnyPattern(path, filePatterns) {
+				ignoredTracked = append(ignoredTracked, path)
+			}
+			return w.Write(path, e)
+		}
+
+		visitFile := func(path, fullPath string, info os.FileInfo) error {
+			old, isTracked, err := tracked(path)
+			if err != nil {
+				return err
+			}
+			stats.walked()
+			if !isTracked && (matchesAnyPattern(path, ignorePatterns) || matchesAnyAttrRule(info, ignorePatterns)) {
+				return nil
+			}
+			switch {
+			case limits.tooLarge(info.Size()):
+				fmt.Printf("warning: skipping %s\n", limits.sizeMessage(path, info.Size()))
+			case isTracked && limits.unchanged(old, true, info):
+				// Fast path: the entry is kept as is.
+				stats.fastPath()
+			case limits.refusesBinary(fullPath):
+				fmt.Printf("warning: skipping binary file %s\n", path)
+			default:
+				hashStart := stats.start()
+				hash, err := storage.HashAndStoreFile(fullPath)
+				if err != nil {
+					fmt.Printf("warning: could not add file %s: %v\n", path, err)
+					break
+				}
+				stats.hashed(hashStart, info.Size())
+				if !isTracked || old.Hash != hash {
+					staged = append(staged, path)
+				}
+				modTime, size := hashedFileMeta(fullPath, info)
+				return keep(path, storage.IndexEntry{
+					Hash:        hash,
+					ModTime:     modTime,
+					Size:        size,
+					Flags:       old.Flags,
+					Mode:        limits.mode(info),
+					DisplayPath: old.DisplayPath,
+				})
+			}
+			// Skipped: a tracked file keeps its entry, an untracked one stays out.
+			if !isTracked {
+				return nil
+			}
+			return keep(path, old)
+		}
+
+		visitEmptyDir := func(dir string) error {
+			if matchesAnyPattern(dir, ignorePatterns) {
+				return nil
+			}
+			placeholder := dir + "/" + EmptyDirPlaceholder
+			e, isTracked, err := tracked(placeholder)
+			if err != nil {
+				return err
+			}
+			if !isTracked || !isEmptyDirPlaceholder(e.Mode) {
+				if e, err = emptyDirEntry(); err != nil {
+					return fmt.Errorf("failed to record empty directory %s: %w", dir, err)
+				}
+				staged = append(staged, placeholder)
+			}
+			return keep(placeholder, e)
+		}
+
+		var walkDir func(dir, fullDir string) error
+		walkDir = func(dir, fullDir string) error {
+			entries, err := os.ReadDir(fullDir)
+			if err != nil {
+				return err
+			}
+			sortDirEntriesForIndex(entries)
+			if len(entries) == 0 && trackEmptyDirs && dir != "" {
+				return visitEmptyDir(dir)
+			}
+			for _, de := range entries {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				path := de.Name()
+				if dir != "" {
+					path = dir + "/" + path
+				}
+				if !IsSafePath(path) || inRepoDir(path) {
+					continue
+				}
+				fullPath := filepath.Join(fullDir, de.Name())
+				if de.IsDir() {
+					// A submodule's entry sorts before its directory, as `d` does before
+					// `d/`; passTo leaves it current, for passed to keep later.
+					if err := passTo(path); err != nil {
+						return err
+					}
+					if isNestedRepo(fullPath) || ok && next == path && entry.Mode == storage.SubmoduleMode {
+						continue
+					}
+					if err := walkDir(path, fullPath); err != nil {
+						return err
+					}
+					continue
+				}
+				info, err := de.Info()
+				if err != nil {
+					continue // removed since the directory was read
+				}
+				if err := visitFile(path, fullPath, info); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if err := walkDir("", rootDir); err != nil {
+			return err
+		}
+
+		// Whatever is left sorts after the last file on disk.
+		for ok {
+			if err := passed(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	stats.finish(begin)
+	if err != nil {
+		return err
+	}
+
+	if len(ignoredTracked) > 0 {
+		fmt.Println("warning: the following tracked files match .kitignore and stay tracked:")
+		for _, path := range ignoredTracked {
+			fmt.Printf("\t%s\n", path)
+		}
+	}
+	recordOp("add", nil, staged)
+	return nil
+}
+
+// sortDirEntriesForIndex orders a directory listing the way the entries' index keys sort:
+// a subdirectory's files all share the prefix `name/`, so it is placed as if named that.
+// `a.txt` therefore comes before directory `a` ('.' < '/'), which comes before `a0`.
+func sortDirEntriesForIndex(entries []os.DirEntry) {
+	key := func(de os.DirEntry) string {
+		if de.IsDir() {
+			return de.Name() + "/"
+		}
+		return de.Name()
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return key(entries[i]) < key(entries[j])
+	})
+}
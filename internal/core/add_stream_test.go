@@ -0,0 +1,170 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+func TestAddAll_LowMemoryMatchesInMemory(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Names around '/' in byte order: `a-b.txt` < `a.txt` < `a/…` < `a0.txt`.
+	files := map[string]string{
+		"a-b.txt": "1", "a.txt": "2", "a/x.txt": "3", "a/y/z.txt": "4", "a0.txt": "5",
+		"gone.txt": "6", "build.log": "7",
+	}
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := AddAll(); err != nil {
+		t.Fatal(err)
+	}
+	// build.log stays tracked despite the new pattern; plus a deletion, edits and new files.
+	edits := map[string]string{".kitignore": "*.log\n", "build.log": "77", "a/x.txt": "33", "a/new.txt": "8", "b/c.txt": "9", "debug.log": "x"}
+	for name, content := range edits {
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Remove("gone.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	indexFile := filepath.Join(".kitcat", "index")
+	before, err := os.ReadFile(indexFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := AddAllWithOptions(context.Background(), AddOptions{LowMemory: true}); err != nil {
+		t.Fatal(err)
+	}
+	streamed, err := storage.LoadIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(indexFile, before, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddAll(); err != nil {
+		t.Fatal(err)
+	}
+	inMemory, err := storage.LoadIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(streamed, inMemory) {
+		t.Errorf("low-memory index = %v\nin-memory index = %v", streamed, inMemory)
+	}
+	if _, ok := streamed["build.log"]; !ok {
+		t.Error("tracked ignored file dropped")
+	}
+
+	// An unsorted index cannot be merged; the regular path takes over and sorts it.
+	unsorted := fmt.Sprintf(`{"z.txt": %q, "a.txt": %q}`, inMemory["a0.txt"], inMemory["a.txt"])
+	if err := os.WriteFile(indexFile, []byte(unsorted), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddAllWithOptions(context.Background(), AddOptions{LowMemory: true}); err != nil {
+		t.Fatal(err)
+	}
+	if index, err := storage.LoadIndex(); err != nil || !reflect.DeepEqual(index, inMemory) {
+		t.Errorf("after unsorted fallback: %v, %v", index, err)
+	}
+}
+
+// benchmarkAddAll measures a no-op AddAll over 20k unchanged tracked files, the common case
+// on a large tree, with the index loaded into memory or streamed.
+func benchmarkAddAll(b *testing.B, lowMemory bool) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	if err := os.Chdir(b.TempDir()); err != nil {
+		b.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		b.Fatal(err)
+	}
+	for d := 0; d < 100; d++ {
+		dir := fmt.Sprintf("src/pkg%03d", d)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			b.Fatal(err)
+		}
+		for f := 0; f < 200; f++ {
+			if err := os.WriteFile(fmt.Sprintf("%s/file%03d.go", dir, f), []byte(dir), 0o644); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	opts := AddOptions{LowMemory: lowMemory}
+	if err := AddAllWithOptions(context.Background(), opts); err != nil {
+		b.Fatal(err)
+	}
+
+	// Sample the heap while AddAll runs; its peak is what limits the size of a tree.
+	var peak uint64
+	stop, sampled := make(chan struct{}), make(chan struct{})
+	runtime.GC()
+	go func() {
+		defer close(sampled)
+		var ms runtime.MemStats
+		ticker := time.NewTicker(time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				runtime.ReadMemStats(&ms)
+				peak = max(peak, ms.HeapAlloc)
+			}
+		}
+	}()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := AddAllWithOptions(context.Background(), opts); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.StopTimer()
+	close(stop)
+	<-sampled
+	b.ReportMetric(float64(peak), "peak-heap-B")
+}
+
+func BenchmarkAddAll_InMemory(b *testing.B)  { benchmarkAddAll(b, false) }
+func BenchmarkAddAll_LowMemory(b *testing.B) { benchmarkAddAll(b, true) }
@@ -0,0 +1,650 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+func TestIndexPathForDisk(t *testing.T) {
+	dir := t.TempDir()
+	diskPath := filepath.Join(dir, "main.go")
+	if err := os.WriteFile(diskPath, []byte("package main\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Lstat(diskPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A hard link stands in for a case-insensitive filesystem: two names, one file.
+	indexPath := filepath.Join(dir, "Main.go")
+	if err := os.Link(diskPath, indexPath); err != nil {
+		t.Skipf("hard links unsupported: %v", err)
+	}
+
+	index := map[string]storage.IndexEntry{
+		indexPath: {Hash: "abc", Flags: storage.FlagAssumeUnchanged},
+	}
+	byFold := indexPathsByFold(index)
+	if got := indexPathForDisk(index, byFold, diskPath, info); got != indexPath {
+		t.Fatalf("indexPathForDisk = %s, want the tracked name %s", got, indexPath)
+	}
+	if _, ok := index[diskPath]; ok {
+		t.Error("on-disk casing added as a second entry")
+	}
+	if entry := index[indexPath]; entry.Hash != "abc" || entry.Flags != storage.FlagAssumeUnchanged || entry.DisplayPath != diskPath {
+		t.Errorf("entry = %+v, want it kept with DisplayPath %s", entry, diskPath)
+	}
+
+	// Back in step with the tracked name: the display path is dropped.
+	indexPathForDisk(index, byFold, indexPath, info)
+	if entry := index[indexPath]; entry.DisplayPath != "" {
+		t.Errorf("stale DisplayPath %q kept", entry.DisplayPath)
+	}
+
+	// A different file that merely shares a case-folded name is left alone.
+	other := filepath.Join(dir, "README")
+	if err := os.WriteFile(other, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	otherInfo, _ := os.Lstat(other)
+	index = map[string]storage.IndexEntry{filepath.Join(dir, "readme"): {Hash: "def"}}
+	if got := indexPathForDisk(index, indexPathsByFold(index), other, otherInfo); got != other {
+		t.Errorf("unrelated file mapped to %s", got)
+	}
+	if index[filepath.Join(dir, "readme")].DisplayPath != "" {
+		t.Error("unrelated entry given a DisplayPath")
+	}
+}
+
+func TestOnDiskCase(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "Docs"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "Docs", "README.md"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := onDiskCase(root, "docs/readme.md"); got != "Docs/README.md" {
+		t.Errorf("onDiskCase = %s, want Docs/README.md", got)
+	}
+	if got := onDiskCase(root, "Docs/new.txt"); got != "Docs/new.txt" {
+		t.Errorf("onDiskCase kept unknown name as %s", got)
+	}
+}
+
+func TestCaseInsensitiveFS(t *testing.T) {
+	dir := t.TempDir()
+	if !caseInsensitiveFS(dir) {
+		t.Error("an empty directory gives nothing to go by and should count as case-insensitive")
+	}
+	if err := os.WriteFile(filepath.Join(dir, "probe.txt"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(filepath.Join(dir, "PROBE.TXT")); err == nil {
+		t.Skip("the temporary directory is on a case-insensitive filesystem")
+	}
+	if caseInsensitiveFS(dir) {
+		t.Error("caseInsensitiveFS = true on a case-sensitive filesystem")
+	}
+
+	// A hard link under the swapped name is what a case-insensitive lookup looks like
+	if err := os.Link(filepath.Join(dir, "probe.txt"), filepath.Join(dir, "PROBE.TXT")); err != nil {
+		t.Skip("hard links not supported:", err)
+	}
+	if !caseInsensitiveFS(dir) {
+		t.Error("caseInsensitiveFS = false when the swapped name finds the same file")
+	}
+}
+
+func TestHashedFileMeta_ZeroedWhenFileChangedDuringHash(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.txt")
+	if err := os.WriteFile(path, []byte("first"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.Lstat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mtime, size := hashedFileMeta(path, before); mtime != before.ModTime().Unix() || size != 5 {
+		t.Errorf("unchanged file: got (%d, %d), want its stat", mtime, size)
+	}
+
+	// A write landing between the stat and the end of hashing.
+	if err := os.WriteFile(path, []byte("first, then more"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if mtime, size := hashedFileMeta(path, before); mtime != 0 || size != 0 {
+		t.Errorf("changed file: got (%d, %d), want zeroed metadata", mtime, size)
+	}
+}
+
+func TestAddAllContext_CancelledLeavesIndexUntouched(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("a.txt", []byte("a"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := AddAllContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	index, err := storage.LoadIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(index) != 0 {
+		t.Errorf("cancelled add wrote the index: %v", index)
+	}
+}
+
+func TestAddFile_FromSubdirectory(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join("src", "pkg"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join("src", "pkg", "a.go"), []byte("package pkg\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(filepath.Join("src", "pkg")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := AddFile("a.go"); err != nil {
+		t.Fatalf("AddFile from subdirectory failed: %v", err)
+	}
+
+	index, err := storage.LoadIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := index[filepath.Join("src", "pkg", "a.go")]; !ok {
+		t.Errorf("expected repo-relative key, got index %v", index)
+	}
+}
+
+func TestAdd_MaxFileSize(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetConfig(maxFileSizeKey, "1k", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("small.txt", []byte("small"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("big.bin", make([]byte, 2048), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := AddFile("big.bin"); err == nil {
+		t.Error("AddFile should refuse a file over add.maxFileSize")
+	}
+	if err := AddAll(); err != nil {
+		t.Fatalf("AddAll failed: %v", err)
+	}
+	index, err := storage.LoadIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := index["big.bin"]; ok {
+		t.Error("oversized file was staged by AddAll")
+	}
+	if _, ok := index["small.txt"]; !ok {
+		t.Error("small file was not staged")
+	}
+
+	if err := AddFileWithOptions("big.bin", AddOptions{Force: true}); err != nil {
+		t.Fatalf("forced add failed: %v", err)
+	}
+	index, err = storage.LoadIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := index["big.bin"]; !ok {
+		t.Error("--force did not stage the oversized file")
+	}
+
+	// A later AddAll must not drop the entry that was forced in.
+	if err := AddAll(); err != nil {
+		t.Fatal(err)
+	}
+	index, err = storage.LoadIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := index["big.bin"]; !ok {
+		t.Error("AddAll removed a tracked oversized file")
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	cases := map[string]int64{"0": 0, "100": 100, "1k": 1024, "10M": 10 << 20, "2g": 2 << 30, "5mb": 5 << 20}
+	for in, want := range cases {
+		got, err := parseByteSize(in)
+		if err != nil || got != want {
+			t.Errorf("parseByteSize(%q) = %d, %v; want %d", in, got, err, want)
+		}
+	}
+	if _, err := parseByteSize("lots"); err == nil {
+		t.Error("expected an error for a non-numeric size")
+	}
+}
+
+func TestAdd_ExcludeBinary(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("doc.md", []byte("# docs\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("logo.png", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Opt-in: without the option binaries are staged as usual.
+	if err := AddFile("logo.png"); err != nil {
+		t.Fatalf("AddFile without exclusion failed: %v", err)
+	}
+	if err := os.Remove(IndexPath()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := AddFileWithOptions("logo.png", AddOptions{ExcludeBinary: true}); err == nil {
+		t.Error("expected an error adding a binary file with ExcludeBinary")
+	}
+	if err := SetConfig(excludeBinaryKey, "true", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddAll(); err != nil {
+		t.Fatalf("AddAll failed: %v", err)
+	}
+	index, err := storage.LoadIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := index["logo.png"]; ok {
+		t.Error("binary file was staged with add.excludeBinary set")
+	}
+	if _, ok := index["doc.md"]; !ok {
+		t.Error("text file was not staged")
+	}
+}
+
+func TestAddFile_KeepGoingCollectsErrors(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir("dir", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join("dir", "good.txt"), []byte("ok"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// A dangling symlink cannot be read, which stands in for any per-file I/O failure.
+	if err := os.Symlink("missing", filepath.Join("dir", "bad.txt")); err != nil {
+		t.Skipf("symlinks unsupported: %v", err)
+	}
+
+	// Strict mode: the unreadable file aborts the add and nothing is staged.
+	if err := AddFile("dir"); err == nil {
+		t.Fatal("expected strict AddFile to fail")
+	}
+	index, err := storage.LoadIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(index) != 0 {
+		t.Errorf("strict add staged files: %v", index)
+	}
+
+	err = AddFileWithOptions("dir", AddOptions{KeepGoing: true})
+	if err == nil || !strings.Contains(err.Error(), "bad.txt") {
+		t.Fatalf("expected an error naming bad.txt, got %v", err)
+	}
+	index, err = storage.LoadIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := index["dir/good.txt"]; !ok {
+		t.Errorf("readable file was not staged: %v", index)
+	}
+	if _, ok := index["dir/bad.txt"]; ok {
+		t.Error("unreadable file was staged")
+	}
+}
+
+func TestAdd_TrustMtimeOffRehashes(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+
+	stamp := time.Now().Add(-time.Hour).Truncate(time.Second)
+	// write replaces the content but keeps size and mtime, as an unreliable network mount may.
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile("a.txt", []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes("a.txt", stamp, stamp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hashOf := func() string {
+		t.Helper()
+		index, err := storage.LoadIndex()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return index["a.txt"]
+	}
+
+	write("one")
+	if err := AddAll(); err != nil {
+		t.Fatal(err)
+	}
+	first := hashOf()
+
+	write("two")
+	if err := AddAll(); err != nil {
+		t.Fatal(err)
+	}
+	if hashOf() != first {
+		t.Fatal("expected the mtime fast path to skip the unchanged-looking file")
+	}
+
+	if err := SetConfig(trustMtimeKey, "false", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddAll(); err != nil {
+		t.Fatal(err)
+	}
+	if hashOf() == first {
+		t.Error("AddAll with core.trustMtime=false did not re-hash the file")
+	}
+
+	write("six")
+	if err := AddFile("a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if want, _ := storage.HashFile("a.txt"); hashOf() != want {
+		t.Error("AddFile with core.trustMtime=false did not re-hash the file")
+	}
+}
+
+func TestAddAll_DirCacheSkipsUnchangedDirectories(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	ClearIgnoreCache()
+	defer ClearIgnoreCache()
+	if err := SetConfig(dirCacheConfigKey, "true", false); err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Backdate directories so they are old enough to be cached.
+	old := time.Now().Add(-time.Hour)
+	settle := func() {
+		t.Helper()
+		for _, dir := range []string{"src", "src/pkg"} {
+			if err := os.Chtimes(dir, old, old); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	tracked := func() map[string]string {
+		t.Helper()
+		index, err := storage.LoadIndex()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return index
+	}
+
+	write("src/main.go", "package main\n")
+	write("src/pkg/lib.go", "package pkg\n")
+	settle()
+	if err := AddAll(); err != nil {
+		t.Fatal(err)
+	}
+	if len(tracked()) != 2 {
+		t.Fatalf("index = %v", tracked())
+	}
+
+	// In-place edits do not touch the directory, but tracked files are still checked.
+	before := tracked()["src/pkg/lib.go"]
+	write("src/pkg/lib.go", "package pkg // edited\n")
+	if err := AddAll(); err != nil {
+		t.Fatal(err)
+	}
+	if tracked()["src/pkg/lib.go"] == before {
+		t.Error("edit to a tracked file in a cached directory was missed")
+	}
+
+	// A new file changes its directory's mtime and is picked up.
+	write("src/pkg/new.go", "package pkg\n")
+	if err := AddAll(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tracked()["src/pkg/new.go"]; !ok {
+		t.Error("new file in a changed directory was not added")
+	}
+
+	// With the mtime reset, the unchanged directory is not read again.
+	settle()
+	if err := AddAll(); err != nil {
+		t.Fatal(err)
+	}
+	write("src/pkg/hidden.go", "package pkg\n")
+	settle()
+	if err := AddAll(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tracked()["src/pkg/hidden.go"]; ok {
+		t.Fatal("expected the cached directory to be skipped")
+	}
+
+	// Changing the index behind AddAll's back invalidates the cache.
+	if err := storage.UpdateIndexWithMeta(func(index map[string]storage.IndexEntry) error {
+		delete(index, "src/main.go")
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddAll(); err != nil {
+		t.Fatal(err)
+	}
+	index := tracked()
+	if _, ok := index["src/main.go"]; !ok {
+		t.Error("file dropped from the index by another command was not re-added")
+	}
+	if _, ok := index["src/pkg/hidden.go"]; !ok {
+		t.Error("full walk after invalidation missed src/pkg/hidden.go")
+	}
+}
+
+func TestAddAll_SkipsNestedRepositories(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	files := []string{"top.txt", "vendor/lib/.git/HEAD", "vendor/lib/lib.go", "tools/.kitcat/index", "tools/tool.go", "worktree/.git", "worktree/main.go"}
+	for _, name := range files {
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, lowMemory := range []bool{false, true} {
+		if err := AddAllWithOptions(context.Background(), AddOptions{LowMemory: lowMemory}); err != nil {
+			t.Fatal(err)
+		}
+		index, err := storage.LoadIndex()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := index["top.txt"]; len(index) != 1 || !ok {
+			t.Errorf("lowMemory=%v: index = %v, want only top.txt", lowMemory, index)
+		}
+	}
+
+	if err := AddFile("vendor"); err != nil {
+		t.Fatal(err)
+	}
+	index, err := storage.LoadIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(index) != 1 {
+		t.Errorf("add vendor staged nested repository files: %v", index)
+	}
+}
+
+func TestAddAll_SkipsAbsoluteRepoDirInsideWorkTree(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	root := t.TempDir()
+	if err := os.Chdir(root); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(storage.EnvRepoDir, filepath.Join(root, "meta"))
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	_ = SetConfig("user.name", "Test", false)
+	_ = SetConfig("user.email", "test@example.com", false)
+
+	if err := os.WriteFile("a.txt", []byte("a\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, lowMemory := range []string{"false", "true"} {
+		_ = SetConfig(lowMemoryKey, lowMemory, false)
+		if err := AddAll(); err != nil {
+			t.Fatal(err)
+		}
+		index, err := storage.LoadIndexWithMeta()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for path := range index {
+			if path != "a.txt" {
+				t.Errorf("add with %s=%s tracked %s", lowMemoryKey, lowMemory, path)
+			}
+		}
+	}
+	if _, _, err := Commit("first"); err != nil {
+		t.Fatal(err)
+	}
+	if dirty, err := IsWorkDirDirty(); err != nil || dirty {
+		t.Errorf("IsWorkDirDirty() = %v, %v after committing everything", dirty, err)
+	}
+}
@@ -0,0 +1,195 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+// maxFileSizeKey caps the size of files `add` will stage, e.g. "50m". Unset or 0 means
+// unlimited, which is the default so existing repositories behave as before.
+const maxFileSizeKey = "add.maxFileSize"
+
+// excludeBinaryKey makes `add` refuse files whose content looks binary. Off by default;
+// it is meant for text-only repositories such as documentation.
+const excludeBinaryKey = "add.excludeBinary"
+
+// trustMtimeKey controls add's fast path, which treats a file whose size and mtime match
+// its index entry as unchanged without reading it. On by default. Set it to false on
+// network filesystems (NFS, SMB) whose mtimes are unreliable: every tracked file is then
+// re-hashed on every add, which costs a full read of the tree but never misses an edit.
+const trustMtimeKey = "core.trustMtime"
+
+// preservePermissionsKey makes `add` record each file's full permission bits and checkout
+// and restore reapply them exactly. Off by default: files are then written 0644, or 0755
+// when the recorded mode has an executable bit, whatever the exact mode was.
+const preservePermissionsKey = "core.preservePermissions"
+
+// binarySniffLen is how much of a file is read to decide whether it is binary.
+const binarySniffLen = 512
+
+// AddOptions adjusts how AddFile and AddAll stage files.
+type AddOptions struct {
+	// Force stages files even when they exceed add.maxFileSize.
+	Force bool
+	// ExcludeBinary refuses binary files, as if add.excludeBinary were true.
+	ExcludeBinary bool
+	// KeepGoing makes AddFile stage every file it can when adding a directory. Files that
+	// cannot be read or hashed are skipped and their errors returned together (errors.Join)
+	// after the index is written. Without it the first failure aborts the add and nothing
+	// is staged.
+	KeepGoing bool
+	// LowMemory makes AddAll stream the index instead of loading it, as if add.lowMemory
+	// were true.
+	LowMemory bool
+	// FollowSymlinks stages the contents of symlinked directories, as if
+	// add.followSymlinks were true.
+	FollowSymlinks bool
+	// Stats, when not nil, receives counters and timings of the run.
+	Stats *AddStats
+	// Exclude holds extra ignore patterns, written as .kitignore lines, for this add only,
+	// e.g. to skip generated artifacts in CI. They add to .kitignore and
+	// .kitcat/info/exclude: a file matching a pattern from any of them is ignored, and
+	// tracked files are never ignored whatever matches them.
+	Exclude []string
+
+	// locks, set by Batch, are the locks the add runs under instead of taking its own.
+	locks *heldLocks
+}
+
+// addLimits holds the per-run guards resolved from config and AddOptions.
+type addLimits struct {
+	maxFileSize    int64 // 0 = unlimited
+	excludeBinary  bool
+	trustMtime     bool
+	preservePerms  bool
+	followSymlinks bool
+	exclude        []string // AddOptions.Exclude, already validated
+}
+
+func loadAddLimits(opts AddOptions) (addLimits, error) {
+	limits := addLimits{
+		excludeBinary:  opts.ExcludeBinary || GetConfigBool(excludeBinaryKey, false),
+		trustMtime:     GetConfigBool(trustMtimeKey, true),
+		preservePerms:  GetConfigBool(preservePermissionsKey, false),
+		followSymlinks: opts.FollowSymlinks || GetConfigBool(followSymlinksKey, false),
+		exclude:        opts.Exclude,
+	}
+	if _, err := ParseExcludePatterns(opts.Exclude); err != nil {
+		return limits, err
+	}
+	if opts.Force {
+		return limits, nil
+	}
+	value, found, err := GetConfig(maxFileSizeKey)
+	if err != nil || !found {
+		return limits, nil
+	}
+	size, err := parseByteSize(value)
+	if err != nil {
+		return limits, fmt.Errorf("invalid %s: %w", maxFileSizeKey, err)
+	}
+	limits.maxFileSize = size
+	return limits, nil
+}
+
+// withExcludes returns patterns followed by the run's extra exclude patterns. patterns,
+// which may be the cached slice, is not modified.
+func (l addLimits) withExcludes(patterns []IgnorePattern) []IgnorePattern {
+	if len(l.exclude) == 0 {
+		return patterns
+	}
+	exclude, _ := ParseExcludePatterns(l.exclude)
+	return slices.Concat(patterns, exclude)
+}
+
+// unchanged reports whether the fast path may skip hashing a file: it is tracked and its
+// size and mtime (and mode, when permissions are preserved) match the index entry.
+// Always false when core.trustMtime is off.
+func (l addLimits) unchanged(entry storage.IndexEntry, tracked bool, info os.FileInfo) bool {
+	if l.preservePerms && entry.Mode != l.mode(info) {
+		return false
+	}
+	return l.trustMtime && tracked && entry.Size == info.Size() && entry.ModTime == info.ModTime().Unix()
+}
+
+// mode returns the permission bits to record for a file, or 0 when they are not preserved.
+func (l addLimits) mode(info os.FileInfo) uint32 {
+	if !l.preservePerms {
+		return 0
+	}
+	return uint32(info.Mode().Perm())
+}
+
+// tooLarge reports whether a file of the given size exceeds the configured limit.
+func (l addLimits) tooLarge(size int64) bool {
+	return l.maxFileSize > 0 && size > l.maxFileSize
+}
+
+// sizeMessage explains why path was refused, for both the warning and the error form.
+func (l addLimits) sizeMessage(path string, size int64) string {
+	return fmt.Sprintf("%s is %s, larger than %s=%s; use --force to add it anyway",
+		path, formatByteSize(size), maxFileSizeKey, formatByteSize(l.maxFileSize))
+}
+
+// refusesBinary reports whether binary files are excluded and path looks binary, using the
+// same NUL-byte check as diff. Unreadable files are left for the hashing step to report.
+func (l addLimits) refusesBinary(path string) bool {
+	if !l.excludeBinary {
+		return false
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	head := make([]byte, binarySniffLen)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return false
+	}
+	return isDiffBinary(head[:n])
+}
+
+// parseByteSize parses a size such as "1048576", "512k", "10M" or "2g" (binary multiples).
+func parseByteSize(s string) (int64, error) {
+	s = strings.TrimSpace(strings.ToLower(s))
+	s = strings.TrimSuffix(s, "b")
+	multiplier := int64(1)
+	if n := len(s); n > 0 {
+		switch s[n-1] {
+		case 'k':
+			multiplier = 1 << 10
+		case 'm':
+			multiplier = 1 << 20
+		case 'g':
+			multiplier = 1 << 30
+		}
+		if multiplier != 1 {
+			s = s[:n-1]
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("not a valid size: %q", s)
+	}
+	return n * multiplier, nil
+}
+
+// formatByteSize renders a byte count using the largest whole binary unit.
+func formatByteSize(n int64) string {
+	switch {
+	case n >= 1<<30 && n%(1<<30) == 0:
+		return fmt.Sprintf("%dG", n>>30)
+	case n >= 1<<20 && n%(1<<20) == 0:
+		return fmt.Sprintf("%dM", n>>20)
+	case n >= 1<<10 && n%(1<<10) == 0:
+		return fmt.Sprintf("%dK", n>>10)
+	}
+	return fmt.Sprintf("%d bytes", n)
+}
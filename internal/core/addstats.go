@@ -0,0 +1,86 @@
+package core
+
+import (
+	"fmt"
+	"time"
+)
+
+// AddStats reports where an add spent its work, for finding out why it is slow. Pass one in
+// AddOptions.Stats to collect it; without one nothing is counted or timed.
+type AddStats struct {
+	FilesWalked int   // files the walk reached, ignored ones included
+	FilesHashed int   // files read, hashed and stored
+	BytesHashed int64 // the size of the files hashed
+	FastPath    int   // tracked files taken as unchanged because size and mtime matched
+	// WalkTime is the time spent walking and checking files, HashTime the time spent
+	// hashing and storing their content, and IndexTime the time spent loading and writing
+	// the index around the walk.
+	WalkTime  time.Duration
+	HashTime  time.Duration
+	IndexTime time.Duration
+}
+
+// String summarizes the stats on one line per phase.
+func (s AddStats) String() string {
+	return fmt.Sprintf("walk:  %d files in %v (%d unchanged by size and mtime)\nhash:  %d files, %s in %v\nindex: %v",
+		s.FilesWalked, s.WalkTime.Round(time.Microsecond), s.FastPath,
+		s.FilesHashed, formatSize(s.BytesHashed), s.HashTime.Round(time.Microsecond),
+		s.IndexTime.Round(time.Microsecond))
+}
+
+// The methods below do nothing on a nil *AddStats, so the add code calls them
+// unconditionally and pays only a nil check when stats are off.
+
+// start returns the time a timed phase begins, or the zero time when stats are off.
+func (s *AddStats) start() time.Time {
+	if s == nil {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// reset clears the counters at the start of an index transaction, which may be retried.
+func (s *AddStats) reset() {
+	if s != nil {
+		*s = AddStats{}
+	}
+}
+
+func (s *AddStats) walked() {
+	if s != nil {
+		s.FilesWalked++
+	}
+}
+
+func (s *AddStats) fastPath() {
+	if s != nil {
+		s.FastPath++
+	}
+}
+
+// hashed records a file of size bytes hashed since start.
+func (s *AddStats) hashed(start time.Time, size int64) {
+	if s != nil {
+		s.FilesHashed++
+		s.BytesHashed += size
+		s.HashTime += time.Since(start)
+	}
+}
+
+// walkedSince records the time the index transaction's callback ran, from start; it is
+// deferred at the top of the callback.
+func (s *AddStats) walkedSince(start time.Time) {
+	if s != nil {
+		s.WalkTime += time.Since(start)
+	}
+}
+
+// finish splits the time since begin, when the index transaction started: what the
+// callback did not spend went to the index, and hashing is taken out of the walk.
+func (s *AddStats) finish(begin time.Time) {
+	if s == nil {
+		return
+	}
+	s.IndexTime = time.Since(begin) - s.WalkTime
+	s.WalkTime -= s.HashTime
+}
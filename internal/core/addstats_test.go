@@ -0,0 +1,65 @@
+package core
+
+import (
+	"os"
+	"testing"
+)
+
+func TestAddAll_CollectsStats(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(".kitignore", []byte("*.log\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ClearIgnoreCache()
+	defer ClearIgnoreCache()
+	for name, content := range map[string]string{"a.txt": "alpha", "b.txt": "bravo!", "debug.log": "ignored"} {
+		if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var stats AddStats
+	if err := AddAllWithOptions(t.Context(), AddOptions{Stats: &stats}); err != nil {
+		t.Fatal(err)
+	}
+	// .kitignore, a.txt and b.txt are hashed; debug.log is walked but ignored.
+	if stats.FilesWalked != 4 || stats.FilesHashed != 3 || stats.FastPath != 0 {
+		t.Errorf("first add stats = %+v, want 4 walked, 3 hashed", stats)
+	}
+	if want := int64(len("*.log\n") + len("alpha") + len("bravo!")); stats.BytesHashed != want {
+		t.Errorf("BytesHashed = %d, want %d", stats.BytesHashed, want)
+	}
+	if stats.WalkTime < 0 || stats.HashTime <= 0 || stats.IndexTime <= 0 {
+		t.Errorf("timings = %+v, want all set", stats)
+	}
+
+	for _, lowMemory := range []bool{false, true} {
+		stats = AddStats{}
+		if err := AddAllWithOptions(t.Context(), AddOptions{Stats: &stats, LowMemory: lowMemory}); err != nil {
+			t.Fatal(err)
+		}
+		if stats.FilesWalked != 4 || stats.FilesHashed != 0 || stats.FastPath != 3 {
+			t.Errorf("unchanged add (lowMemory=%v) stats = %+v, want 3 on the fast path", lowMemory, stats)
+		}
+	}
+
+	stats = AddStats{}
+	if err := AddFileWithOptions("a.txt", AddOptions{Stats: &stats}); err != nil {
+		t.Fatal(err)
+	}
+	if stats.FilesWalked != 1 || stats.FastPath != 1 {
+		t.Errorf("AddFile stats = %+v, want 1 walked on the fast path", stats)
+	}
+}
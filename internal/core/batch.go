@@ -0,0 +1,102 @@
+package core
+
+import (
+	"context"
+	"errors"
+
+	"github.com/LeeFred3042U/kitcat/internal/models"
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+// ErrBatchDone is returned by a Batch method called after WithRepoLock has returned.
+var ErrBatchDone = errors.New("batch already finished")
+
+// heldLocks are the locks an operation runs under when it is part of a Batch, passed down
+// to it instead of taken again: the repository lock, held exclusively, and the index lock.
+// A nil *heldLocks means the operation takes its own locks as usual.
+type heldLocks struct {
+	index *storage.IndexLock
+}
+
+// lockRepoShared takes the shared repository lock, or returns nil when the batch's
+// exclusive lock already covers the operation. RepoLock.Unlock accepts nil.
+func (h *heldLocks) lockRepoShared() (*storage.RepoLock, error) {
+	if h != nil {
+		return nil, nil
+	}
+	return storage.LockRepoShared()
+}
+
+// updateIndex is storage.UpdateIndexWithMeta, through the held index lock when there is one.
+func (h *heldLocks) updateIndex(fn func(index map[string]storage.IndexEntry) error) error {
+	if h != nil {
+		return h.index.Update(fn)
+	}
+	return storage.UpdateIndexWithMeta(fn)
+}
+
+// Batch runs adds and commits under the locks WithRepoLock holds. Its methods behave like
+// the package functions of the same name. A Batch is not safe for concurrent use.
+type Batch struct {
+	locks *heldLocks
+	done  bool
+}
+
+// WithRepoLock runs fn while holding the repository lock exclusively and the index lock, so
+// that a scripted sequence such as several adds followed by a commit is atomic with respect
+// to other kitcat processes: their adds, commits and repacks wait until fn returns, and
+// their index updates too.
+//
+// The re-entrancy contract: locks are not re-entrant, so everything fn changes must go
+// through the Batch it is given, which passes the held locks down instead of taking them
+// again. Calling a package function that takes either lock from fn (AddAll, Commit, Reset,
+// Checkout, Repack and the like) waits for the lock fn's own caller holds, i.e. forever.
+// Read-only functions such as GetStatus, ReadOpLog or storage.LoadIndex are safe.
+// Changes already made stay made when fn fails; nothing is rolled back. The Batch must not
+// be used after fn returns.
+func WithRepoLock(fn func(b *Batch) error) error {
+	if _, err := enterRepoRoot(); err != nil {
+		return err
+	}
+	repoLock, err := storage.LockRepoExclusive()
+	if err != nil {
+		return err
+	}
+	defer repoLock.Unlock()
+	indexLock, err := storage.LockIndex()
+	if err != nil {
+		return err
+	}
+	defer indexLock.Unlock()
+
+	b := &Batch{locks: &heldLocks{index: indexLock}}
+	defer func() { b.done = true }()
+	return fn(b)
+}
+
+// AddFile is AddFileWithOptions within the batch.
+func (b *Batch) AddFile(inputPath string, opts AddOptions) error {
+	if b.done {
+		return ErrBatchDone
+	}
+	opts.locks = b.locks
+	return addPaths([]string{inputPath}, opts)
+}
+
+// AddAll is AddAllWithOptions within the batch. The index is never streamed, whatever
+// opts.LowMemory and add.lowMemory say.
+func (b *Batch) AddAll(ctx context.Context, opts AddOptions) error {
+	if b.done {
+		return ErrBatchDone
+	}
+	opts.locks = b.locks
+	return AddAllWithOptions(ctx, opts)
+}
+
+// Commit is Commit within the batch.
+func (b *Batch) Commit(message string) (models.Commit, string, error) {
+	if b.done {
+		return models.Commit{}, "", ErrBatchDone
+	}
+	return commit(message, b.locks)
+}
@@ -0,0 +1,107 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+func TestWithRepoLock_KeepsOtherWritersOut(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	_ = SetConfig("user.name", "Test", false)
+	_ = SetConfig("user.email", "test@example.com", false)
+
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := os.WriteFile(name, []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A writer that starts during the batch, standing in for another process: the lock
+	// files are locked per open file, so it waits like one would.
+	const hash = "da39a3ee5e6b4b0d3255bfef95601890afd80709"
+	otherDone := make(chan error, 1)
+	var saved *Batch
+	err = WithRepoLock(func(b *Batch) error {
+		saved = b
+		go func() {
+			otherDone <- storage.UpdateIndexWithMeta(func(index map[string]storage.IndexEntry) error {
+				index["other.txt"] = storage.IndexEntry{Hash: hash}
+				return nil
+			})
+		}()
+
+		if err := b.AddFile("a.txt", AddOptions{}); err != nil {
+			return err
+		}
+		if _, _, err := b.Commit("first"); err != nil {
+			return err
+		}
+		if err := b.AddAll(context.Background(), AddOptions{LowMemory: true}); err != nil {
+			return err
+		}
+		if _, _, err := b.Commit("second"); err != nil {
+			return err
+		}
+
+		select {
+		case err := <-otherDone:
+			t.Errorf("another writer got in during the batch (err %v)", err)
+		case <-time.After(50 * time.Millisecond):
+		}
+		// Reads still work inside the batch.
+		index, err := storage.LoadIndex()
+		if err != nil {
+			return err
+		}
+		if len(index) != 2 {
+			t.Errorf("index inside batch = %v", index)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WithRepoLock failed: %v", err)
+	}
+
+	select {
+	case err := <-otherDone:
+		if err != nil {
+			t.Fatalf("waiting writer failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("waiting writer never ran after the batch")
+	}
+	index, err := storage.LoadIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.txt", "b.txt", "other.txt"} {
+		if _, ok := index[name]; !ok {
+			t.Errorf("%s missing from index %v", name, index)
+		}
+	}
+	head, err := GetHeadCommit()
+	if err != nil || head.Message != "second" {
+		t.Errorf("HEAD = %q, %v, want the batch's second commit", head.Message, err)
+	}
+
+	if err := saved.AddFile("a.txt", AddOptions{}); !errors.Is(err, ErrBatchDone) {
+		t.Errorf("AddFile after the batch = %v, want ErrBatchDone", err)
+	}
+}
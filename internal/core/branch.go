@@ -5,13 +5,12 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/LeeFred3042U/kitcat/internal/storage"
 )
 
-const headsDir string = ".kitcat/refs/heads"
-
 // IsValidRefName checks if the branch or tag name is safe and valid
 func IsValidRefName(name string) bool {
 	if !IsSafePath(name) {
@@ -27,26 +26,22 @@ func IsValidRefName(name string) bool {
 	return true
 }
 
-// Resolves the current commit hash by following the HEAD reference
-func readHEAD() (string, error) {
-	headData, err := os.ReadFile(".kitcat/HEAD")
-	if err != nil {
-		return "", err
-	}
-	ref := strings.TrimSpace(string(headData))
-	if !strings.HasPrefix(ref, "ref: ") {
-		return "", fmt.Errorf("invalid HEAD format")
-	}
-	return strings.TrimPrefix(ref, "ref: "), nil
-}
+// defaultBranchKey names the branch a new repository starts on. Set it globally to choose
+// the name for future repositories; init records the name it used in the local config.
+const defaultBranchKey = "init.defaultBranch"
 
-// readCommitHash reads the commit hash from the reference path
-func readCommitHash(referencePath string) (string, error) {
-	commitHash, err := os.ReadFile(filepath.Join(".kitcat", referencePath))
-	if err != nil {
-		return "", err
+// fallbackDefaultBranch is the default branch when init.defaultBranch is unset or invalid.
+const fallbackDefaultBranch = "main"
+
+// DefaultBranch returns the name of the repository's default branch: the one recorded when
+// it was initialized, otherwise the configured init.defaultBranch, otherwise "main".
+// Use it instead of assuming a branch name.
+func DefaultBranch() string {
+	name, ok, err := GetConfig(defaultBranchKey)
+	if err != nil || !ok || !IsValidRefName(name) {
+		return fallbackDefaultBranch
 	}
-	return strings.TrimSpace(string(commitHash)), nil
+	return name
 }
 
 // Create a new branch pointing to the current HEAD commit
@@ -57,13 +52,13 @@ func CreateBranch(name string) error {
 	if IsBranch(name) {
 		return fmt.Errorf("branch '%s' already exists", name)
 	}
-	head, err := readHEAD()
+	head, err := ReadHead()
 	if err != nil {
 		return err
 	}
-	commitHash, err := readCommitHash(head)
-	if err != nil {
-		// If HEAD can't be read, maybe there are no commits yet
+	commitHash := head.Hash
+	if commitHash == "" {
+		// The current branch has no commits yet; fall back to the newest commit
 		lastCommit, err := storage.GetLastCommit()
 		if err != nil {
 			return errors.New("cannot create branch: no commits yet")
@@ -71,17 +66,17 @@ func CreateBranch(name string) error {
 		commitHash = lastCommit.ID
 	}
 
-	if err := os.MkdirAll(headsDir, 0o755); err != nil {
+	if err := os.MkdirAll(HeadsDir(), 0o755); err != nil {
 		return err
 	}
 
-	branchPath := filepath.Join(headsDir, name)
+	branchPath := filepath.Join(HeadsDir(), name)
 	return os.WriteFile(branchPath, []byte(strings.TrimSpace(commitHash)), 0o644)
 }
 
 // Checks if a branch with the given name exists.
 func IsBranch(name string) bool {
-	branchPath := filepath.Join(headsDir, name)
+	branchPath := filepath.Join(HeadsDir(), name)
 	if _, err := os.Stat(branchPath); err == nil {
 		return true
 	}
@@ -103,7 +98,7 @@ func ListBranches() error {
 
 	// Read all files in the refs/heads directory
 	// Each file is a branch
-	branches, err := os.ReadDir(headsDir)
+	branches, err := os.ReadDir(HeadsDir())
 	if err != nil {
 		return err
 	}
@@ -120,26 +115,138 @@ func ListBranches() error {
 	return nil
 }
 
+// BranchInfo describes a local branch as ListBranchInfo reports it.
+type BranchInfo struct {
+	Name    string
+	Tip     string // the commit the branch points at
+	Subject string // first line of the tip's message
+	Current bool   // HEAD is attached to this branch
+	// Ahead counts the commits on the branch that are not on the base, Behind those on the
+	// base that are not on the branch. Unrelated is set when the two share no commit.
+	// All three stay zero when no base is given.
+	Ahead     int
+	Behind    int
+	Unrelated bool
+}
+
+// ListBranchInfo returns every local branch with its tip commit, sorted by name and with
+// the checked-out one marked, the data behind `kitcat branch -v`. With a non-empty base
+// (a branch, HEAD or a commit hash) each branch is also compared with base, using the
+// commit graph when it is up to date.
+func ListBranchInfo(base string) ([]BranchInfo, error) {
+	head, err := ReadHead()
+	if err != nil {
+		return nil, err
+	}
+	baseID := ""
+	if base != "" {
+		if baseID, err = ResolveCommitRef(base); err != nil {
+			return nil, err
+		}
+	}
+
+	entries, err := os.ReadDir(HeadsDir())
+	if err != nil {
+		return nil, err
+	}
+	branches := make([]BranchInfo, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(HeadsDir(), e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		b := BranchInfo{
+			Name:    e.Name(),
+			Tip:     strings.TrimSpace(string(data)),
+			Current: !head.IsDetached() && head.Branch() == e.Name(),
+		}
+		if b.Tip == "" {
+			branches = append(branches, b)
+			continue
+		}
+		c, err := storage.LookupCommit(b.Tip)
+		if err != nil {
+			return nil, fmt.Errorf("branch %s: %w", b.Name, err)
+		}
+		b.Subject, _, _ = strings.Cut(c.Message, "\n")
+		if baseID != "" {
+			ahead, behind, related, err := storage.AheadBehind(b.Tip, baseID)
+			if err != nil {
+				return nil, fmt.Errorf("branch %s: %w", b.Name, err)
+			}
+			b.Ahead, b.Behind, b.Unrelated = ahead, behind, !related
+		}
+		branches = append(branches, b)
+	}
+	sort.Slice(branches, func(i, j int) bool { return branches[i].Name < branches[j].Name })
+	return branches, nil
+}
+
+// ListBranchesVerbose prints every local branch with its tip commit and subject and, with a
+// non-empty base, how far it is ahead of and behind base.
+func ListBranchesVerbose(base string) error {
+	branches, err := ListBranchInfo(base)
+	if err != nil {
+		return err
+	}
+	width := 0
+	for _, b := range branches {
+		width = max(width, len(b.Name))
+	}
+	for _, b := range branches {
+		marker, name := "  ", b.Name
+		if b.Current {
+			marker, name = "* ", colorGreen+b.Name+colorReset
+		}
+		padding := strings.Repeat(" ", width-len(b.Name))
+		tip := "(no commits)"
+		if len(b.Tip) >= 7 {
+			tip = b.Tip[:7]
+		}
+		fmt.Printf("%s%s%s %s %s%s\n", marker, name, padding, tip, branchTracking(b), b.Subject)
+	}
+	return nil
+}
+
+// branchTracking formats the comparison with the base, like "[ahead 2, behind 1] ".
+func branchTracking(b BranchInfo) string {
+	var parts []string
+	switch {
+	case b.Unrelated:
+		parts = append(parts, "unrelated history")
+	default:
+		if b.Ahead > 0 {
+			parts = append(parts, fmt.Sprintf("ahead %d", b.Ahead))
+		}
+		if b.Behind > 0 {
+			parts = append(parts, fmt.Sprintf("behind %d", b.Behind))
+		}
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "[" + strings.Join(parts, ", ") + "] "
+}
+
 func RenameCurrentBranch(newName string) error {
 	if !IsValidRefName(newName) {
 		return fmt.Errorf("invalid branch name '%s'", newName)
 	}
 
-	headPath := ".kitcat/HEAD"
-	headContent, err := os.ReadFile(headPath)
+	head, err := ReadHead()
 	if err != nil {
 		return err
 	}
-
-	headStr := strings.TrimSpace(string(headContent))
-	const refPrefix = "ref: refs/heads/"
-	if !strings.HasPrefix(headStr, refPrefix) {
+	if head.IsDetached() {
 		return errors.New("HEAD is not pointing to a branch")
 	}
 
-	oldName := strings.TrimPrefix(headStr, refPrefix)
-	oldRef := filepath.Join(".kitcat", "refs", "heads", oldName)
-	newRef := filepath.Join(".kitcat", "refs", "heads", newName)
+	oldName := head.Branch()
+	oldRef := filepath.Join(RepoDir(), "refs", "heads", oldName)
+	newRef := filepath.Join(RepoDir(), "refs", "heads", newName)
 
 	if _, err := os.Stat(newRef); err == nil {
 		return fmt.Errorf("branch '%s' already exists", newName)
@@ -154,8 +261,7 @@ func RenameCurrentBranch(newName string) error {
 		return err
 	}
 
-	newHeadContent := []byte(refPrefix + newName + "\n")
-	if err := os.WriteFile(headPath, newHeadContent, 0o644); err != nil {
+	if err := WriteHead(Head{Ref: "refs/heads/" + newName}); err != nil {
 		return err
 	}
 
@@ -169,20 +275,20 @@ func RenameCurrentBranch(newName string) error {
 // DeleteBranch deletes the branch
 // throws error if the branch is equal to HEAD
 func DeleteBranch(name string) error {
-	head, err := readHEAD()
+	head, err := ReadHead()
 	if err != nil {
 		return err
 	}
 
 	// Checks if the branch is set to HEAD
-	if head == "refs/heads/"+name {
+	if head.Ref == "refs/heads/"+name {
 		return fmt.Errorf(
 			"branch `%s` is currently active, switch to another branch and then try to delete again",
 			name,
 		)
 	}
 
-	if err := os.Remove(filepath.Join(headsDir, name)); err != nil {
+	if err := os.Remove(filepath.Join(HeadsDir(), name)); err != nil {
 		return fmt.Errorf("branch `%s` doesn't exist", name)
 	}
 
@@ -287,3 +287,130 @@ func TestRenameCurrentBranch_InvalidName_InvalidRename(t *testing.T) {
 		})
 	}
 }
+
+func TestDefaultBranch_RecordedAtInit(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	t.Setenv("HOME", t.TempDir())
+
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	if got := DefaultBranch(); got != "main" {
+		t.Errorf("DefaultBranch() without config = %q, want main", got)
+	}
+
+	if err := SetConfig("init.defaultBranch", "trunk", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	head, err := ReadHead()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head.Ref != "refs/heads/trunk" || !IsBranch("trunk") || IsBranch("main") {
+		t.Errorf("new repository HEAD = %+v, want refs/heads/trunk only", head)
+	}
+
+	// Changing the global preference does not affect an existing repository.
+	if err := SetConfig("init.defaultBranch", "develop", true); err != nil {
+		t.Fatal(err)
+	}
+	if got := DefaultBranch(); got != "trunk" {
+		t.Errorf("DefaultBranch() = %q, want the recorded trunk", got)
+	}
+}
+
+func TestListBranchInfo_AheadBehind(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	_ = SetConfig("user.name", "Test", false)
+	_ = SetConfig("user.email", "test@example.com", false)
+
+	var commits []models.Commit
+	for _, content := range []string{"one", "second", "the third"} {
+		if err := os.WriteFile("a.txt", []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := AddFile("a.txt"); err != nil {
+			t.Fatal(err)
+		}
+		c, _, err := Commit(content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		commits = append(commits, c)
+	}
+
+	// feature forks from the second commit and adds two of its own; orphan shares nothing.
+	appendCommit := func(parent, message string) string {
+		t.Helper()
+		c := models.Commit{Parent: parent, Message: message, TreeHash: commits[0].TreeHash, Timestamp: time.Now()}
+		c.ID = hashCommit(c)
+		if err := storage.AppendCommit(c); err != nil {
+			t.Fatal(err)
+		}
+		return c.ID
+	}
+	featureTip := appendCommit(appendCommit(commits[1].ID, "feature one"), "feature two\n\nbody")
+	orphanTip := appendCommit("", "orphan")
+	for name, tip := range map[string]string{"feature": featureTip, "orphan": orphanTip} {
+		if err := os.WriteFile(filepath.Join(HeadsDir(), name), []byte(tip), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	branches, err := ListBranchInfo("main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []BranchInfo{
+		{Name: "feature", Tip: featureTip, Subject: "feature two", Ahead: 2, Behind: 1},
+		{Name: "main", Tip: commits[2].ID, Subject: "the third", Current: true},
+		{Name: "orphan", Tip: orphanTip, Subject: "orphan", Ahead: 1, Behind: 3, Unrelated: true},
+	}
+	if len(branches) != len(want) {
+		t.Fatalf("ListBranchInfo = %+v", branches)
+	}
+	for i := range want {
+		if branches[i] != want[i] {
+			t.Errorf("branch %d = %+v, want %+v", i, branches[i], want[i])
+		}
+	}
+
+	// The commit log gives the same counts as the commit graph.
+	if err := os.Remove(filepath.Join(RepoDir(), "commit-graph")); err != nil {
+		t.Fatal(err)
+	}
+	if ahead, behind, related, err := storage.AheadBehind(featureTip, commits[2].ID); err != nil || ahead != 2 || behind != 1 || !related {
+		t.Errorf("AheadBehind without graph = %d, %d, %v, %v", ahead, behind, related, err)
+	}
+
+	if branches, err = ListBranchInfo(""); err != nil || branches[0].Ahead != 0 || branches[0].Behind != 0 {
+		t.Errorf("ListBranchInfo without a base = %+v, %v", branches, err)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/LeeFred3042U/kitcat/internal/storage"
@@ -26,10 +27,20 @@ func CheckoutFile(filePath string) error {
 		return err
 	}
 
-	blobHash, ok := tree[filePath]
+	// Trees and the index use forward-slash keys; the filesystem gets the native form.
+	key := storage.IndexKey(filePath)
+	filePath = filepath.FromSlash(key)
+
+	blobHash, ok := tree[key]
 	if !ok {
 		return errors.New("file not found in the last commit")
 	}
+	if err := ValidateIndexPaths(); err != nil {
+		return err
+	}
+	if err := validateWritePaths([]string{key}, "the last commit"); err != nil {
+		return err
+	}
 
 	// SAFETY CHECK: Prevent overwriting dirty or untracked files
 	if _, err := os.Stat(filePath); err == nil {
@@ -45,7 +56,7 @@ func CheckoutFile(filePath string) error {
 			return err
 		}
 
-		if trackedHash, ok := index[filePath]; ok {
+		if trackedHash, ok := index[key]; ok {
 			// File is tracked: fail if local changes exist (Index != Disk)
 			if currentHash != trackedHash {
 				return fmt.Errorf("error: local changes to '%s' would be overwritten", filePath)
@@ -62,22 +73,35 @@ func CheckoutFile(filePath string) error {
 		return err
 	}
 
-	if err := os.WriteFile(filePath, content, 0o644); err != nil {
+	modes, err := storage.ParseTreeModes(lastCommit.TreeHash)
+	if err != nil {
+		return err
+	}
+	if err := SafeWrite(filePath, content, worktreeMode(modes[key], GetConfigBool(preservePermissionsKey, false))); err != nil {
 		return err
 	}
+	if mode, _, _ := GetConfig("checkout.mtime"); mode == CheckoutMtimeCommit {
+		if err := os.Chtimes(filePath, lastCommit.Timestamp, lastCommit.Timestamp); err != nil {
+			return err
+		}
+	}
 
 	// Update the index to reflect the checked-out version
 	index, err := storage.LoadIndex()
 	if err != nil {
 		return err
 	}
-	index[filePath] = blobHash
-	return storage.WriteIndex(index)
+	index[key] = blobHash
+	if err := storage.WriteIndex(index); err != nil {
+		return err
+	}
+	recordOp("checkout", nil, []string{key})
+	return nil
 }
 
 // Switch the current HEAD to the named branch and updates the working directory.
 func CheckoutBranch(name string) error {
-	branchPath := filepath.Join(headsDir, name)
+	branchPath := filepath.Join(HeadsDir(), name)
 	commitHashBytes, err := os.ReadFile(branchPath)
 	if err != nil {
 		return fmt.Errorf("branch '%s' not found", name)
@@ -105,59 +129,55 @@ func CheckoutBranch(name string) error {
 		)
 	}
 
-	// Before making changes, we should check if the user has unstaged work
-	// that would be overwritten
-	// So the real Git would abort here
-	// For now, this is what i have done
-
-	// Update the working directory to match the target tree
-	// First, delete files that are not in the target tree
-	currentIndex, _ := storage.LoadIndex()
-	for path := range currentIndex {
-		if _, existsInTarget := targetTree[path]; !existsInTarget {
-			os.Remove(path)
-		}
-	}
-
-	// Now, write/update files from the target tree
-	for path, hash := range targetTree {
-		content, err := storage.ReadObject(hash)
-		if err != nil {
-			return err
-		}
-		// Ensure directory exists before writing file
-		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
-			return err
-		}
-		if err := os.WriteFile(path, content, 0o644); err != nil {
-			return err
-		}
+	// Update the working directory and index to match the target tree
+	if err := materializeTree(targetTree, commit); err != nil {
+		return err
 	}
 
-	// Update the index to match the new tree
-	if err := storage.WriteIndex(targetTree); err != nil {
+	// Update HEAD to point to the new branch
+	if err := WriteHead(Head{Ref: "refs/heads/" + name}); err != nil {
 		return err
 	}
+	recordOp("checkout", []string{"refs/heads/" + name, commit.ID}, nil)
+	return nil
+}
 
-	// Update HEAD to point to the new branch
-	newHEADContent := fmt.Sprintf("ref: refs/heads/%s", name)
-	return os.WriteFile(".kitcat/HEAD", []byte(newHEADContent), 0o644)
+// CheckoutOptions controls CheckoutCommitWithOptions.
+type CheckoutOptions struct {
+	// Force lets the checkout discard staged and unstaged changes; without it the checkout
+	// fails with ErrUncommittedChanges when HasUncommittedChanges finds any.
+	Force bool
 }
 
 // CheckoutCommit moves HEAD to a specific commit and updates the working directory
 // This puts the repository in a "detached HEAD" state
 func CheckoutCommit(commitHash string) error {
+	return CheckoutCommitWithOptions(commitHash, CheckoutOptions{})
+}
+
+// CheckoutCommitWithOptions is CheckoutCommit with options.
+func CheckoutCommitWithOptions(commitHash string, opts CheckoutOptions) error {
+	if !opts.Force {
+		if err := requireNoUncommittedChanges("checkout"); err != nil {
+			return err
+		}
+	}
+
 	// Verify the commit actually exists
-	_, err := storage.FindCommit(commitHash)
+	commit, err := storage.FindCommit(commitHash)
 	if err != nil {
 		return fmt.Errorf("commit '%s' not found", commitHash)
 	}
 
-	if err := UpdateWorkspaceAndIndex(commitHash); err != nil {
+	if err := UpdateWorkspaceAndIndex(commit.ID); err != nil {
 		return err
 	}
 
-	return os.WriteFile(".kitcat/HEAD", []byte(commitHash), 0o644)
+	if err := WriteHead(Head{Hash: commit.ID}); err != nil {
+		return err
+	}
+	recordOp("checkout", []string{commit.ID}, nil)
+	return nil
 }
 
 func calculateHash(path string) (string, error) {
@@ -172,3 +192,125 @@ func calculateHash(path string) (string, error) {
 	}
 	return hex.EncodeToString(h.Sum(nil)), nil
 }
+
+// CheckoutOp is a working-tree file operation a checkout would perform.
+type CheckoutOp string
+
+const (
+	CheckoutCreate    CheckoutOp = "create"
+	CheckoutOverwrite CheckoutOp = "overwrite"
+	CheckoutDelete    CheckoutOp = "delete"
+)
+
+// CheckoutAction describes what checking out a target would do to one path.
+type CheckoutAction struct {
+	Path string
+	Op   CheckoutOp
+	// LosesLocalChanges is set when the file on disk holds content found in neither
+	// the index nor the target, i.e. uncommitted work or an untracked file.
+	LosesLocalChanges bool
+}
+
+// CheckoutPlan computes, without touching anything, the file operations that checking
+// out target (a branch name, HEAD, or a full or abbreviated commit hash) would perform
+// on the working tree. Actions are sorted by path.
+func CheckoutPlan(target string) ([]CheckoutAction, error) {
+	commitHash, err := ResolveCommitRef(target)
+	if err != nil {
+		return nil, err
+	}
+	commit, err := storage.FindCommit(commitHash)
+	if err != nil {
+		return nil, fmt.Errorf("'%s' is not a branch or commit", target)
+	}
+	targetTree, err := storage.ParseTree(commit.TreeHash)
+	if err != nil {
+		return nil, err
+	}
+	targetModes, err := storage.ParseTreeModes(commit.TreeHash)
+	if err != nil {
+		return nil, err
+	}
+	index, err := storage.LoadIndexWithMeta()
+	if err != nil {
+		return nil, err
+	}
+	current := make(map[string]string, len(index))
+	for path, entry := range index {
+		current[path] = entry.Hash
+	}
+
+	changed := make(map[string]bool)
+	var actions []CheckoutAction
+	for _, change := range diffTrees(current, targetTree) {
+		changed[change.Path] = true
+		// Placeholders are never written to disk: only the files on the other side count.
+		wasPlaceholder := isEmptyDirPlaceholder(index[change.Path].Mode)
+		isPlaceholder := isEmptyDirPlaceholder(targetModes[change.Path])
+		op := CheckoutOverwrite
+		switch {
+		case change.Kind == ChangeAdded && isPlaceholder, change.Kind == ChangeDeleted && wasPlaceholder:
+			continue
+		case change.Kind == ChangeAdded || wasPlaceholder:
+			op = CheckoutCreate
+		case change.Kind == ChangeDeleted || isPlaceholder:
+			op = CheckoutDelete
+		}
+		lost, err := losesLocalChanges(change.Path, index[change.Path], change.NewHash)
+		if err != nil {
+			return nil, err
+		}
+		actions = append(actions, CheckoutAction{Path: change.Path, Op: op, LosesLocalChanges: lost})
+	}
+
+	// Unchanged paths are rewritten too, which restores missing files and discards edits.
+	for path, hash := range targetTree {
+		if changed[path] || isEmptyDirPlaceholder(targetModes[path]) {
+			continue
+		}
+		entry := index[path]
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			actions = append(actions, CheckoutAction{Path: path, Op: CheckoutCreate})
+			continue
+		}
+		lost, err := losesLocalChanges(path, entry, hash)
+		if err != nil {
+			return nil, err
+		}
+		if lost {
+			actions = append(actions, CheckoutAction{Path: path, Op: CheckoutOverwrite, LosesLocalChanges: true})
+		}
+	}
+
+	sort.Slice(actions, func(i, j int) bool {
+		return actions[i].Path < actions[j].Path
+	})
+	return actions, nil
+}
+
+// losesLocalChanges reports whether path exists on disk with content that matches neither
+// its index entry nor targetHash, so writing or deleting it would destroy that content.
+func losesLocalChanges(path string, entry storage.IndexEntry, targetHash string) (bool, error) {
+	if isEmptyDirPlaceholder(entry.Mode) {
+		return false, nil
+	}
+	// A submodule directory is never overwritten; checkoutSubmodule refuses to move one
+	// with local changes.
+	if info, err := os.Stat(path); os.IsNotExist(err) || err == nil && info.IsDir() {
+		return false, nil
+	}
+	if entry.Hash != "" {
+		// Flags are ignored: a file marked assume-unchanged can still hold edits that
+		// checkout would overwrite.
+		entry.Flags = 0
+		modified, err := isEntryModified(path, entry)
+		if err != nil || !modified {
+			return false, err
+		}
+	}
+	diskHash, err := storage.HashFile(path)
+	if err != nil {
+		return false, err
+	}
+	return diskHash != entry.Hash && diskHash != targetHash, nil
+}
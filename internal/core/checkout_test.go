@@ -1,7 +1,12 @@
 package core
 
 import (
+	"errors"
 	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
 	"testing"
 	"time"
 
@@ -222,3 +227,397 @@ func Test_CheckoutFile_UpdatesIndex(t *testing.T) {
 		t.Errorf("Index has wrong hash. Want %s, got %s", blobHash, storedHash)
 	}
 }
+
+func TestCheckoutCommit_StampsCommitMtime(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	for key, value := range map[string]string{
+		"user.name":      "Test",
+		"user.email":     "test@example.com",
+		"checkout.mtime": CheckoutMtimeCommit,
+	} {
+		if err := SetConfig(key, value, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.WriteFile("a.txt", []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddAll(); err != nil {
+		t.Fatal(err)
+	}
+	commit, _, err := Commit("first")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CheckoutCommit(commit.ID); err != nil {
+		t.Fatalf("CheckoutCommit failed: %v", err)
+	}
+
+	info, err := os.Stat("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().Equal(commit.Timestamp) {
+		t.Errorf("mtime = %v, want commit time %v", info.ModTime(), commit.Timestamp)
+	}
+
+	index, err := storage.LoadIndexWithMeta()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := index["a.txt"]
+	if entry.ModTime != commit.Timestamp.Unix() || entry.Size != 5 {
+		t.Errorf("index metadata not recorded: %+v", entry)
+	}
+}
+
+func TestCheckoutCommit_HardlinksObjects(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("checkout.hardlink falls back to copies on Windows")
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	for key, value := range map[string]string{
+		"user.name":         "Test",
+		"user.email":        "test@example.com",
+		checkoutHardlinkKey: "true",
+	} {
+		if err := SetConfig(key, value, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.WriteFile("a.txt", []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddAll(); err != nil {
+		t.Fatal(err)
+	}
+	commit, _, err := Commit("first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove("a.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CheckoutCommitWithOptions(commit.ID, CheckoutOptions{Force: true}); err != nil {
+		t.Fatalf("CheckoutCommit failed: %v", err)
+	}
+
+	index, err := storage.LoadIndexWithMeta()
+	if err != nil {
+		t.Fatal(err)
+	}
+	objectPath := func(path string) string {
+		return filepath.Join(storage.ResolveObjectsDir(""), index[path].Hash)
+	}
+	sameFile := func(a, b string) bool {
+		t.Helper()
+		ia, err := os.Stat(a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ib, err := os.Stat(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return os.SameFile(ia, ib)
+	}
+
+	if !sameFile("a.txt", objectPath("a.txt")) {
+		t.Error("a.txt is not linked to its object")
+	}
+	if info, _ := os.Stat("a.txt"); info.Mode().Perm()&0o222 != 0 {
+		t.Errorf("linked file is writable: %v", info.Mode())
+	}
+
+	// Replacing a linked file, as editors and kitcat do, leaves the object intact.
+	if err := SafeWrite("a.txt", []byte("edited"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(objectPath("a.txt")); err != nil || string(data) != "hello" {
+		t.Errorf("object content = %q, %v; want %q", data, err, "hello")
+	}
+}
+
+func TestCheckoutCommit_RefusesToDiscardLocalChanges(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	_ = SetConfig("user.name", "Test", false)
+	_ = SetConfig("user.email", "test@example.com", false)
+
+	if err := os.WriteFile("f.txt", []byte("first\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddAll(); err != nil {
+		t.Fatal(err)
+	}
+	first, _, err := Commit("first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("f.txt", []byte("second version\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddAll(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Commit("second"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile("f.txt", []byte("uncommitted edit\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckoutCommit(first.ID); !errors.Is(err, ErrUncommittedChanges) {
+		t.Fatalf("CheckoutCommit over an edited file = %v, want ErrUncommittedChanges", err)
+	}
+	if data, _ := os.ReadFile("f.txt"); string(data) != "uncommitted edit\n" {
+		t.Errorf("f.txt after the refused checkout = %q", data)
+	}
+	if err := CheckoutCommitWithOptions(first.ID, CheckoutOptions{Force: true}); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile("f.txt"); string(data) != "first\n" {
+		t.Errorf("f.txt after a forced checkout = %q", data)
+	}
+}
+
+func TestCheckoutPlan_MatchesCheckoutAndFlagsLostChanges(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	_ = SetConfig("user.name", "Test", false)
+	_ = SetConfig("user.email", "test@example.com", false)
+
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	commitAll := func(message string) {
+		t.Helper()
+		if err := AddAll(); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := Commit(message); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// worktree reads every file outside the repository directory
+	worktree := func() map[string]string {
+		t.Helper()
+		files := make(map[string]string)
+		entries, err := os.ReadDir(".")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range entries {
+			if e.Name() == RepoDir() {
+				continue
+			}
+			data, err := os.ReadFile(e.Name())
+			if err != nil {
+				t.Fatal(err)
+			}
+			files[e.Name()] = string(data)
+		}
+		return files
+	}
+
+	defaultBranch := DefaultBranch()
+	write("keep.txt", "keep\n")
+	write("change.txt", "v1\n")
+	write("gone.txt", "gone\n")
+	commitAll("base")
+	if err := CreateBranch("feature"); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckoutBranch("feature"); err != nil {
+		t.Fatal(err)
+	}
+	write("change.txt", "v2, on feature\n")
+	if err := os.Remove("gone.txt"); err != nil {
+		t.Fatal(err)
+	}
+	write("new.txt", "new\n")
+	commitAll("feature work")
+	if err := CheckoutBranch(defaultBranch); err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := CheckoutPlan("feature")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []CheckoutAction{
+		{Path: "change.txt", Op: CheckoutOverwrite},
+		{Path: "gone.txt", Op: CheckoutDelete},
+		{Path: "new.txt", Op: CheckoutCreate},
+	}
+	if !reflect.DeepEqual(plan, want) {
+		t.Fatalf("CheckoutPlan(feature) = %+v, want %+v", plan, want)
+	}
+
+	// The plan is what CheckoutBranch then does to the working tree
+	before := worktree()
+	if err := CheckoutBranch("feature"); err != nil {
+		t.Fatal(err)
+	}
+	after := worktree()
+	var done []CheckoutAction
+	for path, content := range after {
+		old, existed := before[path]
+		switch {
+		case !existed:
+			done = append(done, CheckoutAction{Path: path, Op: CheckoutCreate})
+		case old != content:
+			done = append(done, CheckoutAction{Path: path, Op: CheckoutOverwrite})
+		}
+	}
+	for path := range before {
+		if _, ok := after[path]; !ok {
+			done = append(done, CheckoutAction{Path: path, Op: CheckoutDelete})
+		}
+	}
+	sort.Slice(done, func(i, j int) bool { return done[i].Path < done[j].Path })
+	if !reflect.DeepEqual(done, plan) {
+		t.Errorf("CheckoutBranch(feature) did %+v, the plan said %+v", done, plan)
+	}
+
+	// Local edits, an untracked file in the way, and edits hidden by assume-unchanged
+	// would all be lost; an edit that already matches the target would not
+	if err := CheckoutBranch(defaultBranch); err != nil {
+		t.Fatal(err)
+	}
+	write("gone.txt", "edited before being deleted\n")
+	write("new.txt", "untracked\n")
+	write("change.txt", "v2, on feature\n")
+	write("keep.txt", "edited but assumed unchanged\n")
+	if err := SetIndexFlag("keep.txt", storage.FlagAssumeUnchanged, true); err != nil {
+		t.Fatal(err)
+	}
+	if plan, err = CheckoutPlan("feature"); err != nil {
+		t.Fatal(err)
+	}
+	want = []CheckoutAction{
+		{Path: "change.txt", Op: CheckoutOverwrite},
+		{Path: "gone.txt", Op: CheckoutDelete, LosesLocalChanges: true},
+		{Path: "keep.txt", Op: CheckoutOverwrite, LosesLocalChanges: true},
+		{Path: "new.txt", Op: CheckoutCreate, LosesLocalChanges: true},
+	}
+	if !reflect.DeepEqual(plan, want) {
+		t.Errorf("CheckoutPlan(feature) with local changes = %+v, want %+v", plan, want)
+	}
+}
+
+func TestCheckoutPlan_SkipsEmptyDirPlaceholders(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	_ = SetConfig("user.name", "Test", false)
+	_ = SetConfig("user.email", "test@example.com", false)
+	_ = SetConfig(trackEmptyDirsKey, "true", false)
+
+	commitAll := func(message string) {
+		t.Helper()
+		if err := AddAll(); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := Commit(message); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile("a.txt", []byte("a\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	commitAll("base")
+	defaultBranch := DefaultBranch()
+	if err := CreateBranch("feature"); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckoutBranch("feature"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir("build", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	commitAll("empty build directory")
+	if err := CheckoutBranch(defaultBranch); err != nil {
+		t.Fatal(err)
+	}
+
+	// Neither creating nor removing the empty directory writes or deletes a file
+	for _, target := range []string{"feature", defaultBranch} {
+		plan, err := CheckoutPlan(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(plan) != 0 {
+			t.Errorf("CheckoutPlan(%s) = %+v, want nothing", target, plan)
+		}
+		if err := CheckoutBranch(target); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -6,7 +6,6 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
-	"strings"
 
 	"github.com/LeeFred3042U/kitcat/internal/storage"
 )
@@ -16,7 +15,7 @@ import (
 // If includeIgnored is true, ignored files are also removed
 func Clean(dryRun bool, includeIgnored bool) error {
 	// Guard: ensure we're inside a kitcat repo
-	if _, err := os.Stat(RepoDir); os.IsNotExist(err) {
+	if _, err := os.Stat(RepoDir()); os.IsNotExist(err) {
 		return errors.New("not a kitcat repository (run `kitcat init`)")
 	}
 
@@ -38,10 +37,10 @@ func Clean(dryRun bool, includeIgnored bool) error {
 			return err
 		}
 
-		clean := filepath.Clean(path)
+		clean := storage.IndexKey(path)
 
 		// skip the repo dir and everything under it
-		if clean == RepoDir || strings.HasPrefix(clean, RepoDir+string(os.PathSeparator)) {
+		if inRepoDir(clean) {
 			if info.IsDir() {
 				return filepath.SkipDir
 			}
@@ -62,7 +61,7 @@ func Clean(dryRun bool, includeIgnored bool) error {
 		// if not tracked, remove (or print if dry run)
 		if _, tracked := index[clean]; !tracked {
 			// Check if file is ignored
-			isIgnored := ShouldIgnore(clean, ignorePatterns, index)
+			isIgnored := ShouldIgnoreInfo(clean, info, ignorePatterns, index)
 
 			// Skip ignored files unless -x flag is set
 			if isIgnored && !includeIgnored {
@@ -0,0 +1,65 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LeeFred3042U/kitcat/internal/models"
+)
+
+// EnvAuthorDate fixes the timestamp of new commits, so the same tree, parent and message
+// always produce the same commit hash. It takes RFC 3339 (2024-01-02T15:04:05Z) or Unix
+// seconds, optionally prefixed with '@'.
+const EnvAuthorDate = "KITCAT_AUTHOR_DATE"
+
+// Now is the clock kitcat reads whenever it records a time: commit and stash timestamps and
+// operation log entries. Tests replace it to freeze time. Filesystem comparisons (mtimes,
+// lock timeouts) keep using the real clock, since they are measured against the OS.
+var Now = time.Now
+
+// commitTime returns the timestamp for a new commit, in UTC, and the author's UTC offset
+// for Commit.TimeZone: $KITCAT_AUTHOR_DATE when set, with the offset it gives ("+0000"
+// for Unix seconds), otherwise the current time from Now in its own zone.
+func commitTime() (time.Time, string, error) {
+	date := strings.TrimSpace(os.Getenv(EnvAuthorDate))
+	if date == "" {
+		now := Now()
+		return now.UTC(), now.Format(timeZoneLayout), nil
+	}
+	if secs, err := strconv.ParseInt(strings.TrimPrefix(date, "@"), 10, 64); err == nil {
+		return time.Unix(secs, 0).UTC(), "+0000", nil
+	}
+	t, err := time.Parse(time.RFC3339, date)
+	if err != nil {
+		return time.Time{}, "", fmt.Errorf("invalid %s %q: use RFC 3339 or Unix seconds", EnvAuthorDate, date)
+	}
+	return t.UTC(), t.Format(timeZoneLayout), nil
+}
+
+// timeZoneLayout formats a UTC offset as Commit.TimeZone stores it.
+const timeZoneLayout = "-0700"
+
+// authorDate returns a commit's timestamp in the zone it was made in, or in the local zone
+// for commits that did not record one.
+func authorDate(c models.Commit) time.Time {
+	if c.TimeZone != "" {
+		if zone, err := time.Parse(timeZoneLayout, c.TimeZone); err == nil {
+			return c.Timestamp.In(zone.Location())
+		}
+	}
+	return c.Timestamp.Local()
+}
+
+// warnClockSkew warns when a new commit is dated before its parent, which, since history
+// only moves forward, means a clock was wrong when one of them was made. The commit is
+// still made: dates are informational, and ordering by parent links is unaffected.
+func warnClockSkew(timestamp time.Time, parent models.Commit) {
+	if !timestamp.Before(parent.Timestamp) {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "warning: commit date %s is earlier than its parent's (%s); check the system clock\n",
+		timestamp.Format(time.RFC3339), parent.Timestamp.UTC().Format(time.RFC3339))
+}
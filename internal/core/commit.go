@@ -5,8 +5,6 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
 	"strings"
 	"time"
 
@@ -29,6 +27,11 @@ func hashCommit(c models.Commit) string {
 // Commit creates a new snapshot of the repository based on the current state of the index
 // It prevents empty commits and returns the full commit object and a formatted summary
 func Commit(message string) (models.Commit, string, error) {
+	return commit(message, nil)
+}
+
+// commit implements Commit, under locks when it runs in a Batch.
+func commit(message string, locks *heldLocks) (models.Commit, string, error) {
 	authorName, _, _ := GetConfig("user.name")
 	authorEmail, _, _ := GetConfig("user.email")
 
@@ -36,11 +39,98 @@ func Commit(message string) (models.Commit, string, error) {
 		return models.Commit{}, "", fmt.Errorf("author identity not configured. Please set user.name and user.email:\n  kitcat config user.name \"Your Name\"\n  kitcat config user.email \"you@example.com\"")
 	}
 
+	repoLock, err := locks.lockRepoShared()
+	if err != nil {
+		return models.Commit{}, "", err
+	}
+	defer repoLock.Unlock()
+
 	treeHash, err := storage.CreateTree()
 	if err != nil {
 		return models.Commit{}, "", err
 	}
+	return commitTree(message, treeHash, authorName, authorEmail)
+}
+
+// CommitPaths commits the staged state of only the given paths, leaving everything else
+// staged (the equivalent of `git commit -- <paths>` for the index). Each path selects an
+// index entry or, for a directory, every entry below it.
+//
+// The new tree is the parent's tree with the selected paths replaced by their staged
+// versions; a selected path that the parent has but the index no longer does is deleted.
+// Every other path keeps the parent's content, so changes staged for it are not part of
+// the commit. The index itself is not modified: the committed entries now match HEAD and
+// the remaining ones still show up as staged. A path that matches nothing in either the
+// index or the parent is an error.
+func CommitPaths(message string, paths []string) (models.Commit, string, error) {
+	authorName, _, _ := GetConfig("user.name")
+	authorEmail, _, _ := GetConfig("user.email")
+
+	if authorName == "" || authorEmail == "" {
+		return models.Commit{}, "", fmt.Errorf("author identity not configured. Please set user.name and user.email:\n  kitcat config user.name \"Your Name\"\n  kitcat config user.email \"you@example.com\"")
+	}
+	if len(paths) == 0 {
+		return models.Commit{}, "", errors.New("no paths given")
+	}
+	repoLock, err := storage.LockRepoShared()
+	if err != nil {
+		return models.Commit{}, "", err
+	}
+	defer repoLock.Unlock()
+
+	index, err := storage.LoadIndexWithMeta()
+	if err != nil {
+		return models.Commit{}, "", err
+	}
+	tree := make(map[string]string)
+	modes := make(map[string]uint32)
+	if parentCommit, err := GetHeadCommit(); err == nil {
+		if tree, err = storage.ParseTree(parentCommit.TreeHash); err != nil {
+			return models.Commit{}, "", err
+		}
+		if modes, err = storage.ParseTreeModes(parentCommit.TreeHash); err != nil {
+			return models.Commit{}, "", err
+		}
+	}
+
+	for _, p := range paths {
+		spec := storage.IndexKey(p)
+		matched := false
+		for path := range tree {
+			if matchesPathspec(path, spec) {
+				delete(tree, path)
+				delete(modes, path)
+				matched = true
+			}
+		}
+		for path, entry := range index {
+			if matchesPathspec(path, spec) {
+				tree[path] = entry.Hash
+				if entry.Mode != 0 {
+					modes[path] = entry.Mode
+				}
+				matched = true
+			}
+		}
+		if !matched {
+			return models.Commit{}, "", fmt.Errorf("pathspec '%s' did not match any file(s) known to kitcat", p)
+		}
+	}
+
+	treeHash, err := storage.WriteTreeWithModes(tree, modes)
+	if err != nil {
+		return models.Commit{}, "", err
+	}
+	return commitTree(message, treeHash, authorName, authorEmail)
+}
 
+// matchesPathspec reports whether an index path is spec itself or lies below it.
+func matchesPathspec(path, spec string) bool {
+	return spec == "." || path == spec || strings.HasPrefix(path, spec+"/")
+}
+
+// commitTree records a commit of treeHash on top of HEAD and advances HEAD to it.
+func commitTree(message, treeHash, authorName, authorEmail string) (models.Commit, string, error) {
 	var parentID, parentTreeHash string
 	parentCommit, err := GetHeadCommit()
 	// If error, we assume root commit (no parent) unless critical system error
@@ -53,40 +143,35 @@ func Commit(message string) (models.Commit, string, error) {
 	if treeHash == parentTreeHash {
 		return models.Commit{}, "", errors.New("nothing to commit, working tree clean")
 	}
+	timestamp, timeZone, err := commitTime()
+	if err != nil {
+		return models.Commit{}, "", err
+	}
+	if parentID != "" {
+		warnClockSkew(timestamp, parentCommit)
+	}
 
 	commit := models.Commit{
 		Parent:      parentID,
 		Message:     message,
-		Timestamp:   time.Now().UTC(),
+		Timestamp:   timestamp,
 		TreeHash:    treeHash,
 		AuthorName:  authorName,
 		AuthorEmail: authorEmail,
+		TimeZone:    timeZone,
 	}
 	commit.ID = hashCommit(commit)
-
-	if err := storage.AppendCommit(commit); err != nil {
+	if err := signCommit(&commit); err != nil {
 		return models.Commit{}, "", err
 	}
 
-	refPath, err := getCurrentBranchRefPath()
-	if err != nil {
-		headData, readErr := os.ReadFile(".kitcat/HEAD")
-		if readErr != nil {
-			return models.Commit{}, "", fmt.Errorf("could not read HEAD: %w", readErr)
-		}
-		ref := strings.TrimSpace(string(headData))
-		if !strings.HasPrefix(ref, "ref: ") {
-			return models.Commit{}, "", fmt.Errorf("cannot commit in detached HEAD state")
-		}
-		refPath = strings.TrimPrefix(ref, "ref: ")
-		if err := os.MkdirAll(filepath.Dir(filepath.Join(".kitcat", refPath)), 0o755); err != nil {
-			return models.Commit{}, "", fmt.Errorf("could not create refs directory: %w", err)
-		}
+	if err := storage.AppendCommit(commit); err != nil {
+		return models.Commit{}, "", err
 	}
 
-	branchFilePath := filepath.Join(".kitcat", refPath)
-	if err := SafeWrite(branchFilePath, []byte(commit.ID), 0o644); err != nil {
-		return models.Commit{}, "", fmt.Errorf("failed to update branch pointer: %w", err)
+	// Advance the current branch, or HEAD itself when detached
+	if err := moveHead(commit.ID); err != nil {
+		return models.Commit{}, "", err
 	}
 
 	parentTree := make(map[string]string)
@@ -95,50 +180,72 @@ func Commit(message string) (models.Commit, string, error) {
 	}
 	newTree, _ := storage.ParseTree(treeHash)
 	summary, _ := GenerateCommitSummary(parentTree, newTree)
+	recordOp("commit", []string{commit.ID}, changedPaths(parentTree, newTree))
 
 	return commit, summary, nil
 }
 
-// AmendCommit updates the message of the most recent commit without changing files.
-// It loads the last commit, updates its message, re-hashes it, and updates the branch pointer.
-func AmendCommit(newMessage string) (models.Commit, error) {
-	// Get the last commit
-	lastCommit, err := storage.GetLastCommit()
+// CommitAmend replaces the HEAD commit with one built from the current index, so files staged
+// since are folded in. The original parent, author and timestamp are kept; an empty
+// newMessage keeps the original message too. The replaced commit stays in the commit log
+// and can be recovered by its hash.
+// It refuses when there is no commit yet or while a rebase is in progress.
+func CommitAmend(newMessage string) (models.Commit, error) {
+	if IsRebaseInProgress() {
+		return models.Commit{}, errors.New("cannot amend while a rebase is in progress")
+	}
+	headCommit, err := GetHeadCommit()
 	if err != nil {
-		if err == storage.ErrNoCommits {
+		if errors.Is(err, storage.ErrNoCommits) {
 			return models.Commit{}, errors.New("no commits to amend")
 		}
-		return models.Commit{}, fmt.Errorf("failed to get last commit: %w", err)
+		return models.Commit{}, fmt.Errorf("failed to read HEAD commit: %w", err)
+	}
+	repoLock, err := storage.LockRepoShared()
+	if err != nil {
+		return models.Commit{}, err
+	}
+	defer repoLock.Unlock()
+
+	treeHash, err := storage.CreateTree()
+	if err != nil {
+		return models.Commit{}, err
+	}
+
+	message := newMessage
+	if strings.TrimSpace(message) == "" {
+		message = headCommit.Message
 	}
 
-	// Create a new commit with the updated message but same tree and parent
 	amendedCommit := models.Commit{
-		Parent:      lastCommit.Parent,
-		Message:     newMessage,
-		Timestamp:   lastCommit.Timestamp, // Keep original timestamp
-		TreeHash:    lastCommit.TreeHash,  // Same files
-		AuthorName:  lastCommit.AuthorName,
-		AuthorEmail: lastCommit.AuthorEmail,
+		Parent:      headCommit.Parent,
+		Message:     message,
+		Timestamp:   headCommit.Timestamp.UTC(), // Keep original timestamp
+		TreeHash:    treeHash,
+		AuthorName:  headCommit.AuthorName,
+		AuthorEmail: headCommit.AuthorEmail,
+		TimeZone:    headCommit.TimeZone,
 	}
 
 	// Re-hash the commit (this generates a new ID)
 	amendedCommit.ID = hashCommit(amendedCommit)
+	if amendedCommit.ID == headCommit.ID {
+		return headCommit, nil
+	}
+	if err := signCommit(&amendedCommit); err != nil {
+		return models.Commit{}, err
+	}
 
 	// Save the amended commit
 	if err := storage.AppendCommit(amendedCommit); err != nil {
 		return models.Commit{}, fmt.Errorf("failed to save amended commit: %w", err)
 	}
 
-	// Update the branch pointer to the new commit ID
-	refPath, err := getCurrentBranchRefPath()
-	if err != nil {
-		return models.Commit{}, fmt.Errorf("failed to get current branch: %w", err)
-	}
-
-	branchFilePath := filepath.Join(".kitcat", refPath)
-	if err := SafeWrite(branchFilePath, []byte(amendedCommit.ID), 0o644); err != nil {
-		return models.Commit{}, fmt.Errorf("failed to update branch pointer: %w", err)
+	// Update the branch pointer (or detached HEAD) to the new commit ID
+	if err := moveHead(amendedCommit.ID); err != nil {
+		return models.Commit{}, err
 	}
+	recordOp("commit --amend", []string{headCommit.ID, amendedCommit.ID}, nil)
 
 	return amendedCommit, nil
 }
@@ -151,18 +258,6 @@ func CommitAll(message string) (models.Commit, string, error) {
 	return Commit(message)
 }
 
-func getCurrentBranchRefPath() (string, error) {
-	headData, err := os.ReadFile(".kitcat/HEAD")
-	if err != nil {
-		return "", err
-	}
-	ref := strings.TrimSpace(string(headData))
-	if !strings.HasPrefix(ref, "ref: ") {
-		return "", fmt.Errorf("invalid HEAD format: %s", ref)
-	}
-	return strings.TrimPrefix(ref, "ref: "), nil
-}
-
 // pluralize is a simple helper for the summary string
 func pluralize(count int) string {
 	if count == 1 {
@@ -199,8 +294,7 @@ func GenerateCommitSummary(parentTree, newTree map[string]string) (string, error
 			filesChanged++
 			oldContent, _ := storage.ReadObject(oldHash)
 			newContent, _ := storage.ReadObject(newHash)
-			d := diff.NewMyersDiff(strings.Split(string(oldContent), "\n"), strings.Split(string(newContent), "\n"))
-			for _, chk := range d.Diffs() {
+			for _, chk := range diff.Compute(diffAlgorithm(), strings.Split(string(oldContent), "\n"), strings.Split(string(newContent), "\n")) {
 				if chk.Operation == diff.INSERT {
 					insertions += len(chk.Text)
 				}
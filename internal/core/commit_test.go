@@ -0,0 +1,310 @@
+package core
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LeeFred3042U/kitcat/internal/models"
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+func TestCommitPaths_CommitsOnlySelectedPaths(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	_ = SetConfig("user.name", "Test", false)
+	_ = SetConfig("user.email", "test@example.com", false)
+
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.MkdirAll("docs", 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a.txt", "a1")
+	write("b.txt", "b1")
+	write("docs/gone.md", "old")
+	if err := AddAll(); err != nil {
+		t.Fatal(err)
+	}
+	base, _, err := Commit("base")
+	if err != nil {
+		t.Fatal(err)
+	}
+	baseTree, err := storage.ParseTree(base.TreeHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write("a.txt", "a2 changed")
+	write("b.txt", "b2 changed")
+	if err := os.Remove("docs/gone.md"); err != nil {
+		t.Fatal(err)
+	}
+	write("docs/new.md", "new")
+	if err := AddAll(); err != nil {
+		t.Fatal(err)
+	}
+	index, err := storage.LoadIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	commit, _, err := CommitPaths("partial", []string{"a.txt", "docs"})
+	if err != nil {
+		t.Fatalf("CommitPaths failed: %v", err)
+	}
+	tree, err := storage.ParseTree(commit.TreeHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"a.txt":       index["a.txt"],    // selected: staged version
+		"b.txt":       baseTree["b.txt"], // not selected: parent version
+		"docs/new.md": index["docs/new.md"],
+	}
+	if len(tree) != len(want) {
+		t.Fatalf("tree = %v, want %v", tree, want)
+	}
+	for path, hash := range want {
+		if tree[path] != hash {
+			t.Errorf("tree[%s] = %s, want %s", path, tree[path], hash)
+		}
+	}
+
+	// The index is untouched, so b.txt is still staged.
+	after, err := storage.LoadIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after["b.txt"] != index["b.txt"] || len(after) != len(index) {
+		t.Errorf("index changed: %v, was %v", after, index)
+	}
+
+	if _, _, err := CommitPaths("none", []string{"missing.txt"}); err == nil {
+		t.Error("expected an error for an unmatched pathspec")
+	}
+}
+
+func TestCommitAmend_FoldsInStagedChanges(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	_ = SetConfig("user.name", "Test", false)
+	_ = SetConfig("user.email", "test@example.com", false)
+
+	if _, err := CommitAmend("nothing yet"); err == nil {
+		t.Fatal("expected an error amending with no commits")
+	}
+
+	if err := os.WriteFile("a.txt", []byte("a1"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddAll(); err != nil {
+		t.Fatal(err)
+	}
+	first, _, err := Commit("first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("b.txt", []byte("b1"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddAll(); err != nil {
+		t.Fatal(err)
+	}
+	second, _, err := Commit("second")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile("c.txt", []byte("c1"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddAll(); err != nil {
+		t.Fatal(err)
+	}
+	amended, err := CommitAmend("")
+	if err != nil {
+		t.Fatalf("CommitAmend failed: %v", err)
+	}
+	if amended.ID == second.ID {
+		t.Fatal("amend did not create a new commit")
+	}
+	if amended.Parent != first.ID {
+		t.Errorf("parent = %s, want %s", amended.Parent, first.ID)
+	}
+	if amended.Message != "second" || amended.AuthorName != second.AuthorName {
+		t.Errorf("message/author not kept: %+v", amended)
+	}
+	tree, err := storage.ParseTree(amended.TreeHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tree["c.txt"]; !ok || len(tree) != 3 {
+		t.Errorf("tree = %v, want a.txt, b.txt and c.txt", tree)
+	}
+	head, err := GetHeadCommit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head.ID != amended.ID {
+		t.Errorf("HEAD = %s, want %s", head.ID, amended.ID)
+	}
+
+	reworded, err := CommitAmend("second, reworded")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reworded.Message != "second, reworded" || reworded.Parent != first.ID {
+		t.Errorf("reworded = %+v", reworded)
+	}
+}
+
+func TestCommit_UsesInjectedClockAndAuthorDate(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	defer func(prev func() time.Time) { Now = prev }(Now)
+
+	// commitIn records the same file and message in a fresh repository.
+	commitIn := func() models.Commit {
+		t.Helper()
+		if err := os.Chdir(t.TempDir()); err != nil {
+			t.Fatal(err)
+		}
+		if err := InitRepo(); err != nil {
+			t.Fatal(err)
+		}
+		_ = SetConfig("user.name", "Test", false)
+		_ = SetConfig("user.email", "test@example.com", false)
+		if err := os.WriteFile("a.txt", []byte("same"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := AddFile("a.txt"); err != nil {
+			t.Fatal(err)
+		}
+		commit, _, err := Commit("reproducible")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return commit
+	}
+
+	frozen := time.Date(2024, 1, 2, 16, 4, 5, 0, time.FixedZone("CET", 3600))
+	Now = func() time.Time { return frozen }
+	first := commitIn()
+	if !first.Timestamp.Equal(frozen) || first.Timestamp.Location() != time.UTC {
+		t.Errorf("timestamp = %v, want %v in UTC", first.Timestamp, frozen)
+	}
+	if first.TimeZone != "+0100" {
+		t.Errorf("time zone = %q, want +0100", first.TimeZone)
+	}
+	if second := commitIn(); second.ID != first.ID {
+		t.Errorf("frozen clock gave different hashes %s and %s", first.ID, second.ID)
+	}
+
+	Now = time.Now
+	t.Setenv(EnvAuthorDate, "@1704207845")
+	if viaEnv := commitIn(); viaEnv.ID != first.ID {
+		t.Errorf("%s commit = %s, want %s", EnvAuthorDate, viaEnv.ID, first.ID)
+	}
+	t.Setenv(EnvAuthorDate, "2024-01-02T15:04:05Z")
+	if viaEnv := commitIn(); viaEnv.ID != first.ID {
+		t.Errorf("%s commit (RFC 3339) = %s, want %s", EnvAuthorDate, viaEnv.ID, first.ID)
+	}
+	t.Setenv(EnvAuthorDate, "2024-01-02T10:34:05-04:30")
+	if viaEnv := commitIn(); viaEnv.ID != first.ID || viaEnv.TimeZone != "-0430" {
+		t.Errorf("%s commit with offset = %s in %q, want %s in -0430", EnvAuthorDate, viaEnv.ID, viaEnv.TimeZone, first.ID)
+	}
+	t.Setenv(EnvAuthorDate, "yesterday")
+	if _, _, err := commitTime(); err == nil {
+		t.Error("invalid author date accepted")
+	}
+}
+
+func TestCommit_ShowsAuthorZoneAndWarnsOnClockSkew(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	defer func(prev func() time.Time) { Now = prev }(Now)
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	_ = SetConfig("user.name", "Test", false)
+	_ = SetConfig("user.email", "test@example.com", false)
+
+	commitAt := func(at time.Time, content string) models.Commit {
+		t.Helper()
+		Now = func() time.Time { return at }
+		if err := os.WriteFile("a.txt", []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := AddFile("a.txt"); err != nil {
+			t.Fatal(err)
+		}
+		commit, _, err := Commit(content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return commit
+	}
+
+	tokyo := time.FixedZone("JST", 9*3600)
+	first := commitAt(time.Date(2024, 5, 1, 9, 0, 0, 0, tokyo), "first")
+	if got := authorDate(first).Format("15:04 -0700"); got != "09:00 +0900" {
+		t.Errorf("author date = %s, want 09:00 +0900", got)
+	}
+
+	oldStderr := os.Stderr
+	r, w, _ := os.Pipe()
+	os.Stderr = w
+	skewed := commitAt(time.Date(2024, 5, 1, 8, 0, 0, 0, tokyo), "second")
+	w.Close()
+	os.Stderr = oldStderr
+	out, _ := io.ReadAll(r)
+
+	if skewed.Parent != first.ID {
+		t.Fatalf("parent = %s, want %s", skewed.Parent, first.ID)
+	}
+	if !strings.Contains(string(out), "earlier than its parent's") {
+		t.Errorf("no clock skew warning, stderr %q", out)
+	}
+}
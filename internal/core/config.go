@@ -3,11 +3,158 @@ package core
 import (
 	"bufio"
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+// indexCompressKey enables gzip compression of the index file when set to true.
+const indexCompressKey = "index.compress"
+
+// indexPrettyKey indents the index JSON for people inspecting it. Off by default: the
+// compact form is smaller and faster to write.
+const indexPrettyKey = "index.pretty"
+
+// indexRecordOpsKey records every index write in .kitcat/index-ops, for reproducing index
+// bugs with replay-index-ops; see storage.IndexOp. Off by default.
+const indexRecordOpsKey = "index.recordOps"
+
+// objectsDirKey relocates the object store; see storage.ResolveObjectsDir.
+const objectsDirKey = "core.objectsDir"
+
+// tempDirKey sets where atomic writes stage their temporary files; see
+// storage.SafeWriteFile. Unset means next to each target, which is always safe.
+const tempDirKey = "core.tempDir"
+
+// mmapThresholdKey sets the file size, e.g. "64m", from which files are hashed through a
+// memory map; see storage.MmapThreshold. Unset or 0 always streams.
+const mmapThresholdKey = "core.mmapThreshold"
+
+// objectNameLengthKey shortens loose object names to that many hex digits of the hash, e.g.
+// "16", for checkouts whose paths would otherwise exceed a path limit; see
+// storage.ObjectNameLength. Unset or invalid means full-length names.
+const objectNameLengthKey = "core.objectNameLength"
+
+// objectDurabilityKey chooses how new objects are synced to disk: "full", "batched" (default)
+// or "none"; see storage.ObjectDurability for what each risks in a crash.
+const objectDurabilityKey = "core.objectDurability"
+
+// renameRetriesKey and renameBackoffKey tune how atomic writes retry a rename that failed
+// transiently, e.g. "8" and "50ms"; see storage.RenameRetry. Invalid values fall back to
+// the defaults of 5 and 10ms, and 0 retries turns retrying off.
+const (
+	renameRetriesKey = "core.renameRetries"
+	renameBackoffKey = "core.renameBackoff"
+)
+
+func init() {
+	storage.IndexCompression = func() bool {
+		return GetConfigBool(indexCompressKey, false)
+	}
+	storage.IndexPretty = func() bool {
+		return GetConfigBool(indexPrettyKey, false)
+	}
+	storage.RecordIndexOps = func() bool {
+		return GetConfigBool(indexRecordOpsKey, false)
+	}
+	storage.ObjectsDirConfig = func() string {
+		value, _, err := GetConfig(objectsDirKey)
+		if err != nil {
+			return ""
+		}
+		return value
+	}
+	storage.TempDirConfig = func() string {
+		value, _, err := GetConfig(tempDirKey)
+		if err != nil || value == "" {
+			return ""
+		}
+		// Relative to the working-tree root, like core.objectsDir
+		return storage.WorkTreePath(value)
+	}
+	storage.MmapThreshold = func() int64 {
+		value, found, err := GetConfig(mmapThresholdKey)
+		if err != nil || !found {
+			return 0
+		}
+		size, err := parseByteSize(value)
+		if err != nil {
+			return 0
+		}
+		return size
+	}
+	storage.ObjectNameLength = func() int {
+		value, found, err := GetConfig(objectNameLengthKey)
+		if err != nil || !found {
+			return 0
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return 0
+		}
+		return n
+	}
+	storage.ObjectDurability = func() string {
+		value, _, _ := GetConfig(objectDurabilityKey)
+		return value
+	}
+	storage.RenameRetry = func() (int, time.Duration) {
+		retries, backoff := storage.DefaultRenameRetries, storage.DefaultRenameBackoff
+		if value, found, err := GetConfig(renameRetriesKey); err == nil && found {
+			if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+				retries = n
+			}
+		}
+		if value, found, err := GetConfig(renameBackoffKey); err == nil && found {
+			if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+				backoff = d
+			}
+		}
+		return retries, backoff
+	}
+}
+
+// configOverrides take precedence over both config files; see SetConfigOverrides.
+var (
+	configOverridesMu sync.RWMutex
+	configOverrides   map[string]string
 )
 
+// SetConfigOverrides makes values take precedence over the local and global config files
+// for every config read that follows in this process, e.g. to turn off core.trustMtime
+// for a single command (kitcat -c core.trustMtime=false add .). Overrides are never
+// written to disk: SetConfig still updates only the file. It replaces any earlier
+// overrides and returns a function that puts them back.
+func SetConfigOverrides(values map[string]string) (restore func()) {
+	configOverridesMu.Lock()
+	defer configOverridesMu.Unlock()
+	prev := configOverrides
+	configOverrides = maps.Clone(values)
+	clearConfigCache()
+	return func() {
+		configOverridesMu.Lock()
+		defer configOverridesMu.Unlock()
+		configOverrides = prev
+		clearConfigCache()
+	}
+}
+
+// ParseConfigOverride splits a "key=value" command-line override. The value may be empty.
+func ParseConfigOverride(arg string) (key, value string, err error) {
+	key, value, ok := strings.Cut(arg, "=")
+	key = strings.TrimSpace(key)
+	if !ok || key == "" {
+		return "", "", fmt.Errorf("invalid config override %q: expected key=value", arg)
+	}
+	return key, strings.TrimSpace(value), nil
+}
+
 // getConfigPath returns the absolute path to the global kitcat config file
 func getConfigPath() (string, error) {
 	homeDir, err := os.UserHomeDir()
@@ -19,7 +166,7 @@ func getConfigPath() (string, error) {
 
 // getLocalConfigPath returns the absolute path to the local repository config file
 func getLocalConfigPath() (string, error) {
-	localConfigPath := filepath.Join(RepoDir, "config")
+	localConfigPath := filepath.Join(RepoDir(), "config")
 	return localConfigPath, nil
 }
 
@@ -48,6 +195,58 @@ func readConfigFromPath(path string) (map[string]string, error) {
 	return config, scanner.Err()
 }
 
+// Cache of parsed config files, keyed by absolute path and invalidated on size/mtime change,
+// so that the storage hooks consulted for every object written or looked up do not re-read
+// both files each time. SetConfig and SetConfigOverrides clear it.
+var (
+	configCacheMu sync.Mutex
+	configCache   = make(map[string]cachedConfig)
+)
+
+type cachedConfig struct {
+	size    int64
+	modTime int64
+	config  map[string]string
+}
+
+// readConfigCached is readConfigFromPath through configCache. The returned map is shared
+// and must not be modified.
+func readConfigCached(path string) (map[string]string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(absPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	configCacheMu.Lock()
+	defer configCacheMu.Unlock()
+
+	if cached, ok := configCache[absPath]; ok &&
+		cached.size == info.Size() && cached.modTime == info.ModTime().UnixNano() {
+		return cached.config, nil
+	}
+	config, err := readConfigFromPath(absPath)
+	if err != nil {
+		return nil, err
+	}
+	configCache[absPath] = cachedConfig{size: info.Size(), modTime: info.ModTime().UnixNano(), config: config}
+	return config, nil
+}
+
+// clearConfigCache drops every cached config file, for writes that the size and mtime
+// might not reveal, such as two within one clock tick.
+func clearConfigCache() {
+	configCacheMu.Lock()
+	defer configCacheMu.Unlock()
+	clear(configCache)
+}
+
 // readConfig loads the global config file into a map
 func readConfig() (map[string]string, error) {
 	path, err := getConfigPath()
@@ -85,6 +284,7 @@ func SetConfig(key, value string, global bool) error {
 	if err != nil {
 		return fmt.Errorf("could not read existing config: %w", err)
 	}
+	defer clearConfigCache()
 
 	// Update the map with the new key-value pair
 	config[key] = value
@@ -110,7 +310,7 @@ func SetConfig(key, value string, global bool) error {
 // Returns ("", false, nil) if not found or file doesn't exist
 // Returns error only on real I/O failure
 func readKey(path, key string) (string, bool, error) {
-	config, err := readConfigFromPath(path)
+	config, err := readConfigCached(path)
 	if err != nil {
 		// Missing file is not an error
 		if os.IsNotExist(err) {
@@ -122,8 +322,16 @@ func readKey(path, key string) (string, bool, error) {
 	return value, ok, nil
 }
 
-// GetConfig reads a key from the config file (local first, then global)
+// GetConfig reads a key from the config file (local first, then global).
+// Overrides set with SetConfigOverrides come before both.
 func GetConfig(key string) (string, bool, error) {
+	configOverridesMu.RLock()
+	value, overridden := configOverrides[key]
+	configOverridesMu.RUnlock()
+	if overridden {
+		return value, true, nil
+	}
+
 	// 1. Try local config first
 	localPath, err := getLocalConfigPath()
 	if err != nil {
@@ -143,6 +351,20 @@ func GetConfig(key string) (string, bool, error) {
 	return readKey(globalPath, key)
 }
 
+// GetConfigBool reads a boolean key (local first, then global).
+// Returns def when the key is unset or its value cannot be parsed as a boolean.
+func GetConfigBool(key string, def bool) bool {
+	value, found, err := GetConfig(key)
+	if err != nil || !found {
+		return def
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return def
+	}
+	return b
+}
+
 // PrintAllConfig prints all key-value pairs in the config file
 func PrintAllConfig() error {
 	config, err := readConfig()
@@ -0,0 +1,150 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+func TestSetConfigOverrides(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetConfig("user.name", "File", false); err != nil {
+		t.Fatal(err)
+	}
+	configPath := filepath.Join(RepoDir(), "config")
+	before, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restore := SetConfigOverrides(map[string]string{"user.name": "Override", "core.trustMtime": "false"})
+	if v, ok, err := GetConfig("user.name"); err != nil || !ok || v != "Override" {
+		t.Errorf("GetConfig(user.name) = %q, %v, %v; want the override", v, ok, err)
+	}
+	if GetConfigBool("core.trustMtime", true) {
+		t.Error("GetConfigBool(core.trustMtime) ignored the override")
+	}
+	after, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(after) != string(before) {
+		t.Errorf("overrides were written to the config file:\n%s", after)
+	}
+
+	restore()
+	if v, _, _ := GetConfig("user.name"); v != "File" {
+		t.Errorf("after restore, user.name = %q, want File", v)
+	}
+	if _, ok, _ := GetConfig("core.trustMtime"); ok {
+		t.Error("after restore, core.trustMtime is still set")
+	}
+
+	for _, arg := range []string{"user.name", "=x", ""} {
+		if _, _, err := ParseConfigOverride(arg); err == nil {
+			t.Errorf("ParseConfigOverride(%q) succeeded", arg)
+		}
+	}
+	if k, v, err := ParseConfigOverride("core.editor=vim -n"); err != nil || k != "core.editor" || v != "vim -n" {
+		t.Errorf("ParseConfigOverride = %q, %q, %v", k, v, err)
+	}
+}
+
+func TestGetConfig_SeesEveryWrite(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	first, second := t.TempDir(), t.TempDir()
+	for _, dir := range []string{first, second} {
+		if err := os.Chdir(dir); err != nil {
+			t.Fatal(err)
+		}
+		if err := InitRepo(); err != nil {
+			t.Fatal(err)
+		}
+		if err := SetConfig("user.name", filepath.Base(dir), false); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The same relative config path in another repository is another file
+	if v, _, _ := GetConfig("user.name"); v != filepath.Base(second) {
+		t.Errorf("user.name in the second repository = %q", v)
+	}
+	if err := os.Chdir(first); err != nil {
+		t.Fatal(err)
+	}
+	if v, _, _ := GetConfig("user.name"); v != filepath.Base(first) {
+		t.Errorf("user.name in the first repository = %q", v)
+	}
+
+	// A write of the same size within the same clock tick, and one by another process
+	for _, name := range []string{"a", "b"} {
+		if err := SetConfig("user.name", name, false); err != nil {
+			t.Fatal(err)
+		}
+		if v, _, _ := GetConfig("user.name"); v != name {
+			t.Errorf("user.name after SetConfig = %q, want %q", v, name)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(RepoDir(), "config"), []byte("user.name = Elsewhere\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if v, _, _ := GetConfig("user.name"); v != "Elsewhere" {
+		t.Errorf("user.name after an outside write = %q, want Elsewhere", v)
+	}
+}
+
+func TestObjectsDir_RelativeToWorkTreeWithRepoDirOverride(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	work := t.TempDir()
+	if err := os.Chdir(work); err != nil {
+		t.Fatal(err)
+	}
+	// The repository directory lives outside the working tree
+	t.Setenv(storage.EnvRepoDir, filepath.Join(t.TempDir(), "repo.kitcat"))
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetConfig(objectsDirKey, "store", false); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile("a.txt", []byte("a\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddFile("a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	index, err := storage.LoadIndexWithMeta()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(work, "store", index["a.txt"].Hash)); err != nil {
+		t.Errorf("object not stored under the working tree's store directory: %v", err)
+	}
+}
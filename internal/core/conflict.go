@@ -0,0 +1,63 @@
+package core
+
+import (
+	"bytes"
+	"strings"
+)
+
+// conflictStyleKey selects how conflicting file content is written out:
+//   - "merge" (default): ours and theirs, separated by =======
+//   - "diff3": additionally the merge-base content, between ||||||| and =======
+const conflictStyleKey = "merge.conflictStyle"
+
+// Values for the merge.conflictStyle config key.
+const (
+	ConflictStyleMerge = "merge"
+	ConflictStyleDiff3 = "diff3"
+)
+
+// conflictStyle returns the configured conflict style, falling back to "merge" for
+// unset or unknown values.
+func conflictStyle() string {
+	if style, _, _ := GetConfig(conflictStyleKey); style == ConflictStyleDiff3 {
+		return ConflictStyleDiff3
+	}
+	return ConflictStyleMerge
+}
+
+// formatConflict renders a file whose ours and theirs versions both changed base.
+// Leading and trailing lines common to all three versions are written as-is; the
+// differing middle is wrapped in conflict markers, with the base section included
+// for the diff3 style.
+func formatConflict(ours, base, theirs []byte, oursLabel, baseLabel, theirsLabel, style string) []byte {
+	o, b, t := splitLines(ours), splitLines(base), splitLines(theirs)
+
+	prefix := 0
+	for prefix < len(o) && prefix < len(b) && prefix < len(t) && o[prefix] == b[prefix] && b[prefix] == t[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(o)-prefix && suffix < len(b)-prefix && suffix < len(t)-prefix &&
+		o[len(o)-1-suffix] == b[len(b)-1-suffix] && b[len(b)-1-suffix] == t[len(t)-1-suffix] {
+		suffix++
+	}
+
+	var out bytes.Buffer
+	writeLines := func(lines []string) {
+		for _, line := range lines {
+			out.WriteString(line + "\n")
+		}
+	}
+	writeLines(o[:prefix])
+	out.WriteString(strings.TrimSpace("<<<<<<< "+oursLabel) + "\n")
+	writeLines(o[prefix : len(o)-suffix])
+	if style == ConflictStyleDiff3 {
+		out.WriteString(strings.TrimSpace("||||||| "+baseLabel) + "\n")
+		writeLines(b[prefix : len(b)-suffix])
+	}
+	out.WriteString("=======\n")
+	writeLines(t[prefix : len(t)-suffix])
+	out.WriteString(strings.TrimSpace(">>>>>>> "+theirsLabel) + "\n")
+	writeLines(o[len(o)-suffix:])
+	return out.Bytes()
+}
@@ -0,0 +1,116 @@
+package core
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+func TestFormatConflict_Styles(t *testing.T) {
+	base := []byte("header\nvalue = 1\nfooter\n")
+	ours := []byte("header\nvalue = 2\nfooter\n")
+	theirs := []byte("header\nvalue = 3\nfooter\n")
+
+	got := string(formatConflict(ours, base, theirs, "HEAD", "base", "abc1234", ConflictStyleMerge))
+	want := "header\n<<<<<<< HEAD\nvalue = 2\n=======\nvalue = 3\n>>>>>>> abc1234\nfooter\n"
+	if got != want {
+		t.Errorf("merge style:\n%s\nwant:\n%s", got, want)
+	}
+
+	got = string(formatConflict(ours, base, theirs, "HEAD", "base", "abc1234", ConflictStyleDiff3))
+	want = "header\n<<<<<<< HEAD\nvalue = 2\n||||||| base\nvalue = 1\n=======\nvalue = 3\n>>>>>>> abc1234\nfooter\n"
+	if got != want {
+		t.Errorf("diff3 style:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestCherryPick_WritesConflictMarkersAndResolves(t *testing.T) {
+	for _, style := range []string{ConflictStyleMerge, ConflictStyleDiff3} {
+		t.Run(style, func(t *testing.T) {
+			cwd, err := os.Getwd()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() {
+				_ = os.Chdir(cwd)
+			}()
+			if err := os.Chdir(t.TempDir()); err != nil {
+				t.Fatal(err)
+			}
+			if err := InitRepo(); err != nil {
+				t.Fatal(err)
+			}
+			_ = SetConfig("user.name", "Test", false)
+			_ = SetConfig("user.email", "test@example.com", false)
+			if err := SetConfig(conflictStyleKey, style, false); err != nil {
+				t.Fatal(err)
+			}
+
+			commitFile := func(content, message string) string {
+				t.Helper()
+				if err := os.WriteFile("config.txt", []byte(content), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				if err := AddFile("config.txt"); err != nil {
+					t.Fatal(err)
+				}
+				c, _, err := Commit(message)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return c.ID
+			}
+			base := commitFile("name = kitcat\nlevel = 1\n", "base")
+			incoming := commitFile("name = kitcat\nlevel = 22\n", "incoming")
+
+			// Rewind to the base and diverge.
+			if err := Reset(base, ResetHard); err != nil {
+				t.Fatal(err)
+			}
+			commitFile("name = kitcat\nlevel = 10\n", "ours")
+
+			err = cherryPick(incoming, false)
+			if err == nil || !strings.Contains(err.Error(), "conflict in config.txt") {
+				t.Fatalf("cherryPick error = %v, want a conflict", err)
+			}
+			data, err := os.ReadFile("config.txt")
+			if err != nil {
+				t.Fatal(err)
+			}
+			text := string(data)
+			for _, marker := range []string{"<<<<<<< HEAD\nlevel = 10\n", "=======\nlevel = 22\n>>>>>>> " + incoming[:7]} {
+				if !strings.Contains(text, marker) {
+					t.Errorf("conflict file missing %q:\n%s", marker, text)
+				}
+			}
+			if hasBase := strings.Contains(text, "||||||| base\nlevel = 1\n"); hasBase != (style == ConflictStyleDiff3) {
+				t.Errorf("base section present = %v for style %s:\n%s", hasBase, style, text)
+			}
+
+			// Resolve by hand, stage and commit, as `rebase --continue` does.
+			if err := os.WriteFile("config.txt", []byte("name = kitcat\nlevel = 123\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if err := AddFile("config.txt"); err != nil {
+				t.Fatal(err)
+			}
+			resolved, _, err := Commit("resolved")
+			if err != nil {
+				t.Fatal(err)
+			}
+			tree, err := storage.ParseTree(resolved.TreeHash)
+			if err != nil {
+				t.Fatal(err)
+			}
+			blob, err := storage.ReadObject(tree["config.txt"])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(blob) != "name = kitcat\nlevel = 123\n" {
+				t.Errorf("resolved content = %q", blob)
+			}
+		})
+	}
+}
@@ -1,22 +1,38 @@
 package core
 
-const (
-	// RepoDir is the name of the directory where all kitcat data is stored.
-	RepoDir = ".kitcat"
-	// ObjectsDir is the subdirectory for storing all content-addressable objects.
-	ObjectsDir = ".kitcat/objects"
-	// RefsDir is the subdirectory for storing references like heads and tags.
-	RefsDir = ".kitcat/refs"
-	// HeadsDir is the subdirectory for storing branch heads.
-	HeadsDir = ".kitcat/refs/heads"
-	// TagsDir is the subdirectory for storing tags.
-	TagsDir = ".kitcat/refs/tags"
-	// IndexPath is the full path to the index file.
-	IndexPath = ".kitcat/index"
-	// HeadPath is the full path to the HEAD file.
-	HeadPath = ".kitcat/HEAD"
-	// CommitsPath is the full path to the commit log file.
-	CommitsPath = ".kitcat/commits.log"
-	// StashPath is the full path to the stash reference file.
-	StashPath = ".kitcat/refs/stash"
+import (
+	"path/filepath"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
 )
+
+// Repository locations. They honour the KITCAT_DIR, KITCAT_INDEX_FILE and KITCAT_OBJECTS
+// environment overrides (see storage.ResolveRepoDir), which is why they are functions, not constants.
+
+// RepoDir returns the directory where all kitcat data is stored.
+func RepoDir() string { return storage.RepoDir() }
+
+// ObjectsDir returns the directory storing all content-addressable objects. It defaults to
+// the objects subdirectory and can be moved with KITCAT_OBJECTS or core.objectsDir.
+func ObjectsDir() string { return storage.ResolveObjectsDir("") }
+
+// RefsDir returns the subdirectory for storing references like heads and tags.
+func RefsDir() string { return filepath.Join(RepoDir(), "refs") }
+
+// HeadsDir returns the subdirectory for storing branch heads.
+func HeadsDir() string { return filepath.Join(RefsDir(), "heads") }
+
+// TagsDir returns the subdirectory for storing tags.
+func TagsDir() string { return filepath.Join(RefsDir(), "tags") }
+
+// IndexPath returns the full path to the index file.
+func IndexPath() string { return storage.ResolveIndexFile("") }
+
+// HeadPath returns the full path to the HEAD file.
+func HeadPath() string { return filepath.Join(RepoDir(), "HEAD") }
+
+// CommitsPath returns the full path to the commit log file.
+func CommitsPath() string { return filepath.Join(RepoDir(), "commits.log") }
+
+// StashPath returns the full path to the stash reference file.
+func StashPath() string { return filepath.Join(RefsDir(), "stash") }
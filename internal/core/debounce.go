@@ -0,0 +1,125 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// debounceKey sets the default StageDebouncer window as a Go duration, e.g. "250ms".
+const debounceKey = "add.debounce"
+
+// defaultDebounce is the window used when add.debounce is unset or invalid.
+const defaultDebounce = 300 * time.Millisecond
+
+// StageDebouncer coalesces rapid staging requests, e.g. from an editor's file watcher, into
+// one index update. The first request after a flush starts a timer; every request until it
+// fires joins the batch, which is then staged in a single index transaction. Requests that
+// keep arriving are therefore flushed at least once per window, and the last batch is
+// flushed when they stop. It is safe for concurrent use.
+type StageDebouncer struct {
+	window  time.Duration
+	opts    AddOptions
+	onFlush func(error)
+
+	mu      sync.Mutex
+	paths   map[string]struct{} // absolute paths requested since the last flush
+	all     bool                // AddAll requested since the last flush
+	timer   *time.Timer
+	closed  bool
+	flushMu sync.Mutex // serializes flushes
+}
+
+// NewStageDebouncer returns a debouncer that stages with opts. A window of zero uses the
+// add.debounce config (default 300ms). onFlush, if not nil, receives the result of every
+// flush started by the timer; flushes requested with Flush or Close return it instead.
+func NewStageDebouncer(window time.Duration, opts AddOptions, onFlush func(error)) *StageDebouncer {
+	if window <= 0 {
+		window = defaultDebounce
+		if v, ok, _ := GetConfig(debounceKey); ok {
+			if d, err := time.ParseDuration(v); err == nil && d > 0 {
+				window = d
+			}
+		}
+	}
+	return &StageDebouncer{window: window, opts: opts, onFlush: onFlush, paths: make(map[string]struct{})}
+}
+
+// Add requests staging of path, a file or directory relative to the current directory.
+func (d *StageDebouncer) Add(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.paths[abs] = struct{}{}
+	d.schedule()
+	return nil
+}
+
+// AddAll requests staging of the whole working tree, as AddAll does.
+func (d *StageDebouncer) AddAll() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.all = true
+	d.schedule()
+}
+
+// schedule starts the flush timer unless one is pending. Called with d.mu held.
+func (d *StageDebouncer) schedule() {
+	if d.timer != nil || d.closed {
+		return
+	}
+	d.timer = time.AfterFunc(d.window, func() {
+		err := d.Flush()
+		if d.onFlush != nil {
+			d.onFlush(err)
+		}
+	})
+}
+
+// Flush stages the pending requests now.
+func (d *StageDebouncer) Flush() error {
+	d.flushMu.Lock()
+	defer d.flushMu.Unlock()
+
+	d.mu.Lock()
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+	all, pending := d.all, d.paths
+	d.all, d.paths = false, make(map[string]struct{})
+	d.mu.Unlock()
+
+	if all {
+		// The whole tree covers every single path requested alongside it.
+		return AddAllWithOptions(context.Background(), d.opts)
+	}
+	var paths []string
+	for p := range pending {
+		// Editors save through short-lived temporary files; one that is already gone
+		// has nothing left to stage.
+		if _, err := os.Lstat(p); err == nil {
+			paths = append(paths, p)
+		}
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+	sort.Strings(paths)
+	return addPaths(paths, d.opts)
+}
+
+// Close flushes what is pending and stops the debouncer; later requests are kept but no
+// longer scheduled, so they are only staged by an explicit Flush.
+func (d *StageDebouncer) Close() error {
+	d.mu.Lock()
+	d.closed = true
+	d.mu.Unlock()
+	return d.Flush()
+}
@@ -0,0 +1,84 @@
+package core
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+func TestStageDebouncer_CoalescesRequests(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+
+	flushed := make(chan error, 4)
+	d := NewStageDebouncer(50*time.Millisecond, AddOptions{}, func(err error) { flushed <- err })
+
+	for _, name := range []string{"a.txt", "b.txt", "a.txt", "gone.tmp"} {
+		if err := os.WriteFile(name, []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := d.Add(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Remove("gone.tmp"); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-flushed:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("pending requests were never flushed")
+	}
+
+	// One transaction, hence one operation log entry, for the whole batch.
+	entries, err := ReadOpLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || !reflect.DeepEqual(entries[0].Paths, []string{"a.txt", "b.txt"}) {
+		t.Errorf("operation log = %+v, want one add of a.txt and b.txt", entries)
+	}
+
+	// Close stages what is still pending without waiting for the timer.
+	if err := os.WriteFile("c.txt", []byte("c"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Add("c.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+	index, err := storage.LoadIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		if _, ok := index[name]; !ok {
+			t.Errorf("%s not staged", name)
+		}
+	}
+	select {
+	case err := <-flushed:
+		t.Errorf("timer flush after Close: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
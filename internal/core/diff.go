@@ -1,10 +1,11 @@
 package core
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
-	"strings"
+	"sort"
 
 	"github.com/LeeFred3042U/kitcat/internal/diff"
 	"github.com/LeeFred3042U/kitcat/internal/storage"
@@ -18,6 +19,20 @@ const (
 	colorBlue  = "\033[1;34m"
 )
 
+// diffAlgorithmKey selects the line diff algorithm: "myers" (default), "patience" or
+// "histogram". Unknown values fall back to Myers.
+const diffAlgorithmKey = "diff.algorithm"
+
+// diffAlgorithm returns the configured line diff algorithm.
+func diffAlgorithm() diff.Algorithm {
+	name, _, _ := GetConfig(diffAlgorithmKey)
+	alg, err := diff.ParseAlgorithm(name)
+	if err != nil {
+		return diff.Myers
+	}
+	return alg
+}
+
 // FileStat holds the number of insertions and deletions for a file
 type FileStat struct {
 	Insertions int
@@ -35,323 +50,312 @@ func isDiffBinary(content []byte) bool {
 	return false
 }
 
-// displayDiff formats and prints the structured diff output from the Myers algorithm.
-// It iterates through each change (insertion, deletion, or equal) and applies the appropriate color
-func displayDiff(diffs []diff.Diff[string]) {
-	// Loop over each diff "chunk" provided by the algorithm
-	for _, d := range diffs {
-		lines := d.Text
+// ChangeUntracked marks a working-tree file that is not in the index. Only unstaged
+// diffs report it.
+const ChangeUntracked ChangeKind = "untracked"
+
+// DiffLine is one line of a FileDiff. Op is "+" for an insertion, "-" for a deletion
+// and " " for unchanged context.
+type DiffLine struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// FileDiff is the structured diff of a single path and the schema of `kitcat diff --json`.
+// Path is repo-relative with forward slashes on every platform. Binary files carry no
+// Lines and no counts, but the sizes of both versions instead; a missing version has
+// size 0.
+type FileDiff struct {
+	Path       string     `json:"path"`
+	Change     ChangeKind `json:"change"` // "added", "modified", "deleted" or "untracked"
+	Binary     bool       `json:"binary"`
+	OldSize    int64      `json:"oldSize,omitempty"`
+	NewSize    int64      `json:"newSize,omitempty"`
+	Insertions int        `json:"insertions"`
+	Deletions  int        `json:"deletions"`
+	Lines      []DiffLine `json:"lines"`
+}
+
+// binarySummary describes the change to a binary file, e.g.
+// "Binary file logo.png changed (1.2 KB → 1.5 KB)".
+func binarySummary(fd FileDiff) string {
+	switch fd.Change {
+	case ChangeAdded, ChangeUntracked:
+		return fmt.Sprintf("Binary file %s added (%s)", fd.Path, formatSize(fd.NewSize))
+	case ChangeDeleted:
+		return fmt.Sprintf("Binary file %s deleted (%s)", fd.Path, formatSize(fd.OldSize))
+	}
+	return fmt.Sprintf("Binary file %s changed (%s → %s)", fd.Path, formatSize(fd.OldSize), formatSize(fd.NewSize))
+}
+
+// formatSize renders a byte count for people, with one decimal from KB on
+// (1 KB = 1024 bytes).
+func formatSize(n int64) string {
+	if n < 1<<10 {
+		return fmt.Sprintf("%d B", n)
+	}
+	value, unit := float64(n)/(1<<10), "KB"
+	for _, next := range []string{"MB", "GB", "TB"} {
+		if value < 1<<10 {
+			break
+		}
+		value, unit = value/(1<<10), next
+	}
+	return fmt.Sprintf("%.1f %s", value, unit)
+}
+
+// buildFileDiff diffs two versions of a file with the configured algorithm, ignoring the
+// whitespace differences ws selects; nil stands for no content.
+func buildFileDiff(path string, kind ChangeKind, oldData, newData []byte, ws diff.Whitespace) FileDiff {
+	fd := FileDiff{Path: filepath.ToSlash(path), Change: kind, Lines: []DiffLine{}}
+	if isDiffBinary(oldData) || isDiffBinary(newData) {
+		fd.Binary = true
+		fd.OldSize, fd.NewSize = int64(len(oldData)), int64(len(newData))
+		return fd
+	}
+
+	for _, d := range diff.Lines(diffAlgorithm(), ws, splitLines(oldData), splitLines(newData)) {
+		op := " "
 		switch d.Operation {
-		// If the operation was an INSERT, print each line in green with a '+' prefix
 		case diff.INSERT:
-			for _, line := range lines {
-				fmt.Printf("%s+ %s%s\n", colorGreen, line, colorReset)
-			}
-		// If the operation was a DELETE, print each line in red with a '-' prefix
+			op = "+"
+			fd.Insertions += len(d.Text)
 		case diff.DELETE:
-			for _, line := range lines {
-				fmt.Printf("%s- %s%s\n", colorRed, line, colorReset)
-			}
-		// If the lines are EQUAL, print them with the default color and two spaces for context
-		case diff.EQUAL:
-			for _, line := range lines {
-				fmt.Printf("  %s\n", line)
-			}
+			op = "-"
+			fd.Deletions += len(d.Text)
+		}
+		for _, line := range d.Text {
+			fd.Lines = append(fd.Lines, DiffLine{Op: op, Text: line})
 		}
 	}
+	return fd
 }
 
-// Diff calculates and displays the differences between the last commit and the current staging area (index)
-// It identifies which files have been added, deleted, or modified.
-func Diff(staged, stat bool) error {
-	stats := make(map[string]FileStat)
-	// Retrieve the metadata for the most recent commit.
-	lastCommit, err := storage.GetLastCommit()
-	if err != nil {
-		// If there are no commits yet, there's nothing to compare against.
-		if err == storage.ErrNoCommits {
-			fmt.Println("No commits yet. Nothing to diff against.")
-			return nil
+// displayDiff prints the lines of a FileDiff, coloring insertions green and deletions red.
+func displayDiff(lines []DiffLine) {
+	for _, line := range lines {
+		switch line.Op {
+		case "+":
+			fmt.Printf("%s+ %s%s\n", colorGreen, line.Text, colorReset)
+		case "-":
+			fmt.Printf("%s- %s%s\n", colorRed, line.Text, colorReset)
+		default:
+			fmt.Printf("  %s\n", line.Text)
 		}
-		return err
 	}
+}
 
-	// Load the current staging area into a map. This represents what will be in the *next* commit
-	index, err := storage.LoadIndex()
+// DiffOptions controls DiffWithOptions and DiffFilesWithOptions.
+type DiffOptions struct {
+	// Staged compares the HEAD commit to the index instead of the index to the working tree.
+	Staged bool
+	// Stat prints only a per-file summary of insertions and deletions.
+	Stat bool
+	// Whitespace selects whitespace differences to ignore, e.g. after reformatting. Lines
+	// are compared normalized but shown as they are; a modified file with no other
+	// changes is left out.
+	Whitespace diff.Whitespace
+}
+
+// Diff calculates and displays the differences between the last commit and the current staging area (index)
+// or, when staged is false, between the index and the working directory.
+// With stat set only a per-file summary of insertions and deletions is printed.
+func Diff(staged, stat bool) error {
+	return DiffWithOptions(DiffOptions{Staged: staged, Stat: stat})
+}
+
+// DiffWithOptions is Diff with explicit options, e.g. to ignore whitespace changes.
+func DiffWithOptions(opts DiffOptions) error {
+	staged := opts.Staged
+	files, err := DiffFilesWithOptions(opts)
 	if err != nil {
 		return err
 	}
 
-	if staged {
-
-		// From the commit, get the tree object which represents the state of the repository at that time
-		// This is a map of `filePath -> contentHash`
-		tree, err := storage.ParseTree(lastCommit.TreeHash)
-		if err != nil {
-			return err
+	if opts.Stat {
+		stats := make(map[string]FileStat)
+		for _, fd := range files {
+			if !fd.Binary {
+				stats[fd.Path] = FileStat{Insertions: fd.Insertions, Deletions: fd.Deletions}
+			}
 		}
+		printDiffStat(stats)
+		return nil
+	}
 
-		// First Loop: Iterate through files in the index to find additions and modifications
-		for path, indexHash := range index {
-			treeHash, ok := tree[path]
-			// If a file is in the index but not in the old tree, it's a new file.
-			if !ok {
-				if !stat {
-					fmt.Printf("%sAdded file: %s%s\n", colorBlue, path, colorReset)
-				}
-
-				// Show content of added file (all lines are additions)
-				content, err := storage.ReadObject(indexHash)
-				if err != nil {
-					return err
-				}
-
-				contentStr := strings.TrimRight(string(content), "\n")
-				fileLines := strings.Split(contentStr, "\n")
-				emptyLines := []string{}
-
-				myers := diff.NewMyersDiff(emptyLines, fileLines)
-				diffs := myers.Diffs()
-				if stat {
-					fileStat := stats[path]
-					for _, d := range diffs {
-						if d.Operation == diff.INSERT {
-							fileStat.Insertions += len(d.Text)
-						}
-					}
-					stats[path] = fileStat
-				} else {
-					displayDiff(diffs)
-				}
-				continue
-			}
+	for _, fd := range files {
+		switch {
+		case staged && fd.Change == ChangeAdded:
+			fmt.Printf("%sAdded file: %s%s\n", colorBlue, fd.Path, colorReset)
+		case staged && fd.Change == ChangeModified:
+			fmt.Printf("%sModified file: %s%s\n", colorBlue, fd.Path, colorReset)
+		case staged && fd.Change == ChangeDeleted:
+			// Deletions are reported without their content.
+			fmt.Printf("%sDeleted file: %s%s\n", colorBlue, fd.Path, colorReset)
+			continue
+		case fd.Change == ChangeDeleted:
+			fmt.Printf("%sDeleted (unstaged): %s%s\n", colorRed, fd.Path, colorReset)
+			continue
+		case fd.Change == ChangeUntracked:
+			fmt.Printf("%s%sUntracked:%s %s\n", colorGreen, colorBlue, colorReset, fd.Path)
+		default:
+			fmt.Printf("%sChanged (unstaged): %s%s\n", colorBlue, fd.Path, colorReset)
+		}
+		if fd.Binary {
+			fmt.Println(binarySummary(fd))
+			continue
+		}
+		displayDiff(fd.Lines)
+	}
+	return nil
+}
 
-			// If the file exists in both, but the content hash is different, it has been modified
-			if indexHash != treeHash {
-				if !stat {
-					fmt.Printf("%sModified file: %s%s\n", colorBlue, path, colorReset)
-				}
+// DiffFiles returns the structured differences Diff prints, sorted by path.
+// With staged set it compares the HEAD commit to the index; otherwise it compares the
+// index to the working directory and also reports untracked files. Before the first
+// commit the staged diff compares against the empty tree, so every entry is added.
+func DiffFiles(staged bool) ([]FileDiff, error) {
+	return DiffFilesWithOptions(DiffOptions{Staged: staged})
+}
 
-				// Read the old and new content from the object store.
-				oldContent, err := storage.ReadObject(treeHash)
-				if err != nil {
-					return err
-				}
-				newContent, err := storage.ReadObject(indexHash)
-				if err != nil {
-					return err
-				}
+// DiffFilesWithOptions is DiffFiles with explicit options; Stat is ignored.
+func DiffFilesWithOptions(opts DiffOptions) ([]FileDiff, error) {
+	staged, ws := opts.Staged, opts.Whitespace
+	files := []FileDiff{}
+	add := func(fd FileDiff) {
+		// A modification made only of ignored whitespace is no change at all.
+		if ws.Any() && fd.Change == ChangeModified && !fd.Binary && fd.Insertions == 0 && fd.Deletions == 0 {
+			return
+		}
+		files = append(files, fd)
+	}
 
-				// If the Content is binary
-				if isDiffBinary(oldContent) || isDiffBinary(newContent) {
-					if !stat {
-						fmt.Println("Binary files differ")
-					}
-					continue
-				}
+	// Load the current staging area into a map. This represents what will be in the *next* commit
+	entries, err := storage.LoadIndexWithMeta()
+	if err != nil {
+		return nil, err
+	}
+	index := make(map[string]string, len(entries))
+	for path, entry := range entries {
+		index[path] = entry.Hash
+	}
 
-				// Split file content into lines to prepare for the diff algorithm
-				oldLines := strings.Split(string(oldContent), "\n")
-				newLines := strings.Split(string(newContent), "\n")
-
-				// Using the Myers algorithm to compute the differences
-				myers := diff.NewMyersDiff(oldLines, newLines)
-				diffs := myers.Diffs()
-
-				if stat {
-					fileStat := stats[path]
-					for _, d := range diffs {
-						switch d.Operation {
-						case diff.INSERT:
-							fileStat.Insertions += len(d.Text)
-						case diff.DELETE:
-							fileStat.Deletions += len(d.Text)
-						}
-					}
-					stats[path] = fileStat
-				} else {
-					// Display the computed differences with color
-					displayDiff(diffs)
-				}
+	if staged {
+		// From the HEAD commit, get the tree object which represents the state of the repository at that time
+		// This is a map of `filePath -> contentHash`
+		tree := make(map[string]string)
+		treeModes := make(map[string]uint32)
+		headCommit, err := GetHeadCommit()
+		if err == nil {
+			if tree, err = storage.ParseTree(headCommit.TreeHash); err != nil {
+				return nil, err
 			}
-		}
-
-		// Next Loop: Iterate through files in the old tree to find deletions.
-		for path, treeHash := range tree {
-			// If a file was in the old tree but is no longer in the index, it has been deleted.
-			if _, ok := index[path]; !ok {
-				if stat {
-					content, err := storage.ReadObject(treeHash)
-					if err != nil {
-						return err
-					}
-					lines := strings.Split(strings.TrimRight(string(content), "\n"), "\n")
-					stats[path] = FileStat{Deletions: len(lines)}
-				} else {
-					fmt.Printf("%sDeleted file: %s%s\n", colorBlue, path, colorReset)
-				}
+			if treeModes, err = storage.ParseTreeModes(headCommit.TreeHash); err != nil {
+				return nil, err
 			}
+		} else if !errors.Is(err, storage.ErrNoCommits) {
+			return nil, err
 		}
-	} else {
-		// Case B: unstaged diff (Index vs Working Directory)
-		// Equivalent to `git diff` (not `--cached`)
-
-		for path, indexHash := range index {
-			// Read current working directory file
-			fileContent, err := os.ReadFile(path)
-			if err != nil {
-				// File deleted from working directory (but still staged)
-				if stat {
-					indexContent, err := storage.ReadObject(indexHash)
-					if err == nil {
-						lines := strings.Split(strings.TrimRight(string(indexContent), "\n"), "\n")
-						stats[path] = FileStat{Deletions: len(lines)}
-					}
-				} else {
-					fmt.Printf("%sDeleted (unstaged): %s%s\n", colorRed, path, colorReset)
-				}
-				continue
-			}
-
-			// Read staged content from index
-			indexContent, err := storage.ReadObject(indexHash)
-			if err != nil {
-				return fmt.Errorf("failed to read index object %s: %w", indexHash, err)
-			}
 
-			// Compare: working directory vs index (staged)
-			if string(fileContent) != string(indexContent) {
-				if !stat {
-					fmt.Printf("%sChanged (unstaged): %s%s\n", colorBlue, path, colorReset)
+		for _, change := range diffTrees(tree, index) {
+			var oldContent, newContent []byte
+			if change.OldHash != "" {
+				if oldContent, err = entryContent(change.OldHash, treeModes[change.Path]); err != nil {
+					return nil, err
 				}
-
-				// If the diff is binary
-				if isDiffBinary(fileContent) || isDiffBinary(indexContent) {
-					if !stat {
-						fmt.Println("Binary files differ")
-					}
-					continue
-				}
-
-				// Index content = "old" (what's staged)
-				// Working dir content = "new" (current changes)
-				indexLines := strings.Split(string(indexContent), "\n")
-				contentStr := strings.TrimRight(string(fileContent), "\n")
-				workDirLines := strings.Split(contentStr, "\n")
-
-				// Myers diff: staged (old) → working dir (new)
-				myers := diff.NewMyersDiff(indexLines, workDirLines)
-				diffs := myers.Diffs()
-
-				if stat {
-					fileStat := stats[path]
-					for _, d := range diffs {
-						switch d.Operation {
-						case diff.INSERT:
-							fileStat.Insertions += len(d.Text)
-						case diff.DELETE:
-							fileStat.Deletions += len(d.Text)
-						}
-					}
-					stats[path] = fileStat
-				} else {
-					displayDiff(diffs)
+			}
+			if change.NewHash != "" {
+				if newContent, err = entryContent(change.NewHash, entries[change.Path].Mode); err != nil {
+					return nil, err
 				}
 			}
+			add(buildFileDiff(change.Path, change.Kind, oldContent, newContent, ws))
 		}
+		return files, nil
+	}
 
-		// Untracked files: exist in working directory but not staged (recursive walk)
-		var untracked []string
-		err := filepath.WalkDir(".", func(path string, d os.DirEntry, err error) error {
-			if err != nil {
-				return err
+	// Unstaged diff (Index vs Working Directory)
+	// Equivalent to `git diff` (not `--cached`)
+	for path, indexHash := range index {
+		if isEmptyDirPlaceholder(entries[path].Mode) {
+			continue
+		}
+		if entries[path].Mode == storage.SubmoduleMode {
+			// Compare the submodule's HEAD; an uninitialized one has nothing to compare.
+			head, err := submoduleHead(filepath.FromSlash(path))
+			if err == nil && head != "" && head != indexHash {
+				add(buildFileDiff(path, ChangeModified, submoduleContent(indexHash), submoduleContent(head), ws))
 			}
+			continue
+		}
+		// Read current working directory file
+		fileContent, readErr := os.ReadFile(filepath.FromSlash(path))
+
+		// Read staged content from index
+		indexContent, err := storage.ReadObject(indexHash)
+		if readErr != nil {
+			// File deleted from working directory (but still staged)
+			add(buildFileDiff(path, ChangeDeleted, indexContent, nil, ws))
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read index object %s: %w", indexHash, err)
+		}
 
-			name := filepath.Base(path)
+		// Compare: working directory vs index (staged)
+		if string(fileContent) != string(indexContent) {
+			add(buildFileDiff(path, ChangeModified, indexContent, fileContent, ws))
+		}
+	}
 
-			// Skip .kitcat directory
-			if name == ".kitcat" {
-				if d.IsDir() {
-					return filepath.SkipDir
-				}
-				return nil
-			}
+	// Untracked files: exist in working directory but not staged (recursive walk)
+	err = filepath.WalkDir(".", func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
 
-			// Skip directories (continue walking into subdirs)
+		// Skip .kitcat directory
+		if filepath.Base(path) == filepath.Base(RepoDir()) {
 			if d.IsDir() {
-				return nil
-			}
-
-			// Only process regular files
-			if !d.Type().IsRegular() {
-				return nil
-			}
-
-			// Get relative path for comparison with index
-			relPath, err := filepath.Rel(".", path)
-			if err != nil {
-				return err
+				return filepath.SkipDir
 			}
+			return nil
+		}
+		// Nested repositories and submodules hold no files of this one
+		if d.IsDir() && path != "." && (isNestedRepo(path) || entries[storage.IndexKey(path)].Mode == storage.SubmoduleMode) {
+			return filepath.SkipDir
+		}
 
-			// File exists on disk but not in index = untracked/new
-			if _, ok := index[relPath]; !ok {
-				untracked = append(untracked, relPath)
-			}
+		// Only process regular files
+		if !d.Type().IsRegular() {
 			return nil
-		})
+		}
+
+		// Get relative path for comparison with index
+		relPath, err := filepath.Rel(".", path)
 		if err != nil {
 			return err
 		}
 
-		// Show untracked file content (all lines are additions)
-		for _, path := range untracked {
-			content, err := os.ReadFile(path)
-			if err != nil {
-				continue
-			}
-
-			// If the content is binary
-			if isDiffBinary(content) {
-				if !stat {
-					fmt.Println("Binary files differ")
-				}
-				continue
-			}
-
-			if !stat {
-				fmt.Printf("%s%sUntracked:%s %s\n", colorGreen, colorBlue, colorReset, path)
-			}
-
-			// Trim trailing newlines and split into lines
-			contentStr := strings.TrimRight(string(content), "\n")
-			fileLines := strings.Split(contentStr, "\n")
-			emptyLines := []string{}
-
-			// Myers diff: empty (old) → file content (new)
-			// All lines will show as green additions
-			myers := diff.NewMyersDiff(emptyLines, fileLines)
-			diffs := myers.Diffs()
-
-			if stat {
-				fileStat := stats[path]
-				for _, d := range diffs {
-					if d.Operation == diff.INSERT {
-						fileStat.Insertions += len(d.Text)
-					}
-				}
-				stats[path] = fileStat
-			} else {
-				// Display the computed differences with color
-				displayDiff(diffs)
-			}
+		// File exists on disk but not in index = untracked/new
+		if _, ok := index[storage.IndexKey(relPath)]; ok {
+			return nil
 		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+		add(buildFileDiff(relPath, ChangeUntracked, nil, content, ws))
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	if stat {
-		printDiffStat(stats)
-	}
-
-	return nil
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+	return files, nil
 }
 
 func printDiffStat(stats map[string]FileStat) {
@@ -0,0 +1,126 @@
+package core
+
+import (
+	"os"
+	"testing"
+
+	"github.com/LeeFred3042U/kitcat/internal/diff"
+)
+
+func TestDiffFilesWithOptions_IgnoresWhitespace(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		"indent.go": "func f() {\n\treturn 1\n}\n",
+		"edit.go":   "a\nb\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := AddAll(); err != nil {
+		t.Fatal(err)
+	}
+	// Reindent with spaces and add trailing whitespace; edit.go also changes for real.
+	if err := os.WriteFile("indent.go", []byte("func f() { \n    return 1\n}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("edit.go", []byte("a  \nc\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	modified := func(opts DiffOptions) []FileDiff {
+		t.Helper()
+		files, err := DiffFilesWithOptions(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out []FileDiff
+		for _, fd := range files {
+			if fd.Change == ChangeModified {
+				out = append(out, fd)
+			}
+		}
+		return out
+	}
+
+	if got := modified(DiffOptions{}); len(got) != 2 {
+		t.Fatalf("diff = %+v, want both files", got)
+	}
+	got := modified(DiffOptions{Whitespace: diff.Whitespace{IgnoreAll: true}})
+	if len(got) != 1 || got[0].Path != "edit.go" {
+		t.Fatalf("ignoring whitespace, diff = %+v, want only edit.go", got)
+	}
+	fd := got[0]
+	if fd.Insertions != 1 || fd.Deletions != 1 {
+		t.Errorf("edit.go: +%d -%d, want +1 -1", fd.Insertions, fd.Deletions)
+	}
+	// The unchanged line is shown as it is in the working tree.
+	if fd.Lines[0].Text != "a  " {
+		t.Errorf("context line = %q, want %q", fd.Lines[0].Text, "a  ")
+	}
+}
+
+func TestDiffFiles_BinaryChangeReportsSizes(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+
+	oldData := append([]byte("\x89PNG\x00"), make([]byte, 1200)...)
+	newData := append([]byte("\x89PNG\x00"), make([]byte, 1536*1024)...)
+	if err := os.WriteFile("logo.png", oldData, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddFile("logo.png"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("logo.png", newData, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := DiffFiles(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fd *FileDiff
+	for i := range files {
+		if files[i].Path == "logo.png" {
+			fd = &files[i]
+		}
+	}
+	if fd == nil {
+		t.Fatalf("logo.png missing from diff: %+v", files)
+	}
+	if !fd.Binary || fd.OldSize != int64(len(oldData)) || fd.NewSize != int64(len(newData)) || len(fd.Lines) != 0 {
+		t.Errorf("binary diff = %+v", *fd)
+	}
+	if got, want := binarySummary(*fd), "Binary file logo.png changed (1.2 KB → 1.5 MB)"; got != want {
+		t.Errorf("binarySummary = %q, want %q", got, want)
+	}
+	if got, want := binarySummary(FileDiff{Path: "a.bin", Change: ChangeAdded, NewSize: 10}), "Binary file a.bin added (10 B)"; got != want {
+		t.Errorf("binarySummary = %q, want %q", got, want)
+	}
+}
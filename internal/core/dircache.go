@@ -0,0 +1,104 @@
+package core
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+// dirCacheConfigKey makes AddAll remember directory mtimes (in .kitcat/dircache) and skip
+// reading directories whose mtime has not changed since the last run. A directory's mtime
+// changes when entries are created, removed or renamed in it, so an unchanged directory
+// holds the same names as before: its ignored and untracked content is not visited at all,
+// and only its tracked files are stat'ed. Edits to tracked files are still detected, as
+// those do not touch the directory mtime. Off by default; enable it on filesystems that
+// update directory mtimes reliably.
+const dirCacheConfigKey = "add.dirCache"
+
+// dirCacheSettle keeps directories modified this recently out of the cache: a second
+// change within the same mtime tick would otherwise go unnoticed.
+const dirCacheSettle = 2 * time.Second
+
+// dirWalkCache is the AddAll side of storage.DirCache: the cache from the previous run,
+// if still valid, and the one being recorded for the next.
+type dirWalkCache struct {
+	prev           storage.DirCache
+	next           storage.DirCache
+	cutoff         int64
+	limits         addLimits
+	trackEmptyDirs bool
+	children       map[string][]string // tracked paths by parent directory ("." for the root)
+}
+
+func newDirWalkCache(index map[string]storage.IndexEntry, limits addLimits, trackEmptyDirs bool) *dirWalkCache {
+	c := &dirWalkCache{
+		prev:           storage.LoadDirCache(),
+		next:           storage.DirCache{Dirs: map[string]storage.DirCacheEntry{}},
+		cutoff:         time.Now().Add(-dirCacheSettle).UnixNano(),
+		limits:         limits,
+		trackEmptyDirs: trackEmptyDirs,
+		children:       make(map[string][]string),
+	}
+	// Anything that changes which files AddAll would track (ignore rules, options, or the
+	// index having been edited by another command) invalidates the whole cache.
+	if c.prev.Key != c.fingerprint(index) {
+		c.prev.Dirs = map[string]storage.DirCacheEntry{}
+	}
+	for p := range index {
+		parent := path.Dir(p)
+		c.children[parent] = append(c.children[parent], p)
+	}
+	return c
+}
+
+// fingerprint hashes the inputs that decide which files AddAll tracks.
+func (c *dirWalkCache) fingerprint(index map[string]storage.IndexEntry) string {
+	h := sha1.New()
+	ignore, _ := os.ReadFile(".kitignore")
+	h.Write(ignore)
+	exclude, _ := os.ReadFile(filepath.Join(RepoDir(), "info", "exclude"))
+	h.Write(exclude)
+	fmt.Fprintf(h, "\x00%+v\x00%v\x00", c.limits, c.trackEmptyDirs)
+	paths := make([]string, 0, len(index))
+	for p := range index {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		h.Write([]byte(p + "\n"))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// unchanged reports whether dir has the mtime recorded by the previous run.
+func (c *dirWalkCache) unchanged(dir string, info os.FileInfo) bool {
+	entry, ok := c.prev.Dirs[dir]
+	return ok && entry.ModTime != 0 && entry.ModTime == info.ModTime().UnixNano()
+}
+
+// record notes dir and its mtime for the next run.
+func (c *dirWalkCache) record(dir string, info os.FileInfo) {
+	parent := path.Dir(dir)
+	p := c.next.Dirs[parent]
+	p.Subdirs = append(p.Subdirs, path.Base(dir))
+	c.next.Dirs[parent] = p
+
+	e := c.next.Dirs[dir]
+	if mtime := info.ModTime().UnixNano(); mtime < c.cutoff {
+		e.ModTime = mtime
+	}
+	c.next.Dirs[dir] = e
+}
+
+// save writes the recorded cache, keyed to the index AddAll just wrote.
+func (c *dirWalkCache) save(index map[string]storage.IndexEntry) error {
+	c.next.Key = c.fingerprint(index)
+	return storage.WriteDirCache(c.next)
+}
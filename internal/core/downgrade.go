@@ -0,0 +1,42 @@
+package core
+
+import (
+	"fmt"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+// DowngradeIndex rewrites the index in the legacy "path": "hash" format, for teammates
+// still on a kitcat version that predates index metadata (see storage.DowngradeIndex).
+// It warns about what is lost: without sizes and mtimes the next add re-hashes every
+// file, and flags such as skip-worktree, recorded modes and on-disk names are dropped.
+func DowngradeIndex() error {
+	if _, err := enterRepoRoot(); err != nil {
+		return err
+	}
+	report, err := storage.DowngradeIndex()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Rewrote %d index entries in the legacy format\n", report.Entries)
+	if report.Metadata > 0 {
+		fmt.Printf("warning: dropped size and mtime of %d entries; the next add re-hashes them instead of taking the fast path\n", report.Metadata)
+	}
+	if len(report.Extras) > 0 {
+		fmt.Println("warning: dropped the flags, modes or on-disk names of:")
+		for _, path := range report.Extras {
+			fmt.Printf("\t%s\n", path)
+		}
+	}
+	return nil
+}
+
+// NormalizeIndexFormat rewrites an index that older versions left partly in their formats
+// entirely in the current one (see storage.NormalizeIndexFormat). It is safe to run at any
+// time; an index already in the current format is left untouched.
+func NormalizeIndexFormat() (storage.IndexNormalization, error) {
+	if _, err := enterRepoRoot(); err != nil {
+		return storage.IndexNormalization{}, err
+	}
+	return storage.NormalizeIndexFormat()
+}
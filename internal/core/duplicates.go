@@ -0,0 +1,61 @@
+package core
+
+import (
+	"sort"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+// DuplicateGroup is a set of tracked paths whose staged content is identical.
+type DuplicateGroup struct {
+	Hash  string
+	Size  int64    // the size of one copy, as recorded in the index
+	Paths []string // sorted
+}
+
+// Wasted returns the bytes taken up by every copy but one.
+func (g DuplicateGroup) Wasted() int64 {
+	return g.Size * int64(len(g.Paths)-1)
+}
+
+// FindDuplicates groups the index entries that share a content hash, for finding files
+// that were copied by accident. Only groups of two or more paths are returned, most
+// wasted bytes first (ties by first path). Nothing is read from the object store: sizes
+// come from the index. Submodules and empty-directory placeholders are skipped.
+func FindDuplicates() ([]DuplicateGroup, error) {
+	if _, err := enterRepoRoot(); err != nil {
+		return nil, err
+	}
+	index, err := storage.LoadIndexWithMeta()
+	if err != nil {
+		return nil, err
+	}
+
+	byHash := make(map[string]*DuplicateGroup)
+	for p, entry := range index {
+		if isEmptyDirPlaceholder(entry.Mode) || entry.Mode == storage.SubmoduleMode {
+			continue
+		}
+		g := byHash[entry.Hash]
+		if g == nil {
+			g = &DuplicateGroup{Hash: entry.Hash, Size: entry.Size}
+			byHash[entry.Hash] = g
+		}
+		g.Paths = append(g.Paths, p)
+	}
+
+	var groups []DuplicateGroup
+	for _, g := range byHash {
+		if len(g.Paths) > 1 {
+			sort.Strings(g.Paths)
+			groups = append(groups, *g)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if wi, wj := groups[i].Wasted(), groups[j].Wasted(); wi != wj {
+			return wi > wj
+		}
+		return groups[i].Paths[0] < groups[j].Paths[0]
+	})
+	return groups, nil
+}
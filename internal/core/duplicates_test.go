@@ -0,0 +1,60 @@
+package core
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestFindDuplicates(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Mkdir("copy", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"small.txt":      "hi\n",
+		"copy/small.txt": "hi\n",
+		"big.txt":        "a much longer line of text\n",
+		"copy/big.txt":   "a much longer line of text\n",
+		"big-2.txt":      "a much longer line of text\n",
+		"unique.txt":     "only once\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := AddAll(); err != nil {
+		t.Fatal(err)
+	}
+
+	groups, err := FindDuplicates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 2 {
+		t.Fatalf("FindDuplicates() = %+v, want 2 groups", groups)
+	}
+	if want := []string{"big-2.txt", "big.txt", "copy/big.txt"}; !reflect.DeepEqual(groups[0].Paths, want) {
+		t.Errorf("first group = %v, want %v", groups[0].Paths, want)
+	}
+	if groups[0].Size != 27 || groups[0].Wasted() != 54 {
+		t.Errorf("first group size %d, wasted %d; want 27, 54", groups[0].Size, groups[0].Wasted())
+	}
+	if want := []string{"copy/small.txt", "small.txt"}; !reflect.DeepEqual(groups[1].Paths, want) {
+		t.Errorf("second group = %v, want %v", groups[1].Paths, want)
+	}
+}
@@ -0,0 +1,49 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+// EmptyDirPlaceholder is the file name used for index entries that stand in for
+// an empty directory. The entry points at the empty blob and carries
+// storage.EmptyDirMode; checkout recreates the directory but never writes the
+// placeholder file itself. A user's own file of that name is an ordinary file.
+const EmptyDirPlaceholder = ".kitcatkeep"
+
+// trackEmptyDirsKey enables recording empty directories during `add --all`.
+// It is off by default because it changes which paths end up in trees.
+const trackEmptyDirsKey = "add.trackEmptyDirs"
+
+// isEmptyDirPlaceholder reports whether an index or tree entry of the given mode is an
+// empty-directory marker.
+func isEmptyDirPlaceholder(mode uint32) bool {
+	return mode == storage.EmptyDirMode
+}
+
+// emptyDirEntry returns the index entry recording an empty directory.
+func emptyDirEntry() (storage.IndexEntry, error) {
+	hash, err := storage.WriteObject(nil)
+	if err != nil {
+		return storage.IndexEntry{}, err
+	}
+	return storage.IndexEntry{Hash: hash, Mode: storage.EmptyDirMode}, nil
+}
+
+// isEmptyDir reports whether dir exists and has no entries at all.
+func isEmptyDir(dir string) bool {
+	f, err := os.Open(dir)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	names, err := f.Readdirnames(1)
+	return len(names) == 0 && err != nil
+}
+
+// materializePlaceholder recreates the directory an empty-directory marker stands for.
+func materializePlaceholder(path string) error {
+	return os.MkdirAll(filepath.Dir(filepath.FromSlash(path)), 0o755)
+}
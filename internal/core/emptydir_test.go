@@ -0,0 +1,134 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+func TestEmptyDirPlaceholders_AddCheckoutStatus(t *testing.T) {
+	for _, tt := range []struct {
+		trackEmptyDirs, lowMemory bool
+	}{
+		{false, false},
+		{true, false},
+		{false, true},
+		{true, true},
+	} {
+		t.Run("trackEmptyDirs="+strconv.FormatBool(tt.trackEmptyDirs)+",lowMemory="+strconv.FormatBool(tt.lowMemory), func(t *testing.T) {
+			cwd, err := os.Getwd()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() {
+				_ = os.Chdir(cwd)
+			}()
+			if err := os.Chdir(t.TempDir()); err != nil {
+				t.Fatal(err)
+			}
+			if err := InitRepo(); err != nil {
+				t.Fatal(err)
+			}
+			_ = SetConfig("user.name", "Test", false)
+			_ = SetConfig("user.email", "test@example.com", false)
+			_ = SetConfig(trackEmptyDirsKey, strconv.FormatBool(tt.trackEmptyDirs), false)
+			_ = SetConfig(lowMemoryKey, strconv.FormatBool(tt.lowMemory), false)
+
+			// An empty directory, and a user's own file that happens to be named like a placeholder
+			if err := os.Mkdir("build", 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Mkdir("keep", 0o755); err != nil {
+				t.Fatal(err)
+			}
+			userFile := filepath.Join("keep", EmptyDirPlaceholder)
+			if err := os.WriteFile(userFile, []byte("not a placeholder\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if err := AddAll(); err != nil {
+				t.Fatal(err)
+			}
+
+			index, err := storage.LoadIndexWithMeta()
+			if err != nil {
+				t.Fatal(err)
+			}
+			userEntry, ok := index["keep/"+EmptyDirPlaceholder]
+			if !ok || userEntry.Mode != 0 {
+				t.Fatalf("user file entry = %+v (tracked %v), want an ordinary file", userEntry, ok)
+			}
+			placeholder, tracked := index["build/"+EmptyDirPlaceholder]
+			if tracked != tt.trackEmptyDirs || tracked && placeholder.Mode != storage.EmptyDirMode {
+				t.Fatalf("placeholder entry = %+v (tracked %v), want tracked %v with EmptyDirMode", placeholder, tracked, tt.trackEmptyDirs)
+			}
+			first, _, err := Commit("first")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Status checks the user's file itself, not only its directory
+			if err := os.WriteFile(userFile, []byte("edited, and longer than before\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			status, err := GetStatus()
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []StatusEntry{{Path: "keep/" + EmptyDirPlaceholder, Change: ChangeModified}}
+			if !reflect.DeepEqual(status.Unstaged, want) {
+				t.Errorf("unstaged after editing the user file = %v, want %v", status.Unstaged, want)
+			}
+
+			// Deleting both is reported, the placeholder only when it is tracked
+			if err := os.RemoveAll("keep"); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Remove("build"); err != nil {
+				t.Fatal(err)
+			}
+			if status, err = GetStatus(); err != nil {
+				t.Fatal(err)
+			}
+			want = []StatusEntry{{Path: "keep/" + EmptyDirPlaceholder, Change: ChangeDeleted}}
+			if tt.trackEmptyDirs {
+				want = append([]StatusEntry{{Path: "build/" + EmptyDirPlaceholder, Change: ChangeDeleted}}, want...)
+			}
+			if !reflect.DeepEqual(status.Unstaged, want) {
+				t.Errorf("unstaged after deleting = %v, want %v", status.Unstaged, want)
+			}
+			if err := AddAll(); err != nil {
+				t.Fatal(err)
+			}
+			if _, _, err := Commit("second"); err != nil {
+				t.Fatal(err)
+			}
+
+			// Checkout writes the user's file back and recreates the empty directory
+			// without a placeholder file in it
+			if err := CheckoutCommit(first.ID); err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(userFile)
+			if err != nil || string(data) != "not a placeholder\n" {
+				t.Errorf("user file after checkout = %q, %v", data, err)
+			}
+			entries, err := os.ReadDir("build")
+			if tt.trackEmptyDirs && (err != nil || len(entries) != 0) {
+				t.Errorf("build after checkout = %v, %v, want an empty directory", entries, err)
+			}
+			if !tt.trackEmptyDirs && !os.IsNotExist(err) {
+				t.Errorf("build recreated without add.trackEmptyDirs: %v", err)
+			}
+			if status, err = GetStatus(); err != nil {
+				t.Fatal(err)
+			}
+			if !status.Clean() {
+				t.Errorf("status after checkout = %+v, want clean", status)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package core
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+func TestEmptyRepo_HistoryDependentOperations(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	_ = SetConfig("user.name", "Test", false)
+	_ = SetConfig("user.email", "test@example.com", false)
+
+	if err := os.WriteFile("a.txt", []byte("hello\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddFile("a.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ResolveHead(); !errors.Is(err, storage.ErrNoCommits) {
+		t.Errorf("ResolveHead() error = %v, want ErrNoCommits", err)
+	}
+	if err := ShowLog(true, 0); err != nil {
+		t.Errorf("ShowLog() = %v, want empty history", err)
+	}
+
+	status, err := GetStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status.Staged) != 1 || status.Staged[0] != (StatusEntry{Path: "a.txt", Change: ChangeAdded}) {
+		t.Errorf("staged = %+v, want a.txt as new", status.Staged)
+	}
+
+	files, err := DiffFiles(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Path != "a.txt" || files[0].Change != ChangeAdded || files[0].Insertions != 1 {
+		t.Errorf("staged diff = %+v, want a.txt added against the empty tree", files)
+	}
+	if files, err = DiffFiles(false); err != nil {
+		t.Fatal(err)
+	}
+	for _, fd := range files {
+		if fd.Path == "a.txt" {
+			t.Errorf("unstaged diff reports clean a.txt: %+v", fd)
+		}
+	}
+
+	if dirty, err := IsWorkDirDirty(); err != nil || !dirty {
+		t.Errorf("IsWorkDirDirty() = %v, %v; want dirty with a staged file", dirty, err)
+	}
+	if _, err := CommitAmend(""); err == nil || err.Error() != "no commits to amend" {
+		t.Errorf("CommitAmend() error = %v", err)
+	}
+	if err := CreateTag("v1", "HEAD"); !errors.Is(err, storage.ErrNoCommits) {
+		t.Errorf("CreateTag(HEAD) error = %v, want ErrNoCommits", err)
+	}
+	if _, err := os.Stat(filepath.Join(TagsDir(), "v1")); !os.IsNotExist(err) {
+		t.Error("tag created in a repository without commits")
+	}
+}
+
+func TestMerge_IntoBranchWithoutCommits(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	_ = SetConfig("user.name", "Test", false)
+	_ = SetConfig("user.email", "test@example.com", false)
+
+	if err := os.WriteFile("a.txt", []byte("hello\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddFile("a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	commit, _, err := Commit("first")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Switch to a new branch that has no commits and an empty index.
+	if err := os.WriteFile(filepath.Join(HeadsDir(), "fresh"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteHead(Head{Ref: "refs/heads/fresh"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.WriteIndex(map[string]string{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove("a.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Merge("main"); err != nil {
+		t.Fatal(err)
+	}
+	head, err := ReadHead()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head.Ref != "refs/heads/fresh" || head.Hash != commit.ID {
+		t.Errorf("HEAD = %+v, want fresh at %s", head, commit.ID)
+	}
+	if data, err := os.ReadFile("a.txt"); err != nil || string(data) != "hello\n" {
+		t.Errorf("a.txt = %q, %v", data, err)
+	}
+}
@@ -0,0 +1,91 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+func TestAdd_ExcludePatterns(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	ClearIgnoreCache()
+	defer ClearIgnoreCache()
+
+	files := map[string]string{
+		".kitignore":           "*.log\n",
+		".kitcat/info/exclude": "local.txt\n",
+		"a.txt":                "a\n",
+		"app.log":              "log\n",
+		"local.txt":            "local\n",
+		"dist/out.js":          "generated\n",
+		"gen/keep.txt":         "keep\n",
+	}
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Tracked before the exclude applies, so it stays tracked.
+	if err := AddFile("gen/keep.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ParseExcludePatterns([]string{"bad["}); err == nil {
+		t.Error("invalid exclude pattern accepted")
+	}
+	opts := AddOptions{Exclude: []string{"dist/", "gen/"}}
+	if err := AddAllWithOptions(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+	tracked := func() map[string]string {
+		t.Helper()
+		index, err := storage.LoadIndex()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return index
+	}
+	index := tracked()
+	for _, name := range []string{".kitignore", "a.txt", "gen/keep.txt"} {
+		if _, ok := index[name]; !ok {
+			t.Errorf("%s not tracked", name)
+		}
+	}
+	for _, name := range []string{"app.log", "local.txt", "dist/out.js"} {
+		if _, ok := index[name]; ok {
+			t.Errorf("%s tracked, want ignored", name)
+		}
+	}
+
+	// The excludes applied to that add only.
+	if err := AddFileWithOptions("dist", AddOptions{Exclude: []string{"*.js"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tracked()["dist/out.js"]; ok {
+		t.Error("dist/out.js tracked despite --exclude '*.js'")
+	}
+	if err := AddFile("dist"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tracked()["dist/out.js"]; !ok {
+		t.Error("dist/out.js not tracked by a later add without excludes")
+	}
+}
@@ -0,0 +1,74 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+// ErrPathNotInCommit is returned by FileAtCommit and ExtractFile for a path the commit
+// does not have.
+var ErrPathNotInCommit = errors.New("path does not exist in commit")
+
+// FileAtCommit returns the content of path as of ref, and the permission bits recorded for
+// it (0 when none were). ref may be HEAD, a branch, a tag, or a full or abbreviated commit
+// hash; path is relative to the repository root, as in the index. Neither the index nor
+// the working tree is read or touched.
+func FileAtCommit(ref, path string) ([]byte, uint32, error) {
+	if _, err := enterRepoRoot(); err != nil {
+		return nil, 0, err
+	}
+	commit, ok, err := resolveShowCommit(ref)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !ok {
+		return nil, 0, fmt.Errorf("unknown revision '%s'", ref)
+	}
+	tree, err := storage.ParseTree(commit.TreeHash)
+	if err != nil {
+		return nil, 0, err
+	}
+	modes, err := storage.ParseTreeModes(commit.TreeHash)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	key := storage.IndexKey(path)
+	hash, found := tree[key]
+	if !found {
+		for p := range tree {
+			if strings.HasPrefix(p, key+"/") {
+				return nil, 0, fmt.Errorf("'%s' is a directory in '%s', not a file", key, ref)
+			}
+		}
+		return nil, 0, fmt.Errorf("'%s' in '%s': %w", key, ref, ErrPathNotInCommit)
+	}
+	if modes[key] == storage.SubmoduleMode {
+		return nil, 0, fmt.Errorf("'%s' is a submodule in '%s', not a file", key, ref)
+	}
+	content, err := storage.ReadObject(hash)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read %s from '%s': %w", key, ref, err)
+	}
+	return content, modes[key], nil
+}
+
+// ExtractFile writes path as of ref to destPath, e.g. to look at a file as it was in a
+// release without checking the release out (see FileAtCommit). destPath is relative to the
+// current directory and is replaced atomically if it exists; its directory must exist.
+// The file gets the mode checkout would give it.
+func ExtractFile(ref, path, destPath string) error {
+	dest, err := filepath.Abs(destPath)
+	if err != nil {
+		return err
+	}
+	content, mode, err := FileAtCommit(ref, path)
+	if err != nil {
+		return err
+	}
+	return SafeWrite(dest, content, worktreeMode(mode, GetConfigBool(preservePermissionsKey, false)))
+}
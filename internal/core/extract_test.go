@@ -0,0 +1,93 @@
+package core
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+func TestExtractFile_WritesHistoricalVersion(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	_ = SetConfig("user.name", "Test", false)
+	_ = SetConfig("user.email", "test@example.com", false)
+
+	if err := os.MkdirAll("docs", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("docs/notes.txt", []byte("v1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddAll(); err != nil {
+		t.Fatal(err)
+	}
+	first, _, err := Commit("first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("docs/notes.txt", []byte("v2 edited\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddAll(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Commit("second"); err != nil {
+		t.Fatal(err)
+	}
+	indexBefore, err := storage.LoadIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Run from a subdirectory: the destination is relative to it, the path to the root.
+	root, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir("docs"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ExtractFile(first.ID[:7], "docs/notes.txt", "old.txt"); err != nil {
+		t.Fatalf("ExtractFile failed: %v", err)
+	}
+	if err := os.Chdir(root); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(filepath.Join("docs", "old.txt")); err != nil || string(data) != "v1\n" {
+		t.Errorf("extracted file = %q, %v, want %q", data, err, "v1\n")
+	}
+	if data, _ := os.ReadFile("docs/notes.txt"); string(data) != "v2 edited\n" {
+		t.Errorf("working tree file changed to %q", data)
+	}
+	indexAfter, err := storage.LoadIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(indexAfter) != len(indexBefore) || indexAfter["docs/notes.txt"] != indexBefore["docs/notes.txt"] {
+		t.Errorf("index changed: %v, was %v", indexAfter, indexBefore)
+	}
+
+	if content, _, err := FileAtCommit("HEAD", "docs/notes.txt"); err != nil || string(content) != "v2 edited\n" {
+		t.Errorf("FileAtCommit(HEAD) = %q, %v", content, err)
+	}
+	if _, _, err := FileAtCommit("HEAD", "missing.txt"); !errors.Is(err, ErrPathNotInCommit) {
+		t.Errorf("missing path error = %v, want ErrPathNotInCommit", err)
+	}
+	if _, _, err := FileAtCommit("HEAD", "docs"); err == nil {
+		t.Error("extracting a directory succeeded")
+	}
+}
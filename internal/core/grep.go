@@ -4,7 +4,6 @@ import (
 	"bufio"
 	"bytes"
 	"fmt"
-	"os"
 	"regexp"
 	"sort"
 	"strings"
@@ -20,77 +19,85 @@ func isBinary(data []byte) bool {
 	return bytes.Contains(data, []byte{0})
 }
 
-/*
-kitcat grep implementation
-*/
-func Grep(args []string) error {
-	if len(args) == 0 {
-		return fmt.Errorf("usage: kitcat grep [--line-number] <pattern>")
-	}
-
-	showLineNumber := false
-	i := 0
+// GrepOptions controls Grep.
+type GrepOptions struct {
+	// IgnoreCase matches the pattern case-insensitively.
+	IgnoreCase bool
+	// PathPrefix limits the search to a tracked file or the files under a directory,
+	// as a repository-relative path. Empty or "." searches everything.
+	PathPrefix string
+}
 
-	if args[0] == "--line-number" {
-		showLineNumber = true
-		i++
-	}
+// GrepMatch is a line Grep found.
+type GrepMatch struct {
+	Path string // forward slashes
+	Line int    // 1-based
+	Text string // without the line ending
+}
 
-	if len(args[i:]) < 1 {
-		return fmt.Errorf("usage: kitcat grep [--line-number] <pattern>")
+// Grep searches tracked content for lines matching the regular expression pattern. With
+// an empty ref it searches the blobs staged in the index, otherwise those of the commit
+// ref names (a branch, HEAD, a tag or a full or abbreviated hash); the working tree is
+// never read, so unstaged edits and untracked files are not searched. Blobs are read one
+// at a time; binary and non-UTF-8 ones are skipped, as are submodules. Matches are
+// ordered by path, then line.
+func Grep(pattern, ref string, opts GrepOptions) ([]GrepMatch, error) {
+	if opts.IgnoreCase {
+		pattern = "(?i)" + pattern
 	}
-
-	pattern := args[i]
-
 	re, err := regexp.Compile(pattern)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	prefix := storage.IndexKey(opts.PathPrefix)
+	if !IsSafePath(prefix) {
+		return nil, fmt.Errorf("unsafe path: %s", opts.PathPrefix)
 	}
 
-	// Load kitcat index (only tracked files)
-	indexMap, err := storage.LoadIndex()
+	if _, err := enterRepoRoot(); err != nil {
+		return nil, err
+	}
+	entries, modes, sourceName, err := restoreSource(ref)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Deterministic order: sort file paths
-	paths := make([]string, 0, len(indexMap))
-	for path := range indexMap {
+	paths := make([]string, 0, len(entries))
+	for path := range entries {
+		if prefix != "." && path != prefix && !strings.HasPrefix(path, prefix+"/") {
+			continue
+		}
+		if isEmptyDirPlaceholder(modes[path]) || modes[path] == storage.SubmoduleMode {
+			continue
+		}
 		paths = append(paths, path)
 	}
 	sort.Strings(paths)
 
+	var matches []GrepMatch
 	for _, path := range paths {
-		data, err := os.ReadFile(path)
+		data, err := storage.ReadObject(entries[path])
 		if err != nil {
-			continue
+			return nil, fmt.Errorf("failed to read %s from %s: %w", path, sourceName, err)
 		}
 
-		// Skip binary files
-		if isBinary(data) {
+		// Skip binary files; only UTF-8 files are scanned
+		if isBinary(data) || !utf8.Valid(data) {
 			continue
 		}
 
-		// Only UTF-8 files are scanned
-		if !utf8.Valid(data) {
-			continue
-		}
-
-		scanner := bufio.NewScanner(strings.NewReader(string(data)))
-		lineNo := 1
-
-		for scanner.Scan() {
-			line := scanner.Text()
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+		for lineNo := 1; scanner.Scan(); lineNo++ {
+			line := strings.TrimSuffix(scanner.Text(), "\r")
 			if re.MatchString(line) {
-				if showLineNumber {
-					fmt.Printf("%s:%d:%s\n", path, lineNo, line)
-				} else {
-					fmt.Printf("%s:%s\n", path, line)
-				}
+				matches = append(matches, GrepMatch{Path: path, Line: lineNo, Text: line})
 			}
-			lineNo++
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to scan %s: %w", path, err)
 		}
 	}
-
-	return nil
+	return matches, nil
 }
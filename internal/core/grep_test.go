@@ -1,12 +1,9 @@
 package core
 
 import (
-	"bytes"
 	"os"
-	"strings"
+	"reflect"
 	"testing"
-
-	"github.com/LeeFred3042U/kitcat/internal/storage"
 )
 
 func TestGrepBasic(t *testing.T) {
@@ -26,64 +23,87 @@ func TestGrepBasic(t *testing.T) {
 	if err := os.Chdir(tmpDir); err != nil {
 		t.Fatal(err)
 	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetConfig("user.name", "Test", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetConfig("user.email", "test@example.com", false); err != nil {
+		t.Fatal(err)
+	}
 
 	// Create test files
+	if err := os.Mkdir("cmd", 0o755); err != nil {
+		t.Fatal(err)
+	}
 	mainContent := "package main\n\nfunc main() {}\n"
-	if err := os.WriteFile("main.go", []byte(mainContent), 0644); err != nil {
+	if err := os.WriteFile("cmd/main.go", []byte(mainContent), 0644); err != nil {
 		t.Fatal(err)
 	}
-
-	if err := os.WriteFile("ignore.go", []byte("func ignored() {}\n"), 0644); err != nil {
+	if err := os.WriteFile("util.go", []byte("// Func helpers\nfunc util() {}\n"), 0644); err != nil {
 		t.Fatal(err)
 	}
-
-	// Create .kitcat directory
-	if err := os.Mkdir(".kitcat", 0755); err != nil {
+	if err := os.WriteFile("data.bin", []byte("func\x00"), 0644); err != nil {
 		t.Fatal(err)
 	}
-
-	// Write kitcat index (ONLY tracked files)
-	index := map[string]string{
-		"main.go": "dummyhash",
+	if err := AddAll(); err != nil {
+		t.Fatal(err)
 	}
-
-	if err := storage.WriteIndex(index); err != nil {
+	commit, _, err := Commit("initial")
+	if err != nil {
 		t.Fatal(err)
 	}
 
-	// Capture stdout
-	var buf bytes.Buffer
-	oldStdout := os.Stdout
-	r, w, err := os.Pipe()
-	if err != nil {
+	// Unstaged edits and untracked files are not searched.
+	if err := os.WriteFile("util.go", []byte("func edited() {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("ignore.go", []byte("func ignored() {}\n"), 0644); err != nil {
 		t.Fatal(err)
 	}
-	os.Stdout = w
 
-	// Run grep
-	if err := Grep([]string{"--line-number", "func"}); err != nil {
+	matches, err := Grep("func", "", GrepOptions{})
+	if err != nil {
 		t.Fatalf("grep returned error: %v", err)
 	}
+	want := []GrepMatch{
+		{Path: "cmd/main.go", Line: 3, Text: "func main() {}"},
+		{Path: "util.go", Line: 2, Text: "func util() {}"},
+	}
+	if !reflect.DeepEqual(matches, want) {
+		t.Errorf("Grep(index) = %+v, want %+v", matches, want)
+	}
 
-	// Restore stdout
-	if err := w.Close(); err != nil {
+	// Staged content is searched; the commit keeps the old version.
+	if err := AddFile("util.go"); err != nil {
 		t.Fatal(err)
 	}
-	os.Stdout = oldStdout
-
-	if _, err := buf.ReadFrom(r); err != nil {
-		t.Fatalf("failed to read output: %v", err)
+	matches, err = Grep("^func", "", GrepOptions{PathPrefix: "util.go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []GrepMatch{{Path: "util.go", Line: 1, Text: "func edited() {}"}}; !reflect.DeepEqual(matches, want) {
+		t.Errorf("Grep(index, util.go) = %+v, want %+v", matches, want)
 	}
 
-	output := buf.String()
-
-	// Assert expected match
-	if !strings.Contains(output, "main.go:3:func main()") {
-		t.Fatalf("expected match not found, got:\n%s", output)
+	matches, err = Grep("func", commit.ID, GrepOptions{IgnoreCase: true, PathPrefix: "util.go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []GrepMatch{
+		{Path: "util.go", Line: 1, Text: "// Func helpers"},
+		{Path: "util.go", Line: 2, Text: "func util() {}"},
+	}
+	if !reflect.DeepEqual(matches, want) {
+		t.Errorf("Grep(commit, -i) = %+v, want %+v", matches, want)
 	}
 
-	// Ensure untracked file is ignored
-	if strings.Contains(output, "ignore.go") {
-		t.Fatalf("untracked file should not be searched")
+	matches, err = Grep("func", "HEAD", GrepOptions{PathPrefix: "cmd"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 1 || matches[0].Path != "cmd/main.go" {
+		t.Errorf("Grep(HEAD, cmd) = %+v, want only cmd/main.go", matches)
 	}
 }
@@ -0,0 +1,105 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+const symbolicRefPrefix = "ref: "
+
+// Head describes what .kitcat/HEAD points at.
+// An attached HEAD stores a symbolic ref ("ref: refs/heads/main"); a detached HEAD stores a
+// commit hash directly.
+type Head struct {
+	// Ref is the symbolic target such as "refs/heads/main". Empty when HEAD is detached.
+	Ref string
+	// Hash is the commit HEAD resolves to. Empty on a branch that has no commits yet.
+	Hash string
+}
+
+// IsDetached reports whether HEAD points directly at a commit rather than a branch.
+func (h Head) IsDetached() bool {
+	return h.Ref == ""
+}
+
+// Branch returns the short branch name for an attached HEAD, or "" when detached.
+func (h Head) Branch() string {
+	return strings.TrimPrefix(h.Ref, "refs/heads/")
+}
+
+// ReadHead parses .kitcat/HEAD and resolves it to a commit hash.
+// A symbolic ref whose branch file does not exist yet is returned with an empty Hash.
+func ReadHead() (Head, error) {
+	return readHeadAt(RepoDir())
+}
+
+// readHeadAt is ReadHead for the repository directory repoDir, e.g. a submodule's.
+func readHeadAt(repoDir string) (Head, error) {
+	headData, err := os.ReadFile(filepath.Join(repoDir, "HEAD"))
+	if err != nil {
+		return Head{}, err
+	}
+	ref := strings.TrimSpace(string(headData))
+
+	if !strings.HasPrefix(ref, symbolicRefPrefix) {
+		return Head{Hash: ref}, nil
+	}
+
+	head := Head{Ref: strings.TrimPrefix(ref, symbolicRefPrefix)}
+	commitHash, err := os.ReadFile(filepath.Join(repoDir, head.Ref))
+	if err != nil && !os.IsNotExist(err) {
+		return Head{}, err
+	}
+	head.Hash = strings.TrimSpace(string(commitHash))
+	return head, nil
+}
+
+// WriteHead stores h in .kitcat/HEAD. For an attached HEAD with a Hash the branch ref is
+// updated too, so writing back a Head returned by ReadHead restores both exactly.
+func WriteHead(h Head) error {
+	if h.IsDetached() {
+		if h.Hash == "" {
+			return errors.New("cannot detach HEAD without a commit")
+		}
+		return SafeWrite(HeadPath(), []byte(h.Hash), 0o644)
+	}
+
+	if h.Hash != "" {
+		refFile := filepath.Join(RepoDir(), h.Ref)
+		if err := os.MkdirAll(filepath.Dir(refFile), 0o755); err != nil {
+			return fmt.Errorf("could not create refs directory: %w", err)
+		}
+		if err := SafeWrite(refFile, []byte(h.Hash), 0o644); err != nil {
+			return fmt.Errorf("failed to update branch pointer: %w", err)
+		}
+	}
+	return SafeWrite(HeadPath(), []byte(symbolicRefPrefix+h.Ref+"\n"), 0o644)
+}
+
+// ResolveHead returns the commit hash HEAD currently points to, whether attached or detached.
+// On a branch without commits (a fresh repository) the error wraps storage.ErrNoCommits.
+func ResolveHead() (string, error) {
+	head, err := ReadHead()
+	if err != nil {
+		return "", err
+	}
+	if head.Hash == "" {
+		return "", fmt.Errorf("HEAD does not point to a commit: branch '%s' has %w", head.Branch(), storage.ErrNoCommits)
+	}
+	return head.Hash, nil
+}
+
+// moveHead points the current branch at commitHash, or HEAD itself when detached.
+func moveHead(commitHash string) error {
+	head, err := ReadHead()
+	if err != nil {
+		return fmt.Errorf("could not read HEAD: %w", err)
+	}
+	head.Hash = commitHash
+	return WriteHead(head)
+}
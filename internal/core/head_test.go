@@ -0,0 +1,80 @@
+package core
+
+import (
+	"os"
+	"testing"
+)
+
+func TestHead_CommitAndResetFollowAttachment(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	_ = SetConfig("user.name", "Test", false)
+	_ = SetConfig("user.email", "test@example.com", false)
+
+	commitFile := func(content string) string {
+		t.Helper()
+		if err := os.WriteFile("a.txt", []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := AddAll(); err != nil {
+			t.Fatal(err)
+		}
+		c, _, err := Commit(content)
+		if err != nil {
+			t.Fatalf("Commit failed: %v", err)
+		}
+		return c.ID
+	}
+
+	first := commitFile("one")
+	second := commitFile("second")
+
+	// Reset on a branch moves the branch, HEAD stays attached.
+	if err := Reset(first, ResetHard); err != nil {
+		t.Fatalf("Reset failed: %v", err)
+	}
+	head, err := ReadHead()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head.IsDetached() || head.Branch() != "main" || head.Hash != first {
+		t.Errorf("after reset got %+v, want main at %s", head, first)
+	}
+
+	// Committing while detached moves HEAD itself and leaves the branch alone.
+	if err := CheckoutCommit(second); err != nil {
+		t.Fatal(err)
+	}
+	third := commitFile("the third")
+	head, err = ReadHead()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !head.IsDetached() || head.Hash != third {
+		t.Errorf("detached commit got %+v, want detached at %s", head, third)
+	}
+	branchHash, err := os.ReadFile(".kitcat/refs/heads/main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(branchHash) != first {
+		t.Errorf("main moved to %s during detached commit, want %s", branchHash, first)
+	}
+
+	resolved, err := ResolveHead()
+	if err != nil || resolved != third {
+		t.Errorf("ResolveHead = %s, %v; want %s", resolved, err, third)
+	}
+}
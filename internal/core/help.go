@@ -10,19 +10,19 @@ type CommandHelp struct {
 var helpMessages = map[string]CommandHelp{
 	"init": {
 		Summary: "Initialize a new KitCat repository",
-		Usage:   "Usage: kitcat init\n\nInitializes a new .kitcat directory in the current folder, preparing it for tracking files",
+		Usage:   "Usage: kitcat init\n\nInitializes a new .kitcat directory in the current folder, preparing it for tracking files.\nThe initial branch is named by the init.defaultBranch config (default main); set it with --global for new repositories.",
 	},
 	"add": {
 		Summary: "Add file contents to the index.",
-		Usage:   "Usage: kitcat add <file-path> | --all | -A\n\nThis command adds file contents to the staging area.\nUse '--all' or '-A' to stage all new, modified, and deleted files.",
+		Usage:   "Usage: kitcat add [--force] [--no-binary] [--keep-going] [--follow-symlinks] [--stats] [--exclude <pattern>]... <file-path> | --all | -A\n\nThis command adds file contents to the staging area.\nUse '--all' or '-A' to stage all new, modified, and deleted files.\nFiles larger than the add.maxFileSize config (e.g. 50m) are refused; use '--force' to add them anyway.\nWith '--no-binary' (or the add.excludeBinary config) files containing NUL bytes are skipped and reported.\nWith '--keep-going' (-k) a directory add stages every readable file and reports the failures at the end, instead of stopping at the first one.\nFiles whose size and mtime match the index are assumed unchanged and not re-read. On network filesystems with\nunreliable mtimes set core.trustMtime=false to re-hash every file: slower (the whole tree is read) but never misses a change.\nWith core.preservePermissions=true the full permission bits are recorded and restored exactly by checkout and restore;\notherwise checked-out files are 0644, or 0755 if a recorded mode is executable.\nWith add.dirCache=true, --all skips reading directories whose mtime is unchanged since the last run (only their\ntracked files are checked), which speeds up deep trees and large ignored directories.\nWith '--follow-symlinks' (or add.followSymlinks=true) symlinks to directories are followed and their files staged\nunder the link's path; a link back to a directory being walked is skipped with a warning.\nWith '--stats' the files walked, hashed and skipped by the fast path, the bytes hashed and the time spent walking,\nhashing and writing the index are printed after the add.\nEach '--exclude <pattern>' ignores files matching a .kitignore-style pattern for this add only, on top of .kitignore\nand .kitcat/info/exclude; a file matching any of them is ignored, and tracked files are never ignored.",
 	},
 	"commit": {
 		Summary: "Record changes to the repository.",
-		Usage:   "Usage: kitcat commit <-m | -am | --amend> <message>\n\nCreates a new commit from the staging area.\nUse '-am' to automatically stage all tracked files before committing.\nUse '--amend' to modify the previous commit.",
+		Usage:   "Usage: kitcat commit <-m | -am | --amend> <message> [-- <path>...]\n\nCreates a new commit from the staging area.\nUse '-am' to automatically stage all tracked files before committing.\nUse '--amend' to replace the previous commit with one that also includes newly staged changes; without -m the message is kept.\nWith '-m <message> -- <path>...' only the staged changes to those paths are committed; everything else stays staged.\nWith commit.sign set (or -c commit.sign=true for one commit) the commit is signed with the ed25519 key at user.signingKey; see verify-commit.",
 	},
 	"diff": {
 		Summary: "Show changes between the last commit and staging area",
-		Usage:   "Usage: kitcat diff\n\nShows content differences between the HEAD commit and the index",
+		Usage:   "Usage: kitcat diff [--cached] [--stat] [--json] [-w | --ignore-all-space] [--ignore-space-at-eol] [--ignore-blank-lines]\n\nShows content differences between the index and the working tree, or between the last commit and the index with --cached.\nThe diff.algorithm config key picks the line diff: myers (default), patience or histogram.\nThe whitespace flags compare lines with all whitespace or trailing whitespace removed, or ignore inserted and deleted blank lines; lines are still shown as they are, and files left without changes are omitted.\nWith --json, prints an array of {path, change, binary, oldSize, newSize, insertions, deletions, lines: [{op, text}]} objects; binary files carry their sizes instead of lines.",
 	},
 	"log": {
 		Summary: "Show the commit history",
@@ -36,9 +36,17 @@ var helpMessages = map[string]CommandHelp{
 		Summary: "Merge a branch into the current branch.",
 		Usage:   "Usage: kitcat merge <branch-name>\n\nJoins another branch's history into the current branch. Currently, only fast-forward merges are supported.",
 	},
+	"ls-tree": {
+		Summary: "List the files of a commit without checking it out",
+		Usage:   "Usage: kitcat ls-tree [--json] [<commit> [<path>]]\n\nPrints the mode, object hash, size and path of every file in <commit> (default HEAD), sorted by path.\nWith <path>, only files at or below it are listed. Mode 000000 means none was recorded.\nWith --json, prints an array of {path, hash, mode, size} objects.",
+	},
 	"ls-files": {
 		Summary: "Show information about files in the index",
-		Usage:   "Usage: kitcat ls-files\n\nPrints a list of all files that are currently in the index (staging area)",
+		Usage:   "Usage: kitcat ls-files [-s] [--json] [--staged] [-m] [--skip-worktree] [--assume-unchanged] [<path>]\n\nPrints a sorted list of files that are currently in the index (staging area).\nFlags:\n  -s, --stage         Show the object hash and size of each entry\n  --staged            Only files whose staged content differs from HEAD\n  -m, --modified      Only files modified or deleted in the working tree\n  --skip-worktree     Only entries marked skip-worktree\n  --assume-unchanged  Only entries marked assume-unchanged\n  --json              Print an array of {path, hash, size, mtime, assumeUnchanged, skipWorktree} objects\n  <path>              Only entries at or below this path",
+	},
+	"update-index": {
+		Summary: "Mark index entries assume-unchanged or skip-worktree",
+		Usage:   "Usage: kitcat update-index (--[no-]assume-unchanged | --[no-]skip-worktree) <path>...\n\nSets or clears a flag on tracked files.\nFlags:\n  --assume-unchanged  Trust the working-tree file as unchanged, e.g. in ls-files -m\n  --skip-worktree     Keep the file tracked but out of the working tree\n  --no-...            Clear the flag again\nList marked files with ls-files --assume-unchanged or --skip-worktree.",
 	},
 	"clean": {
 		Summary: "Remove untracked files from the working directory",
@@ -50,27 +58,107 @@ var helpMessages = map[string]CommandHelp{
 	},
 	"reset": {
 		Summary: "Reset current HEAD to the specified state",
-		Usage:   "Usage: kitcat reset --hard <commit>\n\nResets the index and working tree. Any changes to tracked files in the working tree since <commit> are discarded.",
+		Usage:   "Usage: kitcat reset --hard [--force] <commit>\n\nResets the index and working tree. Any changes to tracked files in the working tree since <commit> are discarded.\nA hard reset refuses to run while there are staged or unstaged changes; --force (-f) discards them.",
 	},
 	"checkout": {
 		Summary: "Switch branches or restore working tree files",
-		Usage:   "Usage: kitcat checkout <branch> or checkout -b <new-branch>\n\nSwitches to a branch. Use -b to create a new branch and switch to it.",
+		Usage:   "Usage: kitcat checkout <branch> | [--force] <commit> or checkout -b <new-branch>\n\nSwitches to a branch. Use -b to create a new branch and switch to it.\nA commit hash (full, or abbreviated to at least 4 hex digits) detaches HEAD at that commit;\nit refuses to discard uncommitted changes unless --force is given.\nUse --dry-run <branch|commit> to list the files checkout would create, overwrite or delete.\nSet checkout.mtime=commit to stamp written files with the commit time instead of the current time.\nSet checkout.hardlink=true to hard-link checked-out files to their stored objects instead of copying them; linked files are read-only.",
+	},
+	"extract": {
+		Summary: "Write one file as of a commit",
+		Usage:   "Usage: kitcat extract <ref> <path> [<dest>]\n\nWrites <path>, relative to the repository root, as it was in <ref> to <dest>, or to standard output without one.\n<ref> may be HEAD, a branch, a tag, or a full or abbreviated commit hash.\nThe index and the rest of the working tree are left alone.",
+	},
+	"merge-tree": {
+		Summary: "Preview a merge without touching the working tree",
+		Usage:   "Usage: kitcat merge-tree <ours> <theirs>\n\nMerges <theirs> into <ours> from their merge base entirely in the object store and prints the\nmerged tree's hash, then one CONFLICT line per path that needs resolving. Conflicted files are stored\nin the tree with conflict markers; nothing is written to the working tree, the index or any ref.\nExits with status 1 when there are conflicts.",
+	},
+	"for-each-ref": {
+		Summary: "List refs and the commits they point to",
+		Usage:   "Usage: kitcat for-each-ref [<pattern>]\n\nPrints \"<hash> <ref>\" for every branch, tag and remote-tracking ref, sorted by name.\n<pattern> is a glob over the full ref name in which * does not match /, e.g. refs/heads/* or refs/tags/v*;\na pattern without wildcards also matches the refs below it, e.g. refs/tags.",
+	},
+	"format-patch": {
+		Summary: "Write a commit as a patch file",
+		Usage:   "Usage: kitcat format-patch <ref> [<file>]\n\nWrites the commit <ref> as a patch, its author, date and message followed by a unified diff against its\nparent, to <file> or standard output. Binary files and submodules cannot be exported.",
+	},
+	"apply-patch": {
+		Summary: "Apply a patch file to the working tree and index",
+		Usage:   "Usage: kitcat apply-patch <file>\n\nApplies a patch written by format-patch (\"-\" reads standard input) and stages the result. The working tree\nmust be clean. Hunks are placed at an offset, or with up to two context lines ignored, when the files\nhave drifted; failing that a file is merged three-way from the version the patch was made against.\nIf any hunk is rejected it is reported and nothing is changed.",
+	},
+	"am": {
+		Summary: "Apply a patch file and commit it",
+		Usage:   "Usage: kitcat am <file>\n\nApplies a patch like apply-patch, then commits it with the patch's author and message.",
+	},
+	"show": {
+		Summary: "Show a commit, tree or blob",
+		Usage:   "Usage: kitcat show [<ref>]\n\nShows what <ref> names (default HEAD). <ref> may be HEAD, a branch, a tag, or a full or abbreviated hash.\nA commit is shown with its metadata and its diff against its parent, a tree as a listing of its entries,\nand a blob as its content.",
 	},
 	"show-object": {
 		Summary: "Provide content or type and size information for repository objects",
-		Usage:   "Usage: kitcat show-object <hash>\n\nShows the contents of the object identified by the hash.",
+		Usage:   "Usage: kitcat show-object <hash>\n\nShows the contents of the object identified by the hash.\nThe hash may be abbreviated to any unambiguous prefix of at least 4 characters.",
+	},
+	"repack": {
+		Summary: "Pack objects into a single delta-compressed pack",
+		Usage:   "Usage: kitcat repack\n\nCollects all objects referenced by history and the index into one pack.\nSuccessive versions of the same file are stored as deltas, and redundant loose objects are removed.\nThe index is also rewritten in compact canonical form.\nWaits for running add and commit commands, and holds new ones off until it is done.",
+	},
+	"write-tree": {
+		Summary: "Print the tree hash of the current index",
+		Usage:   "Usage: kitcat write-tree [--dry-run]\n\nBuilds a tree object from the index, stores it, and prints its hash without creating a commit.\nThe hash depends only on paths, content and recorded modes, so identical trees always print the same hash\nand it can be used as a content fingerprint, e.g. in CI. With --dry-run nothing is written.",
+	},
+	"downgrade-index": {
+		Summary: "Rewrite the index for older kitcat versions",
+		Usage:   "Usage: kitcat downgrade-index\n\nRewrites the index in the legacy \"path\": \"hash\" format that kitcat versions without index metadata read.\nSizes and mtimes are dropped, so the next add re-hashes every file; flags, recorded modes and on-disk names are dropped too.\nThe index is written in the current format again by the next command that updates it.",
+	},
+	"replay-index-ops": {
+		Summary: "Apply a recorded index operation log to this repository",
+		Usage:   "Usage: kitcat replay-index-ops <log>\n\nWith index.recordOps set (or KITCAT_RECORD_INDEX_OPS=1), every index write appends the entries it changed,\nbefore and after, to .kitcat/index-ops. Replaying that log in a fresh repository rebuilds the same index,\nfor reproducing index bugs. Only the recorded results are applied; objects are not copied.",
+	},
+	"normalize-index": {
+		Summary: "Rewrite the index entirely in the current format",
+		Usage:   "Usage: kitcat normalize-index\n\nUpgrades entries older kitcat versions left in the legacy \"path\": \"hash\" form and keys with backslashes,\nwhich reads only migrate in memory, and rewrites the index once. Values in no known format, which reads skip, are dropped.\nRunning it again does nothing; an index already in the current format is not rewritten.",
+	},
+	"watch": {
+		Summary: "Print working-tree changes as they happen",
+		Usage:   "Usage: kitcat watch\n\nPrints one \"<created|modified|deleted>\t<path>\" line per changed file until interrupted. Tracked files and untracked\nfiles that are not ignored are watched; .kitcat and nested repositories are not. The tree is scanned four times a second,\nand a file is reported once it has been left alone for half a second, so an editor's save is a single \"modified\".",
+	},
+	"verify-index": {
+		Summary: "Check index metadata against the working tree",
+		Usage:   "Usage: kitcat verify-index\n\nReports index entries whose recorded size differs from the file on disk, entries whose file is missing,\nand entries with no recorded size/mtime. Such files are re-hashed by every add instead of taking the fast path.\nNothing is read beyond file metadata and nothing is modified.",
+	},
+	"expire-oplog": {
+		Summary: "Drop old or unreachable operation log entries",
+		Usage:   "Usage: kitcat expire-oplog [--older-than <age>] [--unreachable]\n\nRemoves entries from the operation log so it stays bounded. <age> is a duration such as 12h or a number of days such as 30d.\nWith --unreachable, only entries whose commits no branch, tag, stash or HEAD reaches any more are removed;\nwith both options an entry must be old and unreachable. The log is rewritten atomically.",
+	},
+	"verify-history": {
+		Summary: "Check that a branch's commits and trees are all present",
+		Usage:   "Usage: kitcat verify-history [<branch>]\n\nWalks from <branch> (default HEAD) through every parent to the root commit and checks that each commit\nis in the commit log, still matches its hash, and has a tree that exists and decodes.\nReports the first broken link and exits with 1. Blobs are not read and nothing is modified.",
+	},
+	"verify-objects": {
+		Summary: "Re-hash every stored object to find corruption",
+		Usage:   "Usage: kitcat verify-objects\n\nRecomputes the hash of every loose and packed object and lists those whose content no longer matches,\nsorted by hash, exiting with 1 if there are any. Objects are checked concurrently by core.verifyWorkers\nworkers (default: the number of CPUs). Nothing is modified.",
+	},
+	"verify-commit": {
+		Summary: "Check the signature of a commit",
+		Usage:   "Usage: kitcat verify-commit [<commit>]\n\nChecks that <commit> (default HEAD) is signed, still matches its hash, and that its signature was made by a trusted key.\nTrusted keys are the PEM public keys in the file at user.trustedKeys, or else the public half of user.signingKey.\nPrints the fingerprint of the signing key; exits with 1 for unsigned, tampered or untrusted commits.\nCreate a key with: openssl genpkey -algorithm ed25519 -out key.pem (public half: openssl pkey -in key.pem -pubout).",
+	},
+	"duplicates": {
+		Summary: "List tracked files with identical content",
+		Usage:   "Usage: kitcat duplicates\n\nGroups the staged files that share a content hash, most wasted bytes (size x extra copies) first.\nSizes come from the index; no objects are read.",
 	},
 	"branch": {
 		Summary: "List, create, or delete branches",
-		Usage:   "Usage: kitcat branch <name> or branch -m <new-name>\n\nCreates a new branch. Use -m to rename an existing branch.",
+		Usage:   "Usage: kitcat branch <name> or branch -m <new-name> or branch -v [<base>]\n\nCreates a new branch. Use -m to rename an existing branch.\nWith -v, lists every branch with its tip commit and subject, and how many commits it is ahead of\nand behind <base> (default: the default branch); branches sharing no history with it are marked unrelated.",
 	},
 	"mv": {
 		Summary: "Move or rename a file, a directory, or a symlink",
-		Usage:   "Usage: kitcat mv <old> <new>\n\nRenames the file/directory <old> to <new>.",
+		Usage:   "Usage: kitcat mv [-f] [--cached] <old> <new>\n\nRenames the file/directory <old> to <new> and moves its index entries along, keeping what was staged.\nA destination that already exists or is tracked is refused without -f; -f also moves files with unstaged changes.\nWith --cached only the index entries are renamed and the working tree is left alone.",
 	},
 	"status": {
 		Summary: "Show the working tree status",
-		Usage:   "Usage: kitcat status\n\nDisplays paths that have differences between the working tree, the index and the last commit. Shows staged, unstaged and untracked files.",
+		Usage:   "Usage: kitcat status [--ignored] [--json]\n\nDisplays paths that have differences between the working tree, the index and the last commit. Shows staged, unstaged and untracked files.\nWith --ignored, also lists the untracked files matching .kitignore; a directory that is ignored as a whole is shown once, as dir/.\nWith --json, prints {branch, staged: [{path, change}], unstaged: [{path, change}], untracked: [path], ignored: [path]}.",
+	},
+	"snapshot": {
+		Summary: "Save and restore named snapshots of the index and tracked files",
+		Usage:   "Usage: kitcat snapshot save <name> | restore <name> | delete <name> | list\n\nsave copies the index and the current content of every tracked file into .kitcat/snapshots/<name>,\nleaving the working tree, HEAD and branches as they are. restore brings the tracked files and the index\nback to that state, overwriting local changes to tracked files; untracked files are never touched.",
 	},
 	"stash": {
 		Summary: "Stash the current working directory changes",
@@ -78,16 +166,24 @@ var helpMessages = map[string]CommandHelp{
 	},
 	"rebase": {
 		Summary: "Reapply commits on top of another base commit",
-		Usage:   "Usage: kitcat rebase <branch>\n\nReapplies the current branch commits on top of the specified branch, resulting in a linear commit history.",
+		Usage:   "Usage: kitcat rebase <branch>\n\nReapplies the current branch commits on top of the specified branch, resulting in a linear commit history.\nWhen a file was changed on both sides it is written with conflict markers; edit it, 'kitcat add' it and run 'kitcat rebase --continue'.\nSet merge.conflictStyle=diff3 to also show the original (base) content between ||||||| and =======.",
 	},
 	"grep": {
 		Summary: "Search for patterns in tracked files",
-		Usage:   "Usage: kitcat grep <pattern>\n\nSearches through tracked files in the repository and prints lines matching the given pattern.",
+		Usage:   "Usage: kitcat grep [-n] [-i] <pattern> [<commit>] [-- <path>]\n\nPrints the lines of tracked files that match the regular expression <pattern>, as staged in the index or, given <commit>, as committed there. The working tree is not read.\n-n shows line numbers, -i ignores case, and <path> limits the search to a file or directory. Binary files are skipped.",
 	},
 	"shortlog": {
 		Summary: "Summarize commit history by author",
 		Usage:   "Usage: kitcat shortlog\n\nDisplays a condensed summary of commit history, grouped by author, showing commit counts and messages.",
 	},
+	"restore": {
+		Summary: "Restore working tree files",
+		Usage:   "Usage: kitcat restore [--source=<commit>] <path>...\n\nOverwrites the given files (or every tracked file under a directory) with their staged content,\ndiscarding unstaged edits. With --source, restores from a branch or commit instead.\nThe index and HEAD are not changed.",
+	},
+	"submodule": {
+		Summary: "List or add submodules",
+		Usage:   "Usage: kitcat submodule [add <path> <url>]\n\nWithout arguments, lists the submodules in .kitcatmodules with their recorded commits.\n'add' records the kitcat repository at <path>, cloned from <url>, as a submodule: its HEAD commit is staged in place of its files.\nCloning is not supported yet; clone the repository at <path> first.\nCheckout moves initialized submodules to their recorded commits.",
+	},
 	"rm": {
 		Summary: "Remove files from the working tree and index",
 		Usage:   "Usage: kitcat rm <file-path>\n\nRemoves the specified file from the working directory & stages the removal for the next commit.",
@@ -95,11 +191,19 @@ var helpMessages = map[string]CommandHelp{
 }
 
 func PrintGeneralHelp() {
-	fmt.Println("usage: kitcat <command> [arguments]")
+	fmt.Println("usage: kitcat [-c <key>=<value>]... <command> [arguments]")
 	fmt.Println("\nThese are the common KitCat commands:")
 	for name, help := range helpMessages {
 		fmt.Printf("   %-12s %s\n", name, help.Summary)
 	}
+	fmt.Println("\nEnvironment:")
+	fmt.Println("   KITCAT_DIR         location of the repository directory (default .kitcat)")
+	fmt.Println("   KITCAT_INDEX_FILE  location of the index file (default $KITCAT_DIR/index)")
+	fmt.Println("   KITCAT_OBJECTS     location of the object store (default $KITCAT_DIR/objects,")
+	fmt.Println("                      or the core.objectsDir config key)")
+	fmt.Println("   KITCAT_AUTHOR_DATE fixed timestamp for new commits, RFC 3339 or Unix seconds,")
+	fmt.Println("                      for reproducible commit hashes")
+	fmt.Println("\n-c <key>=<value> sets a config value for this command only, without writing it")
 	fmt.Println("\nUse 'kitcat help <command>' for more information about a command")
 }
 
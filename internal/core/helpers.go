@@ -1,6 +1,7 @@
 package core
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -21,55 +22,153 @@ func UpdateWorkspaceAndIndex(commitHash string) error {
 	if err != nil {
 		return err
 	}
+	return materializeTree(targetTree, commit)
+}
+
+// worktreeMode returns the permissions to give a checked-out file whose recorded mode is
+// mode (0 when none was recorded). With core.preservePermissions the recorded bits are
+// used as is; otherwise they are normalized to 0755 or 0644 by the executable bit, so
+// trees written with the setting on can still be checked out with it off.
+func worktreeMode(mode uint32, preserve bool) os.FileMode {
+	switch {
+	case mode == 0:
+		return 0o644
+	case preserve:
+		return os.FileMode(mode).Perm()
+	case mode&0o111 != 0:
+		return 0o755
+	}
+	return 0o644
+}
+
+// Values for the checkout.mtime config key.
+const (
+	// CheckoutMtimeNow leaves written files with the current time (default).
+	CheckoutMtimeNow = "now"
+	// CheckoutMtimeCommit stamps written files with the commit's timestamp.
+	CheckoutMtimeCommit = "commit"
+)
+
+// checkoutHardlinkKey makes checkout hard-link files to their loose objects instead of
+// writing copies (see storage.LinkObject), which saves space and time on large trees.
+// Linked files are read-only. Off by default.
+const checkoutHardlinkKey = "checkout.hardlink"
+
+// materializeTree writes targetTree into the working directory, deletes tracked files
+// that are not part of it, and rewrites the index to match. It refuses to start when a
+// path in the index or the tree is unsafe (see ValidateIndexPaths).
+// With checkout.mtime=commit every written file gets the commit timestamp and the index
+// records its size and mtime, so the next `add` can take the fast path instead of re-hashing.
+// With checkout.hardlink, files are linked to their objects where possible: not with
+// core.preservePermissions or for executables, whose modes the shared file cannot carry,
+// and not for packed objects or across filesystems, where they are written as usual.
+func materializeTree(targetTree map[string]string, commit models.Commit) error {
+	mtimeMode, _, _ := GetConfig("checkout.mtime")
+	stampMtime := mtimeMode == CheckoutMtimeCommit && !commit.Timestamp.IsZero()
+	preserve := GetConfigBool(preservePermissionsKey, false)
+	hardlink := GetConfigBool(checkoutHardlinkKey, false) && !preserve
+	modes := map[string]uint32{}
+	if commit.TreeHash != "" {
+		var err error
+		if modes, err = storage.ParseTreeModes(commit.TreeHash); err != nil {
+			return err
+		}
+	}
+
+	// Both the index (whose stale paths are deleted) and the target tree must stay inside
+	// the working tree before anything is touched.
+	if err := ValidateIndexPaths(); err != nil {
+		return err
+	}
+	source := "the target tree"
+	if commit.ID != "" {
+		source = "commit " + commit.ID
+	}
+	if err := validateTreePaths(targetTree, source); err != nil {
+		return err
+	}
 
 	// Delete files from the current index that are not in the target tree
-	currentIndex, _ := storage.LoadIndex()
+	currentIndex, _ := storage.LoadIndexWithMeta()
 	for path := range currentIndex {
 		if _, existsInTarget := targetTree[path]; !existsInTarget {
-			os.Remove(path)
+			os.Remove(filepath.FromSlash(path))
 		}
 	}
 
+	newIndex := make(map[string]storage.IndexEntry, len(targetTree))
+
 	// Write/update files from the target tree
 	for path, hash := range targetTree {
-		content, err := storage.ReadObject(hash)
-		if err != nil {
-			return err
+		// Recreate files under the case they were created with (see IndexEntry.DisplayPath).
+		display := currentIndex[path].DisplayPath
+		newIndex[path] = storage.IndexEntry{Hash: hash, Mode: modes[path], DisplayPath: display}
+		if isEmptyDirPlaceholder(modes[path]) {
+			if err := materializePlaceholder(path); err != nil {
+				return err
+			}
+			continue
 		}
-		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
-			return err
+		if modes[path] == storage.SubmoduleMode {
+			// The hash is a commit of the submodule; failing to update it leaves the
+			// submodule where it was, which status reports as a change.
+			if err := checkoutSubmodule(path, hash); err != nil {
+				fmt.Printf("warning: submodule %s not updated: %v\n", path, err)
+			}
+			continue
+		}
+		osPath := filepath.FromSlash(path)
+		if display != "" {
+			osPath = filepath.FromSlash(display)
 		}
-		if err := SafeWrite(path, content, 0o644); err != nil {
+		if err := os.MkdirAll(filepath.Dir(osPath), 0o755); err != nil {
 			return err
 		}
+		perm := worktreeMode(modes[path], preserve)
+		if !hardlink || perm != 0o644 || storage.LinkObject(hash, osPath) != nil {
+			content, err := storage.ReadObject(hash)
+			if err != nil {
+				return err
+			}
+			if err := SafeWrite(osPath, content, perm); err != nil {
+				return err
+			}
+		}
+
+		if stampMtime {
+			if err := os.Chtimes(osPath, commit.Timestamp, commit.Timestamp); err != nil {
+				return err
+			}
+			if info, err := os.Stat(osPath); err == nil {
+				newIndex[path] = storage.IndexEntry{
+					Hash:        hash,
+					ModTime:     info.ModTime().Unix(),
+					Size:        info.Size(),
+					Mode:        modes[path],
+					DisplayPath: display,
+				}
+			}
+		}
 	}
 
 	// Update the index to match the new tree
-	return storage.WriteIndex(targetTree)
+	return storage.WriteIndexWithMeta(newIndex)
 }
 
 // GetHeadState returns the current branch name or detached HEAD state.
 // Returns the branch name (e.g., "main") if on a branch, or a detached HEAD description.
 func GetHeadState() (string, error) {
-	headData, err := os.ReadFile(HeadPath)
+	head, err := ReadHead()
 	if err != nil {
 		return "", err
 	}
-	ref := strings.TrimSpace(string(headData))
-
-	// Check if HEAD points to a branch
-	if strings.HasPrefix(ref, "ref: ") {
-		refPath := strings.TrimPrefix(ref, "ref: ")
-		// Extract branch name from refs/heads/<branch>
-		if strings.HasPrefix(refPath, "refs/heads/") {
-			return strings.TrimPrefix(refPath, "refs/heads/"), nil
-		}
-		return refPath, nil
+	if !head.IsDetached() {
+		return head.Branch(), nil
 	}
 
-	// Detached HEAD - ref contains a commit hash
-	if len(ref) >= 7 {
-		return fmt.Sprintf("HEAD (detached at %s)", ref[:7]), nil
+	// Detached HEAD - report the commit it points at
+	if len(head.Hash) >= 7 {
+		return fmt.Sprintf("HEAD (detached at %s)", head.Hash[:7]), nil
 	}
 	return "HEAD (detached)", nil
 }
@@ -86,8 +185,8 @@ func IsWorkDirDirty() (bool, error) {
 			return false, parseErr
 		}
 		headTree = tree
-	} else if !os.IsNotExist(err) && !strings.Contains(err.Error(), "no such file") && !strings.Contains(err.Error(), "cannot find the file") {
-		// If the error is NOT "file not found" (meaning no branch tip yet), return it.
+	} else if !errors.Is(err, storage.ErrNoCommits) && !os.IsNotExist(err) && !strings.Contains(err.Error(), "no such file") && !strings.Contains(err.Error(), "cannot find the file") {
+		// If the error is NOT "no commits yet" or "file not found" (meaning no branch tip yet), return it.
 		return false, err
 	}
 
@@ -124,15 +223,17 @@ func IsWorkDirDirty() (bool, error) {
 	}
 
 	// Check for unstaged changes (Working Directory vs. Index)
-	err = filepath.Walk(".", func(path string, info os.FileInfo, err error) error {
+	err = walkTree(".", GetConfigBool(followSymlinksKey, false), func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
-		cleanPath := filepath.Clean(path)
+		cleanPath := storage.IndexKey(path)
 
-		// Skip the .kitcat directory and other directories
-		if info.IsDir() || strings.HasPrefix(cleanPath, RepoDir+string(os.PathSeparator)) ||
-			cleanPath == RepoDir {
+		// Skip the .kitcat directory and other directories, and nested repositories
+		if info.IsDir() && cleanPath != "." && isNestedRepo(path) {
+			return filepath.SkipDir
+		}
+		if info.IsDir() || inRepoDir(cleanPath) {
 			return nil
 		}
 
@@ -141,7 +242,7 @@ func IsWorkDirDirty() (bool, error) {
 		// If the file is not in the index, check if it should be ignored
 		if !isTracked {
 			// Check if file should be ignored
-			if ShouldIgnore(cleanPath, ignorePatterns, index) {
+			if ShouldIgnoreInfo(cleanPath, info, ignorePatterns, index) {
 				return nil // Skip ignored files
 			}
 			return fmt.Errorf("untracked") // Use error to signal dirty state
@@ -170,60 +271,59 @@ func IsWorkDirDirty() (bool, error) {
 
 // UpdateBranchPointer updates the current branch pointer or HEAD to point to a specific commit.
 // Handles both branch mode (updates refs/heads/<branch>) and detached HEAD mode (updates HEAD directly).
+// Unlike a commit, it refuses to create a branch that does not exist yet.
 func UpdateBranchPointer(commitHash string) error {
-	headData, err := os.ReadFile(HeadPath)
+	head, err := ReadHead()
 	if err != nil {
 		return fmt.Errorf("unable to read HEAD file: %w", err)
 	}
-	ref := strings.TrimSpace(string(headData))
-
-	// Case A: HEAD points to a branch (ref: refs/heads/<branch>)
-	if strings.HasPrefix(ref, "ref: ") {
-		refPath := strings.TrimPrefix(ref, "ref: ")
-		branchFile := filepath.Join(".kitcat", refPath)
-
-		// Verify branch file exists
-		if _, err := os.Stat(branchFile); err != nil {
-			branchName := strings.TrimPrefix(refPath, "refs/heads/")
-			return fmt.Errorf("current branch %s not found", branchName)
-		}
-
-		// Update the branch pointer
-		if err := SafeWrite(branchFile, []byte(commitHash), 0o644); err != nil {
-			return fmt.Errorf("failed to update branch pointer: %w", err)
-		}
-		return nil
+	if !head.IsDetached() && head.Hash == "" {
+		return fmt.Errorf("current branch %s not found", head.Branch())
 	}
-
-	// Case B: Detached HEAD (HEAD contains a commit hash directly)
-	if err := SafeWrite(HeadPath, []byte(commitHash), 0o644); err != nil {
-		return fmt.Errorf("failed to update HEAD: %w", err)
-	}
-	return nil
+	head.Hash = commitHash
+	return WriteHead(head)
 }
 
-// readHead returns the commit hash that HEAD currently points to.
-// This is useful for rollback operations.
-func readHead() (string, error) {
-	headData, err := os.ReadFile(HeadPath)
-	if err != nil {
-		return "", err
+// inRepoDir reports whether a working-tree path (OS or index form) is the repository
+// directory or lies inside it.
+func inRepoDir(path string) bool {
+	dir := repoDirKey()
+	if dir == "" {
+		return false
 	}
-	ref := strings.TrimSpace(string(headData))
+	path = storage.IndexKey(path)
+	return path == dir || strings.HasPrefix(path, dir+"/")
+}
 
-	// If HEAD points to a branch, read the branch file
-	if strings.HasPrefix(ref, "ref: ") {
-		refPath := strings.TrimPrefix(ref, "ref: ")
-		branchFile := filepath.Join(".kitcat", refPath)
-		commitHash, err := os.ReadFile(branchFile)
+// repoDirKey returns the repository directory in index form, relative to the working-tree
+// root, or "" when it lies outside the working tree. A relative directory already is; an
+// absolute KITCAT_DIR is taken relative to the current directory, which findRepoRoot
+// uses as the root whenever KITCAT_DIR is set.
+func repoDirKey() string {
+	dir := RepoDir()
+	if filepath.IsAbs(dir) {
+		cwd, err := os.Getwd()
 		if err != nil {
-			return "", err
+			return ""
+		}
+		rel, err := filepath.Rel(cwd, dir)
+		if err != nil || !filepath.IsLocal(rel) {
+			// The same directory may be reached through a symlink on one side
+			realCwd, cwdErr := filepath.EvalSymlinks(cwd)
+			realDir, dirErr := filepath.EvalSymlinks(dir)
+			if cwdErr != nil || dirErr != nil {
+				return ""
+			}
+			if rel, err = filepath.Rel(realCwd, realDir); err != nil {
+				return ""
+			}
 		}
-		return strings.TrimSpace(string(commitHash)), nil
+		dir = rel
 	}
-
-	// Detached HEAD - ref is the commit hash
-	return ref, nil
+	if !filepath.IsLocal(dir) {
+		return ""
+	}
+	return storage.IndexKey(dir)
 }
 
 // IsSafePath checks if a file path is safe to use (prevents path traversal attacks).
@@ -250,7 +350,7 @@ func IsSafePath(path string) bool {
 // After a reset, HEAD might point to an earlier commit than the last one in the log.
 func GetHeadCommit() (models.Commit, error) {
 	// Get the commit hash that HEAD points to
-	commitHash, err := readHead()
+	commitHash, err := ResolveHead()
 	if err != nil {
 		return models.Commit{}, err
 	}
@@ -262,31 +362,54 @@ func GetHeadCommit() (models.Commit, error) {
 // IsRepoInitialized checks if the current directory or any parent is a valid kitcat repository.
 // If found, it changes the current working directory to the repository root.
 func IsRepoInitialized() bool {
+	_, err := enterRepoRoot()
+	return err == nil
+}
+
+// findRepoRoot walks up from the current directory to the nearest directory containing
+// RepoDir and returns its absolute path, without changing directory.
+func findRepoRoot() (string, error) {
 	cwd, err := os.Getwd()
 	if err != nil {
-		return false
+		return "", err
+	}
+
+	// With KITCAT_DIR set the repository is wherever it points and the working tree is
+	// the current directory; there is nothing to discover.
+	if os.Getenv(storage.EnvRepoDir) != "" {
+		if _, err := os.Stat(RepoDir()); err != nil {
+			return "", fmt.Errorf("not a kitcat repository: %s", RepoDir())
+		}
+		return cwd, nil
 	}
 
 	for {
-		if _, err := os.Stat(filepath.Join(cwd, RepoDir)); err == nil {
-			// Found the repository root
-			// Update the working directory to the repo root so that
-			// all relative paths (RepoDir, etc.) are valid.
-			if err := os.Chdir(cwd); err != nil {
-				return false
-			}
-			return true
+		if _, err := os.Stat(filepath.Join(cwd, RepoDir())); err == nil {
+			return cwd, nil
 		}
 
 		parent := filepath.Dir(cwd)
 		if parent == cwd {
 			// Reached the system root without finding .kitcat
-			return false
+			return "", errors.New("not a kitcat repository (or any of the parent directories): .kitcat")
 		}
 		cwd = parent
 	}
 }
 
+// enterRepoRoot locates the repository root and makes it the working directory,
+// so that relative paths (RepoDir, etc.) are valid. Returns the absolute root.
+func enterRepoRoot() (string, error) {
+	root, err := findRepoRoot()
+	if err != nil {
+		return "", err
+	}
+	if err := os.Chdir(root); err != nil {
+		return "", err
+	}
+	return root, nil
+}
+
 // Write data in safe way
 func SafeWrite(filename string, data []byte, perm os.FileMode) error {
 	dirPath := filepath.Dir(filename)
@@ -382,12 +505,16 @@ func ResolveCommitRef(ref string) (string, error) {
 
 	// Case 2: Branch name
 	if IsBranch(ref) {
-		branchRefPath := filepath.Join(".kitcat", "refs", "heads", ref)
+		branchRefPath := filepath.Join(RepoDir(), "refs", "heads", ref)
 		hashBytes, err := os.ReadFile(branchRefPath)
 		if err != nil {
 			return "", fmt.Errorf("reading branch %s: %w", ref, err)
 		}
-		return strings.TrimSpace(string(hashBytes)), nil
+		hash := strings.TrimSpace(string(hashBytes))
+		if hash == "" {
+			return "", fmt.Errorf("branch '%s' has %w", ref, storage.ErrNoCommits)
+		}
+		return hash, nil
 	}
 
 	// Case 3: Assume it's a commit hash (caller will validate)
@@ -5,8 +5,11 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
 )
 
 // IgnorePattern represents a single pattern from .kitignore
@@ -14,7 +17,10 @@ type IgnorePattern struct {
 	Original    string // The original pattern line from .kitignore
 	Pattern     string // The processed pattern (without comments/whitespace)
 	IsDirectory bool   // True if pattern ends with '/' (directory-only pattern)
-	LineNumber  int    // Line number in .kitignore for error reporting
+	LineNumber  int    // Line number in its file for error reporting; 0 for an exclude pattern
+	// Attr is set for a size or age rule, which matches by file metadata rather than by
+	// name and so only applies where ShouldIgnoreInfo has the FileInfo.
+	Attr *AttrRule
 }
 
 // Global cache for ignore patterns
@@ -24,8 +30,9 @@ var (
 	ignoreCacheInit bool
 )
 
-// LoadIgnorePatterns reads and parses the .kitignore file
-// Returns an empty slice if .kitignore doesn't exist (not an error)
+// LoadIgnorePatterns reads and parses the .kitignore file, followed by the repository's
+// own .kitcat/info/exclude, which takes the same patterns but is never committed.
+// Returns an empty slice if neither file exists (not an error)
 // Skips invalid patterns with a warning to stderr
 func LoadIgnorePatterns() ([]IgnorePattern, error) {
 	// Check cache first
@@ -46,18 +53,34 @@ func LoadIgnorePatterns() ([]IgnorePattern, error) {
 		return ignoreCache, nil
 	}
 
+	patterns, err := readIgnoreFile(".kitignore")
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := readIgnoreFile(filepath.Join(RepoDir(), "info", "exclude"))
+	if err != nil {
+		return nil, err
+	}
+	patterns = append(patterns, exclude...)
+
+	// Cache the results
+	ignoreCache = patterns
+	ignoreCacheInit = true
+
+	return patterns, nil
+}
+
+// readIgnoreFile parses the ignore file name, warning about and skipping invalid lines.
+// A missing file has no patterns.
+func readIgnoreFile(name string) ([]IgnorePattern, error) {
 	patterns := []IgnorePattern{}
 
-	// Open .kitignore file
-	file, err := os.Open(".kitignore")
+	file, err := os.Open(name)
 	if err != nil {
 		if os.IsNotExist(err) {
-			// No .kitignore file is not an error, just return empty patterns
-			ignoreCache = patterns
-			ignoreCacheInit = true
 			return patterns, nil
 		}
-		return nil, fmt.Errorf("error reading .kitignore: %w", err)
+		return nil, fmt.Errorf("error reading %s: %w", name, err)
 	}
 	defer file.Close()
 
@@ -66,48 +89,78 @@ func LoadIgnorePatterns() ([]IgnorePattern, error) {
 
 	for scanner.Scan() {
 		lineNumber++
-		line := scanner.Text()
-
-		// Trim whitespace
-		line = strings.TrimSpace(line)
-
-		// Skip empty lines and comments
-		if line == "" || strings.HasPrefix(line, "#") {
+		pattern, ok, err := parseIgnoreLine(scanner.Text(), lineNumber)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %s line %d: %v (skipping)\n", name, lineNumber, err)
 			continue
 		}
+		if ok {
+			patterns = append(patterns, pattern)
+		}
+	}
 
-		// Check if this is a directory pattern (ends with /)
-		isDirectory := strings.HasSuffix(line, "/")
-		pattern := line
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", name, err)
+	}
+	return patterns, nil
+}
 
-		// Remove trailing slash for processing, we'll handle it separately
-		if isDirectory {
-			pattern = strings.TrimSuffix(pattern, "/")
+// ParseExcludePatterns parses patterns given for a single command, such as those of
+// AddOptions.Exclude, written as .kitignore lines. Unlike in a file, an invalid pattern
+// is an error.
+func ParseExcludePatterns(lines []string) ([]IgnorePattern, error) {
+	var patterns []IgnorePattern
+	for _, line := range lines {
+		pattern, ok, err := parseIgnoreLine(line, 0)
+		if err != nil {
+			return nil, fmt.Errorf("exclude pattern: %w", err)
 		}
-
-		// Validate the pattern
-		if !isValidPattern(pattern) {
-			fmt.Fprintf(os.Stderr, "warning: .kitignore line %d: invalid pattern '%s' (skipping)\n", lineNumber, line)
-			continue
+		if ok {
+			patterns = append(patterns, pattern)
 		}
+	}
+	return patterns, nil
+}
+
+// parseIgnoreLine parses one line of an ignore file. It reports ok=false for blank lines
+// and comments.
+func parseIgnoreLine(line string, lineNumber int) (IgnorePattern, bool, error) {
+	// Trim whitespace
+	line = strings.TrimSpace(line)
 
-		patterns = append(patterns, IgnorePattern{
-			Original:    line,
-			Pattern:     pattern,
-			IsDirectory: isDirectory,
-			LineNumber:  lineNumber,
-		})
+	// Skip empty lines and comments
+	if line == "" || strings.HasPrefix(line, "#") {
+		return IgnorePattern{}, false, nil
 	}
 
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("error reading .kitignore: %w", err)
+	if isAttrRule(line) {
+		rule, err := ParseAttrRule(line)
+		if err != nil {
+			return IgnorePattern{}, false, err
+		}
+		return IgnorePattern{Original: line, LineNumber: lineNumber, Attr: &rule}, true, nil
 	}
 
-	// Cache the results
-	ignoreCache = patterns
-	ignoreCacheInit = true
+	// Check if this is a directory pattern (ends with /)
+	isDirectory := strings.HasSuffix(line, "/")
+	pattern := line
 
-	return patterns, nil
+	// Remove trailing slash for processing, we'll handle it separately
+	if isDirectory {
+		pattern = strings.TrimSuffix(pattern, "/")
+	}
+
+	// Validate the pattern
+	if !isValidPattern(pattern) {
+		return IgnorePattern{}, false, fmt.Errorf("invalid pattern '%s'", line)
+	}
+
+	return IgnorePattern{
+		Original:    line,
+		Pattern:     pattern,
+		IsDirectory: isDirectory,
+		LineNumber:  lineNumber,
+	}, true, nil
 }
 
 // ShouldIgnore checks if a path should be ignored based on patterns
@@ -119,19 +172,55 @@ func ShouldIgnore(path string, patterns []IgnorePattern, trackedFiles map[string
 		return false
 	}
 
-	// Check if path matches any pattern
+	return matchesAnyPattern(path, patterns)
+}
+
+// matchesAnyPattern reports whether path matches any ignore pattern, tracked or not.
+func matchesAnyPattern(path string, patterns []IgnorePattern) bool {
 	for _, pattern := range patterns {
 		if matchesPattern(path, pattern) {
 			return true
 		}
 	}
-
 	return false
 }
 
+// ListTrackedIgnored returns the sorted index paths that match a .kitignore pattern.
+// Such files stay tracked (ShouldIgnore never ignores tracked files), which usually means
+// the pattern was added after the file; they keep showing up in status until untracked.
+func ListTrackedIgnored() ([]string, error) {
+	patterns, err := LoadIgnorePatterns()
+	if err != nil {
+		return nil, err
+	}
+	index, err := storage.LoadIndexWithMeta()
+	if err != nil {
+		return nil, err
+	}
+	return trackedIgnored(index, patterns), nil
+}
+
+func trackedIgnored(index map[string]storage.IndexEntry, patterns []IgnorePattern) []string {
+	paths := []string{}
+	if len(patterns) == 0 {
+		return paths
+	}
+	for path := range index {
+		if matchesAnyPattern(path, patterns) {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
 // matchesPattern checks if a path matches a specific ignore pattern
 // Handles glob patterns, directory patterns, and recursive patterns (**)
 func matchesPattern(path string, pattern IgnorePattern) bool {
+	if pattern.Attr != nil {
+		return false
+	}
+
 	// Normalize path separators for cross-platform compatibility
 	path = filepath.ToSlash(path)
 	patternStr := filepath.ToSlash(pattern.Pattern)
@@ -0,0 +1,56 @@
+package core
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestListTrackedIgnored(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	ClearIgnoreCache()
+	defer ClearIgnoreCache()
+
+	if err := os.MkdirAll("build", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{"main.go": "package main\n", "debug.log": "log\n", "build/out.bin": "bin\n"} {
+		if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := AddAll(); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ListTrackedIgnored(); err != nil || len(got) != 0 {
+		t.Fatalf("ListTrackedIgnored without .kitignore = %v, %v", got, err)
+	}
+
+	// The ignore rules arrive after the files were added.
+	if err := os.WriteFile(".kitignore", []byte("*.log\nbuild/\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ClearIgnoreCache()
+	if err := AddAll(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ListTrackedIgnored()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"build/out.bin", "debug.log"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ListTrackedIgnored = %v, want %v", got, want)
+	}
+}
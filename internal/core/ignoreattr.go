@@ -0,0 +1,127 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Attributes an AttrRule can test.
+const (
+	AttrSize = "size"
+	AttrAge  = "age"
+)
+
+// AttrRule is a .kitignore rule that matches untracked files by size or modification
+// age instead of by name, written "size:>100M" or "age:>1y". The "size:" and "age:"
+// prefixes followed by < or > cannot be mistaken for a glob, which never needs them.
+type AttrRule struct {
+	Attr    string        // AttrSize or AttrAge
+	Greater bool          // match values above the limit when true, below it otherwise
+	Size    int64         // the limit of a size rule, in bytes
+	Age     time.Duration // the limit of an age rule
+}
+
+// sizeUnits are the suffixes a size limit may carry; K, M, G and T are powers of 1024.
+var sizeUnits = map[string]int64{
+	"": 1, "B": 1,
+	"K": 1 << 10, "KB": 1 << 10,
+	"M": 1 << 20, "MB": 1 << 20,
+	"G": 1 << 30, "GB": 1 << 30,
+	"T": 1 << 40, "TB": 1 << 40,
+}
+
+// ageUnits are the suffixes an age limit must carry; a year is 365 days.
+var ageUnits = map[string]time.Duration{
+	"s": time.Second,
+	"m": time.Minute,
+	"h": time.Hour,
+	"d": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour,
+	"y": 365 * 24 * time.Hour,
+}
+
+// isAttrRule reports whether a .kitignore line is meant as an attribute rule, valid or not.
+func isAttrRule(line string) bool {
+	return strings.HasPrefix(line, AttrSize+":") || strings.HasPrefix(line, AttrAge+":")
+}
+
+// ParseAttrRule parses an attribute rule such as "size:>100M", "size:<1K" or "age:>30d".
+func ParseAttrRule(line string) (AttrRule, error) {
+	attr, cond, _ := strings.Cut(line, ":")
+	if attr != AttrSize && attr != AttrAge {
+		return AttrRule{}, fmt.Errorf("unknown attribute %q (want size or age)", attr)
+	}
+	rule := AttrRule{Attr: attr}
+	switch {
+	case strings.HasPrefix(cond, ">"):
+		rule.Greater = true
+	case strings.HasPrefix(cond, "<"):
+	default:
+		return AttrRule{}, fmt.Errorf("%s rule %q needs < or >", attr, line)
+	}
+	value := strings.TrimSpace(cond[1:])
+	digits := strings.TrimRightFunc(value, func(r rune) bool { return r < '0' || r > '9' })
+	n, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil || n < 0 {
+		return AttrRule{}, fmt.Errorf("%s rule %q has no valid number", attr, line)
+	}
+	unit := value[len(digits):]
+
+	if attr == AttrSize {
+		mult, ok := sizeUnits[strings.ToUpper(unit)]
+		if !ok || n > (1<<63-1)/mult {
+			return AttrRule{}, fmt.Errorf("size rule %q: bad unit %q (want B, K, M, G or T)", line, unit)
+		}
+		rule.Size = n * mult
+		return rule, nil
+	}
+	mult, ok := ageUnits[unit]
+	if !ok || n > int64(1<<63-1)/int64(mult) {
+		return AttrRule{}, fmt.Errorf("age rule %q: bad unit %q (want s, m, h, d, w or y)", line, unit)
+	}
+	rule.Age = time.Duration(n) * mult
+	return rule, nil
+}
+
+// Matches reports whether a file with info satisfies the rule, taking its age relative
+// to now. Directories never match.
+func (r AttrRule) Matches(info os.FileInfo, now time.Time) bool {
+	if info == nil || info.IsDir() {
+		return false
+	}
+	if r.Attr == AttrSize {
+		if r.Greater {
+			return info.Size() > r.Size
+		}
+		return info.Size() < r.Size
+	}
+	age := now.Sub(info.ModTime())
+	if r.Greater {
+		return age > r.Age
+	}
+	return age < r.Age
+}
+
+// ShouldIgnoreInfo is ShouldIgnore for a file whose FileInfo is at hand, as it is in a
+// walk: besides the name patterns it applies the size and age rules. Tracked files are
+// still never ignored.
+func ShouldIgnoreInfo(path string, info os.FileInfo, patterns []IgnorePattern, trackedFiles map[string]string) bool {
+	if _, isTracked := trackedFiles[path]; isTracked {
+		return false
+	}
+	return matchesAnyPattern(path, patterns) || matchesAnyAttrRule(info, patterns)
+}
+
+// matchesAnyAttrRule reports whether info satisfies any attribute rule in patterns.
+func matchesAnyAttrRule(info os.FileInfo, patterns []IgnorePattern) bool {
+	now := Now()
+	for _, p := range patterns {
+		if p.Attr != nil && p.Attr.Matches(info, now) {
+			return true
+		}
+	}
+	return false
+}
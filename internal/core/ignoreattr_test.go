@@ -0,0 +1,95 @@
+package core
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+func TestParseAttrRule(t *testing.T) {
+	tests := []struct {
+		line    string
+		want    AttrRule
+		wantErr bool
+	}{
+		{line: "size:>100M", want: AttrRule{Attr: AttrSize, Greater: true, Size: 100 << 20}},
+		{line: "size:<1kb", want: AttrRule{Attr: AttrSize, Size: 1 << 10}},
+		{line: "size:>512", want: AttrRule{Attr: AttrSize, Greater: true, Size: 512}},
+		{line: "age:>1y", want: AttrRule{Attr: AttrAge, Greater: true, Age: 365 * 24 * time.Hour}},
+		{line: "age:<2w", want: AttrRule{Attr: AttrAge, Age: 14 * 24 * time.Hour}},
+		{line: "size:100M", wantErr: true},
+		{line: "size:>M", wantErr: true},
+		{line: "size:>10Q", wantErr: true},
+		{line: "age:>3", wantErr: true},
+		{line: "size:>99999999999T", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseAttrRule(tt.line)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseAttrRule(%q) error = %v, wantErr %v", tt.line, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("ParseAttrRule(%q) = %+v, want %+v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestAddAll_IgnoresBySizeAndAge(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	ClearIgnoreCache()
+	defer ClearIgnoreCache()
+
+	files := map[string]string{
+		".kitignore": "size:>1K\nage:>30d\n",
+		"small.txt":  "small\n",
+		"big.log":    strings.Repeat("x", 2048),
+		"stale.tmp":  "stale\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Now().Add(-60 * 24 * time.Hour)
+	if err := os.Chtimes("stale.tmp", old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := AddAll(); err != nil {
+		t.Fatal(err)
+	}
+	index, err := storage.LoadIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name := range files {
+		_, tracked := index[name]
+		if want := name == ".kitignore" || name == "small.txt"; tracked != want {
+			t.Errorf("%s tracked = %v, want %v", name, tracked, want)
+		}
+	}
+
+	status, err := GetStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status.Untracked) != 0 {
+		t.Errorf("untracked = %v, want none", status.Untracked)
+	}
+}
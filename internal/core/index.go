@@ -14,7 +14,7 @@ type IndexEntry struct {
 
 // LoadIndex reads the .kitcat/index file
 func LoadIndex() ([]IndexEntry, error) {
-	data, err := os.ReadFile(IndexPath)
+	data, err := os.ReadFile(IndexPath())
 	if os.IsNotExist(err) {
 		return []IndexEntry{}, nil
 	}
@@ -41,7 +41,7 @@ func LoadIndex() ([]IndexEntry, error) {
 
 // SaveIndex writes the index back to disk
 func SaveIndex(entries []IndexEntry) error {
-	file, err := os.Create(IndexPath)
+	file, err := os.Create(IndexPath())
 	if err != nil {
 		return err
 	}
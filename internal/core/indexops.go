@@ -0,0 +1,24 @@
+package core
+
+import (
+	"os"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+// ReplayIndexOps applies the index operation log at logPath, recorded with index.recordOps
+// in some repository, to this repository's index, and returns how many operations it
+// applied (see storage.ReplayIndexOps). It is meant for a fresh repository, to reproduce
+// the index a bug report describes.
+func ReplayIndexOps(logPath string) (int, error) {
+	f, err := os.Open(logPath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	if _, err := enterRepoRoot(); err != nil {
+		return 0, err
+	}
+	return storage.ReplayIndexOps(f)
+}
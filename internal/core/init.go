@@ -20,10 +20,10 @@ func InitRepo() error {
 
 	// Create all necessary subdirectories using the public constants.
 	dirs := []string{
-		RepoDir,
-		ObjectsDir,
-		HeadsDir,
-		TagsDir,
+		RepoDir(),
+		ObjectsDir(),
+		HeadsDir(),
+		TagsDir(),
 	}
 
 	for _, dir := range dirs {
@@ -33,7 +33,7 @@ func InitRepo() error {
 	}
 
 	// Create empty files only if they do not exist.
-	files := []string{IndexPath, CommitsPath}
+	files := []string{IndexPath(), CommitsPath()}
 	for _, file := range files {
 		if !isPathExist(file) {
 			f, err := os.Create(file)
@@ -44,22 +44,27 @@ func InitRepo() error {
 		}
 	}
 
-	// Create the HEAD file to point to the default branch (main) only if it does not exist.
-	headContent := []byte("ref: refs/heads/main")
-	if !isPathExist(HeadPath) {
-		if err := os.WriteFile(HeadPath, headContent, 0o644); err != nil {
+	// Create the HEAD file to point to the default branch only if it does not exist,
+	// and record which branch that is.
+	branch := DefaultBranch()
+	headContent := []byte("ref: refs/heads/" + branch)
+	if !isPathExist(HeadPath()) {
+		if err := os.WriteFile(HeadPath(), headContent, 0o644); err != nil {
 			return err
 		}
-		fmt.Printf("%sUsing 'main' as the name for the default branch.%s\n\n", colorYellow, colorReset)
+		if err := SetConfig(defaultBranchKey, branch, false); err != nil {
+			return err
+		}
+		fmt.Printf("%sUsing '%s' as the name for the default branch.%s\n\n", colorYellow, branch, colorReset)
 		fmt.Printf("%sBranches can be renamed via this command:%s\n", colorYellow, colorReset)
 		fmt.Printf("%s\tkitcat branch -m <branch_name>%s\n\n", colorYellow, colorReset)
 		fmt.Printf("%sList all the branches via this command:%s\n", colorYellow, colorReset)
 		fmt.Printf("%s\tkitcat branch -l%s\n", colorYellow, colorReset)
 	}
-	// Generating empty main branch file only if it does not exist.
-	mainBranchPath := filepath.Join(HeadsDir, "main")
-	if !isPathExist(mainBranchPath) {
-		if err := os.WriteFile(mainBranchPath, []byte(""), 0o644); err != nil {
+	// Generating empty default branch file only if it does not exist.
+	branchPath := filepath.Join(HeadsDir(), branch)
+	if !isPathExist(branchPath) {
+		if err := os.WriteFile(branchPath, []byte(""), 0o644); err != nil {
 			return err
 		}
 	}
@@ -72,7 +77,7 @@ func InitRepo() error {
 		}
 	}
 
-	if absPath, err := filepath.Abs(RepoDir); err != nil {
+	if absPath, err := filepath.Abs(RepoDir()); err != nil {
 		return err
 	} else {
 		fmt.Printf("%s\nInitialized empty kitcat repository in %s\n\n%s", colorYellow, absPath, colorReset)
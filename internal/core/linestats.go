@@ -0,0 +1,105 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+// LineStatsOptions controls LineStats.
+type LineStatsOptions struct {
+	// Exclude skips the files matching a pattern in .kitignore syntax, e.g. "*.pb.go"
+	// or "vendor/" for generated or vendored code. Empty excludes nothing.
+	Exclude string
+}
+
+// ExtensionStats is the line count of the tracked files with one extension.
+type ExtensionStats struct {
+	// Ext is the lower-cased extension with its dot, such as ".go", or "" for files
+	// without one (dotfiles like .editorconfig included).
+	Ext   string
+	Files int
+	Lines int64
+	Bytes int64
+}
+
+// LineStats counts the lines of the staged content of every tracked file, grouped by
+// extension, most lines first (ties by extension). Blobs are read one at a time from the
+// object store; binary files, submodules and empty-directory placeholders are skipped.
+// A last line without a newline counts as a line.
+func LineStats(opts LineStatsOptions) ([]ExtensionStats, error) {
+	var exclude []IgnorePattern
+	if opts.Exclude != "" {
+		pattern := IgnorePattern{Original: opts.Exclude, Pattern: opts.Exclude}
+		if strings.HasSuffix(pattern.Pattern, "/") {
+			pattern.IsDirectory = true
+			pattern.Pattern = strings.TrimSuffix(pattern.Pattern, "/")
+		}
+		if !isValidPattern(pattern.Pattern) {
+			return nil, fmt.Errorf("invalid exclude pattern: %s", opts.Exclude)
+		}
+		exclude = append(exclude, pattern)
+	}
+
+	if _, err := enterRepoRoot(); err != nil {
+		return nil, err
+	}
+	index, err := storage.LoadIndexWithMeta()
+	if err != nil {
+		return nil, err
+	}
+
+	byExt := make(map[string]*ExtensionStats)
+	for p, entry := range index {
+		if isEmptyDirPlaceholder(entry.Mode) || entry.Mode == storage.SubmoduleMode || matchesAnyPattern(p, exclude) {
+			continue
+		}
+		data, err := storage.ReadObject(entry.Hash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read object for %s: %w", p, err)
+		}
+		if isBinary(data) {
+			continue
+		}
+		lines := int64(bytes.Count(data, []byte{'\n'}))
+		if len(data) > 0 && data[len(data)-1] != '\n' {
+			lines++
+		}
+
+		ext := fileExtension(p)
+		s := byExt[ext]
+		if s == nil {
+			s = &ExtensionStats{Ext: ext}
+			byExt[ext] = s
+		}
+		s.Files++
+		s.Lines += lines
+		s.Bytes += int64(len(data))
+	}
+
+	stats := make([]ExtensionStats, 0, len(byExt))
+	for _, s := range byExt {
+		stats = append(stats, *s)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Lines != stats[j].Lines {
+			return stats[i].Lines > stats[j].Lines
+		}
+		return stats[i].Ext < stats[j].Ext
+	})
+	return stats, nil
+}
+
+// fileExtension returns the lower-cased extension of a tracked path, "" when it has none.
+func fileExtension(p string) string {
+	name := path.Base(p)
+	ext := path.Ext(name)
+	if ext == name {
+		return "" // a dotfile
+	}
+	return strings.ToLower(ext)
+}
@@ -0,0 +1,81 @@
+package core
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestLineStats(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		"main.go":         "package main\n\nfunc main() {}\n",
+		"util.GO":         "package main\nvar x = 1", // no trailing newline
+		"api.pb.go":       "package api\n// generated\n// generated\n// generated\n",
+		"README.md":       "# Title\n",
+		"Makefile":        "all:\n\tgo build\n",
+		".editorconfig":   "root = true\n",
+		"logo.png":        "\x89PNG\x00\x01",
+		"gen/schema.json": "{}\n",
+	}
+	if err := os.Mkdir("gen", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := AddAll(); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := LineStats(LineStatsOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ExtensionStats{
+		{Ext: ".go", Files: 3, Lines: 9, Bytes: 102},
+		{Ext: "", Files: 2, Lines: 3, Bytes: 27},
+		{Ext: ".json", Files: 1, Lines: 1, Bytes: 3},
+		{Ext: ".md", Files: 1, Lines: 1, Bytes: 8},
+	}
+	if !reflect.DeepEqual(stats, want) {
+		t.Errorf("LineStats() = %+v\nwant %+v", stats, want)
+	}
+
+	stats, err = LineStats(LineStatsOptions{Exclude: "*.pb.go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats[0] != (ExtensionStats{Ext: ".go", Files: 2, Lines: 5, Bytes: 51}) {
+		t.Errorf("with *.pb.go excluded, .go = %+v", stats[0])
+	}
+
+	stats, err = LineStats(LineStatsOptions{Exclude: "gen/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range stats {
+		if s.Ext == ".json" {
+			t.Errorf("gen/ excluded, but got %+v", s)
+		}
+	}
+
+	if _, err := LineStats(LineStatsOptions{Exclude: "[bad"}); err == nil {
+		t.Error("expected an error for an invalid exclude pattern")
+	}
+}
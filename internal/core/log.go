@@ -1,6 +1,7 @@
 package core
 
 import (
+	"errors"
 	"fmt"
 	"sort"
 
@@ -14,10 +15,13 @@ func ShowLog(oneline bool, limit int) error {
 	// 1Start from HEAD (Architecture from reset-hard branch)
 	// We must walk backwards from HEAD, otherwise 'reset' changes won't be reflected
 	currentCommit, err := GetHeadCommit()
-	if err != nil {
-		// Handle the case where the repo is empty or HEAD is invalid
+	if errors.Is(err, storage.ErrNoCommits) {
+		// A fresh repository has an empty history
 		return nil
 	}
+	if err != nil {
+		return err
+	}
 
 	commitHash := currentCommit.ID
 	count := 0
@@ -29,7 +33,7 @@ func ShowLog(oneline bool, limit int) error {
 			break
 		}
 
-		commit, err := storage.FindCommit(commitHash)
+		commit, err := storage.LookupCommit(commitHash)
 		if err != nil {
 			return err
 		}
@@ -40,7 +44,7 @@ func ShowLog(oneline bool, limit int) error {
 		} else {
 			fmt.Printf("commit %s\n", commit.ID)
 			fmt.Printf("Author: %s <%s>\n", commit.AuthorName, commit.AuthorEmail)
-			fmt.Printf("Date:   %s\n", commit.Timestamp.Local().Format("Mon Jan 02 15:04:05 2006 -0700"))
+			fmt.Printf("Date:   %s\n", authorDate(commit).Format("Mon Jan 02 15:04:05 2006 -0700"))
 			fmt.Printf("\n    %s\n\n", commit.Message)
 		}
 
@@ -1,20 +1,163 @@
 package core
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
 
 	"github.com/LeeFred3042U/kitcat/internal/storage"
 )
 
+// LsFilesOptions narrows the set of index entries returned by LsFiles.
+// The zero value lists every tracked file.
+type LsFilesOptions struct {
+	Staged   bool   // only entries whose content differs from HEAD
+	Modified bool   // only entries whose working-tree file differs from the index (or is missing)
+	Flags    uint8  // only entries carrying all of these storage.Flag* bits
+	Prefix   string // only entries at or below this repo-relative path
+}
+
+// LsFilesEntry is a single index entry returned by LsFiles.
+type LsFilesEntry struct {
+	Path  string
+	Entry storage.IndexEntry
+}
+
+// lsFilesJSON is the stable `kitcat ls-files --json` schema for one entry. The index's own
+// short keys are an on-disk detail, so they are spelled out here.
+type lsFilesJSON struct {
+	Path            string `json:"path"` // forward slashes on every platform
+	Hash            string `json:"hash"`
+	Size            int64  `json:"size"`
+	ModTime         int64  `json:"mtime"` // Unix seconds; 0 when unknown
+	AssumeUnchanged bool   `json:"assumeUnchanged"`
+	SkipWorktree    bool   `json:"skipWorktree"`
+}
+
+// MarshalJSON encodes the entry using the documented ls-files JSON field names.
+func (e LsFilesEntry) MarshalJSON() ([]byte, error) {
+	return json.Marshal(lsFilesJSON{
+		Path:            filepath.ToSlash(e.Path),
+		Hash:            e.Entry.Hash,
+		Size:            e.Entry.Size,
+		ModTime:         e.Entry.ModTime,
+		AssumeUnchanged: e.Entry.Flags&storage.FlagAssumeUnchanged != 0,
+		SkipWorktree:    e.Entry.Flags&storage.FlagSkipWorktree != 0,
+	})
+}
+
+// LsFiles queries the index and returns matching entries sorted by path.
+// Filters combine with AND semantics.
+func LsFiles(opts LsFilesOptions) ([]LsFilesEntry, error) {
+	index, err := storage.LoadIndexPrefix(opts.Prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var headTree map[string]string
+	if opts.Staged {
+		headTree = make(map[string]string)
+		if headCommit, err := GetHeadCommit(); err == nil {
+			headTree, err = storage.ParseTree(headCommit.TreeHash)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	result := []LsFilesEntry{}
+	for path, entry := range index {
+		if entry.Flags&opts.Flags != opts.Flags {
+			continue
+		}
+		if opts.Staged {
+			if headHash, ok := headTree[path]; ok && headHash == entry.Hash {
+				continue
+			}
+		}
+		if opts.Modified {
+			modified, err := isEntryModified(path, entry)
+			if err != nil {
+				return nil, err
+			}
+			if !modified {
+				continue
+			}
+		}
+		result = append(result, LsFilesEntry{Path: path, Entry: entry})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Path < result[j].Path
+	})
+	return result, nil
+}
+
+// isEntryModified reports whether the working-tree file differs from its index entry.
+// Matching size and mtime are trusted, the same fast path AddAll uses. Entries marked
+// assume-unchanged or skip-worktree are never modified: the file is trusted, or absent.
+func isEntryModified(path string, entry storage.IndexEntry) (bool, error) {
+	if entry.Flags&(storage.FlagAssumeUnchanged|storage.FlagSkipWorktree) != 0 {
+		return false, nil
+	}
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if entry.Size == info.Size() && entry.ModTime == info.ModTime().Unix() {
+		return false, nil
+	}
+	hash, err := storage.HashFile(path)
+	if err != nil {
+		return false, err
+	}
+	return hash != entry.Hash, nil
+}
+
+// SetIndexFlag sets or clears a storage.Flag* bit on a tracked path, which may be
+// absolute or relative to the current directory.
+func SetIndexFlag(path string, flag uint8, enable bool) error {
+	if enable {
+		return UpdateIndexFlags(path, flag, 0)
+	}
+	return UpdateIndexFlags(path, 0, flag)
+}
+
+// UpdateIndexFlags sets the storage.Flag* bits in set and clears those in unset on a
+// tracked path, in one index update. It backs `kitcat update-index`.
+func UpdateIndexFlags(path string, set, unset uint8) error {
+	key, err := RepoRelPath(path)
+	if err != nil {
+		return err
+	}
+	if _, err := enterRepoRoot(); err != nil {
+		return err
+	}
+	return storage.UpdateIndexWithMeta(func(index map[string]storage.IndexEntry) error {
+		entry, ok := index[key]
+		if !ok {
+			return fmt.Errorf("pathspec '%s' did not match any files", path)
+		}
+		entry.Flags = entry.Flags&^unset | set
+		index[key] = entry
+		return nil
+	})
+}
+
 // ListFiles prints all tracked file paths from the index
 func ListFiles() error {
-	index, err := storage.LoadIndex()
+	entries, err := LsFiles(LsFilesOptions{})
 	if err != nil {
 		return err
 	}
 
-	for path := range index {
-		fmt.Println(path)
+	for _, e := range entries {
+		fmt.Println(e.Path)
 	}
 	return nil
 }
@@ -0,0 +1,107 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+func TestLsFiles_Filters(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	_ = SetConfig("user.name", "Test", false)
+	_ = SetConfig("user.email", "test@example.com", false)
+
+	if err := os.Mkdir("src", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"z.txt", "src/c.txt", "a.txt", "src/b.txt"} {
+		if err := os.WriteFile(filepath.FromSlash(name), []byte(name+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := AddAll(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Commit("first"); err != nil {
+		t.Fatal(err)
+	}
+
+	// a.txt edited and z.txt deleted in the working tree, src/d.txt staged, and
+	// src/c.txt edited but marked assume-unchanged
+	if err := os.WriteFile("a.txt", []byte("edited a\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove("z.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join("src", "d.txt"), []byte("d\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddFile(filepath.Join("src", "d.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join("src", "c.txt"), []byte("edited c\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetIndexFlag(filepath.Join("src", "c.txt"), storage.FlagAssumeUnchanged, true); err != nil {
+		t.Fatal(err)
+	}
+
+	paths := func(opts LsFilesOptions) []string {
+		t.Helper()
+		entries, err := LsFiles(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := []string{}
+		for _, e := range entries {
+			got = append(got, e.Path)
+		}
+		return got
+	}
+	tests := []struct {
+		name string
+		opts LsFilesOptions
+		want []string
+	}{
+		{"all, sorted", LsFilesOptions{}, []string{"a.txt", "src/b.txt", "src/c.txt", "src/d.txt", "z.txt"}},
+		{"staged", LsFilesOptions{Staged: true}, []string{"src/d.txt"}},
+		{"modified", LsFilesOptions{Modified: true}, []string{"a.txt", "z.txt"}},
+		{"flag", LsFilesOptions{Flags: storage.FlagAssumeUnchanged}, []string{"src/c.txt"}},
+		{"no match for flag", LsFilesOptions{Flags: storage.FlagSkipWorktree}, []string{}},
+		{"prefix", LsFilesOptions{Prefix: "src"}, []string{"src/b.txt", "src/c.txt", "src/d.txt"}},
+		{"prefix and staged", LsFilesOptions{Prefix: "src", Staged: true}, []string{"src/d.txt"}},
+		{"prefix and modified", LsFilesOptions{Prefix: "src", Modified: true}, []string{}},
+	}
+	for _, tt := range tests {
+		if got := paths(tt.opts); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: LsFiles(%+v) = %v, want %v", tt.name, tt.opts, got, tt.want)
+		}
+	}
+
+	if err := SetIndexFlag(filepath.Join("src", "c.txt"), storage.FlagAssumeUnchanged, false); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"a.txt", "src/c.txt", "z.txt"}
+	if got := paths(LsFilesOptions{Modified: true}); !reflect.DeepEqual(got, want) {
+		t.Errorf("modified after clearing assume-unchanged = %v, want %v", got, want)
+	}
+	if err := SetIndexFlag("untracked.txt", storage.FlagAssumeUnchanged, true); err == nil {
+		t.Error("SetIndexFlag on an untracked path should fail")
+	}
+}
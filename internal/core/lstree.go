@@ -0,0 +1,76 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+// TreeFile is one file of a commit's tree, as returned by ListTree.
+type TreeFile struct {
+	Path string `json:"path"` // forward slashes on every platform
+	Hash string `json:"hash"`
+	// Mode is the permission bits recorded in the tree, storage.SubmoduleMode for a
+	// submodule, or 0 when none were recorded (checked out as 0644).
+	Mode uint32 `json:"mode"`
+	// Size is the length of the blob; 0 for submodules, whose hash names a commit of
+	// another repository.
+	Size int64 `json:"size"`
+}
+
+// ListTree returns the files of the commit ref names (a branch, HEAD or a full or short
+// hash) without checking it out, sorted by path. A non-empty prefix limits the list to
+// the files at or below it, matching whole path components as LsFiles does. Sizes are
+// taken from the object store (see storage.ObjectSize); empty-directory placeholders are
+// left out.
+func ListTree(ref, prefix string) ([]TreeFile, error) {
+	key := ""
+	if prefix != "" {
+		if key = storage.IndexKey(prefix); key == "." {
+			key = ""
+		} else if !IsSafePath(key) {
+			return nil, fmt.Errorf("unsafe path: %s", prefix)
+		}
+	}
+
+	if _, err := enterRepoRoot(); err != nil {
+		return nil, err
+	}
+	id, err := ResolveCommitRef(ref)
+	if err != nil {
+		return nil, err
+	}
+	commit, err := storage.FindCommit(id)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := storage.ParseTree(commit.TreeHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tree of %s: %w", commit.ID, err)
+	}
+	modes, err := storage.ParseTreeModes(commit.TreeHash)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []TreeFile{}
+	for p, hash := range tree {
+		if key != "" && p != key && !strings.HasPrefix(p, key+"/") {
+			continue
+		}
+		if isEmptyDirPlaceholder(modes[p]) {
+			continue
+		}
+		f := TreeFile{Path: p, Hash: hash, Mode: modes[p]}
+		if f.Mode != storage.SubmoduleMode {
+			if f.Size, err = storage.ObjectSize(hash); err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", p, err)
+			}
+		}
+		files = append(files, f)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, nil
+}
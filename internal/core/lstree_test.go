@@ -0,0 +1,85 @@
+package core
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+func TestListTree(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	_ = SetConfig("user.name", "Test User", false)
+	_ = SetConfig("user.email", "test@example.com", false)
+
+	if err := os.MkdirAll("pkg/sub", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"README":         "hello\n",
+		"pkg/a.go":       "package pkg\n",
+		"pkg/sub/b.go":   "package sub\n\n",
+		"pkgs/other.txt": "x",
+	}
+	if err := os.Mkdir("pkgs", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := AddFile(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	commit, _, err := Commit("first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Later changes to the index and working tree do not show up.
+	if err := os.Remove("README"); err != nil {
+		t.Fatal(err)
+	}
+
+	all, err := ListTree(commit.ID[:7], "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, f := range all {
+		paths = append(paths, f.Path)
+		if want, _ := storage.HashFile(f.Path); f.Path != "README" && f.Hash != want {
+			t.Errorf("%s: hash %s, want %s", f.Path, f.Hash, want)
+		}
+		if f.Size != int64(len(files[f.Path])) {
+			t.Errorf("%s: size %d, want %d", f.Path, f.Size, len(files[f.Path]))
+		}
+	}
+	if want := []string{"README", "pkg/a.go", "pkg/sub/b.go", "pkgs/other.txt"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("ListTree paths = %v, want %v", paths, want)
+	}
+
+	sub, err := ListTree("HEAD", "pkg/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sub) != 2 || sub[0].Path != "pkg/a.go" || sub[1].Path != "pkg/sub/b.go" {
+		t.Errorf("ListTree(pkg/) = %+v", sub)
+	}
+	if _, err := ListTree("HEAD", "../x"); err == nil {
+		t.Error("expected an error for an unsafe prefix")
+	}
+}
@@ -0,0 +1,104 @@
+package core
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+// ManifestEntry is one line of a manifest: a tracked path, its object hash and size.
+type ManifestEntry struct {
+	Hash string
+	Size int64
+	Path string // forward slashes
+}
+
+// ExportManifest writes the index as a flat manifest, one "hash size path" line per entry,
+// sorted by path, with LF line endings and forward-slash paths on every platform, so two
+// manifests can be compared byte for byte across machines. Entries staged without size
+// metadata get the size of their stored object.
+func ExportManifest(w io.Writer) error {
+	index, err := storage.LoadIndexWithMeta()
+	if err != nil {
+		return err
+	}
+	paths := make([]string, 0, len(index))
+	for path := range index {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	bw := bufio.NewWriter(w)
+	for _, path := range paths {
+		if strings.ContainsAny(path, "\r\n") {
+			return fmt.Errorf("cannot export %q: manifest paths cannot contain line breaks", path)
+		}
+		entry := index[path]
+		size := entry.Size
+		if size == 0 && entry.ModTime == 0 && entry.Mode != storage.SubmoduleMode {
+			data, err := storage.ReadObject(entry.Hash)
+			if err != nil {
+				return fmt.Errorf("failed to read object for %s: %w", path, err)
+			}
+			size = int64(len(data))
+		}
+		if _, err := fmt.Fprintf(bw, "%s %d %s\n", entry.Hash, size, path); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// ImportManifest reads a manifest written by ExportManifest and validates it instead of
+// trusting it: every line must be well-formed with a safe path, paths must be unique and
+// sorted, and every hash must name a stored object of the declared size. It returns the
+// entries when all checks pass, and otherwise an error listing every problem found.
+// Nothing is written; staging the entries is up to the caller.
+func ImportManifest(r io.Reader) ([]ManifestEntry, error) {
+	var entries []ManifestEntry
+	var problems []error
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := scanner.Text()
+		fields := strings.SplitN(line, " ", 3)
+		if len(fields) != 3 || fields[2] == "" || strings.HasSuffix(line, "\r") {
+			problems = append(problems, fmt.Errorf("line %d: expected \"hash size path\"", lineNo))
+			continue
+		}
+		size, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil || size < 0 {
+			problems = append(problems, fmt.Errorf("line %d: invalid size %q", lineNo, fields[1]))
+			continue
+		}
+		entry := ManifestEntry{Hash: fields[0], Size: size, Path: fields[2]}
+
+		if !IsSafePath(entry.Path) || storage.IndexKey(entry.Path) != entry.Path || entry.Path == "." || inRepoDir(entry.Path) {
+			problems = append(problems, fmt.Errorf("line %d: unsafe or non-canonical path %q", lineNo, entry.Path))
+			continue
+		}
+		if n := len(entries); n > 0 && entries[n-1].Path >= entry.Path {
+			problems = append(problems, fmt.Errorf("line %d: %s is duplicated or out of order", lineNo, entry.Path))
+			continue
+		}
+		if data, err := storage.ReadObject(entry.Hash); err != nil {
+			problems = append(problems, fmt.Errorf("line %d: %s: object %s is not stored", lineNo, entry.Path, entry.Hash))
+		} else if int64(len(data)) != entry.Size {
+			problems = append(problems, fmt.Errorf("line %d: %s: object %s has %d bytes, manifest says %d", lineNo, entry.Path, entry.Hash, len(data), entry.Size))
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid manifest: %w", errors.Join(problems...))
+	}
+	return entries, nil
+}
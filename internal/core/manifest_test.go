@@ -0,0 +1,74 @@
+package core
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+func TestManifest_ExportAndValidate(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll("src", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{"z.txt": "zz", "src/a b.go": "package a\n", "a.txt": "a"}
+	for name, content := range files {
+		if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := AddAll(); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := ExportManifest(&buf); err != nil {
+		t.Fatal(err)
+	}
+	index, err := storage.LoadIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := index["a.txt"] + " 1 a.txt\n" +
+		index["src/a b.go"] + " 10 src/a b.go\n" +
+		index["z.txt"] + " 2 z.txt\n"
+	if buf.String() != want {
+		t.Fatalf("manifest =\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	entries, err := ImportManifest(strings.NewReader(want))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 || entries[1].Path != "src/a b.go" || entries[1].Size != 10 {
+		t.Errorf("entries = %+v", entries)
+	}
+
+	bad := []string{
+		index["a.txt"] + " 5 a.txt\n",                                 // wrong size
+		strings.Repeat("0", 40) + " 1 a.txt\n",                        // unknown object
+		index["a.txt"] + " 1 ../a.txt\n",                              // escapes the repository
+		index["z.txt"] + " 2 z.txt\n" + index["a.txt"] + " 1 a.txt\n", // out of order
+		"not a manifest\n",
+	}
+	for _, manifest := range bad {
+		if _, err := ImportManifest(strings.NewReader(manifest)); err == nil {
+			t.Errorf("ImportManifest(%q) accepted an invalid manifest", manifest)
+		}
+	}
+}
@@ -14,7 +14,7 @@ import (
 // Currently only supports strict fast-forward merges
 func Merge(branchToMerge string) error {
 	// Guard: ensure we're inside a kitcat repo
-	if _, err := os.Stat(RepoDir); os.IsNotExist(err) {
+	if _, err := os.Stat(RepoDir()); os.IsNotExist(err) {
 		return errors.New("not a kitcat repository (run `kitcat init`)")
 	}
 
@@ -30,15 +30,30 @@ func Merge(branchToMerge string) error {
 	}
 
 	// Getting the commit hash of the branch to merge
-	branchPath := filepath.Join(HeadsDir, branchToMerge)
+	branchPath := filepath.Join(HeadsDir(), branchToMerge)
 	featureHeadHashBytes, err := os.ReadFile(branchPath)
 	if err != nil {
 		return fmt.Errorf("branch '%s' not found", branchToMerge)
 	}
 	featureHeadHash := strings.TrimSpace(string(featureHeadHashBytes))
+	if featureHeadHash == "" {
+		return fmt.Errorf("branch '%s' has no commits yet", branchToMerge)
+	}
 
 	// Getting the commit hash of the current branch (HEAD)
-	currentHeadHash, err := readHead()
+	currentHeadHash, err := ResolveHead()
+	if errors.Is(err, storage.ErrNoCommits) {
+		// Nothing to merge into yet: the current branch simply starts at the merged tip
+		fmt.Printf("Fast-forward to %s\n", featureHeadHash[:7])
+		if err := UpdateWorkspaceAndIndex(featureHeadHash); err != nil {
+			return fmt.Errorf("failed to update workspace: %w", err)
+		}
+		if err := moveHead(featureHeadHash); err != nil {
+			return fmt.Errorf("failed to update branch pointer: %w", err)
+		}
+		recordOp("merge", []string{"refs/heads/" + branchToMerge, featureHeadHash}, nil)
+		return nil
+	}
 	if err != nil {
 		return fmt.Errorf("could not read current HEAD: %w", err)
 	}
@@ -94,5 +109,6 @@ func Merge(branchToMerge string) error {
 		)
 	}
 
+	recordOp("merge", []string{"refs/heads/" + branchToMerge, featureHeadHash}, nil)
 	return nil
 }
@@ -0,0 +1,348 @@
+package core
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/LeeFred3042U/kitcat/internal/diff"
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+// MergeConflictKind says why a path could not be merged.
+type MergeConflictKind string
+
+const (
+	// MergeConflictContent: both sides changed the file in overlapping or adjacent lines,
+	// or it is binary or a submodule, which are not merged line by line.
+	MergeConflictContent MergeConflictKind = "content"
+	// MergeConflictAddAdd: both sides added the file, with different content.
+	MergeConflictAddAdd MergeConflictKind = "add/add"
+	// MergeConflictModifyDelete: one side changed the file and the other deleted it.
+	MergeConflictModifyDelete MergeConflictKind = "modify/delete"
+	// MergeConflictMode: both sides changed the file's mode, differently.
+	MergeConflictMode MergeConflictKind = "mode"
+)
+
+// MergeConflict is a path MergeTrees could not merge.
+type MergeConflict struct {
+	Path string
+	Kind MergeConflictKind
+}
+
+// MergeTreeResult is the outcome of MergeTrees.
+type MergeTreeResult struct {
+	// TreeHash names the merged tree, which is stored whether or not the merge is clean.
+	TreeHash string
+	// Conflicts are the paths that need resolving, sorted by path.
+	Conflicts []MergeConflict
+}
+
+// Clean reports whether the merge had no conflicts, i.e. TreeHash can be committed as it is.
+func (r MergeTreeResult) Clean() bool {
+	return len(r.Conflicts) == 0
+}
+
+// mergeEntry is a path's hash and mode in one tree; the zero value is an absent path.
+type mergeEntry struct {
+	hash string
+	mode uint32
+}
+
+// MergeTrees merges the changes from the tree base to the tree theirs into the tree ours,
+// entirely in the object store: the index and the working tree are neither read nor
+// touched. base may be "" for histories without a common ancestor.
+//
+// A path changed on one side only takes that side. A file both sides changed is merged
+// line by line, using the configured diff algorithm (diff.algorithm), and is clean when the
+// changes neither overlap nor touch. What cannot be merged is reported in Conflicts and
+// stored as follows: a content or add/add conflict as a blob with conflict markers
+// (see merge.conflictStyle), except binary files and submodules, which keep ours; a
+// modify/delete conflict as the modified file; a mode conflict with ours's mode. The
+// returned tree thus always exists, but only a clean one is fit to be committed.
+func MergeTrees(base, ours, theirs string) (MergeTreeResult, error) {
+	baseTree, err := readMergeTree(base)
+	if err != nil {
+		return MergeTreeResult{}, err
+	}
+	oursTree, err := readMergeTree(ours)
+	if err != nil {
+		return MergeTreeResult{}, err
+	}
+	theirsTree, err := readMergeTree(theirs)
+	if err != nil {
+		return MergeTreeResult{}, err
+	}
+
+	paths := make(map[string]bool)
+	for _, tree := range []map[string]mergeEntry{baseTree, oursTree, theirsTree} {
+		for path := range tree {
+			paths[path] = true
+		}
+	}
+	sorted := make([]string, 0, len(paths))
+	for path := range paths {
+		sorted = append(sorted, path)
+	}
+	sort.Strings(sorted)
+
+	hashes := make(map[string]string)
+	modes := make(map[string]uint32)
+	var conflicts []MergeConflict
+	for _, path := range sorted {
+		merged, kind, err := mergeTreeEntry(baseTree[path], oursTree[path], theirsTree[path])
+		if err != nil {
+			return MergeTreeResult{}, fmt.Errorf("merging %s: %w", path, err)
+		}
+		if kind != "" {
+			conflicts = append(conflicts, MergeConflict{Path: path, Kind: kind})
+		}
+		if merged.hash == "" {
+			continue
+		}
+		hashes[path] = merged.hash
+		if merged.mode != 0 {
+			modes[path] = merged.mode
+		}
+	}
+
+	treeHash, err := storage.WriteTreeWithModes(hashes, modes)
+	if err != nil {
+		return MergeTreeResult{}, err
+	}
+	return MergeTreeResult{TreeHash: treeHash, Conflicts: conflicts}, nil
+}
+
+// PreviewMerge merges the commits theirs into ours with MergeTrees, from their merge base,
+// without touching the working tree, the index or any ref. ours and theirs may be HEAD,
+// branches, tags, or full or abbreviated commit hashes.
+func PreviewMerge(ours, theirs string) (MergeTreeResult, error) {
+	if _, err := enterRepoRoot(); err != nil {
+		return MergeTreeResult{}, err
+	}
+	oursCommit, ok, err := resolveShowCommit(ours)
+	if err != nil {
+		return MergeTreeResult{}, err
+	}
+	if !ok {
+		return MergeTreeResult{}, fmt.Errorf("unknown revision '%s'", ours)
+	}
+	theirsCommit, ok, err := resolveShowCommit(theirs)
+	if err != nil {
+		return MergeTreeResult{}, err
+	}
+	if !ok {
+		return MergeTreeResult{}, fmt.Errorf("unknown revision '%s'", theirs)
+	}
+	baseHash, err := storage.FindMergeBase(oursCommit.ID, theirsCommit.ID)
+	if err != nil {
+		return MergeTreeResult{}, fmt.Errorf("failed to calculate merge base: %w", err)
+	}
+	baseCommit, err := storage.FindCommit(baseHash)
+	if err != nil {
+		return MergeTreeResult{}, err
+	}
+	return MergeTrees(baseCommit.TreeHash, oursCommit.TreeHash, theirsCommit.TreeHash)
+}
+
+// readMergeTree reads a tree as path -> entry; "" is the empty tree.
+func readMergeTree(hash string) (map[string]mergeEntry, error) {
+	tree := make(map[string]mergeEntry)
+	if hash == "" {
+		return tree, nil
+	}
+	hashes, err := storage.ParseTree(hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tree %s: %w", hash, err)
+	}
+	modes, err := storage.ParseTreeModes(hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tree %s: %w", hash, err)
+	}
+	for path, h := range hashes {
+		tree[path] = mergeEntry{hash: h, mode: modes[path]}
+	}
+	return tree, nil
+}
+
+// mergeTreeEntry merges one path, returning its merged entry (zero when it is deleted) and
+// the kind of conflict, "" when there is none.
+func mergeTreeEntry(base, ours, theirs mergeEntry) (mergeEntry, MergeConflictKind, error) {
+	switch {
+	case ours == theirs || theirs == base:
+		return ours, "", nil
+	case ours == base:
+		return theirs, "", nil
+	case ours.hash == "":
+		return theirs, MergeConflictModifyDelete, nil
+	case theirs.hash == "":
+		return ours, MergeConflictModifyDelete, nil
+	}
+
+	var kind MergeConflictKind
+	merged := mergeEntry{hash: ours.hash, mode: ours.mode}
+	switch {
+	case ours.mode == theirs.mode || theirs.mode == base.mode:
+	case ours.mode == base.mode:
+		merged.mode = theirs.mode
+	default:
+		kind = MergeConflictMode
+	}
+	if ours.hash == theirs.hash || theirs.hash == base.hash {
+		return merged, kind, nil
+	}
+	if ours.hash == base.hash {
+		merged.hash = theirs.hash
+		return merged, kind, nil
+	}
+
+	contentKind := MergeConflictContent
+	if base.hash == "" {
+		contentKind = MergeConflictAddAdd
+	}
+	if ours.mode == storage.SubmoduleMode || theirs.mode == storage.SubmoduleMode || base.mode == storage.SubmoduleMode {
+		return merged, contentKind, nil
+	}
+	var baseContent []byte
+	if base.hash != "" {
+		var err error
+		if baseContent, err = storage.ReadObject(base.hash); err != nil {
+			return mergeEntry{}, "", err
+		}
+	}
+	oursContent, err := storage.ReadObject(ours.hash)
+	if err != nil {
+		return mergeEntry{}, "", err
+	}
+	theirsContent, err := storage.ReadObject(theirs.hash)
+	if err != nil {
+		return mergeEntry{}, "", err
+	}
+	if isBinary(baseContent) || isBinary(oursContent) || isBinary(theirsContent) {
+		return merged, contentKind, nil
+	}
+
+	content, clean := mergeLines(baseContent, oursContent, theirsContent)
+	if !clean {
+		kind = contentKind
+		content = formatConflict(oursContent, baseContent, theirsContent, "ours", "base", "theirs", conflictStyle())
+	}
+	if merged.hash, err = storage.WriteObject(content); err != nil {
+		return mergeEntry{}, "", err
+	}
+	return merged, kind, nil
+}
+
+// mergeHunk is a change to a range of base lines, [start, end), replacing them with lines.
+type mergeHunk struct {
+	start, end int
+	lines      []string
+}
+
+// mergeLines merges the line changes from base to ours and from base to theirs, reporting
+// false when they overlap or touch and differ.
+func mergeLines(base, ours, theirs []byte) ([]byte, bool) {
+	b := splitLinesKeepEnds(base)
+	oursHunks := lineHunks(b, splitLinesKeepEnds(ours))
+	theirsHunks := lineHunks(b, splitLinesKeepEnds(theirs))
+
+	var out []string
+	pos, i, j := 0, 0, 0
+	for i < len(oursHunks) || j < len(theirsHunks) {
+		var fromOurs, fromTheirs []mergeHunk
+		var start, end int
+		if j == len(theirsHunks) || (i < len(oursHunks) && oursHunks[i].start <= theirsHunks[j].start) {
+			start, end = oursHunks[i].start, oursHunks[i].end
+			fromOurs = append(fromOurs, oursHunks[i])
+			i++
+		} else {
+			start, end = theirsHunks[j].start, theirsHunks[j].end
+			fromTheirs = append(fromTheirs, theirsHunks[j])
+			j++
+		}
+		// Take in every hunk of either side that overlaps or touches the group so far
+		for {
+			if i < len(oursHunks) && oursHunks[i].start <= end {
+				end = max(end, oursHunks[i].end)
+				fromOurs = append(fromOurs, oursHunks[i])
+				i++
+				continue
+			}
+			if j < len(theirsHunks) && theirsHunks[j].start <= end {
+				end = max(end, theirsHunks[j].end)
+				fromTheirs = append(fromTheirs, theirsHunks[j])
+				j++
+				continue
+			}
+			break
+		}
+
+		out = append(out, b[pos:start]...)
+		oursLines := applyHunks(b, start, end, fromOurs)
+		theirsLines := applyHunks(b, start, end, fromTheirs)
+		switch {
+		case len(fromTheirs) == 0:
+			out = append(out, oursLines...)
+		case len(fromOurs) == 0 || slices.Equal(oursLines, theirsLines):
+			out = append(out, theirsLines...)
+		default:
+			return nil, false
+		}
+		pos = end
+	}
+	out = append(out, b[pos:]...)
+	return []byte(strings.Join(out, "")), true
+}
+
+// lineHunks returns the changes that turn base into side, in order.
+func lineHunks(base, side []string) []mergeHunk {
+	var hunks []mergeHunk
+	var cur *mergeHunk
+	pos := 0
+	for _, d := range diff.Compute(diffAlgorithm(), base, side) {
+		if d.Operation == diff.EQUAL {
+			if cur != nil {
+				hunks = append(hunks, *cur)
+				cur = nil
+			}
+			pos += len(d.Text)
+			continue
+		}
+		if cur == nil {
+			cur = &mergeHunk{start: pos, end: pos}
+		}
+		if d.Operation == diff.DELETE {
+			pos += len(d.Text)
+			cur.end = pos
+		} else {
+			cur.lines = append(cur.lines, d.Text...)
+		}
+	}
+	if cur != nil {
+		hunks = append(hunks, *cur)
+	}
+	return hunks
+}
+
+// applyHunks returns base[start:end] with hunks, which lie within it, applied.
+func applyHunks(base []string, start, end int, hunks []mergeHunk) []string {
+	var out []string
+	pos := start
+	for _, h := range hunks {
+		out = append(out, base[pos:h.start]...)
+		out = append(out, h.lines...)
+		pos = h.end
+	}
+	return append(out, base[pos:end]...)
+}
+
+// splitLinesKeepEnds splits data into lines that keep their "\n", so joining them gives
+// data back byte for byte, a missing final newline included.
+func splitLinesKeepEnds(data []byte) []string {
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
@@ -0,0 +1,122 @@
+package core
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+func TestMergeTrees_MergesInObjectStore(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+
+	blob := func(content string) string {
+		hash, err := storage.WriteObject([]byte(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hash
+	}
+	tree := func(files map[string]string) string {
+		hashes := make(map[string]string, len(files))
+		for path, content := range files {
+			hashes[path] = blob(content)
+		}
+		hash, err := storage.WriteTree(hashes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hash
+	}
+
+	base := tree(map[string]string{
+		"lines.txt":   "one\ntwo\nthree\nfour\nfive\n",
+		"clash.txt":   "a\nb\nc\n",
+		"gone.txt":    "keep me\n",
+		"removed.txt": "bye\n",
+	})
+	ours := tree(map[string]string{
+		"lines.txt":   "ONE\ntwo\nthree\nfour\nfive\n",
+		"clash.txt":   "a\nours\nc\n",
+		"gone.txt":    "changed\n",
+		"removed.txt": "bye\n",
+		"added.txt":   "ours\n",
+	})
+	theirs := tree(map[string]string{
+		"lines.txt": "one\ntwo\nthree\nfour\nFIVE\n",
+		"clash.txt": "a\ntheirs\nc\n",
+		"added.txt": "theirs\n",
+		"new.txt":   "new\n",
+	})
+
+	result, err := MergeTrees(base, ours, theirs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantConflicts := []MergeConflict{
+		{Path: "added.txt", Kind: MergeConflictAddAdd},
+		{Path: "clash.txt", Kind: MergeConflictContent},
+		{Path: "gone.txt", Kind: MergeConflictModifyDelete},
+	}
+	if !reflect.DeepEqual(result.Conflicts, wantConflicts) {
+		t.Fatalf("conflicts = %v, want %v", result.Conflicts, wantConflicts)
+	}
+
+	merged, err := storage.ParseTree(result.TreeHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := func(path string) string {
+		hash, ok := merged[path]
+		if !ok {
+			t.Fatalf("%s missing from merged tree", path)
+		}
+		data, err := storage.ReadObject(hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	if got := read("lines.txt"); got != "ONE\ntwo\nthree\nfour\nFIVE\n" {
+		t.Errorf("lines.txt = %q, want both sides' changes", got)
+	}
+	if got := read("new.txt"); got != "new\n" {
+		t.Errorf("new.txt = %q", got)
+	}
+	if got := read("gone.txt"); got != "changed\n" {
+		t.Errorf("gone.txt = %q, want the modified side", got)
+	}
+	if got := read("clash.txt"); !strings.Contains(got, "<<<<<<< ours\nours\n=======\ntheirs\n>>>>>>> theirs\n") {
+		t.Errorf("clash.txt = %q, want conflict markers", got)
+	}
+	if _, ok := merged["removed.txt"]; ok {
+		t.Error("removed.txt should be deleted")
+	}
+	for _, path := range []string{"lines.txt", "clash.txt", "new.txt"} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s written to the working tree", path)
+		}
+	}
+
+	clean, err := MergeTrees(base, ours, base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !clean.Clean() || clean.TreeHash != ours {
+		t.Errorf("merging an unchanged side = %+v, want clean %s", clean, ours)
+	}
+}
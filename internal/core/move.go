@@ -2,76 +2,138 @@ package core
 
 import (
 	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/LeeFred3042U/kitcat/internal/storage"
 )
 
+// MoveOptions controls MoveFileWithOptions.
+type MoveOptions struct {
+	// Force overwrites an existing destination and moves files with unstaged changes.
+	Force bool
+	// Cached only renames the index entries and leaves the working tree alone, e.g. after
+	// the files were already moved by another tool.
+	Cached bool
+}
+
+// MoveFile renames a file or directory on disk and in the index (see MoveFileWithOptions).
 func MoveFile(oldPath, newPath string, force bool) error {
+	return MoveFileWithOptions(oldPath, newPath, MoveOptions{Force: force})
+}
+
+// MoveFileWithOptions is `mv` for tracked paths: it renames oldPath to newPath on disk and
+// moves every index entry at or below oldPath to the new key in a single index transaction.
+// The entries keep their hash, size, mtime and flags, so what was staged stays staged and
+// nothing is re-hashed. A destination that exists on disk or in the index is an error unless
+// opts.Force is set. An untracked source is moved and then staged at its new path.
+func MoveFileWithOptions(oldPath, newPath string, opts MoveOptions) error {
 	if oldPath == newPath {
 		return errors.New("source and destination paths are the same")
 	}
-	if !IsSafePath(oldPath) || !IsSafePath(newPath) {
-		return errors.New("unsafe path detected")
+	src, err := RepoRelPath(oldPath)
+	if err != nil {
+		return err
 	}
-
-	// If force is true, overwrites destination
-	// If not returns error if destination path already exists
-	if force {
-		if err := os.RemoveAll(newPath); err != nil && !os.IsNotExist(err) {
-			return err
-		}
-	} else {
-		if _, err := os.Stat(newPath); err == nil {
-			return errors.New("destination path already exists")
-		} else if !os.IsNotExist(err) {
-			return err
-		}
+	dst, err := RepoRelPath(newPath)
+	if err != nil {
+		return err
+	}
+	if src == dst {
+		return errors.New("source and destination paths are the same")
 	}
+	if src == "." || dst == "." {
+		return errors.New("cannot move the repository root")
+	}
+	if strings.HasPrefix(dst, src+"/") {
+		return fmt.Errorf("cannot move '%s' into itself", oldPath)
+	}
+	if _, err := enterRepoRoot(); err != nil {
+		return err
+	}
+	srcPath, dstPath := filepath.FromSlash(src), filepath.FromSlash(dst)
 
-	// Check for uncommitted changes unless force is true
-	if !force {
-		idx, err := storage.LoadIndex()
-		if err != nil {
-			return err
-		}
+	idx, err := storage.LoadIndexWithMeta()
+	if err != nil {
+		return err
+	}
+	tracked := entriesUnder(idx, src)
+	if len(tracked) == 0 && opts.Cached {
+		return fmt.Errorf("'%s' is not under version control", oldPath)
+	}
+	if !opts.Force && len(entriesUnder(idx, dst)) > 0 {
+		return fmt.Errorf("destination '%s' is already tracked, use -f to force", newPath)
+	}
 
-		// Only check if file is tracked in the index
-		if indexHash, exists := idx[oldPath]; exists {
-			currentHash, err := storage.HashFile(oldPath)
-			if err != nil {
+	if !opts.Cached {
+		// If force is true, overwrites destination
+		// If not returns error if destination path already exists
+		if opts.Force {
+			if err := os.RemoveAll(dstPath); err != nil && !os.IsNotExist(err) {
 				return err
 			}
+		} else {
+			if _, err := os.Stat(dstPath); err == nil {
+				return errors.New("destination path already exists")
+			} else if !os.IsNotExist(err) {
+				return err
+			}
+		}
 
-			if currentHash != indexHash {
-				return errors.New("local changes present, use -f to force")
+		// Check for uncommitted changes unless force is true
+		if !opts.Force {
+			for _, path := range tracked {
+				currentHash, err := storage.HashFile(path)
+				if err != nil {
+					return err
+				}
+				if currentHash != idx[path].Hash {
+					return errors.New("local changes present, use -f to force")
+				}
 			}
 		}
-	}
 
-	// Rename file
-	if err := os.Rename(oldPath, newPath); err != nil {
-		return err
-	}
+		// Rename file
+		if err := os.Rename(srcPath, dstPath); err != nil {
+			return err
+		}
 
-	// Stage new file
-	if err := AddFile(newPath); err != nil {
-		return err
+		// Nothing to carry over: stage the file at its new path
+		if len(tracked) == 0 {
+			return AddFile(dstPath)
+		}
 	}
 
-	// Load index
-	idx, err := storage.LoadIndex()
-	if err != nil {
-		return err
+	err = storage.UpdateIndexWithMeta(func(index map[string]storage.IndexEntry) error {
+		for _, path := range entriesUnder(index, dst) {
+			delete(index, path)
+		}
+		for _, path := range entriesUnder(index, src) {
+			entry := index[path]
+			entry.DisplayPath = "" // the new name is spelled as given
+			index[dst+strings.TrimPrefix(path, src)] = entry
+			delete(index, path)
+		}
+		return nil
+	})
+	if err != nil && !opts.Cached {
+		// Put the files back so disk and index still agree
+		if renameErr := os.Rename(dstPath, srcPath); renameErr != nil {
+			return fmt.Errorf("%w; additionally failed to move '%s' back: %v", err, newPath, renameErr)
+		}
 	}
+	return err
+}
 
-	// Remove old file from index
-	delete(idx, oldPath)
-
-	// Write index
-	if err := storage.WriteIndex(idx); err != nil {
-		return err
+// entriesUnder lists the index paths that are path itself or lie below it.
+func entriesUnder(index map[string]storage.IndexEntry, path string) []string {
+	var paths []string
+	for p := range index {
+		if matchesPathspec(p, path) {
+			paths = append(paths, p)
+		}
 	}
-
-	return nil
+	return paths
 }
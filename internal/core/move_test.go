@@ -363,3 +363,76 @@ func TestMoveFile_UntrackedFile(t *testing.T) {
 		t.Fatalf("expected newPath to be staged after move")
 	}
 }
+
+func TestMoveFileWithOptions_PreservesIndexEntries(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.MkdirAll("pkg/sub", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{"pkg/a.go": "a", "pkg/sub/b.go": "b", "other.txt": "o"} {
+		if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := AddAll(); err != nil {
+		t.Fatal(err)
+	}
+	before, err := storage.LoadIndexWithMeta()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A whole directory moves with its entries unchanged.
+	if err := MoveFile("pkg", "lib", false); err != nil {
+		t.Fatal(err)
+	}
+	after, err := storage.LoadIndexWithMeta()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after["lib/a.go"] != before["pkg/a.go"] || after["lib/sub/b.go"] != before["pkg/sub/b.go"] {
+		t.Errorf("moved entries changed: %+v", after)
+	}
+	if _, ok := after["pkg/a.go"]; ok {
+		t.Error("old entry left in the index")
+	}
+	if _, err := os.Stat("lib/sub/b.go"); err != nil {
+		t.Errorf("directory not moved on disk: %v", err)
+	}
+
+	// A tracked destination is refused without force.
+	if err := MoveFileWithOptions("other.txt", "lib/a.go", MoveOptions{Cached: true}); err == nil {
+		t.Error("expected an error for a tracked destination")
+	}
+
+	// --cached renames only the index entry.
+	if err := os.Rename("other.txt", "renamed.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := MoveFileWithOptions("other.txt", "renamed.txt", MoveOptions{Cached: true}); err != nil {
+		t.Fatal(err)
+	}
+	after, err = storage.LoadIndexWithMeta()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after["renamed.txt"] != before["other.txt"] {
+		t.Errorf("renamed.txt = %+v, want %+v", after["renamed.txt"], before["other.txt"])
+	}
+	if err := MoveFileWithOptions("missing.txt", "x.txt", MoveOptions{Cached: true}); err == nil {
+		t.Error("expected an error moving an untracked path with --cached")
+	}
+}
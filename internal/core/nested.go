@@ -0,0 +1,24 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+// nestedRepoMarkers are the entries that make a directory the root of another repository:
+// a kitcat repository directory, or Git's .git (a file in Git worktrees and submodules).
+var nestedRepoMarkers = []string{storage.DefaultRepoDir, ".git"}
+
+// isNestedRepo reports whether dir, a directory below the repository root, is the root of
+// another repository. Its contents belong to that repository, so add never descends into
+// it; files under it that were staged before are dropped from the index like deleted ones.
+func isNestedRepo(dir string) bool {
+	for _, marker := range nestedRepoMarkers {
+		if _, err := os.Lstat(filepath.Join(dir, marker)); err == nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,153 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+// ReadOpLog returns the operation log, oldest first: one entry for every add, commit,
+// reset, checkout and merge that completed in this repository.
+func ReadOpLog() ([]storage.OpLogEntry, error) {
+	return storage.ReadOpLog()
+}
+
+// OpLogExpiry selects the operation log entries ExpireOpLog drops.
+type OpLogExpiry struct {
+	// OlderThan drops only entries recorded longer ago than this; 0 means any age.
+	OlderThan time.Duration
+	// Unreachable drops only entries whose commits are all unreachable from every branch,
+	// tag, stash and HEAD, such as those of amended or reset-away commits. Entries that
+	// name no commit of this repository, like those of add, are kept.
+	Unreachable bool
+}
+
+// ExpireOpLog drops the operation log entries selected by expiry, so the log does not grow
+// forever, and returns how many it dropped. At least one of OlderThan and Unreachable must
+// be set; with both, an entry must be old and unreachable to go. The log is rewritten
+// atomically and entries appended meanwhile are kept.
+func ExpireOpLog(expiry OpLogExpiry) (int, error) {
+	if expiry.OlderThan < 0 {
+		return 0, errors.New("expiry age must not be negative")
+	}
+	if expiry.OlderThan == 0 && !expiry.Unreachable {
+		return 0, errors.New("nothing to expire: give an age, unreachable, or both")
+	}
+	cutoff := Now().Add(-expiry.OlderThan)
+
+	var known, reachable map[string]bool
+	if expiry.Unreachable {
+		var err error
+		if known, reachable, err = reachableCommits(); err != nil {
+			return 0, err
+		}
+	}
+	return storage.RewriteOpLog(func(entry storage.OpLogEntry) bool {
+		if expiry.OlderThan > 0 && !entry.Time.Before(cutoff) {
+			return true
+		}
+		if !expiry.Unreachable {
+			return false
+		}
+		named := false
+		for _, ref := range entry.Refs {
+			if reachable[ref] {
+				return true
+			}
+			named = named || known[ref]
+		}
+		return !named
+	})
+}
+
+// ParseExpiryAge parses an age for OpLogExpiry.OlderThan: a Go duration such as "12h", or a
+// whole number of days such as "30d".
+func ParseExpiryAge(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid age %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age %q", s)
+	}
+	return d, nil
+}
+
+// reachableCommits returns every commit in the commit log (known) and those reachable from
+// a branch, a tag, a stash entry or HEAD.
+func reachableCommits() (known, reachable map[string]bool, err error) {
+	commits, err := storage.ReadCommits()
+	if err != nil {
+		return nil, nil, err
+	}
+	known = make(map[string]bool, len(commits))
+	parent := make(map[string]string, len(commits))
+	for _, c := range commits {
+		known[c.ID] = true
+		parent[c.ID] = c.Parent
+	}
+
+	var tips []string
+	for _, dir := range []string{HeadsDir(), TagsDir()} {
+		entries, err := os.ReadDir(dir)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, nil, err
+		}
+		for _, e := range entries {
+			if e.IsDir() {
+				continue
+			}
+			data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+			if err != nil {
+				return nil, nil, err
+			}
+			tips = append(tips, strings.TrimSpace(string(data)))
+		}
+	}
+	stashes, err := storage.ListStashes()
+	if err != nil {
+		return nil, nil, err
+	}
+	tips = append(tips, stashes...)
+	if head, err := ReadHead(); err == nil {
+		tips = append(tips, head.Hash)
+	}
+
+	reachable = make(map[string]bool)
+	for _, id := range tips {
+		for id != "" && known[id] && !reachable[id] {
+			reachable[id] = true
+			id = parent[id]
+		}
+	}
+	return known, reachable, nil
+}
+
+// recordOp appends an entry to the operation log. The operation has already taken effect
+// when it is logged, so a failure to log is a warning rather than an error of the command.
+func recordOp(op string, refs, paths []string) {
+	entry := storage.OpLogEntry{Time: Now().UTC(), Op: op, Refs: refs, Paths: paths}
+	if err := storage.AppendOpLog(entry); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: could not write operation log: %v\n", err)
+	}
+}
+
+// changedPaths lists the paths whose hash differs between two path->hash maps, sorted.
+func changedPaths(from, to map[string]string) []string {
+	changes := diffTrees(from, to)
+	paths := make([]string, len(changes))
+	for i, c := range changes {
+		paths[i] = c.Path
+	}
+	return paths
+}
@@ -0,0 +1,175 @@
+package core
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+func TestOpLog_RecordsMutatingOperations(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetConfig("user.name", "Test", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetConfig("user.email", "test@example.com", false); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile("a.txt", []byte("one"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddFile("a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	first, _, err := Commit("first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateBranch("feature"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("b.txt", []byte("two"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddAll(); err != nil {
+		t.Fatal(err)
+	}
+	second, _, err := Commit("second")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckoutBranch("feature"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Reset(second.ID, ResetMixed); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := ReadOpLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []storage.OpLogEntry{
+		{Op: "add", Paths: []string{"a.txt"}},
+		{Op: "commit", Refs: []string{first.ID}, Paths: []string{"a.txt"}},
+		{Op: "add", Paths: []string{"b.txt"}},
+		{Op: "commit", Refs: []string{second.ID}, Paths: []string{"b.txt"}},
+		{Op: "checkout", Refs: []string{"refs/heads/feature", first.ID}},
+		{Op: "reset --mixed", Refs: []string{second.ID}},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("got %d entries, want %d: %+v", len(entries), len(want), entries)
+	}
+	for i, e := range entries {
+		if e.Time.IsZero() {
+			t.Errorf("entry %d has no timestamp", i)
+		}
+		e.Time = want[i].Time
+		if !reflect.DeepEqual(e, want[i]) {
+			t.Errorf("entry %d = %+v, want %+v", i, e, want[i])
+		}
+	}
+}
+
+func TestExpireOpLog(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetConfig("user.name", "Test", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetConfig("user.email", "test@example.com", false); err != nil {
+		t.Fatal(err)
+	}
+	defer func(prev func() time.Time) { Now = prev }(Now)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	Now = func() time.Time { return start }
+
+	commitFile := func(content, message string) {
+		t.Helper()
+		if err := os.WriteFile("a.txt", []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := AddFile("a.txt"); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := Commit(message); err != nil {
+			t.Fatal(err)
+		}
+	}
+	commitFile("one", "first")
+	if _, err := CommitAmend("first, amended"); err != nil {
+		t.Fatal(err)
+	}
+	Now = func() time.Time { return start.Add(48 * time.Hour) }
+	commitFile("second", "second")
+
+	ops := func() []string {
+		t.Helper()
+		entries, err := ReadOpLog()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Op)
+		}
+		return names
+	}
+	if got, want := ops(), []string{"add", "commit", "commit --amend", "add", "commit"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("operation log = %v, want %v", got, want)
+	}
+
+	if _, err := ExpireOpLog(OpLogExpiry{}); err == nil {
+		t.Error("ExpireOpLog without an age or unreachable succeeded")
+	}
+
+	// Only the original first commit is gone; the amend entry still names its replacement.
+	dropped, err := ExpireOpLog(OpLogExpiry{Unreachable: true})
+	if err != nil || dropped != 1 {
+		t.Fatalf("ExpireOpLog(unreachable) = %d, %v; want 1", dropped, err)
+	}
+	if got, want := ops(), []string{"add", "commit --amend", "add", "commit"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after unreachable expiry = %v, want %v", got, want)
+	}
+
+	age, err := ParseExpiryAge("1d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dropped, err = ExpireOpLog(OpLogExpiry{OlderThan: age})
+	if err != nil || dropped != 2 {
+		t.Fatalf("ExpireOpLog(1d) = %d, %v; want 2", dropped, err)
+	}
+	if got, want := ops(), []string{"add", "commit"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after age expiry = %v, want %v", got, want)
+	}
+	if _, err := ParseExpiryAge("-1h"); err == nil {
+		t.Error("ParseExpiryAge accepted a negative age")
+	}
+}
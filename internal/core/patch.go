@@ -0,0 +1,701 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LeeFred3042U/kitcat/internal/diff"
+	"github.com/LeeFred3042U/kitcat/internal/models"
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+// ErrPatchRejected is wrapped by the error of ApplyPatch when hunks do not apply.
+var ErrPatchRejected = errors.New("patch does not apply")
+
+// patchContext is the number of unchanged lines written around each change of a patch.
+const patchContext = 3
+
+// maxPatchFuzz is how many context lines, at each end of a hunk, ApplyPatch may ignore to
+// place a hunk whose surroundings have drifted, as patch's fuzz factor.
+const maxPatchFuzz = 2
+
+// zeroHash stands for the missing side of an added or deleted file on a patch's index line.
+var zeroHash = strings.Repeat("0", 40)
+
+// Patch is a commit as a patch file, as written by ExportPatch and read by ParsePatch.
+type Patch struct {
+	// Commit is the ID of the exported commit, empty when the patch does not name one.
+	Commit      string
+	AuthorName  string
+	AuthorEmail string
+	// Date is the author date, zero when the patch has none.
+	Date    time.Time
+	Message string
+	Files   []FilePatch
+}
+
+// FilePatch is the change a patch makes to one file. OldPath is empty for a file the patch
+// creates and NewPath for one it deletes.
+type FilePatch struct {
+	OldPath string
+	NewPath string
+	// OldHash and NewHash are the blob hashes from the patch's index line, when it has one.
+	OldHash string
+	NewHash string
+	hunks   []patchHunk
+}
+
+// Path is the file the patch changes.
+func (fp FilePatch) Path() string {
+	if fp.NewPath != "" {
+		return fp.NewPath
+	}
+	return fp.OldPath
+}
+
+// patchHunk is one "@@" section of a file patch.
+type patchHunk struct {
+	oldStart, newStart int // as in the header: 1-based, or the line before for an empty side
+	lines              []patchLine
+}
+
+// patchLine is a line of a hunk: op is ' ', '-' or '+', and text keeps its "\n", which only
+// a last line without one lacks.
+type patchLine struct {
+	op   byte
+	text string
+}
+
+// RejectedHunk is a hunk ApplyPatch could not place, or a file it could not patch at all,
+// in which case Header is empty.
+type RejectedHunk struct {
+	Path   string
+	Header string
+	Reason string
+}
+
+// PatchResult is what ApplyPatch did.
+type PatchResult struct {
+	Patch *Patch
+	// Changed are the paths written and staged, sorted.
+	Changed []string
+	// Merged are the paths among Changed that were patched by a three-way merge.
+	Merged []string
+	// Rejected are the hunks that did not apply; when there are any, nothing was changed.
+	Rejected []RejectedHunk
+}
+
+// ExportPatch writes the commit ref names as a patch to w, the equivalent of git
+// format-patch: a mail-style header with the author, date and message, followed by a
+// unified diff against the commit's parent, with blob hashes on each file's index line so
+// that ApplyPatch can fall back to a three-way merge. ref may be HEAD, a branch, a tag, or
+// a full or abbreviated commit hash. Binary files and submodules cannot be exported, and
+// file permissions and empty-directory placeholders are not carried.
+func ExportPatch(ref string, w io.Writer) error {
+	if _, err := enterRepoRoot(); err != nil {
+		return err
+	}
+	commit, ok, err := resolveShowCommit(ref)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("unknown revision '%s'", ref)
+	}
+	tree, err := storage.ParseTree(commit.TreeHash)
+	if err != nil {
+		return err
+	}
+	modes, err := storage.ParseTreeModes(commit.TreeHash)
+	if err != nil {
+		return err
+	}
+	parentTree := map[string]string{}
+	parentModes := map[string]uint32{}
+	if commit.Parent != "" {
+		parent, err := storage.FindCommit(commit.Parent)
+		if err != nil {
+			return err
+		}
+		if parentTree, err = storage.ParseTree(parent.TreeHash); err != nil {
+			return err
+		}
+		if parentModes, err = storage.ParseTreeModes(parent.TreeHash); err != nil {
+			return err
+		}
+	}
+
+	var b bytes.Buffer
+	subject, body, _ := strings.Cut(strings.TrimSpace(commit.Message), "\n")
+	fmt.Fprintf(&b, "From %s Mon Sep 17 00:00:00 2001\n", commit.ID)
+	fmt.Fprintf(&b, "From: %s <%s>\n", commit.AuthorName, commit.AuthorEmail)
+	fmt.Fprintf(&b, "Date: %s\n", authorDate(commit).Format(time.RFC1123Z))
+	fmt.Fprintf(&b, "Subject: [PATCH] %s\n\n", strings.TrimSpace(subject))
+	if body = strings.TrimSpace(body); body != "" {
+		b.WriteString(body + "\n\n")
+	}
+	b.WriteString("---\n")
+
+	for _, change := range diffTrees(parentTree, tree) {
+		if modes[change.Path] == storage.SubmoduleMode || parentModes[change.Path] == storage.SubmoduleMode {
+			return fmt.Errorf("cannot export submodule %s as a patch", change.Path)
+		}
+		if isEmptyDirPlaceholder(modes[change.Path]) || isEmptyDirPlaceholder(parentModes[change.Path]) {
+			continue
+		}
+		var oldData, newData []byte
+		if change.OldHash != "" {
+			if oldData, err = storage.ReadObject(change.OldHash); err != nil {
+				return err
+			}
+		}
+		if change.NewHash != "" {
+			if newData, err = storage.ReadObject(change.NewHash); err != nil {
+				return err
+			}
+		}
+		if isBinary(oldData) || isBinary(newData) {
+			return fmt.Errorf("cannot export binary file %s as a patch", change.Path)
+		}
+		writeFilePatch(&b, change, oldData, newData)
+	}
+	_, err = w.Write(b.Bytes())
+	return err
+}
+
+// writeFilePatch writes the diff --git section of one changed file.
+func writeFilePatch(b *bytes.Buffer, change TreeChange, oldData, newData []byte) {
+	oldName, newName := "a/"+change.Path, "b/"+change.Path
+	oldHash, newHash := change.OldHash, change.NewHash
+	if change.Kind == ChangeAdded {
+		oldName, oldHash = "/dev/null", zeroHash
+	}
+	if change.Kind == ChangeDeleted {
+		newName, newHash = "/dev/null", zeroHash
+	}
+	fmt.Fprintf(b, "diff --git a/%s b/%s\n", change.Path, change.Path)
+	fmt.Fprintf(b, "index %s..%s\n", oldHash, newHash)
+	fmt.Fprintf(b, "--- %s\n+++ %s\n", oldName, newName)
+	for _, h := range unifiedHunks(splitLinesKeepEnds(oldData), splitLinesKeepEnds(newData)) {
+		b.WriteString(h.header() + "\n")
+		for _, line := range h.lines {
+			b.WriteByte(line.op)
+			b.WriteString(line.text)
+			if !strings.HasSuffix(line.text, "\n") {
+				b.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+	}
+}
+
+// unifiedHunks diffs two files, split with splitLinesKeepEnds, into hunks with
+// patchContext lines of context; changes closer than twice that share a hunk.
+func unifiedHunks(a, b []string) []patchHunk {
+	var lines []patchLine
+	for _, d := range diff.Compute(diffAlgorithm(), a, b) {
+		op := byte(' ')
+		switch d.Operation {
+		case diff.INSERT:
+			op = '+'
+		case diff.DELETE:
+			op = '-'
+		}
+		for _, text := range d.Text {
+			lines = append(lines, patchLine{op: op, text: text})
+		}
+	}
+	// oldAt[i] and newAt[i] count the lines of a and b before lines[i]
+	oldAt, newAt := make([]int, len(lines)+1), make([]int, len(lines)+1)
+	for i, line := range lines {
+		oldAt[i+1], newAt[i+1] = oldAt[i], newAt[i]
+		if line.op != '+' {
+			oldAt[i+1]++
+		}
+		if line.op != '-' {
+			newAt[i+1]++
+		}
+	}
+
+	var hunks []patchHunk
+	for i := 0; i < len(lines); {
+		if lines[i].op == ' ' {
+			i++
+			continue
+		}
+		start, last := max(i-patchContext, 0), i
+		for j := i; j < len(lines) && j-last <= 2*patchContext+1; j++ {
+			if lines[j].op != ' ' {
+				last = j
+			}
+		}
+		end := min(last+patchContext+1, len(lines))
+		h := patchHunk{oldStart: oldAt[start], newStart: newAt[start], lines: lines[start:end]}
+		if oldAt[end] > oldAt[start] {
+			h.oldStart++
+		}
+		if newAt[end] > newAt[start] {
+			h.newStart++
+		}
+		hunks = append(hunks, h)
+		i = end
+	}
+	return hunks
+}
+
+// side returns the lines of the hunk without those marked skip: the old side for '+',
+// the new side for '-'.
+func (h patchHunk) side(skip byte) []string {
+	var out []string
+	for _, line := range h.lines {
+		if line.op != skip {
+			out = append(out, line.text)
+		}
+	}
+	return out
+}
+
+// header renders the hunk's "@@ -old +new @@" line.
+func (h patchHunk) header() string {
+	return fmt.Sprintf("@@ -%d,%d +%d,%d @@", h.oldStart, len(h.side('+')), h.newStart, len(h.side('-')))
+}
+
+// context returns how many context lines the hunk has before its first change and after
+// its last.
+func (h patchHunk) context() (leading, trailing int) {
+	for leading < len(h.lines) && h.lines[leading].op == ' ' {
+		leading++
+	}
+	for trailing < len(h.lines) && h.lines[len(h.lines)-1-trailing].op == ' ' {
+		trailing++
+	}
+	return leading, trailing
+}
+
+// expectedIndex is where the hunk's old side starts in the file, 0-based.
+func (h patchHunk) expectedIndex() int {
+	if len(h.side('+')) == 0 {
+		return h.oldStart
+	}
+	return h.oldStart - 1
+}
+
+var hunkHeaderRE = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// ParsePatch reads a patch as written by ExportPatch. Mail headers and the message are
+// optional, so plain unified diffs with ---/+++ file headers parse too.
+func ParsePatch(r io.Reader) (*Patch, error) {
+	data, err := io.ReadAll(bufio.NewReader(r))
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	patch := &Patch{}
+
+	// The mail header runs to the first blank line, the message from there to "---".
+	i := 0
+	if len(lines) > 0 && strings.HasPrefix(lines[0], "From ") {
+		if fields := strings.Fields(lines[0]); len(fields) > 1 {
+			patch.Commit = fields[1]
+		}
+		var subject string
+		for i = 1; i < len(lines) && strings.TrimSpace(lines[i]) != ""; i++ {
+			line := strings.TrimRight(lines[i], "\r\n")
+			switch {
+			case strings.HasPrefix(line, "From: "):
+				from := strings.TrimPrefix(line, "From: ")
+				if lt := strings.LastIndex(from, "<"); lt >= 0 && strings.HasSuffix(from, ">") {
+					patch.AuthorName = strings.TrimSpace(from[:lt])
+					patch.AuthorEmail = from[lt+1 : len(from)-1]
+				} else {
+					patch.AuthorName = strings.TrimSpace(from)
+				}
+			case strings.HasPrefix(line, "Date: "):
+				date, err := time.Parse(time.RFC1123Z, strings.TrimPrefix(line, "Date: "))
+				if err != nil {
+					return nil, fmt.Errorf("invalid patch date: %w", err)
+				}
+				patch.Date = date
+			case strings.HasPrefix(line, "Subject: "):
+				subject = strings.TrimPrefix(line, "Subject: ")
+			case strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t"):
+				if subject != "" { // a folded subject line
+					subject += " " + strings.TrimSpace(line)
+				}
+			}
+		}
+		if strings.HasPrefix(subject, "[PATCH") {
+			if _, rest, ok := strings.Cut(subject, "]"); ok {
+				subject = rest
+			}
+		}
+		var body []string
+		for ; i < len(lines); i++ {
+			line := strings.TrimRight(lines[i], "\r\n")
+			if line == "---" || strings.HasPrefix(line, "diff --git ") {
+				break
+			}
+			body = append(body, line)
+		}
+		patch.Message = strings.TrimSpace(subject)
+		if text := strings.TrimSpace(strings.Join(body, "\n")); text != "" {
+			patch.Message += "\n\n" + text
+		}
+	}
+
+	var oldHash, newHash string
+	for i < len(lines) {
+		line := lines[i]
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			oldHash, newHash = "", ""
+			i++
+		case strings.HasPrefix(line, "index "):
+			hashes, _, _ := strings.Cut(strings.TrimSpace(strings.TrimPrefix(line, "index ")), " ")
+			oldHash, newHash, _ = strings.Cut(hashes, "..")
+			i++
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			fp := FilePatch{
+				OldPath: patchFilePath(line[len("--- "):], "a/"),
+				NewPath: patchFilePath(lines[i+1][len("+++ "):], "b/"),
+			}
+			if oldHash != zeroHash {
+				fp.OldHash = oldHash
+			}
+			if newHash != zeroHash {
+				fp.NewHash = newHash
+			}
+			if fp.OldPath == "" && fp.NewPath == "" {
+				return nil, fmt.Errorf("patch line %d: file header names no file", i+1)
+			}
+			patch.Files = append(patch.Files, fp)
+			i += 2
+		case strings.HasPrefix(line, "@@ "):
+			if len(patch.Files) == 0 {
+				return nil, fmt.Errorf("patch line %d: hunk without a file header", i+1)
+			}
+			h, next, err := parseHunk(lines, i)
+			if err != nil {
+				return nil, err
+			}
+			fp := &patch.Files[len(patch.Files)-1]
+			fp.hunks = append(fp.hunks, h)
+			i = next
+		default:
+			i++
+		}
+	}
+	if len(patch.Files) == 0 {
+		return nil, errors.New("no file changes found in patch")
+	}
+	return patch, nil
+}
+
+// patchFilePath returns the repository path of a ---/+++ file name, "" for /dev/null.
+func patchFilePath(name, prefix string) string {
+	name = strings.TrimRight(name, "\r\n")
+	name, _, _ = strings.Cut(name, "\t") // traditional diffs append a timestamp
+	if name == "/dev/null" {
+		return ""
+	}
+	return strings.TrimPrefix(name, prefix)
+}
+
+// parseHunk reads the hunk whose header is lines[i], returning it and the index of the
+// line after it.
+func parseHunk(lines []string, i int) (patchHunk, int, error) {
+	m := hunkHeaderRE.FindStringSubmatch(lines[i])
+	if m == nil {
+		return patchHunk{}, 0, fmt.Errorf("patch line %d: malformed hunk header", i+1)
+	}
+	count := func(s string) int {
+		if s == "" {
+			return 1
+		}
+		n, _ := strconv.Atoi(s)
+		return n
+	}
+	h := patchHunk{}
+	h.oldStart, _ = strconv.Atoi(m[1])
+	h.newStart, _ = strconv.Atoi(m[3])
+	oldLeft, newLeft := count(m[2]), count(m[4])
+
+	for i++; i < len(lines) && lines[i] != ""; i++ {
+		line := lines[i]
+		if strings.HasPrefix(line, `\`) {
+			if len(h.lines) > 0 {
+				last := &h.lines[len(h.lines)-1]
+				last.text = strings.TrimSuffix(last.text, "\n")
+			}
+			continue
+		}
+		if oldLeft == 0 && newLeft == 0 {
+			break
+		}
+		op := byte(' ')
+		text := "\n" // mailers may strip the space off an empty context line
+		if line != "\n" {
+			op, text = line[0], line[1:]
+		}
+		switch op {
+		case ' ':
+			oldLeft--
+			newLeft--
+		case '-':
+			oldLeft--
+		case '+':
+			newLeft--
+		default:
+			return patchHunk{}, 0, fmt.Errorf("patch line %d: unexpected line in hunk", i+1)
+		}
+		if oldLeft < 0 || newLeft < 0 {
+			return patchHunk{}, 0, fmt.Errorf("patch line %d: hunk longer than its header says", i+1)
+		}
+		h.lines = append(h.lines, patchLine{op: op, text: text})
+	}
+	if oldLeft > 0 || newLeft > 0 {
+		return patchHunk{}, 0, errors.New("patch ends in the middle of a hunk")
+	}
+	return h, i, nil
+}
+
+// ApplyPatch applies a patch, as written by ExportPatch, to the working tree and stages the
+// result, the equivalent of git apply --index. The working tree and index must be clean.
+//
+// Each hunk is placed where its header says, or, if the file has drifted since the patch
+// was made, at the nearest offset where its lines match, ignoring up to two context lines at
+// each end if need be. A file whose hunks still do not all fit is patched by a three-way
+// merge instead when the object store has the blob the patch was made against (its index
+// line): the patch is applied to that blob and the result merged with the current file as
+// MergeTrees merges, which succeeds when the drift and the patch touch different lines.
+//
+// The patch is applied completely or not at all: when any hunk is rejected nothing is
+// written, and the error wraps ErrPatchRejected with the rejected hunks in the result.
+// Renames are not supported.
+func ApplyPatch(r io.Reader) (PatchResult, error) {
+	patch, err := ParsePatch(r)
+	if err != nil {
+		return PatchResult{}, err
+	}
+	result := PatchResult{Patch: patch}
+	if _, err := enterRepoRoot(); err != nil {
+		return result, err
+	}
+	if err := requireNoUncommittedChanges("apply-patch"); err != nil {
+		return result, err
+	}
+
+	type outcome struct {
+		path    string
+		content []byte
+		remove  bool
+	}
+	var outcomes []outcome
+	seen := make(map[string]bool)
+	for _, fp := range patch.Files {
+		path := fp.Path()
+		if fp.OldPath != "" && fp.NewPath != "" && fp.OldPath != fp.NewPath {
+			return result, fmt.Errorf("patch renames %s to %s, which is not supported", fp.OldPath, fp.NewPath)
+		}
+		if !IsSafePath(path) || inRepoDir(path) {
+			return result, fmt.Errorf("patch touches unsafe path '%s'", path)
+		}
+		if seen[path] {
+			return result, fmt.Errorf("patch changes %s more than once", path)
+		}
+		seen[path] = true
+
+		reject := func(reason string) {
+			result.Rejected = append(result.Rejected, RejectedHunk{Path: path, Reason: reason})
+		}
+		current, err := os.ReadFile(filepath.FromSlash(path))
+		exists := err == nil
+		if err != nil && !os.IsNotExist(err) {
+			return result, err
+		}
+		if fp.OldPath == "" && exists {
+			reject("already exists")
+			continue
+		}
+		if fp.OldPath != "" && !exists {
+			reject("does not exist")
+			continue
+		}
+
+		patched, rejected := applyPatchHunks(splitLinesKeepEnds(current), fp.hunks, maxPatchFuzz)
+		content := []byte(strings.Join(patched, ""))
+		if len(rejected) > 0 && len(fp.OldHash) == 40 {
+			if merged, ok := threeWayPatch(fp, current); ok {
+				content, rejected = merged, nil
+				result.Merged = append(result.Merged, path)
+			}
+		}
+		for _, h := range rejected {
+			result.Rejected = append(result.Rejected, RejectedHunk{Path: path, Header: h.header(), Reason: "context does not match"})
+		}
+		if len(rejected) > 0 {
+			continue
+		}
+		if fp.NewPath == "" && len(content) > 0 {
+			reject("has content the patch does not delete")
+			continue
+		}
+		outcomes = append(outcomes, outcome{path: path, content: content, remove: fp.NewPath == ""})
+	}
+	if len(result.Rejected) > 0 {
+		return result, fmt.Errorf("%w: %d hunk(s) rejected", ErrPatchRejected, len(result.Rejected))
+	}
+
+	var added, removed []string
+	for _, o := range outcomes {
+		osPath := filepath.FromSlash(o.path)
+		if o.remove {
+			if err := os.Remove(osPath); err != nil {
+				return result, err
+			}
+			removed = append(removed, o.path)
+			continue
+		}
+		perm := os.FileMode(0o644)
+		if info, err := os.Stat(osPath); err == nil {
+			perm = info.Mode().Perm()
+		}
+		if err := os.MkdirAll(filepath.Dir(osPath), 0o755); err != nil {
+			return result, err
+		}
+		if err := SafeWrite(osPath, o.content, perm); err != nil {
+			return result, err
+		}
+		added = append(added, o.path)
+	}
+	if len(added) > 0 {
+		if err := addPaths(added, AddOptions{Force: true}); err != nil {
+			return result, fmt.Errorf("failed to stage patched files: %w", err)
+		}
+	}
+	if len(removed) > 0 {
+		err := storage.UpdateIndexWithMeta(func(index map[string]storage.IndexEntry) error {
+			for _, path := range removed {
+				delete(index, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return result, fmt.Errorf("failed to stage deleted files: %w", err)
+		}
+	}
+	result.Changed = append(added, removed...)
+	sort.Strings(result.Changed)
+	return result, nil
+}
+
+// AmPatch applies a patch with ApplyPatch and commits the result with the patch's author
+// and message, the equivalent of git am. The commit is dated now; the patch's date is not
+// kept. Like ApplyPatch, it changes nothing when a hunk is rejected.
+func AmPatch(r io.Reader) (models.Commit, PatchResult, error) {
+	result, err := ApplyPatch(r)
+	if err != nil {
+		return models.Commit{}, result, err
+	}
+	patch := result.Patch
+	if strings.TrimSpace(patch.Message) == "" || patch.AuthorName == "" || patch.AuthorEmail == "" {
+		return models.Commit{}, result, errors.New("patch has no author or message to commit with; the changes are staged")
+	}
+
+	repoLock, err := storage.LockRepoShared()
+	if err != nil {
+		return models.Commit{}, result, err
+	}
+	defer repoLock.Unlock()
+	treeHash, err := storage.CreateTree()
+	if err != nil {
+		return models.Commit{}, result, err
+	}
+	commit, _, err := commitTree(patch.Message, treeHash, patch.AuthorName, patch.AuthorEmail)
+	return commit, result, err
+}
+
+// threeWayPatch applies fp to the blob it was made against and merges the result with the
+// current content, reporting false when either step fails.
+func threeWayPatch(fp FilePatch, current []byte) ([]byte, bool) {
+	base, err := storage.ReadObject(fp.OldHash)
+	if err != nil {
+		return nil, false
+	}
+	patched, rejected := applyPatchHunks(splitLinesKeepEnds(base), fp.hunks, 0)
+	if len(rejected) > 0 {
+		return nil, false
+	}
+	return mergeLines(base, current, []byte(strings.Join(patched, "")))
+}
+
+// applyPatchHunks applies hunks, in order, to lines, ignoring up to fuzz context lines at
+// each end of a hunk that does not fit as it is. It returns the patched lines, which leave
+// out the rejected hunks.
+func applyPatchHunks(lines []string, hunks []patchHunk, fuzz int) ([]string, []patchHunk) {
+	var out []string
+	var rejected []patchHunk
+	pos, offset := 0, 0
+	for _, h := range hunks {
+		at, front, back, ok := locateHunk(lines, pos, h.expectedIndex()+offset, h, fuzz)
+		if !ok {
+			rejected = append(rejected, h)
+			continue
+		}
+		oldLines, newLines := h.side('+'), h.side('-')
+		out = append(out, lines[pos:at]...)
+		out = append(out, newLines[front:len(newLines)-back]...)
+		pos = at + len(oldLines) - front - back
+		offset = at - front - h.expectedIndex()
+	}
+	return append(out, lines[pos:]...), rejected
+}
+
+// locateHunk finds where the old side of h matches lines at or after from, nearest to want,
+// dropping up to fuzz context lines from each end when it matches nowhere, but always
+// keeping at least one. It returns the index of the match and the lines dropped.
+func locateHunk(lines []string, from, want int, h patchHunk, fuzz int) (at, front, back int, ok bool) {
+	oldLines := h.side('+')
+	leading, trailing := h.context()
+	for f := 0; f <= fuzz; f++ {
+		front, back = min(f, leading), min(f, trailing)
+		if f > 0 && (front+back >= leading+trailing || (front < f && back < f)) {
+			break
+		}
+		if at, ok := findLines(lines, from, want+front, oldLines[front:len(oldLines)-back]); ok {
+			return at, front, back, true
+		}
+	}
+	return 0, 0, 0, false
+}
+
+// findLines returns the index of seg in lines at or after from, nearest to want.
+func findLines(lines []string, from, want int, seg []string) (int, bool) {
+	last := len(lines) - len(seg)
+	if last < from {
+		return 0, false
+	}
+	want = min(max(want, from), last)
+	matches := func(at int) bool {
+		return at >= from && at <= last && slices.Equal(lines[at:at+len(seg)], seg)
+	}
+	for d := 0; want-d >= from || want+d <= last; d++ {
+		if matches(want - d) {
+			return want - d, true
+		}
+		if matches(want + d) {
+			return want + d, true
+		}
+	}
+	return 0, false
+}
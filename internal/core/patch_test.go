@@ -0,0 +1,178 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+func TestExportAndApplyPatch(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+
+	// numbered returns lines line01..line20, with the given lines replaced.
+	numbered := func(replace map[int]string) string {
+		var b strings.Builder
+		for i := 1; i <= 20; i++ {
+			if line, ok := replace[i]; ok {
+				b.WriteString(line + "\n")
+				continue
+			}
+			fmt.Fprintf(&b, "line%02d\n", i)
+		}
+		return b.String()
+	}
+	write := func(path, content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	read := func(path string) string {
+		t.Helper()
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	// repoWithBase makes a repository whose first commit has the base files, then, when
+	// notes is not empty, commits it as a drifted notes.txt.
+	repoWithBase := func(author, notes string) {
+		t.Helper()
+		if err := os.Chdir(t.TempDir()); err != nil {
+			t.Fatal(err)
+		}
+		if err := InitRepo(); err != nil {
+			t.Fatal(err)
+		}
+		_ = SetConfig("user.name", author, false)
+		_ = SetConfig("user.email", strings.ToLower(author)+"@example.com", false)
+		write("notes.txt", numbered(nil))
+		write("old.txt", "old\n")
+		if err := AddAll(); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := Commit("base"); err != nil {
+			t.Fatal(err)
+		}
+		if notes != "" {
+			write("notes.txt", notes)
+			if err := AddAll(); err != nil {
+				t.Fatal(err)
+			}
+			if _, _, err := Commit("drift"); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	repoWithBase("Alice", "")
+	write("notes.txt", numbered(map[int]string{5: "edited05", 10: "edited10"}))
+	write("new.txt", "no newline")
+	if err := os.Remove("old.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddAll(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Commit("Change notes\n\nUpper-case two lines."); err != nil {
+		t.Fatal(err)
+	}
+	var patch bytes.Buffer
+	if err := ExportPatch("HEAD", &patch); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"From: Alice <alice@example.com>\n", "Subject: [PATCH] Change notes\n", "--- /dev/null\n+++ b/new.txt\n", "\\ No newline at end of file\n"} {
+		if !strings.Contains(patch.String(), want) {
+			t.Fatalf("patch lacks %q:\n%s", want, patch.String())
+		}
+	}
+
+	// Lines inserted at the top move every hunk: applied at an offset, and committed.
+	repoWithBase("Bob", "intro\nintro\n"+numbered(nil))
+	commit, result, err := AmPatch(bytes.NewReader(patch.Bytes()))
+	if err != nil {
+		t.Fatalf("am: %v (rejected %v)", err, result.Rejected)
+	}
+	if want := "intro\nintro\n" + numbered(map[int]string{5: "edited05", 10: "edited10"}); read("notes.txt") != want {
+		t.Errorf("notes.txt = %q, want %q", read("notes.txt"), want)
+	}
+	if read("new.txt") != "no newline" {
+		t.Errorf("new.txt = %q", read("new.txt"))
+	}
+	if _, err := os.Stat("old.txt"); !os.IsNotExist(err) {
+		t.Error("old.txt not deleted")
+	}
+	if commit.AuthorName != "Alice" || commit.Message != "Change notes\n\nUpper-case two lines." {
+		t.Errorf("commit by %s with message %q, want the patch's", commit.AuthorName, commit.Message)
+	}
+	if want := []string{"new.txt", "notes.txt", "old.txt"}; !reflect.DeepEqual(result.Changed, want) {
+		t.Errorf("changed = %v, want %v", result.Changed, want)
+	}
+
+	// A change between the hunk's two edits breaks its context: merged three-way.
+	repoWithBase("Bob", numbered(map[int]string{7: "drift07"}))
+	result, err = ApplyPatch(bytes.NewReader(patch.Bytes()))
+	if err != nil {
+		t.Fatalf("apply: %v (rejected %v)", err, result.Rejected)
+	}
+	if want := numbered(map[int]string{5: "edited05", 7: "drift07", 10: "edited10"}); read("notes.txt") != want {
+		t.Errorf("notes.txt = %q, want %q", read("notes.txt"), want)
+	}
+	if !reflect.DeepEqual(result.Merged, []string{"notes.txt"}) {
+		t.Errorf("merged = %v, want notes.txt", result.Merged)
+	}
+	index, err := storage.LoadIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := index["new.txt"]; !ok {
+		t.Error("new.txt not staged")
+	}
+
+	// A conflicting change to a patched line: rejected, and nothing changes.
+	drifted := numbered(map[int]string{5: "other05"})
+	repoWithBase("Bob", drifted)
+	result, err = ApplyPatch(bytes.NewReader(patch.Bytes()))
+	if !errors.Is(err, ErrPatchRejected) {
+		t.Fatalf("apply = %v, want %v", err, ErrPatchRejected)
+	}
+	if len(result.Rejected) != 1 || result.Rejected[0].Path != "notes.txt" || result.Rejected[0].Header == "" {
+		t.Errorf("rejected = %+v, want the notes.txt hunk", result.Rejected)
+	}
+	if read("notes.txt") != drifted {
+		t.Error("notes.txt changed by a rejected patch")
+	}
+	if _, err := os.Stat("new.txt"); !os.IsNotExist(err) {
+		t.Error("new.txt created by a rejected patch")
+	}
+}
+
+func TestApplyPatchHunks_FuzzIgnoresDriftedOuterContext(t *testing.T) {
+	old := splitLinesKeepEnds([]byte("a\nb\nc\nd\ne\nf\ng\n"))
+	hunks := unifiedHunks(old, splitLinesKeepEnds([]byte("a\nb\nc\nD\ne\nf\ng\n")))
+	drifted := splitLinesKeepEnds([]byte("A\nb\nc\nd\ne\nf\ng\n"))
+
+	if _, rejected := applyPatchHunks(drifted, hunks, 0); len(rejected) != 1 {
+		t.Fatalf("without fuzz %d hunks rejected, want 1", len(rejected))
+	}
+	got, rejected := applyPatchHunks(drifted, hunks, maxPatchFuzz)
+	if len(rejected) != 0 {
+		t.Fatalf("with fuzz %d hunks rejected", len(rejected))
+	}
+	if want := "A\nb\nc\nD\ne\nf\ng\n"; strings.Join(got, "") != want {
+		t.Errorf("patched = %q, want %q", strings.Join(got, ""), want)
+	}
+}
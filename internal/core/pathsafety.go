@@ -0,0 +1,116 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+// ErrUnsafePath is wrapped by the errors ValidateIndexPaths and the write paths it guards
+// return for a path that would be written outside the working tree or into .kitcat.
+var ErrUnsafePath = errors.New("security: refusing unsafe path")
+
+// RepoRelPath converts inputPath, absolute or relative to the current directory, to the
+// repository-relative key the index uses: cleaned and with forward slashes, "." for the
+// root itself. The repository is discovered from the current directory, which is left
+// unchanged. A path outside the working tree, or one IsSafePath rejects, is an
+// ErrUnsafePath error. Commands taking paths from the user convert them with this before
+// moving to the repository root.
+func RepoRelPath(inputPath string) (string, error) {
+	abs, err := filepath.Abs(inputPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve absolute path: %w", err)
+	}
+	root, err := findRepoRoot()
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(root, abs)
+	if err != nil {
+		return "", fmt.Errorf("%w %q: outside the repository", ErrUnsafePath, inputPath)
+	}
+	key := storage.IndexKey(rel)
+	if key == ".." || strings.HasPrefix(key, "../") {
+		return "", fmt.Errorf("%w %q: outside the repository", ErrUnsafePath, inputPath)
+	}
+	if !IsSafePath(key) {
+		return "", fmt.Errorf("%w %q", ErrUnsafePath, inputPath)
+	}
+	return key, nil
+}
+
+// ValidateIndexPaths checks every index key, and the on-disk spelling recorded with it,
+// before checkout or restore writes files for them. IsSafePath guards paths when they are
+// added; this catches an index that was crafted or corrupted afterwards. The first bad
+// path, in sorted order, is reported.
+func ValidateIndexPaths() error {
+	index, err := storage.LoadIndexWithMeta()
+	if err != nil {
+		return err
+	}
+	paths := make([]string, 0, len(index))
+	for p, entry := range index {
+		paths = append(paths, p)
+		if entry.DisplayPath != "" {
+			paths = append(paths, entry.DisplayPath)
+		}
+	}
+	return validateWritePaths(paths, "the index")
+}
+
+// validateTreePaths is ValidateIndexPaths for the keys of a tree about to be written.
+func validateTreePaths(tree map[string]string, source string) error {
+	paths := make([]string, 0, len(tree))
+	for p := range tree {
+		paths = append(paths, p)
+	}
+	return validateWritePaths(paths, source)
+}
+
+// validateWritePaths rejects any path that is absolute, has a ".." component, or, joined
+// to the repository root (the working directory) and cleaned, lands outside it or inside
+// the .kitcat directory. source names where the paths came from, for the error.
+func validateWritePaths(paths []string, source string) error {
+	root, err := filepath.Abs(".")
+	if err != nil {
+		return err
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		if reason := unsafeWritePath(root, p); reason != "" {
+			return fmt.Errorf("%w %q in %s: %s", ErrUnsafePath, p, source, reason)
+		}
+	}
+	return nil
+}
+
+// unsafeWritePath returns why path must not be written below root, or "" when it is safe.
+func unsafeWritePath(root, path string) string {
+	if path == "" {
+		return "empty path"
+	}
+	// Index keys use forward slashes; treat backslashes as separators too, so a key
+	// written on one OS cannot smuggle a component past the check on another.
+	slashed := strings.ReplaceAll(path, `\`, "/")
+	if strings.HasPrefix(slashed, "/") || filepath.IsAbs(path) || filepath.VolumeName(path) != "" {
+		return "absolute path"
+	}
+	for _, part := range strings.Split(slashed, "/") {
+		if part == ".." {
+			return "contains a .. component"
+		}
+	}
+	full := filepath.Join(root, filepath.FromSlash(slashed))
+	rel, err := filepath.Rel(root, full)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "resolves outside the repository"
+	}
+	if inRepoDir(rel) {
+		return "inside the repository directory"
+	}
+	return ""
+}
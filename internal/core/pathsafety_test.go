@@ -0,0 +1,88 @@
+package core
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+func TestUnsafeWritePath(t *testing.T) {
+	root := t.TempDir()
+	for path, safe := range map[string]bool{
+		"a.txt":            true,
+		"dir/b.txt":        true,
+		"a..b/c":           true,
+		"../etc/passwd":    false,
+		"dir/../../x":      false,
+		`dir\..\..\x`:      false,
+		"/etc/passwd":      false,
+		".kitcat/config":   false,
+		"dir/./../.kitcat": false,
+		"":                 false,
+		".":                false,
+	} {
+		if reason := unsafeWritePath(root, path); (reason == "") != safe {
+			t.Errorf("unsafeWritePath(%q) = %q, want safe=%v", path, reason, safe)
+		}
+	}
+}
+
+func TestCheckoutRefusesTraversalInIndex(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	parent := t.TempDir()
+	repo := filepath.Join(parent, "repo")
+	if err := os.Mkdir(repo, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(repo); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	_ = SetConfig("user.name", "Test User", false)
+	_ = SetConfig("user.email", "test@example.com", false)
+
+	if err := os.WriteFile("a.txt", []byte("one"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddFile("a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	commit, _, err := Commit("first")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A crafted index entry pointing outside the repository.
+	index, err := storage.LoadIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	index["../evil.txt"] = index["a.txt"]
+	if err := storage.WriteIndex(index); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ValidateIndexPaths(); !errors.Is(err, ErrUnsafePath) {
+		t.Fatalf("ValidateIndexPaths() error = %v, want ErrUnsafePath", err)
+	}
+	if err := CheckoutCommitWithOptions(commit.ID, CheckoutOptions{Force: true}); !errors.Is(err, ErrUnsafePath) {
+		t.Errorf("CheckoutCommit error = %v, want ErrUnsafePath", err)
+	}
+	if err := Restore(".", ""); !errors.Is(err, ErrUnsafePath) {
+		t.Errorf("Restore error = %v, want ErrUnsafePath", err)
+	}
+	if _, err := os.Stat(filepath.Join(parent, "evil.txt")); !os.IsNotExist(err) {
+		t.Errorf("file written outside the repository: %v", err)
+	}
+}
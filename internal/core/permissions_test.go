@@ -0,0 +1,111 @@
+package core
+
+import (
+	"os"
+	"testing"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+func TestPreservePermissions_RoundTrip(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	_ = SetConfig("user.name", "Test", false)
+	_ = SetConfig("user.email", "test@example.com", false)
+
+	perm := func(name string) os.FileMode {
+		t.Helper()
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info.Mode().Perm()
+	}
+	for name, mode := range map[string]os.FileMode{"deploy.sh": 0o700, "secret.conf": 0o640, "plain.txt": 0o644} {
+		if err := os.WriteFile(name, []byte(name), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(name, mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Off by default: nothing is recorded and tree hashes match the plain format.
+	if err := AddAll(); err != nil {
+		t.Fatal(err)
+	}
+	plainTree, err := storage.CreateTree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err := storage.LoadIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, _ := storage.WriteTree(index); plainTree != want {
+		t.Fatalf("tree without modes = %s, want %s", plainTree, want)
+	}
+
+	if err := SetConfig(preservePermissionsKey, "true", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddAll(); err != nil {
+		t.Fatal(err)
+	}
+	commit, _, err := Commit("modes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	modes, err := storage.ParseTreeModes(commit.TreeHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if modes["deploy.sh"] != 0o700 || modes["secret.conf"] != 0o640 || modes["plain.txt"] != 0o644 {
+		t.Fatalf("tree modes = %v", modes)
+	}
+
+	// Exact modes come back on restore and checkout.
+	if err := os.Chmod("deploy.sh", 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Restore("deploy.sh", ""); err != nil {
+		t.Fatal(err)
+	}
+	if got := perm("deploy.sh"); got != 0o700 {
+		t.Errorf("restored deploy.sh mode = %o, want 700", got)
+	}
+	if err := os.Remove("secret.conf"); err != nil {
+		t.Fatal(err)
+	}
+	if err := UpdateWorkspaceAndIndex(commit.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := perm("secret.conf"); got != 0o640 {
+		t.Errorf("checked-out secret.conf mode = %o, want 640", got)
+	}
+
+	// With the setting off the recorded modes are normalized.
+	if err := SetConfig(preservePermissionsKey, "false", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := UpdateWorkspaceAndIndex(commit.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := perm("deploy.sh"); got != 0o755 {
+		t.Errorf("normalized deploy.sh mode = %o, want 755", got)
+	}
+	if got := perm("secret.conf"); got != 0o644 {
+		t.Errorf("normalized secret.conf mode = %o, want 644", got)
+	}
+}
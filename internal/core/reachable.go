@@ -0,0 +1,61 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/LeeFred3042U/kitcat/internal/models"
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+// ReachableObjects returns every hash reachable from commit, a commit reference such as
+// HEAD, a branch, a tag or a (short) hash: the commit and its ancestors, their trees, and
+// the blobs those trees list. It is the basis for reachability analysis such as garbage
+// collection or deciding what to transfer. Commits are records of the commit log rather
+// than stored objects; trees and blobs are objects.
+//
+// Trees are flat in kitcat, so there are no subtrees to recurse into, but successive
+// commits often share a tree (e.g. after a revert or an empty commit); each tree is read
+// only once. Submodule entries are left out: their commits belong to the nested
+// repository. The result is sorted.
+func ReachableObjects(commit string) ([]string, error) {
+	id, err := ResolveCommitRef(commit)
+	if err != nil {
+		return nil, err
+	}
+	commits, err := storage.ReadCommits()
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]models.Commit, len(commits))
+	for _, c := range commits {
+		byID[c.ID] = c
+	}
+
+	seen := make(map[string]bool)
+	for id != "" && !seen[id] {
+		c, ok := byID[id]
+		if !ok {
+			return nil, fmt.Errorf("commit %s not found", id)
+		}
+		seen[id] = true
+		if c.TreeHash != "" && !seen[c.TreeHash] {
+			seen[c.TreeHash] = true
+			tree, err := storage.ParseTreeObjects(c.TreeHash)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read tree for commit %s: %w", c.ID, err)
+			}
+			for _, hash := range tree {
+				seen[hash] = true
+			}
+		}
+		id = c.Parent
+	}
+
+	hashes := make([]string, 0, len(seen))
+	for hash := range seen {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+	return hashes, nil
+}
@@ -0,0 +1,87 @@
+package core
+
+import (
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+func TestReachableObjects(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetConfig("user.name", "Test", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetConfig("user.email", "test@example.com", false); err != nil {
+		t.Fatal(err)
+	}
+
+	commitFile := func(name, content, message string) string {
+		t.Helper()
+		if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := AddFile(name); err != nil {
+			t.Fatal(err)
+		}
+		c, _, err := Commit(message)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c.ID
+	}
+	first := commitFile("a.txt", "one", "first")
+	second := commitFile("a.txt", "second version", "second")
+	if err := CreateBranch("feature"); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckoutBranch("feature"); err != nil {
+		t.Fatal(err)
+	}
+	commitFile("b.txt", "feature only", "third")
+
+	want := []string{first, second}
+	for _, id := range []string{first, second} {
+		c, err := storage.FindCommit(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree, err := storage.ParseTree(c.TreeHash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, c.TreeHash, tree["a.txt"])
+	}
+	sort.Strings(want)
+
+	got, err := ReachableObjects("main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ReachableObjects(main) = %v, want %v", got, want)
+	}
+
+	// Objects of the feature branch are reachable from it, and its history with them.
+	got, err = ReachableObjects("feature")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want)+3 {
+		t.Errorf("ReachableObjects(feature) has %d objects, want %d", len(got), len(want)+3)
+	}
+}
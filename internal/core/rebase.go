@@ -1,12 +1,13 @@
 package core
 
 import (
-	"crypto/sha1"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 
 	"github.com/LeeFred3042U/kitcat/internal/models"
@@ -65,7 +66,7 @@ func RebaseInteractive(commitHash string) error {
 	if err != nil {
 		return err
 	}
-	headHash, err := readHead()
+	headHash, err := ResolveHead()
 	if err != nil {
 		return err
 	}
@@ -83,7 +84,7 @@ func RebaseInteractive(commitHash string) error {
 		return nil
 	}
 
-	todoPath := filepath.Join(RepoDir, "rebase-todo")
+	todoPath := filepath.Join(RepoDir(), "rebase-todo")
 	todoContent := generateTodo(commitsToRebase)
 	if err := os.WriteFile(todoPath, []byte(todoContent), 0o644); err != nil {
 		return err
@@ -129,14 +130,7 @@ func RebaseInteractive(commitHash string) error {
 	// This branch will be used as the new HEAD during the rebase
 	// It will be deleted after the rebase completes or is aborted
 	tmpBranch := "kitcat-rebase-tmp"
-	tmpBranchPath := filepath.Join(".kitcat", "refs", "heads", tmpBranch)
-	if err := os.MkdirAll(filepath.Dir(tmpBranchPath), 0o755); err != nil {
-		return err
-	}
-	if err := os.WriteFile(tmpBranchPath, []byte(ontoCommit.ID), 0o644); err != nil {
-		return err
-	}
-	if err := os.WriteFile(".kitcat/HEAD", []byte("ref: refs/heads/"+tmpBranch), 0o644); err != nil {
+	if err := WriteHead(Head{Ref: "refs/heads/" + tmpBranch, Hash: ontoCommit.ID}); err != nil {
 		return fmt.Errorf("failed to update HEAD: %w", err)
 	}
 	if err := UpdateWorkspaceAndIndex(ontoCommit.ID); err != nil {
@@ -185,7 +179,7 @@ func RebaseContinue() error {
 		}
 
 		if cmd == "reword" {
-			head, _ := readHead()
+			head, _ := ResolveHead()
 			newMsg := promptForMessage(msg)
 			if newMsg != msg {
 				if err := amendCommitMessage(head, newMsg); err != nil {
@@ -223,22 +217,23 @@ func RebaseAbort() error {
 	fmt.Printf("Aborting rebase. restoring HEAD to %s\n", state.OrigHead[:7])
 
 	if state.HeadName != "" {
-		if err := os.WriteFile(".kitcat/HEAD", []byte("ref: "+state.HeadName), 0o644); err != nil {
-			return err
-		}
-		if err := os.WriteFile(filepath.Join(".kitcat", state.HeadName), []byte(state.OrigHead), 0o644); err != nil {
+		if err := WriteHead(Head{Ref: state.HeadName, Hash: state.OrigHead}); err != nil {
 			return err
 		}
 		if err := UpdateWorkspaceAndIndex(state.OrigHead); err != nil {
 			return err
 		}
 	} else {
-		if err := Reset(state.OrigHead, "hard"); err != nil {
+		// Rebase started detached: leave the temporary branch before resetting
+		if err := WriteHead(Head{Hash: state.OrigHead}); err != nil {
+			return err
+		}
+		if err := ResetWithOptions(state.OrigHead, ResetHard, ResetOptions{Force: true}); err != nil {
 			return err
 		}
 	}
 
-	os.Remove(filepath.Join(".kitcat", "refs", "heads", "kitcat-rebase-tmp"))
+	os.Remove(filepath.Join(RepoDir(), "refs", "heads", "kitcat-rebase-tmp"))
 	return ClearRebaseState()
 }
 
@@ -298,22 +293,18 @@ func RunRebaseLoop() error {
 // finishRebase finalizes the rebase by updating HEAD and cleaning up temporary state
 // returns an error if any operation fails
 func finishRebase(state *RebaseState) error {
-	headHash, err := readHead()
+	headHash, err := ResolveHead()
 	if err != nil {
 		return err
 	}
 
 	if state.HeadName != "" {
-		if err := os.WriteFile(".kitcat/HEAD", []byte("ref: "+state.HeadName), 0o644); err != nil {
-			return err
-		}
-		refPath := filepath.Join(".kitcat", state.HeadName)
-		if err := os.WriteFile(refPath, []byte(headHash), 0o644); err != nil {
+		if err := WriteHead(Head{Ref: state.HeadName, Hash: headHash}); err != nil {
 			return err
 		}
 	}
 
-	os.Remove(filepath.Join(".kitcat", "refs", "heads", "kitcat-rebase-tmp"))
+	os.Remove(filepath.Join(RepoDir(), "refs", "heads", "kitcat-rebase-tmp"))
 	return ClearRebaseState()
 }
 
@@ -359,7 +350,7 @@ func cherryPick(hash string, noCommit bool) error {
 	if err != nil {
 		return err
 	}
-	if err := applyChanges(changes); err != nil {
+	if err := applyChanges(changes, commit.ID[:7]); err != nil {
 		return err
 	}
 	if noCommit {
@@ -411,51 +402,92 @@ func getChanges(parentHash, childHash string) (map[string]Change, error) {
 	return changes, nil
 }
 
-// applyChanges applies the given changes to the working directory and index
-// returns an error if any conflicts are detected
-func applyChanges(changes map[string]Change) error {
+// applyChanges applies the given changes to the working directory and index, in path
+// order. A file modified on both sides is merged line by line; when the edits overlap it is
+// left in the working tree with conflict markers (see merge.conflictStyle), the incoming
+// side labelled with label. Every change that does not conflict is applied, and the
+// returned error lists every path that does.
+func applyChanges(changes map[string]Change, label string) error {
 	headCommit, _ := GetHeadCommit()
 	headTree, _ := storage.ParseTree(headCommit.TreeHash)
 
-	for path, change := range changes {
-		targetHash := change.NewHash
-		if targetHash == "" {
-			headFileHash, existsInHead := headTree[path]
+	paths := make([]string, 0, len(changes))
+	for path := range changes {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var conflicts []error
+	for _, path := range paths {
+		change := changes[path]
+		headFileHash, existsInHead := headTree[path]
+		if change.NewHash == "" {
 			if existsInHead && headFileHash != change.OldHash {
-				return fmt.Errorf(
-					"conflict in %s: deleted in incoming commit, but modified in HEAD",
-					path,
-				)
+				conflicts = append(conflicts, fmt.Errorf("conflict in %s: deleted in incoming commit, but modified in HEAD", path))
+				continue
 			}
 			if err := RemoveFile(path, false); err != nil {
 				return err
 			}
-		} else {
-			content, err := storage.ReadObject(targetHash)
+			continue
+		}
+		if !existsInHead && change.OldHash != "" {
+			conflicts = append(conflicts, fmt.Errorf("conflict in %s: modified in incoming commit, but deleted in HEAD", path))
+			continue
+		}
+
+		content, err := storage.ReadObject(change.NewHash)
+		if err != nil {
+			return err
+		}
+		if existsInHead && headFileHash != change.OldHash && headFileHash != change.NewHash {
+			merged, outcome, err := mergeWithHead(path, headFileHash, change.OldHash, content, label)
 			if err != nil {
 				return err
 			}
-			headFileHash, existsInHead := headTree[path]
-			if existsInHead {
-				if headFileHash != change.OldHash {
-					return fmt.Errorf("conflict in %s: modified in incoming commit, but modified in HEAD", path)
-				}
-			} else if change.OldHash != "" {
-				return fmt.Errorf("conflict in %s: modified in incoming commit, but deleted in HEAD", path)
+			if outcome != "" {
+				conflicts = append(conflicts, fmt.Errorf("conflict in %s: modified in incoming commit, but modified in HEAD; %s", path, outcome))
+				continue
 			}
+			content = merged
+		}
 
-			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
-				return err
-			}
-			if err := os.WriteFile(path, content, 0o644); err != nil {
-				return err
-			}
-			if err := AddFile(path); err != nil {
-				return err
-			}
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return err
+		}
+		if err := SafeWrite(path, content, 0o644); err != nil {
+			return err
+		}
+		if err := AddFile(path); err != nil {
+			return err
 		}
 	}
-	return nil
+	return errors.Join(conflicts...)
+}
+
+// mergeWithHead merges the incoming content of path into HEAD's version, using baseHash as
+// the common ancestor. When the edits overlap it writes path with conflict markers; a
+// binary file is left as HEAD has it. Either way the returned outcome says what was done,
+// and it is empty for a clean merge.
+func mergeWithHead(path, headHash, baseHash string, incoming []byte, label string) ([]byte, string, error) {
+	ours, err := storage.ReadObject(headHash)
+	if err != nil {
+		return nil, "", err
+	}
+	var base []byte
+	if baseHash != "" {
+		if base, err = storage.ReadObject(baseHash); err != nil {
+			return nil, "", err
+		}
+	}
+	if isBinary(base) || isBinary(ours) || isBinary(incoming) {
+		return nil, "binary file left as in HEAD", nil
+	}
+	if merged, clean := mergeLines(base, ours, incoming); clean {
+		return merged, "", nil
+	}
+	merged := formatConflict(ours, base, incoming, "HEAD", "base", label, conflictStyle())
+	return nil, "conflict markers written", SafeWrite(filepath.FromSlash(path), merged, 0o644)
 }
 
 // generateTodo generates the initial todo content for the given commit hashes
@@ -519,7 +551,7 @@ func getCommitsBetween(start, end string) ([]string, error) {
 // promptForMessage opens the user's editor to edit the commit message, starting with defaultMsg
 // and returns the edited message
 func promptForMessage(defaultMsg string) string {
-	tmp := ".kitcat/COMMIT_EDITMSG"
+	tmp := filepath.Join(RepoDir(), "COMMIT_EDITMSG")
 	if err := os.WriteFile(tmp, []byte(defaultMsg), 0o644); err != nil {
 		fmt.Printf("Warning: failed to write temp commit msg: %v\n", err)
 	}
@@ -583,15 +615,5 @@ func amendCommit(prevHead models.Commit, newMsg string) error {
 
 // saveObject saves the given content as an object and returns its hash
 func saveObject(content []byte) (string, error) {
-	h := sha1.New()
-	h.Write(content)
-	hash := fmt.Sprintf("%x", h.Sum(nil))
-	objPath := filepath.Join(".kitcat", "objects", hash)
-	if err := os.MkdirAll(filepath.Dir(objPath), 0o755); err != nil {
-		return "", err
-	}
-	if err := os.WriteFile(objPath, content, 0o644); err != nil {
-		return "", err
-	}
-	return hash, nil
+	return storage.WriteObject(content)
 }
@@ -19,7 +19,7 @@ type RebaseState struct {
 }
 
 func EnsureRebaseDir() error {
-	path := filepath.Join(RepoDir, "rebase-merge")
+	path := filepath.Join(RepoDir(), "rebase-merge")
 	return os.MkdirAll(path, 0755)
 }
 
@@ -27,7 +27,7 @@ func SaveRebaseState(state RebaseState) error {
 	if err := EnsureRebaseDir(); err != nil {
 		return err
 	}
-	base := filepath.Join(RepoDir, "rebase-merge")
+	base := filepath.Join(RepoDir(), "rebase-merge")
 
 	if err := os.WriteFile(filepath.Join(base, "head-name"), []byte(state.HeadName), 0644); err != nil {
 		return err
@@ -52,7 +52,7 @@ func SaveRebaseState(state RebaseState) error {
 }
 
 func LoadRebaseState() (*RebaseState, error) {
-	base := filepath.Join(RepoDir, "rebase-merge")
+	base := filepath.Join(RepoDir(), "rebase-merge")
 	if _, err := os.Stat(base); os.IsNotExist(err) {
 		return nil, fmt.Errorf("no rebase in progress")
 	}
@@ -81,12 +81,12 @@ func LoadRebaseState() (*RebaseState, error) {
 }
 
 func IsRebaseInProgress() bool {
-	_, err := os.Stat(filepath.Join(RepoDir, "rebase-merge"))
+	_, err := os.Stat(filepath.Join(RepoDir(), "rebase-merge"))
 	return err == nil
 }
 
 func ClearRebaseState() error {
-	return os.RemoveAll(filepath.Join(RepoDir, "rebase-merge"))
+	return os.RemoveAll(filepath.Join(RepoDir(), "rebase-merge"))
 }
 
 func ReadNextTodo() (string, *RebaseState, error) {
@@ -1,8 +1,14 @@
 package core
 
 import (
+	"os"
+	"path/filepath"
 	"reflect"
+	"runtime"
+	"strings"
 	"testing"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
 )
 
 func TestParseTodo(t *testing.T) {
@@ -53,3 +59,195 @@ func TestParseTodo(t *testing.T) {
 		})
 	}
 }
+
+// divergedRepo sets up a repository whose default branch and an "onto" branch both changed
+// the base commit: the same line of x.txt and y.txt, different lines of clean.txt, and
+// only the default branch adds new.txt and deletes gone.txt. It returns the tip of onto
+// and the default branch's commit, which is checked out.
+func divergedRepo(t *testing.T, style string) (onto, ours string) {
+	t.Helper()
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	_ = SetConfig("user.name", "Test", false)
+	_ = SetConfig("user.email", "test@example.com", false)
+	if err := SetConfig(conflictStyleKey, style, false); err != nil {
+		t.Fatal(err)
+	}
+	commit := func(files map[string]string, removed []string, message string) string {
+		t.Helper()
+		for name, content := range files {
+			if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, name := range removed {
+			if err := os.Remove(name); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := AddAll(); err != nil {
+			t.Fatal(err)
+		}
+		c, _, err := Commit(message)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c.ID
+	}
+
+	defaultBranch := DefaultBranch()
+	commit(map[string]string{
+		"x.txt":     "x = 1\n",
+		"y.txt":     "y = 1\n",
+		"clean.txt": "a\nb\nc\nd\ne\n",
+		"gone.txt":  "gone\n",
+	}, nil, "base")
+	if err := CreateBranch("onto"); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckoutBranch("onto"); err != nil {
+		t.Fatal(err)
+	}
+	onto = commit(map[string]string{"x.txt": "x = 2\n", "y.txt": "y = 2\n", "clean.txt": "a\nb\nc\nd\nE\n"}, nil, "onto")
+	if err := CheckoutBranch(defaultBranch); err != nil {
+		t.Fatal(err)
+	}
+	ours = commit(map[string]string{"x.txt": "x = 3\n", "y.txt": "y = 3\n", "clean.txt": "A\nb\nc\nd\ne\n", "new.txt": "new\n"}, []string{"gone.txt"}, "ours")
+	return onto, ours
+}
+
+func TestCherryPick_AppliesEveryChangeAndListsEveryConflict(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	onto, ours := divergedRepo(t, ConflictStyleMerge)
+	if err := Reset(onto, ResetHard); err != nil {
+		t.Fatal(err)
+	}
+
+	err = cherryPick(ours, false)
+	if err == nil {
+		t.Fatal("cherryPick succeeded, want conflicts")
+	}
+	for _, path := range []string{"x.txt", "y.txt"} {
+		if !strings.Contains(err.Error(), "conflict in "+path) {
+			t.Errorf("cherryPick error %q does not list %s", err, path)
+		}
+		if data, _ := os.ReadFile(path); !strings.Contains(string(data), "<<<<<<< HEAD") {
+			t.Errorf("%s has no conflict markers:\n%s", path, data)
+		}
+	}
+	if strings.Contains(err.Error(), "clean.txt") {
+		t.Errorf("cherryPick error %q lists clean.txt, whose edits do not overlap", err)
+	}
+	if data, _ := os.ReadFile("clean.txt"); string(data) != "A\nb\nc\nd\nE\n" {
+		t.Errorf("clean.txt = %q, want both sides' edits", data)
+	}
+	if data, _ := os.ReadFile("new.txt"); string(data) != "new\n" {
+		t.Errorf("new.txt = %q, want it added", data)
+	}
+	if _, err := os.Stat("gone.txt"); !os.IsNotExist(err) {
+		t.Errorf("gone.txt still present: %v", err)
+	}
+}
+
+func TestRebase_ConflictMarkersResolveAndContinue(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("edits the todo list with a shell script")
+	}
+	for _, style := range []string{ConflictStyleMerge, ConflictStyleDiff3} {
+		t.Run(style, func(t *testing.T) {
+			cwd, err := os.Getwd()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() {
+				_ = os.Chdir(cwd)
+			}()
+			if err := os.Chdir(t.TempDir()); err != nil {
+				t.Fatal(err)
+			}
+			onto, ours := divergedRepo(t, style)
+			// The todo list holds every commit not reachable from onto, the shared base
+			// included; the editor keeps only ours
+			editor := filepath.Join(t.TempDir(), "editor.sh")
+			script := "#!/bin/sh\ngrep '^pick " + ours + " ' \"$1\" > \"$1.new\" && mv \"$1.new\" \"$1\"\n"
+			if err := os.WriteFile(editor, []byte(script), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			t.Setenv("EDITOR", editor)
+
+			if err := RebaseInteractive(onto); err != nil {
+				t.Fatal(err)
+			}
+			if !IsRebaseInProgress() {
+				t.Fatal("rebase finished despite the conflicts")
+			}
+			for _, path := range []string{"x.txt", "y.txt"} {
+				data, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				name := strings.TrimSuffix(path, ".txt")
+				want := "<<<<<<< HEAD\n" + name + " = 2\n"
+				if style == ConflictStyleDiff3 {
+					want += "||||||| base\n" + name + " = 1\n"
+				}
+				want += "=======\n" + name + " = 3\n>>>>>>> " + ours[:7] + "\n"
+				if string(data) != want {
+					t.Errorf("%s =\n%s\nwant:\n%s", path, data, want)
+				}
+				// Resolve by hand and stage it
+				if err := os.WriteFile(path, []byte(name+" = 23\n"), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				if err := AddFile(path); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := RebaseContinue(); err != nil {
+				t.Fatal(err)
+			}
+			if IsRebaseInProgress() {
+				t.Fatal("rebase still in progress after --continue")
+			}
+			head, err := GetHeadCommit()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if head.Parent != onto || head.Message != "ours" {
+				t.Errorf("HEAD = %q on %s, want the replayed commit on %s", head.Message, head.Parent, onto)
+			}
+			tree, err := storage.ParseTree(head.TreeHash)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make(map[string]string)
+			for path, hash := range tree {
+				data, err := storage.ReadObject(hash)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got[path] = string(data)
+			}
+			want := map[string]string{
+				"x.txt":     "x = 23\n",
+				"y.txt":     "y = 23\n",
+				"clean.txt": "A\nb\nc\nd\nE\n",
+				"new.txt":   "new\n",
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("rebased tree = %v, want %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+// ReconcileOptions controls Reconcile.
+type ReconcileOptions struct {
+	AddOptions
+	// RefreshOnly re-populates the size and mtime of tracked files whose content still
+	// matches the index, e.g. after a checkout left them zeroed, and changes nothing else:
+	// no object is written and no entry is added, updated or removed.
+	RefreshOnly bool
+}
+
+// ReconcileReport lists what Reconcile did to the index. Each list is sorted by path.
+type ReconcileReport struct {
+	Added     []string // newly tracked
+	Updated   []string // tracked with new content
+	Deleted   []string // no longer in the working tree
+	Refreshed []string // same content, new size/mtime
+}
+
+// Reconcile brings the index in sync with the working tree after external changes, such
+// as a build script rewriting many files, and reports every entry it touched. By default
+// it stages exactly what AddAll would. With opts.RefreshOnly it only refreshes metadata,
+// hashing each file whose size or mtime is stale without storing it.
+func Reconcile(ctx context.Context, opts ReconcileOptions) (ReconcileReport, error) {
+	var report ReconcileReport
+	if !opts.RefreshOnly {
+		err := addAll(ctx, opts.AddOptions, &report)
+		return report, err
+	}
+
+	root, err := enterRepoRoot()
+	if err != nil {
+		return report, err
+	}
+	err = storage.UpdateIndexWithMeta(func(index map[string]storage.IndexEntry) error {
+		report = ReconcileReport{}
+		for path, entry := range index {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if isEmptyDirPlaceholder(entry.Mode) || entry.Flags&storage.FlagSkipWorktree != 0 {
+				continue
+			}
+			fullPath := filepath.Join(root, filepath.FromSlash(path))
+			info, err := os.Lstat(fullPath)
+			if err != nil || info.IsDir() {
+				continue // a pending deletion, left for a full reconcile
+			}
+			if entry.ModTime == info.ModTime().Unix() && entry.Size == info.Size() {
+				continue
+			}
+			hash, err := storage.HashFile(fullPath)
+			if err != nil || hash != entry.Hash {
+				continue // modified content is staged only by a full reconcile
+			}
+			modTime, size := hashedFileMeta(fullPath, info)
+			if modTime == 0 {
+				continue
+			}
+			entry.ModTime, entry.Size = modTime, size
+			index[path] = entry
+			report.Refreshed = append(report.Refreshed, path)
+		}
+		sort.Strings(report.Refreshed)
+		return nil
+	})
+	return report, err
+}
+
+// compareIndexes reports how the index changed from before to after.
+func compareIndexes(before, after map[string]storage.IndexEntry) ReconcileReport {
+	d := DiffIndexes(before, after)
+	report := ReconcileReport{Added: d.Added, Updated: d.Modified, Deleted: d.Removed}
+	for path, entry := range after {
+		old, existed := before[path]
+		if existed && old.Hash == entry.Hash && (old.ModTime != entry.ModTime || old.Size != entry.Size) {
+			report.Refreshed = append(report.Refreshed, path)
+		}
+	}
+	sort.Strings(report.Refreshed)
+	return report
+}
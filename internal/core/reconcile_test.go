@@ -0,0 +1,88 @@
+package core
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+func TestReconcile_RefreshOnlyAndFull(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		if err := os.WriteFile(name, []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := AddAll(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Zeroed metadata, as a checkout may leave it; b.txt also has new content.
+	err = storage.UpdateIndexWithMeta(func(index map[string]storage.IndexEntry) error {
+		for path, entry := range index {
+			entry.ModTime, entry.Size = 0, 0
+			index[path] = entry
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("b.txt", []byte("changed"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	objectsBefore, err := os.ReadDir(".kitcat/objects")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Reconcile(context.Background(), ReconcileOptions{RefreshOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ReconcileReport{Refreshed: []string{"a.txt", "c.txt"}}
+	if !reflect.DeepEqual(report, want) {
+		t.Errorf("refresh-only report = %+v, want %+v", report, want)
+	}
+	objectsAfter, _ := os.ReadDir(".kitcat/objects")
+	if len(objectsAfter) != len(objectsBefore) {
+		t.Errorf("refresh-only wrote objects: %d -> %d", len(objectsBefore), len(objectsAfter))
+	}
+	index, err := storage.LoadIndexWithMeta()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if index["a.txt"].Size != 5 || index["b.txt"].Size != 0 {
+		t.Errorf("metadata after refresh: a=%+v b=%+v", index["a.txt"], index["b.txt"])
+	}
+
+	if err := os.Remove("c.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("d.txt", []byte("d"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	report, err = Reconcile(context.Background(), ReconcileOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = ReconcileReport{Added: []string{"d.txt"}, Updated: []string{"b.txt"}, Deleted: []string{"c.txt"}}
+	if !reflect.DeepEqual(report, want) {
+		t.Errorf("full report = %+v, want %+v", report, want)
+	}
+}
@@ -0,0 +1,127 @@
+package core
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Ref is a reference and the commit it resolves to.
+type Ref struct {
+	// Name is the full ref name, e.g. "refs/heads/main" or "refs/tags/v1.0".
+	Name string
+	Hash string
+}
+
+// maxSymbolicRefDepth bounds how many symbolic refs are followed, so a cycle fails
+// instead of looping.
+const maxSymbolicRefDepth = 5
+
+// ListRefs returns every ref under .kitcat/refs (branches, tags and, when present,
+// remote-tracking refs) whose name matches pattern, sorted by name, the equivalent of
+// git for-each-ref. pattern is a glob in path.Match syntax over the full name, where
+// "*" does not cross "/", e.g. "refs/heads/*" or "refs/tags/v*"; a pattern without
+// wildcards also matches everything below it, so "refs/tags" lists all tags. An empty
+// pattern matches every ref.
+//
+// Symbolic refs ("ref: refs/heads/main") are resolved to the hash of their target. Tags
+// are lightweight, holding the commit hash itself, so there are no tag objects to peel.
+// Refs that resolve to no commit, such as a branch without commits yet, are left out, as
+// are the stash, which is a stack listed by `kitcat stash list`, and lock and temporary
+// files. Nothing is written. Like the other commands, ListRefs moves to the repository
+// root.
+func ListRefs(pattern string) ([]Ref, error) {
+	if _, err := enterRepoRoot(); err != nil {
+		return nil, err
+	}
+	if pattern != "" {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid ref pattern %q: %w", pattern, err)
+		}
+	}
+	repoDir := RepoDir()
+
+	var refs []Ref
+	err := filepath.WalkDir(RefsDir(), func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || !isRefFileName(d.Name()) {
+			return nil
+		}
+		rel, err := filepath.Rel(repoDir, p)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if name == "refs/stash" || !refMatches(name, pattern) {
+			return nil
+		}
+		hash, err := resolveRefFile(repoDir, name)
+		if err != nil {
+			return err
+		}
+		if hash != "" {
+			refs = append(refs, Ref{Name: name, Hash: hash})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].Name < refs[j].Name })
+	return refs, nil
+}
+
+// isRefFileName reports whether a file in the refs directory can be a ref rather than a
+// lock or a temporary file left by an atomic write.
+func isRefFileName(name string) bool {
+	return !strings.HasSuffix(name, ".lock") && !strings.HasSuffix(name, ".rwlock") &&
+		!strings.HasPrefix(name, "atomic-")
+}
+
+// refMatches reports whether the ref name matches a ListRefs pattern.
+func refMatches(name, pattern string) bool {
+	if pattern == "" {
+		return true
+	}
+	if ok, _ := path.Match(pattern, name); ok {
+		return true
+	}
+	prefix := strings.TrimSuffix(pattern, "/")
+	return !strings.ContainsAny(prefix, `*?[\`) && strings.HasPrefix(name, prefix+"/")
+}
+
+// resolveRefFile returns the commit hash the ref name, relative to repoDir, resolves to,
+// following symbolic refs, or "" when it names no commit.
+func resolveRefFile(repoDir, name string) (string, error) {
+	for range maxSymbolicRefDepth {
+		data, err := os.ReadFile(filepath.Join(repoDir, filepath.FromSlash(name)))
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		value := strings.TrimSpace(string(data))
+		target, symbolic := strings.CutPrefix(value, symbolicRefPrefix)
+		if !symbolic {
+			if len(value) != 40 || strings.Trim(value, "0123456789abcdef") != "" {
+				return "", nil
+			}
+			return value, nil
+		}
+		if !IsSafePath(target) || !strings.HasPrefix(target, "refs/") {
+			return "", nil
+		}
+		name = target
+	}
+	return "", fmt.Errorf("symbolic ref %s: too many levels of indirection", name)
+}
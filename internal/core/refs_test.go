@@ -0,0 +1,94 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestListRefs_FiltersAndResolves(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	_ = SetConfig("user.name", "Test", false)
+	_ = SetConfig("user.email", "test@example.com", false)
+
+	if err := os.WriteFile("a.txt", []byte("a"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddFile("a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	commit, _, err := Commit("first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateBranch("feature"); err != nil {
+		t.Fatal(err)
+	}
+	for _, tag := range []string{"v1.0", "v2.0", "nightly"} {
+		if err := CreateTag(tag, "HEAD"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	remote := filepath.Join(RefsDir(), "remotes", "origin")
+	if err := os.MkdirAll(remote, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(remote, "HEAD"), []byte("ref: refs/heads/feature\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(remote, "dangling"), []byte("ref: refs/heads/missing\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(HeadsDir(), "feature.lock"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	names := func(pattern string) []string {
+		t.Helper()
+		refs, err := ListRefs(pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, ref := range refs {
+			if ref.Hash != commit.ID {
+				t.Errorf("%s = %s, want %s", ref.Name, ref.Hash, commit.ID)
+			}
+			names = append(names, ref.Name)
+		}
+		return names
+	}
+
+	all := []string{
+		"refs/heads/feature", "refs/heads/" + DefaultBranch(), "refs/remotes/origin/HEAD",
+		"refs/tags/nightly", "refs/tags/v1.0", "refs/tags/v2.0",
+	}
+	if got := names(""); !reflect.DeepEqual(got, all) {
+		t.Errorf("all refs = %v, want %v", got, all)
+	}
+	if got, want := names("refs/tags/v*"), []string{"refs/tags/v1.0", "refs/tags/v2.0"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("refs/tags/v* = %v, want %v", got, want)
+	}
+	if got, want := names("refs/remotes"), []string{"refs/remotes/origin/HEAD"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("refs/remotes = %v, want %v", got, want)
+	}
+	if got := names("refs/*"); got != nil {
+		t.Errorf("refs/* = %v, want nothing: * does not cross /", got)
+	}
+	if _, err := ListRefs("refs/["); err == nil {
+		t.Error("invalid pattern accepted")
+	}
+}
@@ -10,9 +10,12 @@ import (
 )
 
 func RemoveFile(filename string, recursive bool) error {
-	filename = filepath.Clean(filename)
-	if !IsSafePath(filename) {
-		return fmt.Errorf("unsafe path detected: %s", filename)
+	filename, err := RepoRelPath(filename)
+	if err != nil {
+		return err
+	}
+	if _, err := enterRepoRoot(); err != nil {
+		return err
 	}
 
 	return storage.UpdateIndex(func(index map[string]string) error {
@@ -22,7 +25,7 @@ func RemoveFile(filename string, recursive bool) error {
 			// Recursive: find ALL tracked files under this directory
 			for trackedFile := range index {
 				if trackedFile == filename ||
-					strings.HasPrefix(trackedFile, filename+string(filepath.Separator)) {
+					strings.HasPrefix(trackedFile, filename+"/") {
 					filesToRemove = append(filesToRemove, trackedFile)
 				}
 			}
@@ -40,7 +43,7 @@ func RemoveFile(filename string, recursive bool) error {
 
 		// Step 1: Remove files from disk (non-fatal if missing)
 		for _, filePath := range filesToRemove {
-			if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+			if err := os.Remove(filepath.FromSlash(filePath)); err != nil && !os.IsNotExist(err) {
 				fmt.Printf("Warning: could not remove %s: %v\n", filePath, err)
 			}
 		}
@@ -0,0 +1,102 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+// Repack gathers every object referenced by the commit history and the index into a
+// single pack, delta-compressing successive versions of the same path.
+// Previously packed objects are carried over, so nothing stored is lost, and the
+// loose copies and old packs made redundant by the new pack are removed afterwards.
+// It holds the repository lock exclusively, so it waits for running adds and commits.
+func Repack() (storage.PackStats, error) {
+	return RepackContext(context.Background())
+}
+
+// RepackContext is Repack with cancellation, checked per commit while gathering objects and
+// per object while building the pack. A cancelled repack leaves existing packs untouched.
+func RepackContext(ctx context.Context) (storage.PackStats, error) {
+	if _, err := os.Stat(RepoDir()); os.IsNotExist(err) {
+		return storage.PackStats{}, errors.New("not a kitcat repository (run `kitcat init`)")
+	}
+	// Wait for adds and commits in flight: they may rely on an object in a pack this
+	// replaces, or have written one that is not referenced yet and so not gathered.
+	repoLock, err := storage.LockRepoExclusive()
+	if err != nil {
+		return storage.PackStats{}, err
+	}
+	defer repoLock.Unlock()
+
+	var candidates []storage.PackCandidate
+
+	// Commits are stored oldest first, which gives the per-path version order
+	// the pack builder needs to pick delta bases.
+	commits, err := storage.ReadCommits()
+	if err != nil {
+		return storage.PackStats{}, err
+	}
+	for _, c := range commits {
+		if err := ctx.Err(); err != nil {
+			return storage.PackStats{}, err
+		}
+		if c.TreeHash == "" || !storage.HasObject(c.TreeHash) {
+			continue
+		}
+		tree, err := storage.ParseTreeObjects(c.TreeHash)
+		if err != nil {
+			return storage.PackStats{}, fmt.Errorf("failed to read tree for commit %s: %w", c.ID, err)
+		}
+		candidates = append(candidates, storage.PackCandidate{Hash: c.TreeHash})
+		candidates = append(candidates, treeCandidates(tree)...)
+	}
+
+	// Staged content is the newest version of each path.
+	index, err := storage.LoadIndex()
+	if err != nil {
+		return storage.PackStats{}, err
+	}
+	for _, c := range treeCandidates(index) {
+		if storage.HasObject(c.Hash) {
+			candidates = append(candidates, c)
+		}
+	}
+
+	// Keep anything already packed, even if it is no longer referenced.
+	packed, err := storage.PackedObjects()
+	if err != nil {
+		return storage.PackStats{}, err
+	}
+	for _, hash := range packed {
+		candidates = append(candidates, storage.PackCandidate{Hash: hash})
+	}
+
+	stats, err := storage.BuildPack(ctx, candidates)
+	if err != nil {
+		return storage.PackStats{}, err
+	}
+	if err := storage.PruneRedundant(stats.Name); err != nil {
+		return stats, fmt.Errorf("pack written but pruning failed: %w", err)
+	}
+	return stats, nil
+}
+
+// treeCandidates converts a path->hash map into pack candidates in path order.
+func treeCandidates(tree map[string]string) []storage.PackCandidate {
+	paths := make([]string, 0, len(tree))
+	for p := range tree {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	out := make([]storage.PackCandidate, 0, len(paths))
+	for _, p := range paths {
+		out = append(out, storage.PackCandidate{Hash: tree[p], Path: p})
+	}
+	return out
+}
@@ -0,0 +1,91 @@
+package core
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRepoRelPath(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	root, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join("src", "pkg"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir("src"); err != nil {
+		t.Fatal(err)
+	}
+
+	for input, want := range map[string]string{
+		"pkg/a.go":    "src/pkg/a.go",
+		"./pkg//b.go": "src/pkg/b.go",
+		"../top.txt":  "top.txt",
+		"..":          ".",
+		".":           "src",
+		filepath.Join(root, "src", "pkg", "c.go"): "src/pkg/c.go",
+	} {
+		got, err := RepoRelPath(input)
+		if err != nil || got != want {
+			t.Errorf("RepoRelPath(%q) = %q, %v, want %q", input, got, err, want)
+		}
+	}
+	for _, input := range []string{"../../outside.txt", filepath.Dir(root), "bad\x01name"} {
+		if got, err := RepoRelPath(input); !errors.Is(err, ErrUnsafePath) {
+			t.Errorf("RepoRelPath(%q) = %q, %v, want ErrUnsafePath", input, got, err)
+		}
+	}
+	if wd, _ := os.Getwd(); wd != filepath.Join(root, "src") {
+		t.Errorf("RepoRelPath changed the working directory to %s", wd)
+	}
+}
+
+func TestRemoveFile_FromSubdirectory(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll("src", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join("src", "a.txt"), []byte("a"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddAll(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Chdir("src"); err != nil {
+		t.Fatal(err)
+	}
+	if err := RemoveFile("a.txt", false); err != nil {
+		t.Fatalf("RemoveFile from a subdirectory: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join("src", "a.txt")); !os.IsNotExist(err) {
+		t.Errorf("src/a.txt still on disk: %v", err)
+	}
+}
@@ -3,8 +3,6 @@ package core
 import (
 	"fmt"
 	"maps"
-	"os"
-	"strings"
 
 	"github.com/LeeFred3042U/kitcat/internal/storage"
 )
@@ -15,12 +13,29 @@ const (
 	ResetMixed = "mixed"
 )
 
+// ResetOptions controls ResetWithOptions.
+type ResetOptions struct {
+	// Force lets a hard reset discard staged and unstaged changes; without it the reset
+	// fails with ErrUncommittedChanges when HasUncommittedChanges finds any.
+	Force bool
+}
+
 // Reset performs reset operation with specified mode
 // Modes: "soft", "mixed", "hard"
 func Reset(commitHash string, mode string) error {
+	return ResetWithOptions(commitHash, mode, ResetOptions{})
+}
+
+// ResetWithOptions is Reset with options.
+func ResetWithOptions(commitHash string, mode string, opts ResetOptions) error {
 	if !IsRepoInitialized() {
 		return fmt.Errorf("not a kitcat repository (or any of the parent directories): .kitcat")
 	}
+	if mode == ResetHard && !opts.Force {
+		if err := requireNoUncommittedChanges("reset --hard"); err != nil {
+			return err
+		}
+	}
 
 	// Step 1: Validate commit exists
 	commit, err := storage.FindCommit(commitHash)
@@ -28,15 +43,15 @@ func Reset(commitHash string, mode string) error {
 		return fmt.Errorf("fatal: invalid commit: %s", commitHash)
 	}
 
-	// Step 2: Backup current HEAD
-	headData, err := os.ReadFile(".kitcat/HEAD")
+	// Step 2: Backup current HEAD (branch and the commit it points at)
+	oldHead, err := ReadHead()
 	if err != nil {
 		return fmt.Errorf("fatal: unable to read HEAD: %w", err)
 	}
-	oldHead := strings.TrimSpace(string(headData))
 
-	// Step 3: Move HEAD (ALL modes)
-	if err := os.WriteFile(".kitcat/HEAD", []byte(commitHash), 0o644); err != nil {
+	// Step 3: Move HEAD (ALL modes); an attached HEAD stays on its branch
+	commitHash = commit.ID
+	if err := moveHead(commitHash); err != nil {
 		return fmt.Errorf("failed to update HEAD: %w", err)
 	}
 
@@ -47,7 +62,7 @@ func Reset(commitHash string, mode string) error {
 
 	case ResetMixed:
 		if err := resetIndex(commitHash); err != nil {
-			if err = os.WriteFile(".kitcat/HEAD", []byte(oldHead), 0o644); err != nil {
+			if err = WriteHead(oldHead); err != nil {
 				return fmt.Errorf("failed to update HEAD: %w", err)
 			}
 			return fmt.Errorf("failed to reset index: %w", err)
@@ -56,13 +71,13 @@ func Reset(commitHash string, mode string) error {
 
 	case ResetHard:
 		if err := resetIndex(commitHash); err != nil {
-			if err = os.WriteFile(".kitcat/HEAD", []byte(oldHead), 0o644); err != nil {
+			if err = WriteHead(oldHead); err != nil {
 				return fmt.Errorf("failed to update HEAD: %w", err)
 			}
 			return fmt.Errorf("failed to reset index: %w", err)
 		}
 		if err := resetWorkspace(commitHash); err != nil {
-			if err = os.WriteFile(".kitcat/HEAD", []byte(oldHead), 0o644); err != nil {
+			if err = WriteHead(oldHead); err != nil {
 				return fmt.Errorf("failed to update HEAD: %w", err)
 			}
 			return fmt.Errorf("failed to reset workspace: %w", err)
@@ -70,12 +85,13 @@ func Reset(commitHash string, mode string) error {
 		fmt.Printf("HEAD is now at %s %s\n", commitHash[:7], commit.Message)
 
 	default:
-		if err = os.WriteFile(".kitcat/HEAD", []byte(oldHead), 0o644); err != nil {
+		if err = WriteHead(oldHead); err != nil {
 			return fmt.Errorf("failed to update HEAD: %w", err)
 		}
 		return fmt.Errorf("unknown reset mode: %s. Use --soft, --mixed, or --hard", mode)
 	}
 
+	recordOp("reset --"+mode, []string{commitHash}, nil)
 	return nil
 }
 
@@ -0,0 +1,123 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+// Restore overwrites working-tree files with their content from source, leaving the index
+// and HEAD alone. An empty source means the index, which discards unstaged edits; otherwise
+// source is a branch, HEAD, or a full or abbreviated commit hash. path may name a file or a
+// directory, in which case every tracked file below it is restored. Like checkout, files are
+// written under the case they were created with (see IndexEntry.DisplayPath), and missing
+// directories are recreated. Nothing is written when the index or source holds an unsafe
+// path (see ValidateIndexPaths).
+func Restore(path string, source string) error {
+	cleanPath, err := RepoRelPath(path)
+	if err != nil {
+		return err
+	}
+	if _, err := enterRepoRoot(); err != nil {
+		return err
+	}
+
+	entries, modes, sourceName, err := restoreSource(source)
+	if err != nil {
+		return err
+	}
+	if err := ValidateIndexPaths(); err != nil {
+		return err
+	}
+	index, err := storage.LoadIndexWithMeta()
+	if err != nil {
+		return err
+	}
+	if err := validateTreePaths(entries, sourceName); err != nil {
+		return err
+	}
+
+	var matches []string
+	for p := range entries {
+		if p == cleanPath || cleanPath == "." || strings.HasPrefix(p, cleanPath+"/") {
+			matches = append(matches, p)
+		}
+	}
+	if len(matches) == 0 {
+		return fmt.Errorf("pathspec '%s' did not match any file(s) known to %s", cleanPath, sourceName)
+	}
+	sort.Strings(matches)
+
+	preserve := GetConfigBool(preservePermissionsKey, false)
+	for _, p := range matches {
+		if isEmptyDirPlaceholder(modes[p]) {
+			if err := materializePlaceholder(p); err != nil {
+				return err
+			}
+			continue
+		}
+		if modes[p] == storage.SubmoduleMode {
+			if err := checkoutSubmodule(p, entries[p]); err != nil {
+				return fmt.Errorf("failed to restore %s: %w", p, err)
+			}
+			continue
+		}
+		content, err := storage.ReadObject(entries[p])
+		if err != nil {
+			return fmt.Errorf("failed to read %s from %s: %w", p, sourceName, err)
+		}
+		osPath := filepath.FromSlash(p)
+		if display := index[p].DisplayPath; display != "" {
+			osPath = filepath.FromSlash(display)
+		}
+		if err := os.MkdirAll(filepath.Dir(osPath), 0o755); err != nil {
+			return fmt.Errorf("failed to restore %s: %w", p, err)
+		}
+		if err := SafeWrite(osPath, content, worktreeMode(modes[p], preserve)); err != nil {
+			return fmt.Errorf("failed to restore %s: %w", p, err)
+		}
+	}
+	return nil
+}
+
+// restoreSource loads the path->hash map Restore reads from, the recorded permission bits,
+// and a name for messages.
+func restoreSource(source string) (map[string]string, map[string]uint32, string, error) {
+	if source == "" {
+		index, err := storage.LoadIndexWithMeta()
+		if err != nil {
+			return nil, nil, "", err
+		}
+		hashes := make(map[string]string, len(index))
+		modes := make(map[string]uint32)
+		for path, entry := range index {
+			hashes[path] = entry.Hash
+			if entry.Mode != 0 {
+				modes[path] = entry.Mode
+			}
+		}
+		return hashes, modes, "the index", nil
+	}
+
+	commitHash, err := ResolveCommitRef(source)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	commit, err := storage.FindCommit(commitHash)
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("invalid source '%s': %w", source, err)
+	}
+	tree, err := storage.ParseTree(commit.TreeHash)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	modes, err := storage.ParseTreeModes(commit.TreeHash)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return tree, modes, "'" + source + "'", nil
+}
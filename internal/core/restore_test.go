@@ -0,0 +1,162 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+func TestRestore_FromIndexCommitAndDirectory(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	_ = SetConfig("user.name", "Test", false)
+	_ = SetConfig("user.email", "test@example.com", false)
+
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.FromSlash(name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	read := func(name string) string {
+		t.Helper()
+		data, err := os.ReadFile(filepath.FromSlash(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	if err := os.Mkdir("src", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	write("a.txt", "committed a\n")
+	write("src/b.txt", "committed b\n")
+	write("src/c.txt", "committed c\n")
+	if err := AddAll(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Commit("first"); err != nil {
+		t.Fatal(err)
+	}
+
+	// From the index: staged content wins over HEAD, and the index is left alone
+	write("a.txt", "staged a\n")
+	if err := AddFile("a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	write("a.txt", "unstaged edit\n")
+	if err := Restore("a.txt", ""); err != nil {
+		t.Fatal(err)
+	}
+	if got := read("a.txt"); got != "staged a\n" {
+		t.Errorf("a.txt restored from the index = %q", got)
+	}
+
+	// From a commit
+	if err := Restore("a.txt", "HEAD"); err != nil {
+		t.Fatal(err)
+	}
+	if got := read("a.txt"); got != "committed a\n" {
+		t.Errorf("a.txt restored from HEAD = %q", got)
+	}
+	index, err := storage.LoadIndexWithMeta()
+	if err != nil {
+		t.Fatal(err)
+	}
+	staged, err := storage.WriteObject([]byte("staged a\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if index["a.txt"].Hash != staged {
+		t.Error("restoring from HEAD changed the index")
+	}
+
+	// A directory restores every file below it, recreating the directory itself
+	if err := os.RemoveAll("src"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Restore("src", ""); err != nil {
+		t.Fatal(err)
+	}
+	if got := read("src/b.txt") + read("src/c.txt"); got != "committed b\ncommitted c\n" {
+		t.Errorf("src restored = %q", got)
+	}
+
+	err = Restore("missing.txt", "")
+	if err == nil || !strings.Contains(err.Error(), "did not match any file(s) known to the index") {
+		t.Errorf("Restore of an unknown path = %v, want a pathspec error", err)
+	}
+	err = Restore("missing.txt", "HEAD")
+	if err == nil || !strings.Contains(err.Error(), "did not match any file(s) known to 'HEAD'") {
+		t.Errorf("Restore of an unknown path from HEAD = %v, want a pathspec error", err)
+	}
+}
+
+func TestRestore_WritesDisplayPath(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	_ = SetConfig("user.name", "Test", false)
+	_ = SetConfig("user.email", "test@example.com", false)
+
+	// notes.txt is tracked, but the file on disk was created as Notes.txt, as on a
+	// case-insensitive filesystem
+	hash, err := storage.WriteObject([]byte("tracked\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.WriteIndexWithMeta(map[string]storage.IndexEntry{
+		"notes.txt": {Hash: hash, DisplayPath: "Notes.txt"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Commit("notes"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, source := range []string{"", "HEAD"} {
+		if err := os.WriteFile("Notes.txt", []byte("local edit\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := Restore("notes.txt", source); err != nil {
+			t.Fatal(err)
+		}
+		if data, err := os.ReadFile("Notes.txt"); err != nil || string(data) != "tracked\n" {
+			t.Errorf("Notes.txt restored from %q = %q, %v", source, data, err)
+		}
+		entries, err := os.ReadDir(".")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range entries {
+			if e.Name() == "notes.txt" {
+				t.Errorf("restoring from %q wrote notes.txt beside Notes.txt", source)
+			}
+		}
+	}
+}
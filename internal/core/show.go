@@ -2,16 +2,203 @@ package core
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 
+	"github.com/LeeFred3042U/kitcat/internal/diff"
+	"github.com/LeeFred3042U/kitcat/internal/models"
 	"github.com/LeeFred3042U/kitcat/internal/storage"
 )
 
 // Displays the contents of a kitcat object
 func ShowObject(hash string) error {
-	data, err := storage.ReadObject(hash)
+	fullHash, err := storage.ResolveHash(hash)
+	if err != nil {
+		return err
+	}
+	data, err := storage.ReadObject(fullHash)
 	if err != nil {
 		return err
 	}
 	fmt.Println(string(data))
 	return nil
 }
+
+// Show resolves ref and returns a human-readable rendering of what it names.
+// ref may be HEAD, a branch, a tag, or a full or abbreviated commit or object hash.
+//   - commit: the log-style header followed by the diff against its parent
+//   - tree: one "<hash>  <path>" line per entry
+//   - blob: the raw content, or a one-line note for binary data
+func Show(ref string) (string, error) {
+	commit, ok, err := resolveShowCommit(ref)
+	if err != nil {
+		return "", err
+	}
+	if ok {
+		return formatCommit(commit)
+	}
+
+	hash, err := storage.ResolveHash(ref)
+	if err != nil {
+		return "", fmt.Errorf("unknown revision or object '%s': %w", ref, err)
+	}
+	data, err := storage.ReadObject(hash)
+	if err != nil {
+		return "", err
+	}
+	if isTreeObject(data) {
+		return formatTree(hash)
+	}
+	if isDiffBinary(data) {
+		return fmt.Sprintf("Binary object %s (%d bytes)\n", hash, len(data)), nil
+	}
+	return string(data), nil
+}
+
+// resolveShowCommit looks ref up as a symbolic name and then as a commit hash.
+// It reports false, without an error, when ref does not name a commit.
+func resolveShowCommit(ref string) (models.Commit, bool, error) {
+	var hash string
+	switch {
+	case ref == "HEAD" || IsBranch(ref):
+		h, err := ResolveCommitRef(ref)
+		if err != nil {
+			return models.Commit{}, false, err
+		}
+		hash = h
+	default:
+		if !IsValidRefName(ref) {
+			break
+		}
+		if data, err := os.ReadFile(filepath.Join(TagsDir(), ref)); err == nil {
+			hash = strings.TrimSpace(string(data))
+		}
+	}
+
+	if hash != "" {
+		commit, err := storage.FindCommit(hash)
+		if err != nil {
+			return models.Commit{}, false, err
+		}
+		return commit, true, nil
+	}
+
+	// A bare hash may be a commit (in commits.log) or an object; commits win.
+	if len(ref) < 4 {
+		return models.Commit{}, false, nil
+	}
+	commit, err := storage.FindCommit(ref)
+	if err != nil {
+		return models.Commit{}, false, nil
+	}
+	return commit, true, nil
+}
+
+// formatCommit renders a commit like `kitcat log` followed by its changes.
+func formatCommit(commit models.Commit) (string, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "commit %s\n", commit.ID)
+	fmt.Fprintf(&b, "Author: %s <%s>\n", commit.AuthorName, commit.AuthorEmail)
+	fmt.Fprintf(&b, "Date:   %s\n", authorDate(commit).Format("Mon Jan 02 15:04:05 2006 -0700"))
+	fmt.Fprintf(&b, "\n    %s\n\n", commit.Message)
+
+	tree, err := storage.ParseTree(commit.TreeHash)
+	if err != nil {
+		return "", err
+	}
+	parentTree := map[string]string{}
+	if commit.Parent != "" {
+		parent, err := storage.FindCommit(commit.Parent)
+		if err != nil {
+			return "", err
+		}
+		if parentTree, err = storage.ParseTree(parent.TreeHash); err != nil {
+			return "", err
+		}
+	}
+
+	for _, change := range diffTrees(parentTree, tree) {
+		switch change.Kind {
+		case ChangeAdded:
+			fmt.Fprintf(&b, "Added file: %s\n", change.Path)
+		case ChangeModified:
+			fmt.Fprintf(&b, "Modified file: %s\n", change.Path)
+		case ChangeDeleted:
+			fmt.Fprintf(&b, "Deleted file: %s\n", change.Path)
+		}
+		if err := writeBlobDiff(&b, change.Path, change.Kind, change.OldHash, change.NewHash); err != nil {
+			return "", err
+		}
+	}
+	return b.String(), nil
+}
+
+// writeBlobDiff writes the line diff between two blobs, or their sizes if either is binary;
+// an empty hash stands for no content.
+func writeBlobDiff(b *strings.Builder, path string, kind ChangeKind, oldHash, newHash string) error {
+	var oldData, newData []byte
+	var err error
+	if oldHash != "" {
+		if oldData, err = storage.ReadObject(oldHash); err != nil {
+			return err
+		}
+	}
+	if newHash != "" {
+		if newData, err = storage.ReadObject(newHash); err != nil {
+			return err
+		}
+	}
+	fd := buildFileDiff(path, kind, oldData, newData, diff.Whitespace{})
+	if fd.Binary {
+		b.WriteString(binarySummary(fd) + "\n")
+		return nil
+	}
+	for _, line := range fd.Lines {
+		b.WriteString(line.Op + " " + line.Text + "\n")
+	}
+	return nil
+}
+
+func splitLines(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+}
+
+// isTreeObject reports whether data has the tree layout written by storage.CreateTree:
+// one "<40-hex hash> <path>" line per entry. Objects carry no type header, so this is
+// a structural check; a blob would have to mimic the format exactly to be misread.
+func isTreeObject(data []byte) bool {
+	text := strings.TrimRight(string(data), "\n")
+	if text == "" {
+		return false
+	}
+	for _, line := range strings.Split(text, "\n") {
+		hash, path, ok := strings.Cut(line, " ")
+		if !ok || path == "" || len(hash) != 40 || strings.Trim(hash, "0123456789abcdef") != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func formatTree(hash string) (string, error) {
+	tree, err := storage.ParseTree(hash)
+	if err != nil {
+		return "", err
+	}
+	paths := make([]string, 0, len(tree))
+	for path := range tree {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var b strings.Builder
+	for _, path := range paths {
+		fmt.Fprintf(&b, "%s  %s\n", tree[path], path)
+	}
+	return b.String(), nil
+}
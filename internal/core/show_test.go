@@ -0,0 +1,85 @@
+package core
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+func TestShow_CommitTreeAndBlob(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	_ = SetConfig("user.name", "Test", false)
+	_ = SetConfig("user.email", "test@example.com", false)
+
+	if err := os.WriteFile("a.txt", []byte("one\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddAll(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Commit("first"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("a.txt", []byte("one\ntwo\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddAll(); err != nil {
+		t.Fatal(err)
+	}
+	second, _, err := Commit("second")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := Show("HEAD")
+	if err != nil {
+		t.Fatalf("Show(HEAD) failed: %v", err)
+	}
+	for _, want := range []string{"commit " + second.ID, "    second", "Modified file: a.txt", "  one\n", "+ two\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Show(HEAD) missing %q:\n%s", want, out)
+		}
+	}
+
+	if out, err := Show(second.ID[:7]); err != nil || !strings.Contains(out, "commit "+second.ID) {
+		t.Errorf("Show(abbreviated commit) = %q, %v", out, err)
+	}
+
+	tree, err := storage.ParseTree(second.TreeHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err = Show(second.TreeHash[:8])
+	if err != nil {
+		t.Fatalf("Show(tree) failed: %v", err)
+	}
+	if want := tree["a.txt"] + "  a.txt\n"; out != want {
+		t.Errorf("Show(tree) = %q, want %q", out, want)
+	}
+
+	out, err = Show(tree["a.txt"])
+	if err != nil {
+		t.Fatalf("Show(blob) failed: %v", err)
+	}
+	if out != "one\ntwo\n" {
+		t.Errorf("Show(blob) = %q", out)
+	}
+
+	if _, err := Show("nope"); err == nil {
+		t.Error("expected an error for an unknown ref")
+	}
+}
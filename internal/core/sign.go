@@ -0,0 +1,234 @@
+package core
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/LeeFred3042U/kitcat/internal/models"
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+const (
+	// signCommitsKey makes commit sign every new commit with user.signingKey. Off by
+	// default; `kitcat -c commit.sign=true commit ...` signs a single commit.
+	signCommitsKey = "commit.sign"
+	// signingKeyKey is the path of the ed25519 private key commits are signed with: a
+	// PEM-encoded PKCS#8 key as written by `openssl genpkey -algorithm ed25519`.
+	signingKeyKey = "user.signingKey"
+	// trustedKeysKey is the path of a file of PEM-encoded public keys (`openssl pkey
+	// -pubout`) whose signatures VerifyCommit accepts. Without it only the public half of
+	// user.signingKey is trusted.
+	trustedKeysKey = "user.trustedKeys"
+)
+
+// signatureScheme prefixes every commit signature, so other schemes can be added later.
+const signatureScheme = "ed25519"
+
+// ErrUnsigned is returned by VerifyCommit for a commit that carries no signature.
+var ErrUnsigned = errors.New("commit is not signed")
+
+// signedPayload returns the bytes a commit signature covers: every field except the ID,
+// which is derived from them, and the signature itself. Encoding a fixed struct as JSON
+// keeps the payload unambiguous for any message or author name.
+//
+// Format kitcat-commit-v2 adds the author's time zone. Commits recorded before time zones
+// have none and keep the v1 payload, byte for byte, so their signatures still verify; as
+// the zone picks the format, adding one to or removing one from a signed commit breaks its
+// signature either way.
+func signedPayload(c models.Commit) []byte {
+	format := "kitcat-commit-v1"
+	if c.TimeZone != "" {
+		format = "kitcat-commit-v2"
+	}
+	payload, _ := json.Marshal(struct {
+		Format      string
+		Tree        string
+		Parent      string
+		AuthorName  string
+		AuthorEmail string
+		Timestamp   string
+		TimeZone    string `json:",omitempty"`
+		Message     string
+	}{
+		Format:      format,
+		Tree:        c.TreeHash,
+		Parent:      c.Parent,
+		AuthorName:  c.AuthorName,
+		AuthorEmail: c.AuthorEmail,
+		Timestamp:   c.Timestamp.UTC().Format(time.RFC3339Nano),
+		TimeZone:    c.TimeZone,
+		Message:     c.Message,
+	})
+	return payload
+}
+
+// signCommit signs c with user.signingKey when commit.sign is set. The signature, stored
+// as "ed25519 <public key> <signature>" in base64, does not change the commit ID.
+func signCommit(c *models.Commit) error {
+	if !GetConfigBool(signCommitsKey, false) {
+		return nil
+	}
+	key, err := loadSigningKey()
+	if err != nil {
+		return err
+	}
+	sig := ed25519.Sign(key, signedPayload(*c))
+	pub := key.Public().(ed25519.PublicKey)
+	c.Signature = strings.Join([]string{
+		signatureScheme,
+		base64.StdEncoding.EncodeToString(pub),
+		base64.StdEncoding.EncodeToString(sig),
+	}, " ")
+	return nil
+}
+
+// loadSigningKey reads the private key named by user.signingKey.
+func loadSigningKey() (ed25519.PrivateKey, error) {
+	path, _, _ := GetConfig(signingKeyKey)
+	if path == "" {
+		return nil, fmt.Errorf("%s is set but %s is not", signCommitsKey, signingKeyKey)
+	}
+	data, err := os.ReadFile(expandHome(path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("signing key %s is not a PEM private key", path)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("signing key %s: %w", path, err)
+	}
+	key, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("signing key %s is not an ed25519 key", path)
+	}
+	return key, nil
+}
+
+// trustedKeys returns the public keys VerifyCommit accepts, from user.trustedKeys or else
+// user.signingKey.
+func trustedKeys() ([]ed25519.PublicKey, error) {
+	path, _, _ := GetConfig(trustedKeysKey)
+	if path == "" {
+		if signingKey, _, _ := GetConfig(signingKeyKey); signingKey == "" {
+			return nil, fmt.Errorf("no trusted keys: set %s or %s", trustedKeysKey, signingKeyKey)
+		}
+		key, err := loadSigningKey()
+		if err != nil {
+			return nil, err
+		}
+		return []ed25519.PublicKey{key.Public().(ed25519.PublicKey)}, nil
+	}
+
+	data, err := os.ReadFile(expandHome(path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trusted keys: %w", err)
+	}
+	var keys []ed25519.PublicKey
+	for {
+		var block *pem.Block
+		if block, data = pem.Decode(data); block == nil {
+			break
+		}
+		if block.Type != "PUBLIC KEY" {
+			continue
+		}
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("trusted keys %s: %w", path, err)
+		}
+		if key, ok := parsed.(ed25519.PublicKey); ok {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("trusted keys %s holds no ed25519 public key", path)
+	}
+	return keys, nil
+}
+
+// expandHome replaces a leading ~/ with the home directory, as config paths are often
+// written in the global config file.
+func expandHome(path string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	return path
+}
+
+// KeyFingerprint identifies a public key as "SHA256:" and the unpadded base64 of its
+// SHA-256, the form ssh-keygen -l prints.
+func KeyFingerprint(key ed25519.PublicKey) string {
+	sum := sha256.Sum256(key)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+// VerifyCommit checks the signature of the commit ref names (a branch, HEAD or a full or
+// short hash) against the trusted keys and returns the fingerprint of the key that made
+// it. The commit must also still match its hash, since the signature does not cover the
+// ID. An unsigned commit yields ErrUnsigned.
+func VerifyCommit(ref string) (string, error) {
+	id, err := ResolveCommitRef(ref)
+	if err != nil {
+		return "", err
+	}
+	c, err := storage.FindCommit(id)
+	if err != nil {
+		return "", err
+	}
+	trusted, err := trustedKeys()
+	if err != nil {
+		return "", err
+	}
+	return verifyCommitSignature(c, trusted)
+}
+
+// verifyCommitSignature checks c's signature against trusted and returns the signer's
+// fingerprint.
+func verifyCommitSignature(c models.Commit, trusted []ed25519.PublicKey) (string, error) {
+	if hashCommit(c) != c.ID {
+		return "", fmt.Errorf("commit %s does not match its hash", c.ID)
+	}
+	if c.Signature == "" {
+		return "", fmt.Errorf("%s: %w", c.ID, ErrUnsigned)
+	}
+	fields := strings.Fields(c.Signature)
+	if len(fields) != 3 || fields[0] != signatureScheme {
+		return "", fmt.Errorf("commit %s has a malformed signature", c.ID)
+	}
+	pub, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return "", fmt.Errorf("commit %s has a malformed signature", c.ID)
+	}
+	sig, err := base64.StdEncoding.DecodeString(fields[2])
+	if err != nil {
+		return "", fmt.Errorf("commit %s has a malformed signature", c.ID)
+	}
+
+	key := ed25519.PublicKey(pub)
+	fingerprint := KeyFingerprint(key)
+	if !ed25519.Verify(key, signedPayload(c), sig) {
+		return "", fmt.Errorf("bad signature on commit %s from key %s", c.ID, fingerprint)
+	}
+	for _, t := range trusted {
+		if bytes.Equal(t, key) {
+			return fingerprint, nil
+		}
+	}
+	return "", fmt.Errorf("commit %s is signed by untrusted key %s", c.ID, fingerprint)
+}
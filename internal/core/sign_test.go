@@ -0,0 +1,150 @@
+package core
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+// writeKeyPair writes a fresh ed25519 key pair as PEM files in dir and returns their paths.
+func writeKeyPair(t *testing.T, dir, name string) (privPath, pubPath string, pub ed25519.PublicKey) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privPath = filepath.Join(dir, name+".pem")
+	pubPath = filepath.Join(dir, name+".pub.pem")
+	if err := os.WriteFile(privPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(pubPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return privPath, pubPath, pub
+}
+
+func TestSignedCommitVerifies(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	_ = SetConfig("user.name", "Test User", false)
+	_ = SetConfig("user.email", "test@example.com", false)
+	keyDir := t.TempDir()
+	privPath, _, pub := writeKeyPair(t, keyDir, "me")
+	_, otherPub, _ := writeKeyPair(t, keyDir, "other")
+
+	if err := os.WriteFile("a.txt", []byte("one"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddFile("a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	unsigned, _, err := Commit("unsigned")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SetConfig(signingKeyKey, privPath, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyCommit(unsigned.ID); !errors.Is(err, ErrUnsigned) {
+		t.Errorf("VerifyCommit(unsigned) error = %v, want ErrUnsigned", err)
+	}
+
+	if err := SetConfig(signCommitsKey, "true", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("a.txt", []byte("second"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddFile("a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	signed, _, err := Commit("signed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signed.Signature == "" || hashCommit(signed) != signed.ID {
+		t.Fatalf("commit = %+v, want a signature that leaves the ID alone", signed)
+	}
+	fingerprint, err := VerifyCommit("HEAD")
+	if err != nil {
+		t.Fatalf("VerifyCommit(HEAD) failed: %v", err)
+	}
+	if fingerprint != KeyFingerprint(pub) {
+		t.Errorf("fingerprint = %s, want %s", fingerprint, KeyFingerprint(pub))
+	}
+	stored, err := storage.FindCommit(signed.ID)
+	if err != nil || stored.Signature != signed.Signature {
+		t.Errorf("stored signature = %q, %v", stored.Signature, err)
+	}
+
+	// A changed author is not covered by the ID, but is by the signature.
+	tampered := signed
+	tampered.AuthorName = "Mallory"
+	if _, err := verifyCommitSignature(tampered, []ed25519.PublicKey{pub}); err == nil {
+		t.Error("tampered commit verified")
+	}
+
+	// So is the time zone, whether changed or removed.
+	if signed.TimeZone == "" {
+		t.Fatal("commit recorded no time zone")
+	}
+	for _, zone := range []string{"+1300", ""} {
+		tampered = signed
+		tampered.TimeZone = zone
+		if _, err := verifyCommitSignature(tampered, []ed25519.PublicKey{pub}); err == nil {
+			t.Errorf("commit with time zone %q instead of %q verified", zone, signed.TimeZone)
+		}
+	}
+
+	// Commits from before time zones keep the v1 payload and still verify.
+	legacy := signed
+	legacy.TimeZone = ""
+	payload := string(signedPayload(legacy))
+	if !strings.HasPrefix(payload, `{"Format":"kitcat-commit-v1",`) || strings.Contains(payload, "TimeZone") {
+		t.Errorf("payload without a time zone = %s, want the v1 format", payload)
+	}
+	key, err := loadSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy.Signature = signatureScheme + " " + base64.StdEncoding.EncodeToString(pub) + " " +
+		base64.StdEncoding.EncodeToString(ed25519.Sign(key, signedPayload(legacy)))
+	if _, err := verifyCommitSignature(legacy, []ed25519.PublicKey{pub}); err != nil {
+		t.Errorf("v1-signed commit did not verify: %v", err)
+	}
+
+	if err := SetConfig(trustedKeysKey, otherPub, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyCommit("HEAD"); err == nil {
+		t.Error("commit verified against a trust list without its key")
+	}
+}
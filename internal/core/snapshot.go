@@ -0,0 +1,212 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/LeeFred3042U/kitcat/internal/models"
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+// SnapshotInfo describes a named snapshot of the index and tracked working-tree files.
+type SnapshotInfo struct {
+	Name    string    `json:"name"`
+	Created time.Time `json:"created"`
+	Head    string    `json:"head,omitempty"` // the HEAD commit when it was taken, if any
+	// Index is the tree of the staged content and Worktree the tree of the tracked files
+	// as they were on disk; both are ordinary tree objects.
+	Index    string `json:"index"`
+	Worktree string `json:"worktree"`
+}
+
+// SnapshotsDir returns the directory holding one JSON record per snapshot.
+func SnapshotsDir() string { return filepath.Join(RepoDir(), "snapshots") }
+
+// snapshotPath validates name and returns the path of its record.
+func snapshotPath(name string) (string, error) {
+	if !IsValidRefName(name) || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("invalid snapshot name: %q", name)
+	}
+	return filepath.Join(SnapshotsDir(), name), nil
+}
+
+// Snapshot saves the index and the current content of every tracked file under name,
+// replacing an earlier snapshot of that name, without touching HEAD, branches or the
+// working tree. It is a lighter safety net than stash: nothing is reset and snapshots are
+// restored by name as often as needed. Untracked files are not captured.
+func Snapshot(name string) (SnapshotInfo, error) {
+	path, err := snapshotPath(name)
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+	if _, err := enterRepoRoot(); err != nil {
+		return SnapshotInfo{}, err
+	}
+	repoLock, err := storage.LockRepoShared()
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+	defer repoLock.Unlock()
+
+	index, err := storage.LoadIndexWithMeta()
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+	indexTree, err := storage.CreateTree()
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+
+	// The working-tree tree holds each tracked file as it is on disk; deleted files are
+	// left out. Submodules and empty-directory placeholders keep their index entries.
+	hashes := make(map[string]string, len(index))
+	modes := make(map[string]uint32)
+	for p, entry := range index {
+		if entry.Mode != 0 {
+			modes[p] = entry.Mode
+		}
+		if entry.Mode == storage.SubmoduleMode || isEmptyDirPlaceholder(entry.Mode) {
+			hashes[p] = entry.Hash
+			continue
+		}
+		hash, err := storage.HashAndStoreFile(filepath.FromSlash(p))
+		if errors.Is(err, os.ErrNotExist) {
+			delete(modes, p)
+			continue
+		}
+		if err != nil {
+			return SnapshotInfo{}, fmt.Errorf("failed to snapshot %s: %w", p, err)
+		}
+		hashes[p] = hash
+	}
+	worktreeTree, err := storage.WriteTreeWithModes(hashes, modes)
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+
+	info := SnapshotInfo{Name: name, Created: Now().UTC(), Index: indexTree, Worktree: worktreeTree}
+	if head, err := GetHeadCommit(); err == nil {
+		info.Head = head.ID
+	}
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+	if err := os.MkdirAll(SnapshotsDir(), 0o755); err != nil {
+		return SnapshotInfo{}, err
+	}
+	if err := storage.SafeWriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return SnapshotInfo{}, err
+	}
+	recordOp("snapshot", nil, nil)
+	return info, nil
+}
+
+// ReadSnapshot returns the record of the named snapshot.
+func ReadSnapshot(name string) (SnapshotInfo, error) {
+	path, err := snapshotPath(name)
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+	if _, err := enterRepoRoot(); err != nil {
+		return SnapshotInfo{}, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return SnapshotInfo{}, fmt.Errorf("snapshot '%s' not found", name)
+	}
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+	var info SnapshotInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return SnapshotInfo{}, fmt.Errorf("snapshot '%s' is corrupt: %w", name, err)
+	}
+	return info, nil
+}
+
+// RestoreSnapshot brings the tracked files and the index back to the named snapshot:
+// files are rewritten from it, files tracked now but absent from it are deleted, and the
+// index is replaced by the snapshot's. HEAD and branches are left alone, as are untracked
+// files. Local changes to tracked files are overwritten; take another snapshot first to
+// keep them.
+func RestoreSnapshot(name string) error {
+	info, err := ReadSnapshot(name)
+	if err != nil {
+		return err
+	}
+	worktree, err := storage.ParseTree(info.Worktree)
+	if err != nil {
+		return fmt.Errorf("failed to read snapshot '%s': %w", name, err)
+	}
+	indexHashes, err := storage.ParseTree(info.Index)
+	if err != nil {
+		return fmt.Errorf("failed to read snapshot '%s': %w", name, err)
+	}
+	indexModes, err := storage.ParseTreeModes(info.Index)
+	if err != nil {
+		return err
+	}
+
+	if err := materializeTree(worktree, models.Commit{TreeHash: info.Worktree}); err != nil {
+		return err
+	}
+	index := make(map[string]storage.IndexEntry, len(indexHashes))
+	for p, hash := range indexHashes {
+		index[p] = storage.IndexEntry{Hash: hash, Mode: indexModes[p]}
+	}
+	if err := storage.WriteIndexWithMeta(index); err != nil {
+		return err
+	}
+	recordOp("snapshot restore", nil, nil)
+	return nil
+}
+
+// ListSnapshots returns every snapshot, sorted by name.
+func ListSnapshots() ([]SnapshotInfo, error) {
+	if _, err := enterRepoRoot(); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(SnapshotsDir())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	snapshots := []SnapshotInfo{}
+	for _, e := range entries {
+		// Skip leftovers of an interrupted SafeWriteFile.
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") || strings.HasSuffix(e.Name(), ".tmp") {
+			continue
+		}
+		info, err := ReadSnapshot(e.Name())
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, info)
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Name < snapshots[j].Name })
+	return snapshots, nil
+}
+
+// DeleteSnapshot removes the named snapshot. Its objects stay in the object store.
+func DeleteSnapshot(name string) error {
+	path, err := snapshotPath(name)
+	if err != nil {
+		return err
+	}
+	if _, err := enterRepoRoot(); err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("snapshot '%s' not found", name)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package core
+
+import (
+	"os"
+	"testing"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	_ = SetConfig("user.name", "Test User", false)
+	_ = SetConfig("user.email", "test@example.com", false)
+
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a.txt", "one")
+	write("b.txt", "bee")
+	if err := AddAll(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Commit("first"); err != nil {
+		t.Fatal(err)
+	}
+	// Staged and unstaged edits, both captured.
+	write("a.txt", "staged")
+	if err := AddFile("a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	write("a.txt", "unstaged edit")
+	stagedIndex, err := storage.LoadIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Snapshot("before"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Wreck the work: edit, delete, and track a new file.
+	write("a.txt", "oops")
+	if err := os.Remove("b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	write("c.txt", "new")
+	if err := AddAll(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RestoreSnapshot("before"); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{"a.txt": "unstaged edit", "b.txt": "bee"} {
+		if got, err := os.ReadFile(name); err != nil || string(got) != want {
+			t.Errorf("%s = %q, %v; want %q", name, got, err, want)
+		}
+	}
+	if _, err := os.Stat("c.txt"); !os.IsNotExist(err) {
+		t.Errorf("c.txt, tracked only after the snapshot, still exists: %v", err)
+	}
+	index, err := storage.LoadIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(index) != len(stagedIndex) || index["a.txt"] != stagedIndex["a.txt"] || index["b.txt"] != stagedIndex["b.txt"] {
+		t.Errorf("index = %v, want %v", index, stagedIndex)
+	}
+
+	snapshots, err := ListSnapshots()
+	if err != nil || len(snapshots) != 1 || snapshots[0].Name != "before" {
+		t.Fatalf("ListSnapshots() = %+v, %v", snapshots, err)
+	}
+	if err := DeleteSnapshot("before"); err != nil {
+		t.Fatal(err)
+	}
+	if err := RestoreSnapshot("before"); err == nil {
+		t.Error("restored a deleted snapshot")
+	}
+	if _, err := Snapshot("../escape"); err == nil {
+		t.Error("expected an error for an invalid snapshot name")
+	}
+}
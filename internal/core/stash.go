@@ -1,10 +1,10 @@
 package core
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"strings"
-	"time"
 
 	"github.com/LeeFred3042U/kitcat/internal/models"
 	"github.com/LeeFred3042U/kitcat/internal/storage"
@@ -74,8 +74,8 @@ func StashDrop(index int) error {
 	}
 
 	// Write the new stash list back to the file (preserve order: 0 = newest)
-	path := ".kitcat/refs/stash"
-	if err := os.MkdirAll(".kitcat/refs", 0o755); err != nil {
+	path := StashPath()
+	if err := os.MkdirAll(RefsDir(), 0o755); err != nil {
 		return err
 	}
 	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
@@ -109,7 +109,7 @@ func StashPush(message string) error {
 	// Step 2: Get current HEAD commit for parent reference and message
 	headCommit, err := GetHeadCommit()
 	if err != nil {
-		if err == storage.ErrNoCommits || strings.Contains(err.Error(), "not found") {
+		if errors.Is(err, storage.ErrNoCommits) || strings.Contains(err.Error(), "not found") {
 			return fmt.Errorf("cannot stash: no commits yet")
 		}
 		return fmt.Errorf("failed to get HEAD commit: %w", err)
@@ -131,22 +131,23 @@ func StashPush(message string) error {
 	}
 
 	// Step 5: Update index with current working directory state for tracked files
-	index, err := storage.LoadIndex()
-	if err != nil {
-		return fmt.Errorf("failed to load index: %w", err)
-	}
-
-	for path := range index {
-		if _, err := os.Stat(path); err == nil {
-			hash, err := storage.HashAndStoreFile(path)
-			if err != nil {
-				return fmt.Errorf("failed to hash file %s: %w", path, err)
+	// Entries keep their modes, so submodules stay submodules in the stash tree.
+	err = storage.UpdateIndexWithMeta(func(index map[string]storage.IndexEntry) error {
+		for path, entry := range index {
+			if entry.Mode == storage.SubmoduleMode {
+				continue
+			}
+			if _, err := os.Stat(path); err == nil {
+				hash, err := storage.HashAndStoreFile(path)
+				if err != nil {
+					return fmt.Errorf("failed to hash file %s: %w", path, err)
+				}
+				index[path] = storage.IndexEntry{Hash: hash, Mode: entry.Mode}
 			}
-			index[path] = hash
 		}
-	}
-
-	if err := storage.WriteIndex(index); err != nil {
+		return nil
+	})
+	if err != nil {
 		return fmt.Errorf("failed to write updated index: %w", err)
 	}
 
@@ -175,13 +176,18 @@ func StashPush(message string) error {
 	}
 
 	// Step 9: Create the stash commit
+	timestamp, timeZone, err := commitTime()
+	if err != nil {
+		return err
+	}
 	stashCommit := models.Commit{
 		Parent:      headCommit.ID,
 		Message:     wipMessage,
-		Timestamp:   time.Now().UTC(),
+		Timestamp:   timestamp,
 		TreeHash:    treeHash,
 		AuthorName:  authorName,
 		AuthorEmail: authorEmail,
+		TimeZone:    timeZone,
 	}
 	stashCommit.ID = hashCommit(stashCommit)
 
@@ -195,8 +201,9 @@ func StashPush(message string) error {
 		return fmt.Errorf("failed to push stash: %w", err)
 	}
 
-	// Step 12: Perform hard reset to HEAD to clean the workspace
-	if err := Reset(headCommit.ID, ResetHard); err != nil {
+	// Step 12: Perform hard reset to HEAD to clean the workspace; the changes it
+	// discards are safe in the stash
+	if err := ResetWithOptions(headCommit.ID, ResetHard, ResetOptions{Force: true}); err != nil {
 		return fmt.Errorf("failed to reset workspace after stashing: %w", err)
 	}
 
@@ -1,23 +1,106 @@
 package core
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
-	"strings"
+	"sort"
 
 	"github.com/LeeFred3042U/kitcat/internal/storage"
 )
 
+// StatusEntry is a single changed path in a StatusResult.
+type StatusEntry struct {
+	Path   string     `json:"path"`
+	Change ChangeKind `json:"change"` // "added", "modified" or "deleted"
+}
+
+// StatusResult is the structured form of `kitcat status`. It is also the schema of
+// `kitcat status --json`, so field names are stable. Paths are repo-relative and use
+// forward slashes on every platform; each list is sorted by path.
+type StatusResult struct {
+	Branch    string        `json:"branch"`    // as printed after "On branch", e.g. "main" or "HEAD detached at ..."
+	Staged    []StatusEntry `json:"staged"`    // index vs HEAD
+	Unstaged  []StatusEntry `json:"unstaged"`  // working tree vs index
+	Untracked []string      `json:"untracked"` // files neither tracked nor ignored
+	// Ignored lists untracked files matching .kitignore. A directory that is ignored and
+	// holds no tracked file is listed once, as "dir/", and is not descended into.
+	Ignored []string `json:"ignored"`
+}
+
+// Clean reports whether there is nothing to commit and nothing untracked.
+func (r StatusResult) Clean() bool {
+	return len(r.Staged) == 0 && len(r.Unstaged) == 0 && len(r.Untracked) == 0
+}
+
 // Status compares the state of the working directory, index, and last commit,
-// then prints a summary of the changes
-func Status() error {
-	// Print the current branch status at the top
+// then prints a summary of the changes. showIgnored also lists the ignored paths.
+func Status(showIgnored bool) error {
+	result, err := GetStatus()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("On branch %s\n", result.Branch)
+
+	// Print Final Summary - Only show sections that have content
+	if len(result.Staged) > 0 {
+		fmt.Println("\nChanges to be committed:")
+		for _, change := range result.Staged {
+			fmt.Printf("\t%s\n", formatStatusEntry(change))
+		}
+	}
+
+	if len(result.Unstaged) > 0 {
+		fmt.Println("\nChanges not staged for commit:")
+		for _, change := range result.Unstaged {
+			fmt.Printf("\t%s\n", formatStatusEntry(change))
+		}
+	}
+
+	if len(result.Untracked) > 0 {
+		fmt.Println("\nUntracked files:")
+		for _, file := range result.Untracked {
+			fmt.Printf("\t%s\n", file)
+		}
+	}
+
+	if showIgnored && len(result.Ignored) > 0 {
+		fmt.Println("\nIgnored files:")
+		for _, path := range result.Ignored {
+			fmt.Printf("\t%s\n", path)
+		}
+	}
+
+	// If all sections are empty, show a clean message
+	if result.Clean() {
+		fmt.Println("nothing to commit, working tree clean")
+	}
+
+	return nil
+}
+
+func formatStatusEntry(e StatusEntry) string {
+	switch e.Change {
+	case ChangeAdded:
+		return "new file:  " + e.Path
+	case ChangeDeleted:
+		return "deleted:   " + e.Path
+	}
+	return "modified:  " + e.Path
+}
+
+// GetStatus compares the working directory, index, and HEAD commit and returns the
+// categorized changes without printing anything.
+func GetStatus() (StatusResult, error) {
+	result := StatusResult{Staged: []StatusEntry{}, Unstaged: []StatusEntry{}, Untracked: []string{}, Ignored: []string{}}
+
 	headState, err := GetHeadState()
 	if err != nil {
 		headState = "no commits yet"
 	}
-	fmt.Printf("On branch %s\n", headState)
+	result.Branch = headState
 
 	// Load the tree from the commit that HEAD points to
 	// Note: We use GetHeadCommit() instead of storage.GetLastCommit() because
@@ -27,68 +110,67 @@ func Status() error {
 	if err == nil {
 		tree, parseErr := storage.ParseTree(headCommit.TreeHash)
 		if parseErr != nil {
-			return parseErr
+			return result, parseErr
 		}
 		headTree = tree
-	} else if err != storage.ErrNoCommits {
-		return err
+	} else if !errors.Is(err, storage.ErrNoCommits) {
+		return result, err
 	}
 
-	// Load the current staging area
-	index, err := storage.LoadIndex()
+	// Load the current staging area. Status is polled by editors, so read without locking.
+	entries, err := storage.LoadIndexOptimistic()
 	if err != nil {
-		return err
+		return result, err
+	}
+	index := make(map[string]string, len(entries))
+	displayed := make(map[string]string) // on-disk spelling -> tracked path
+	for path, entry := range entries {
+		index[path] = entry.Hash
+		if entry.DisplayPath != "" {
+			displayed[entry.DisplayPath] = path
+		}
 	}
 
 	// Load ignore patterns
 	ignorePatterns, err := LoadIgnorePatterns()
 	if err != nil {
-		return err
-	}
-
-	// Prepare slices to hold the categorized changes
-	stagedChanges := []string{}
-	unstagedChanges := []string{}
-	untrackedFiles := []string{}
-
-	// Create a set of all file paths from both HEAD and the index for a complete comparison
-	allPaths := make(map[string]bool)
-	for path := range headTree {
-		allPaths[path] = true
-	}
-	for path := range index {
-		allPaths[path] = true
+		return result, err
 	}
 
 	// Categorize Staged Changes (Index vs. HEAD)
-	for path := range allPaths {
-		headHash, inHead := headTree[path]
-		indexHash, inIndex := index[path]
-
-		if inIndex && !inHead {
-			stagedChanges = append(stagedChanges, fmt.Sprintf("new file:  %s", path))
-		} else if !inIndex && inHead {
-			stagedChanges = append(stagedChanges, fmt.Sprintf("deleted:   %s", path))
-		} else if inIndex && inHead && headHash != indexHash {
-			stagedChanges = append(stagedChanges, fmt.Sprintf("modified:  %s", path))
-		}
+	for _, change := range diffTrees(headTree, index) {
+		result.Staged = append(result.Staged, StatusEntry{Path: filepath.ToSlash(change.Path), Change: change.Kind})
 	}
 
 	// Track which files we've seen in the working directory
 	visitedPaths := make(map[string]bool)
+	trackedDirs := trackedDirectories(index)
 
 	// Categorize Unstaged & Untracked Changes (Working Directory vs. Index)
-	err = filepath.Walk(".", func(path string, info os.FileInfo, err error) error {
+	// Follow symlinked directories when add does, so edits to the files staged through
+	// them show up and the links themselves are not listed as untracked.
+	err = walkTree(".", GetConfigBool(followSymlinksKey, false), func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
-		cleanPath := filepath.Clean(path)
+		cleanPath := storage.IndexKey(path)
 
-		// Skip the .kitcat directory and other directories
-		if info.IsDir() || strings.HasPrefix(cleanPath, RepoDir+string(os.PathSeparator)) ||
-			cleanPath == RepoDir {
+		// Skip the .kitcat directory and other directories, and nested repositories
+		if info.IsDir() && cleanPath != "." && isNestedRepo(path) {
+			return filepath.SkipDir
+		}
+		if info.IsDir() && cleanPath != "." && !inRepoDir(cleanPath) && ignoredDirectory(cleanPath, ignorePatterns, trackedDirs) {
+			result.Ignored = append(result.Ignored, cleanPath+"/")
+			return filepath.SkipDir
+		}
+		if info.IsDir() || inRepoDir(cleanPath) {
 			return nil
 		}
+		if tracked, ok := displayed[cleanPath]; ok {
+			if _, exact := index[cleanPath]; !exact {
+				cleanPath = tracked
+			}
+		}
 
 		visitedPaths[cleanPath] = true
 
@@ -97,10 +179,11 @@ func Status() error {
 		// If the file is not in the index, it's untracked
 		if !isTracked {
 			// Check if file should be ignored
-			if ShouldIgnore(cleanPath, ignorePatterns, index) {
-				return nil // Skip ignored files
+			if ShouldIgnoreInfo(cleanPath, info, ignorePatterns, index) {
+				result.Ignored = append(result.Ignored, cleanPath)
+				return nil
 			}
-			untrackedFiles = append(untrackedFiles, cleanPath)
+			result.Untracked = append(result.Untracked, cleanPath)
 			return nil
 		}
 
@@ -110,50 +193,64 @@ func Status() error {
 			return hashErr
 		}
 		if currentHash != indexHash {
-			unstagedChanges = append(unstagedChanges, fmt.Sprintf("modified:  %s", cleanPath))
+			result.Unstaged = append(result.Unstaged, StatusEntry{Path: cleanPath, Change: ChangeModified})
 		}
 		return nil
 	})
 	if err != nil {
-		return err
+		return result, err
+	}
+
+	// A submodule whose HEAD moved away from the recorded commit is modified.
+	for path, entry := range entries {
+		if entry.Mode != storage.SubmoduleMode {
+			continue
+		}
+		if head, err := submoduleHead(filepath.FromSlash(path)); err == nil && head != "" && head != entry.Hash {
+			result.Unstaged = append(result.Unstaged, StatusEntry{Path: path, Change: ChangeModified})
+		}
 	}
 
 	// Check for files that are in the index but not in the working directory (deleted files)
 	for path := range index {
+		if isEmptyDirPlaceholder(entries[path].Mode) {
+			// Placeholders are never on disk; only the directory they stand for is.
+			if _, err := os.Stat(filepath.Dir(filepath.FromSlash(path))); os.IsNotExist(err) {
+				result.Unstaged = append(result.Unstaged, StatusEntry{Path: filepath.ToSlash(path), Change: ChangeDeleted})
+			}
+			continue
+		}
 		if !visitedPaths[path] {
 			// Verify it's actually missing
-			if _, err := os.Stat(path); os.IsNotExist(err) {
-				unstagedChanges = append(unstagedChanges, fmt.Sprintf("deleted:   %s", path))
+			if _, err := os.Stat(filepath.FromSlash(path)); os.IsNotExist(err) {
+				result.Unstaged = append(result.Unstaged, StatusEntry{Path: filepath.ToSlash(path), Change: ChangeDeleted})
 			}
 		}
 	}
 
-	// Print Final Summary - Only show sections that have content
-	if len(stagedChanges) > 0 {
-		fmt.Println("\nChanges to be committed:")
-		for _, change := range stagedChanges {
-			fmt.Printf("\t%s\n", change)
-		}
-	}
-
-	if len(unstagedChanges) > 0 {
-		fmt.Println("\nChanges not staged for commit:")
-		for _, change := range unstagedChanges {
-			fmt.Printf("\t%s\n", change)
-		}
-	}
+	sort.Slice(result.Unstaged, func(i, j int) bool {
+		return result.Unstaged[i].Path < result.Unstaged[j].Path
+	})
+	sort.Strings(result.Untracked)
+	sort.Strings(result.Ignored)
+	return result, nil
+}
 
-	if len(untrackedFiles) > 0 {
-		fmt.Println("\nUntracked files:")
-		for _, file := range untrackedFiles {
-			fmt.Printf("\t%s\n", file)
+// trackedDirectories returns every directory that has a tracked path somewhere below it.
+func trackedDirectories(index map[string]string) map[string]bool {
+	dirs := make(map[string]bool)
+	for path := range index {
+		for dir := filepath.ToSlash(filepath.Dir(path)); dir != "." && !dirs[dir]; dir = filepath.ToSlash(filepath.Dir(dir)) {
+			dirs[dir] = true
 		}
 	}
+	return dirs
+}
 
-	// If all sections are empty, show a clean message
-	if len(stagedChanges) == 0 && len(unstagedChanges) == 0 && len(untrackedFiles) == 0 {
-		fmt.Println("nothing to commit, working tree clean")
-	}
-
-	return nil
+// ignoredDirectory reports whether dir matches an ignore pattern and has no tracked path
+// below it, so everything inside is ignored and a walk can skip it as a whole. A directory
+// holding a tracked file is still walked: the file stays tracked and the rest is checked
+// one path at a time.
+func ignoredDirectory(dir string, patterns []IgnorePattern, trackedDirs map[string]bool) bool {
+	return !trackedDirs[dir] && matchesAnyPattern(dir, patterns)
 }
@@ -0,0 +1,147 @@
+package core
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+func TestStructuredStatusAndDiff_JSON(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	_ = SetConfig("user.name", "Test", false)
+	_ = SetConfig("user.email", "test@example.com", false)
+
+	if err := os.Mkdir("src", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	tracked := filepath.Join("src", "a.txt")
+	if err := os.WriteFile(tracked, []byte("a\nb\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddFile(tracked); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Commit("first"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(tracked, []byte("a\nc\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := GetStatus()
+	if err != nil {
+		t.Fatalf("GetStatus failed: %v", err)
+	}
+	got, err := json.Marshal(status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"branch":"main","staged":[],"unstaged":[{"path":"src/a.txt","change":"modified"}],"untracked":[],"ignored":[".kitignore"]}`
+	if string(got) != want {
+		t.Errorf("status JSON = %s\nwant %s", got, want)
+	}
+
+	files, err := DiffFiles(false)
+	if err != nil {
+		t.Fatalf("DiffFiles failed: %v", err)
+	}
+	var modified *FileDiff
+	for i := range files {
+		if files[i].Path == "src/a.txt" {
+			modified = &files[i]
+		}
+	}
+	if modified == nil {
+		t.Fatalf("src/a.txt missing from diff: %+v", files)
+	}
+	got, err = json.Marshal(modified)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = `{"path":"src/a.txt","change":"modified","binary":false,"insertions":1,"deletions":1,` +
+		`"lines":[{"op":" ","text":"a"},{"op":"-","text":"b"},{"op":"+","text":"c"}]}`
+	if string(got) != want {
+		t.Errorf("diff JSON = %s\nwant %s", got, want)
+	}
+
+	got, err = json.Marshal(LsFilesEntry{Path: tracked, Entry: storage.IndexEntry{Hash: "abc", Size: 4, Flags: storage.FlagSkipWorktree}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = `{"path":"src/a.txt","hash":"abc","size":4,"mtime":0,"assumeUnchanged":false,"skipWorktree":true}`
+	if string(got) != want {
+		t.Errorf("ls-files JSON = %s\nwant %s", got, want)
+	}
+}
+
+func TestGetStatus_CollapsesIgnoredDirectories(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	ClearIgnoreCache()
+	defer ClearIgnoreCache()
+
+	// dist/ has a tracked file, so only its untracked contents are ignored one by one.
+	for _, dir := range []string{"node_modules/pkg/lib", "dist"} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, content := range map[string]string{
+		"dist/keep.txt":                "keep\n",
+		"dist/app.js":                  "app\n",
+		"node_modules/pkg/index.js":    "index\n",
+		"node_modules/pkg/lib/util.js": "util\n",
+		"debug.log":                    "log\n",
+		"main.go":                      "package main\n",
+	} {
+		if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := AddFile("dist/keep.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(".kitignore", []byte(".kitignore\n*.log\nnode_modules/\ndist/\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ClearIgnoreCache()
+
+	status, err := GetStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"main.go"}; !reflect.DeepEqual(status.Untracked, want) {
+		t.Errorf("untracked = %v, want %v", status.Untracked, want)
+	}
+	want := []string{".kitignore", "debug.log", "dist/app.js", "node_modules/"}
+	if !reflect.DeepEqual(status.Ignored, want) {
+		t.Errorf("ignored = %v, want %v", status.Ignored, want)
+	}
+}
@@ -0,0 +1,234 @@
+package core
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+// SubmodulesFile lists the repository's submodules, one "path url" line each, sorted by
+// path. It is tracked like any other file so that the URLs travel with the commits.
+const SubmodulesFile = ".kitcatmodules"
+
+// Submodule is a kitcat repository nested in the working tree whose commit is recorded
+// in the index and in commits, instead of its files.
+type Submodule struct {
+	Path   string // forward slashes, relative to the repository root
+	URL    string
+	Commit string // the recorded commit; empty when the path is not staged
+}
+
+// ReadSubmodules returns the submodules listed in SubmodulesFile with the commits the
+// index records for them, sorted by path.
+func ReadSubmodules() ([]Submodule, error) {
+	if _, err := enterRepoRoot(); err != nil {
+		return nil, err
+	}
+	urls, err := readSubmodulesFile()
+	if err != nil {
+		return nil, err
+	}
+	index, err := storage.LoadIndexWithMeta()
+	if err != nil {
+		return nil, err
+	}
+	subs := make([]Submodule, 0, len(urls))
+	for path, url := range urls {
+		sub := Submodule{Path: path, URL: url}
+		if entry, ok := index[path]; ok && entry.Mode == storage.SubmoduleMode {
+			sub.Commit = entry.Hash
+		}
+		subs = append(subs, sub)
+	}
+	sort.Slice(subs, func(i, j int) bool { return subs[i].Path < subs[j].Path })
+	return subs, nil
+}
+
+// SubmoduleAdd registers the repository at path as a submodule cloned from url: it is
+// listed in SubmodulesFile, which is staged, and its current HEAD commit is staged as a
+// submodule entry in place of any files tracked under path.
+//
+// Cloning is not implemented yet, so the nested repository must already exist at path.
+func SubmoduleAdd(path, url string) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to resolve absolute path: %w", err)
+	}
+	root, err := enterRepoRoot()
+	if err != nil {
+		return errors.New("not a kitcat repository (run `kitcat init`)")
+	}
+	rel, err := filepath.Rel(root, absPath)
+	if err != nil {
+		return fmt.Errorf("path %s is outside repository", path)
+	}
+	key := storage.IndexKey(rel)
+	if key == "." || !IsSafePath(key) || inRepoDir(key) || strings.ContainsAny(key, "\r\n") {
+		return fmt.Errorf("invalid submodule path: %s", path)
+	}
+	if url == "" || strings.ContainsAny(url, " \t\r\n") {
+		return fmt.Errorf("invalid submodule url: %q", url)
+	}
+	if _, err := os.Stat(filepath.Join(absPath, storage.DefaultRepoDir)); err != nil {
+		return fmt.Errorf("%s is not a kitcat repository: cloning is not supported yet, clone %s there first", key, url)
+	}
+	commit, err := submoduleHead(absPath)
+	if err != nil {
+		return fmt.Errorf("could not read HEAD of submodule %s: %w", key, err)
+	}
+	if commit == "" {
+		return fmt.Errorf("submodule %s has no commits", key)
+	}
+
+	urls, err := readSubmodulesFile()
+	if err != nil {
+		return err
+	}
+	urls[key] = url
+	if err := writeSubmodulesFile(urls); err != nil {
+		return err
+	}
+	if err := AddFile(filepath.Join(root, SubmodulesFile)); err != nil {
+		return err
+	}
+
+	err = storage.UpdateIndexWithMeta(func(index map[string]storage.IndexEntry) error {
+		for p := range index {
+			if strings.HasPrefix(p, key+"/") {
+				delete(index, p)
+			}
+		}
+		index[key] = storage.IndexEntry{Hash: commit, Mode: storage.SubmoduleMode}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	recordOp("submodule add", []string{commit}, []string{key})
+	return nil
+}
+
+// readSubmodulesFile parses SubmodulesFile into a path -> url map. A missing file has no
+// submodules; blank lines and lines starting with '#' are skipped.
+func readSubmodulesFile() (map[string]string, error) {
+	urls := make(map[string]string)
+	f, err := os.Open(SubmodulesFile)
+	if os.IsNotExist(err) {
+		return urls, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		// URLs have no spaces, so the last one separates them from the path.
+		i := strings.LastIndex(line, " ")
+		if i <= 0 {
+			return nil, fmt.Errorf("%s:%d: expected \"path url\"", SubmodulesFile, lineNo)
+		}
+		urls[strings.TrimSpace(line[:i])] = line[i+1:]
+	}
+	return urls, scanner.Err()
+}
+
+func writeSubmodulesFile(urls map[string]string) error {
+	paths := make([]string, 0, len(urls))
+	for path := range urls {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	var b strings.Builder
+	for _, path := range paths {
+		fmt.Fprintf(&b, "%s %s\n", path, urls[path])
+	}
+	return SafeWrite(SubmodulesFile, []byte(b.String()), 0o644)
+}
+
+// submoduleHead returns the commit HEAD resolves to in the repository rooted at dir, or
+// "" when it has none yet.
+func submoduleHead(dir string) (string, error) {
+	head, err := readHeadAt(filepath.Join(dir, storage.DefaultRepoDir))
+	if err != nil {
+		return "", err
+	}
+	return head.Hash, nil
+}
+
+// refreshGitlink is what add does with the submodule entry e for the directory fullPath:
+// it follows the nested repository's HEAD, and stays as is while the submodule is not
+// initialized. exists is false once the directory is gone, i.e. the submodule was removed.
+func refreshGitlink(fullPath string, e storage.IndexEntry) (entry storage.IndexEntry, exists bool) {
+	info, err := os.Stat(fullPath)
+	if err != nil || !info.IsDir() {
+		return e, false
+	}
+	if head, err := submoduleHead(fullPath); err == nil && head != "" {
+		e.Hash = head
+	}
+	return e, true
+}
+
+// checkoutSubmodule materializes the submodule at path, recorded at commit. The directory
+// is always created; if a repository was cloned there, it is checked out at commit with a
+// detached HEAD, unless it has uncommitted changes or does not have the commit.
+func checkoutSubmodule(path, commit string) error {
+	dir := filepath.FromSlash(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	if _, err := os.Stat(filepath.Join(dir, storage.DefaultRepoDir)); err != nil {
+		return nil // not initialized
+	}
+	head, err := submoduleHead(dir)
+	if err != nil || head == commit {
+		return err
+	}
+	if os.Getenv(storage.EnvRepoDir) != "" {
+		return fmt.Errorf("cannot update submodule %s while %s is set", path, storage.EnvRepoDir)
+	}
+	return inDir(dir, func() error {
+		if dirty, err := IsWorkDirDirty(); err != nil || dirty {
+			return fmt.Errorf("submodule %s has local changes", path)
+		}
+		return CheckoutCommit(commit)
+	})
+}
+
+// submoduleContent is the text diffs show for a submodule recorded at commit, as Git does.
+func submoduleContent(commit string) []byte {
+	return []byte("Subproject commit " + commit + "\n")
+}
+
+// entryContent returns what a tree or index entry holds: the stored object, or for a
+// submodule the text standing for its commit.
+func entryContent(hash string, mode uint32) ([]byte, error) {
+	if mode == storage.SubmoduleMode {
+		return submoduleContent(hash), nil
+	}
+	return storage.ReadObject(hash)
+}
+
+// inDir runs fn with dir as the working directory and changes back afterwards.
+func inDir(dir string, fn func() error) error {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	if err := os.Chdir(dir); err != nil {
+		return err
+	}
+	defer os.Chdir(cwd)
+	return fn()
+}
@@ -0,0 +1,144 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+func TestSubmodule_RecordedAndCheckedOut(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	root := t.TempDir()
+	if err := os.Chdir(root); err != nil {
+		t.Fatal(err)
+	}
+	initRepo := func() {
+		t.Helper()
+		if err := InitRepo(); err != nil {
+			t.Fatal(err)
+		}
+		if err := SetConfig("user.name", "Test", false); err != nil {
+			t.Fatal(err)
+		}
+		if err := SetConfig("user.email", "test@example.com", false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	commitAll := func(message string) string {
+		t.Helper()
+		if err := AddAll(); err != nil {
+			t.Fatal(err)
+		}
+		c, _, err := Commit(message)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c.ID
+	}
+	initRepo()
+
+	// The nested repository, at two commits.
+	var libFirst, libSecond string
+	if err := os.Mkdir("lib", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	err = inDir("lib", func() error {
+		initRepo()
+		if err := os.WriteFile("lib.txt", []byte("one"), 0o644); err != nil {
+			return err
+		}
+		libFirst = commitAll("lib one")
+		if err := os.WriteFile("lib.txt", []byte("second"), 0o644); err != nil {
+			return err
+		}
+		libSecond = commitAll("lib two")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile("app.txt", []byte("app"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := SubmoduleAdd("lib", "https://example.com/lib"); err != nil {
+		t.Fatalf("SubmoduleAdd: %v", err)
+	}
+	outerFirst := commitAll("add lib")
+
+	subs, err := ReadSubmodules()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subs) != 1 || subs[0] != (Submodule{Path: "lib", URL: "https://example.com/lib", Commit: libSecond}) {
+		t.Fatalf("ReadSubmodules = %+v", subs)
+	}
+	index, err := storage.LoadIndexWithMeta()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := index["lib/lib.txt"]; ok {
+		t.Error("files of the submodule were staged")
+	}
+	modes, err := storage.ParseTreeModes(mustCommitTree(t, outerFirst))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if modes["lib"] != storage.SubmoduleMode {
+		t.Errorf("tree mode of lib = %o, want %o", modes["lib"], storage.SubmoduleMode)
+	}
+
+	// Moving the nested HEAD shows as a change, and add records the new commit.
+	if err := inDir("lib", func() error { return CheckoutCommit(libFirst) }); err != nil {
+		t.Fatal(err)
+	}
+	status, err := GetStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status.Unstaged) != 1 || status.Unstaged[0].Path != "lib" {
+		t.Errorf("unstaged = %+v, want lib modified", status.Unstaged)
+	}
+	for _, lowMemory := range []bool{false, true} {
+		if err := AddAllWithOptions(context.Background(), AddOptions{LowMemory: lowMemory}); err != nil {
+			t.Fatal(err)
+		}
+		if index, err = storage.LoadIndexWithMeta(); err != nil {
+			t.Fatal(err)
+		}
+		if e := index["lib"]; e.Hash != libFirst || e.Mode != storage.SubmoduleMode {
+			t.Errorf("lowMemory=%v: lib entry = %+v, want submodule at %s", lowMemory, e, libFirst)
+		}
+	}
+	commitAll("lib back to one")
+
+	// Checking out the first commit moves the submodule back to the commit recorded there.
+	if err := CheckoutCommit(outerFirst); err != nil {
+		t.Fatal(err)
+	}
+	head, err := submoduleHead(filepath.Join(root, "lib"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head != libSecond {
+		t.Errorf("submodule HEAD = %s, want %s", head, libSecond)
+	}
+}
+
+func mustCommitTree(t *testing.T, id string) string {
+	t.Helper()
+	c, err := storage.FindCommit(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c.TreeHash
+}
@@ -0,0 +1,110 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// followSymlinksKey makes `add` descend into symlinks to directories and stage their
+// contents under the link's path, as if the directory were in the tree. Off by default:
+// such a symlink is then not followed.
+const followSymlinksKey = "add.followSymlinks"
+
+// walkTree is filepath.Walk, or walkFollowingSymlinks when follow is set.
+func walkTree(root string, follow bool, fn filepath.WalkFunc) error {
+	if !follow {
+		return filepath.Walk(root, fn)
+	}
+	return walkFollowingSymlinks(root, fn)
+}
+
+// walkFollowingSymlinks walks root like filepath.Walk, except that a symlink to a
+// directory is reported to fn with the directory's FileInfo and walked, with paths below
+// the link rather than its target. A link back to a directory that is already being walked
+// would loop forever, so a directory is skipped, with a warning, when its resolved path is
+// that of one of its ancestors in the walk. The same directory reached through two
+// unrelated links is walked twice, once under each path.
+func walkFollowingSymlinks(root string, fn filepath.WalkFunc) error {
+	info, err := followedStat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = walkFollowing(root, info, fn, map[string]bool{})
+	}
+	if err == filepath.SkipDir || err == filepath.SkipAll {
+		return nil
+	}
+	return err
+}
+
+// walkFollowing walks path, whose followed FileInfo is info; ancestors holds the resolved
+// paths of the directories above it.
+func walkFollowing(path string, info os.FileInfo, fn filepath.WalkFunc, ancestors map[string]bool) error {
+	if !info.IsDir() {
+		return fn(path, info, nil)
+	}
+	real, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return fn(path, info, err)
+	}
+	if real, err = filepath.Abs(real); err != nil {
+		return fn(path, info, err)
+	}
+	if ancestors[real] {
+		fmt.Printf("warning: skipping %s: symlink cycle back to %s\n", path, real)
+		return nil
+	}
+	ancestors[real] = true
+	defer delete(ancestors, real)
+
+	names, err := readDirNames(path)
+	if err1 := fn(path, info, err); err != nil || err1 != nil {
+		return err1
+	}
+	for _, name := range names {
+		child := filepath.Join(path, name)
+		childInfo, err := followedStat(child)
+		if err != nil {
+			if err := fn(child, childInfo, err); err != nil && err != filepath.SkipDir {
+				return err
+			}
+			continue
+		}
+		if err := walkFollowing(child, childInfo, fn, ancestors); err != nil {
+			if !childInfo.IsDir() || err != filepath.SkipDir {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// followedStat is os.Lstat, except that a symlink to a directory yields the directory's
+// FileInfo. A dangling link or one to a file keeps its own, as filepath.Walk reports it.
+func followedStat(path string) (os.FileInfo, error) {
+	info, err := os.Lstat(path)
+	if err != nil || info.Mode()&os.ModeSymlink == 0 {
+		return info, err
+	}
+	if target, err := os.Stat(path); err == nil && target.IsDir() {
+		return target, nil
+	}
+	return info, nil
+}
+
+// readDirNames returns the sorted names in dir, as filepath.Walk reads them.
+func readDirNames(dir string) ([]string, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	names, err := f.Readdirnames(-1)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,88 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+func TestAddAll_FollowSymlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("creating symlinks needs extra privileges on Windows")
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	shared := t.TempDir()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A shared directory outside the repository, linked in, with a link back to itself.
+	if err := os.MkdirAll(filepath.Join(shared, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(shared, "sub", "lib.txt"), []byte("lib"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(shared, filepath.Join(shared, "sub", "loop")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(shared, "vendor"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("main.txt", []byte("main"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := AddAll(); err != nil {
+		t.Fatal(err)
+	}
+	index, err := storage.LoadIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := index["vendor/sub/lib.txt"]; ok {
+		t.Fatal("symlinked directory followed without add.followSymlinks")
+	}
+
+	if err := AddAllWithOptions(t.Context(), AddOptions{FollowSymlinks: true}); err != nil {
+		t.Fatalf("AddAll following symlinks: %v", err)
+	}
+	index, err = storage.LoadIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"main.txt", "vendor/sub/lib.txt"} {
+		if _, ok := index[p]; !ok {
+			t.Errorf("%s not staged; index = %v", p, index)
+		}
+	}
+	for p := range index {
+		if filepath.Base(filepath.Dir(p)) == "loop" {
+			t.Errorf("walked into the symlink cycle: %s", p)
+		}
+	}
+
+	// Status follows the link too once it is configured, so the tree is clean.
+	if err := SetConfig(followSymlinksKey, "true", false); err != nil {
+		t.Fatal(err)
+	}
+	status, err := GetStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status.Unstaged) != 0 || len(status.Untracked) != 0 {
+		t.Errorf("status after add = %+v, want clean", status)
+	}
+}
@@ -5,9 +5,9 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
-)
 
-const tagsDir = ".kitcat/refs/tags"
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
 
 // Creates a new lightweight tag pointing to a specific commit
 
@@ -20,11 +20,11 @@ func CreateTag(tagName, commitID string) error {
 		return fmt.Errorf("invalid tag name: %s", tagName)
 	}
 
-	if err := os.MkdirAll(tagsDir, 0o755); err != nil {
+	if err := os.MkdirAll(TagsDir(), 0o755); err != nil {
 		return err
 	}
 
-	tagPath := filepath.Join(tagsDir, tagName)
+	tagPath := filepath.Join(TagsDir(), tagName)
 	// Checks if tag already exists.
 	if _, err := os.Stat(tagPath); err == nil {
 		return fmt.Errorf("error: tag %s already exists", tagName)
@@ -32,6 +32,17 @@ func CreateTag(tagName, commitID string) error {
 		return err
 	}
 
+	// The target must name an existing commit; HEAD and branches are resolved first.
+	hash, err := ResolveCommitRef(commitID)
+	if err != nil {
+		return err
+	}
+	commit, err := storage.FindCommit(hash)
+	if err != nil {
+		return fmt.Errorf("cannot tag '%s': %w", commitID, err)
+	}
+	commitID = commit.ID
+
 	// Creates a new tag.
 	if err := os.WriteFile(tagPath, []byte(commitID), 0o644); err != nil {
 		return err
@@ -49,14 +60,14 @@ func ListTags() ([]string, error) {
 		)
 	}
 
-	if _, err := os.Stat(tagsDir); err != nil {
+	if _, err := os.Stat(TagsDir()); err != nil {
 		if os.IsNotExist(err) {
 			return []string{}, nil
 		}
 		return nil, err
 	}
 
-	entries, err := os.ReadDir(tagsDir)
+	entries, err := os.ReadDir(TagsDir())
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,85 @@
+package core
+
+import (
+	"sort"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+// ChangeKind classifies how a path differs between two trees.
+type ChangeKind string
+
+const (
+	ChangeAdded    ChangeKind = "added"
+	ChangeModified ChangeKind = "modified"
+	ChangeDeleted  ChangeKind = "deleted"
+)
+
+// TreeChange is a single path-level difference between two path->hash maps.
+type TreeChange struct {
+	Path    string
+	Kind    ChangeKind
+	OldHash string
+	NewHash string
+}
+
+// diffTrees compares two path->hash maps (trees or index snapshots) and returns the
+// changes needed to turn from into to, sorted by path.
+func diffTrees(from, to map[string]string) []TreeChange {
+	var changes []TreeChange
+	for path, oldHash := range from {
+		newHash, ok := to[path]
+		switch {
+		case !ok:
+			changes = append(changes, TreeChange{Path: path, Kind: ChangeDeleted, OldHash: oldHash})
+		case newHash != oldHash:
+			changes = append(changes, TreeChange{Path: path, Kind: ChangeModified, OldHash: oldHash, NewHash: newHash})
+		}
+	}
+	for path, newHash := range to {
+		if _, ok := from[path]; !ok {
+			changes = append(changes, TreeChange{Path: path, Kind: ChangeAdded, NewHash: newHash})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes
+}
+
+// IndexDiff lists the paths that differ between two indexes, each list sorted.
+type IndexDiff struct {
+	Added    []string // only in the second index
+	Removed  []string // only in the first index
+	Modified []string // in both, with different hashes
+}
+
+// Empty reports whether the two indexes staged the same content.
+func (d IndexDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Modified) == 0
+}
+
+// DiffIndexes compares two index snapshots, e.g. taken before and after a script ran,
+// by hash only: entries whose size, mtime or flags changed but not their content are
+// not reported. It does not touch the repository.
+func DiffIndexes(a, b map[string]storage.IndexEntry) IndexDiff {
+	var d IndexDiff
+	for path, entry := range b {
+		old, ok := a[path]
+		switch {
+		case !ok:
+			d.Added = append(d.Added, path)
+		case old.Hash != entry.Hash:
+			d.Modified = append(d.Modified, path)
+		}
+	}
+	for path := range a {
+		if _, ok := b[path]; !ok {
+			d.Removed = append(d.Removed, path)
+		}
+	}
+	sort.Strings(d.Added)
+	sort.Strings(d.Removed)
+	sort.Strings(d.Modified)
+	return d
+}
@@ -0,0 +1,41 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+func TestDiffIndexes(t *testing.T) {
+	a := map[string]storage.IndexEntry{
+		"same.txt":    {Hash: "1111", Size: 4, ModTime: 100},
+		"touched.txt": {Hash: "2222", Size: 4, ModTime: 100},
+		"changed.txt": {Hash: "3333"},
+		"gone.txt":    {Hash: "4444"},
+		"b/gone.txt":  {Hash: "5555"},
+	}
+	b := map[string]storage.IndexEntry{
+		"same.txt":    {Hash: "1111", Size: 4, ModTime: 100},
+		"touched.txt": {Hash: "2222", Size: 5, ModTime: 200, Flags: storage.FlagAssumeUnchanged},
+		"changed.txt": {Hash: "6666"},
+		"z/new.txt":   {Hash: "7777"},
+		"new.txt":     {Hash: "8888"},
+	}
+
+	got := DiffIndexes(a, b)
+	want := IndexDiff{
+		Added:    []string{"new.txt", "z/new.txt"},
+		Removed:  []string{"b/gone.txt", "gone.txt"},
+		Modified: []string{"changed.txt"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DiffIndexes = %+v, want %+v", got, want)
+	}
+	if got.Empty() {
+		t.Error("Empty() = true for differing indexes")
+	}
+	if d := DiffIndexes(a, a); !d.Empty() {
+		t.Errorf("DiffIndexes(a, a) = %+v, want empty", d)
+	}
+}
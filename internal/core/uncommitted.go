@@ -0,0 +1,98 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+// ErrUncommittedChanges is wrapped by the errors of operations that refuse to discard
+// staged or unstaged changes unless forced.
+var ErrUncommittedChanges = errors.New("uncommitted changes would be lost")
+
+// UncommittedChanges says which kinds of change HasUncommittedChanges found.
+type UncommittedChanges struct {
+	Staged   bool // the index differs from HEAD
+	Unstaged bool // a tracked file differs from the index
+}
+
+// String lists the categories found, e.g. "staged and unstaged changes".
+func (c UncommittedChanges) String() string {
+	var kinds []string
+	if c.Staged {
+		kinds = append(kinds, "staged")
+	}
+	if c.Unstaged {
+		kinds = append(kinds, "unstaged")
+	}
+	if len(kinds) == 0 {
+		return "no changes"
+	}
+	return strings.Join(kinds, " and ") + " changes"
+}
+
+// HasUncommittedChanges reports whether the index differs from HEAD or a tracked file
+// differs from the index, and which. Files whose size and mtime match the index are
+// trusted without hashing, and it stops looking at each category once it has found a
+// change, so a clean tree costs one stat per tracked file. Untracked files do not count:
+// the operations it guards leave them alone. Skip-worktree and assume-unchanged entries,
+// submodules and empty-directory placeholders are not compared with the working tree.
+func HasUncommittedChanges() (bool, UncommittedChanges, error) {
+	var changes UncommittedChanges
+	if _, err := enterRepoRoot(); err != nil {
+		return false, changes, err
+	}
+	index, err := storage.LoadIndexWithMeta()
+	if err != nil {
+		return false, changes, err
+	}
+
+	headTree := map[string]string{}
+	if head, err := GetHeadCommit(); err == nil {
+		if headTree, err = storage.ParseTree(head.TreeHash); err != nil {
+			return false, changes, err
+		}
+	} else if !errors.Is(err, storage.ErrNoCommits) {
+		return false, changes, err
+	}
+	if len(headTree) != len(index) {
+		changes.Staged = true
+	}
+
+	for p, entry := range index {
+		if !changes.Staged {
+			if hash, ok := headTree[p]; !ok || hash != entry.Hash {
+				changes.Staged = true
+			}
+		}
+		if changes.Unstaged || entry.Mode == storage.SubmoduleMode || isEmptyDirPlaceholder(entry.Mode) ||
+			entry.Flags&(storage.FlagSkipWorktree|storage.FlagAssumeUnchanged) != 0 {
+			continue
+		}
+		modified, err := isEntryModified(filepath.FromSlash(p), entry)
+		if err != nil {
+			return false, changes, err
+		}
+		changes.Unstaged = modified
+		if changes.Staged && changes.Unstaged {
+			break
+		}
+	}
+	return changes.Staged || changes.Unstaged, changes, nil
+}
+
+// requireNoUncommittedChanges returns an ErrUncommittedChanges error naming op when
+// HasUncommittedChanges finds anything.
+func requireNoUncommittedChanges(op string) error {
+	dirty, changes, err := HasUncommittedChanges()
+	if err != nil {
+		return fmt.Errorf("could not check for local changes: %w", err)
+	}
+	if dirty {
+		return fmt.Errorf("%w by %s: there are %s; commit or stash them first", ErrUncommittedChanges, op, changes)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package core
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestHasUncommittedChanges_GuardsHardReset(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	_ = SetConfig("user.name", "Test", false)
+	_ = SetConfig("user.email", "test@example.com", false)
+
+	check := func(want UncommittedChanges) {
+		t.Helper()
+		dirty, got, err := HasUncommittedChanges()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want || dirty != (want.Staged || want.Unstaged) {
+			t.Errorf("HasUncommittedChanges() = %v, %+v, want %+v", dirty, got, want)
+		}
+	}
+
+	if err := os.WriteFile("a.txt", []byte("one"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddAll(); err != nil {
+		t.Fatal(err)
+	}
+	check(UncommittedChanges{Staged: true})
+	commit, _, err := Commit("first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(UncommittedChanges{})
+
+	// Untracked files do not count.
+	if err := os.WriteFile("new.txt", []byte("untracked"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	check(UncommittedChanges{})
+
+	if err := os.WriteFile("a.txt", []byte("changed"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	check(UncommittedChanges{Unstaged: true})
+
+	err = Reset(commit.ID, ResetHard)
+	if !errors.Is(err, ErrUncommittedChanges) {
+		t.Fatalf("Reset --hard error = %v, want ErrUncommittedChanges", err)
+	}
+	if data, _ := os.ReadFile("a.txt"); string(data) != "changed" {
+		t.Errorf("refused reset touched a.txt: %q", data)
+	}
+
+	// Soft and mixed resets keep the working tree and are not guarded.
+	if err := Reset(commit.ID, ResetMixed); err != nil {
+		t.Fatalf("Reset --mixed failed: %v", err)
+	}
+
+	if err := ResetWithOptions(commit.ID, ResetHard, ResetOptions{Force: true}); err != nil {
+		t.Fatalf("forced Reset --hard failed: %v", err)
+	}
+	if data, _ := os.ReadFile("a.txt"); string(data) != "one" {
+		t.Errorf("a.txt after forced reset = %q, want %q", data, "one")
+	}
+	check(UncommittedChanges{})
+}
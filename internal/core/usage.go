@@ -0,0 +1,59 @@
+package core
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+// RootUsageDir is the DirUsage bucket for files at the top of the working tree.
+const RootUsageDir = "/"
+
+// DirUsage is the tracked size of one top-level directory.
+type DirUsage struct {
+	Dir   string // first path component, or RootUsageDir
+	Files int
+	Bytes int64 // sum of the recorded sizes
+}
+
+// DiskUsageByDir sums the recorded size of every index entry by top-level directory,
+// largest first (ties by name), to show where the size of the tracked tree comes from.
+// Only the index is read, so entries staged without metadata count as zero bytes, and
+// empty-directory placeholders are not counted.
+func DiskUsageByDir() ([]DirUsage, error) {
+	index, err := storage.LoadIndexWithMeta()
+	if err != nil {
+		return nil, err
+	}
+
+	byDir := make(map[string]*DirUsage)
+	for path, entry := range index {
+		if isEmptyDirPlaceholder(entry.Mode) {
+			continue
+		}
+		dir, _, nested := strings.Cut(path, "/")
+		if !nested {
+			dir = RootUsageDir
+		}
+		u := byDir[dir]
+		if u == nil {
+			u = &DirUsage{Dir: dir}
+			byDir[dir] = u
+		}
+		u.Files++
+		u.Bytes += entry.Size
+	}
+
+	usage := make([]DirUsage, 0, len(byDir))
+	for _, u := range byDir {
+		usage = append(usage, *u)
+	}
+	sort.Slice(usage, func(i, j int) bool {
+		if usage[i].Bytes != usage[j].Bytes {
+			return usage[i].Bytes > usage[j].Bytes
+		}
+		return usage[i].Dir < usage[j].Dir
+	})
+	return usage, nil
+}
@@ -0,0 +1,53 @@
+package core
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+func TestDiskUsageByDir_GroupsByTopLevelDirectory(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := storage.WriteIndexWithMeta(map[string]storage.IndexEntry{
+		"assets/logo.png":                   {Hash: "a", Size: 5000},
+		"assets/fonts/a.ttf":                {Hash: "b", Size: 3000},
+		"src/main.go":                       {Hash: "c", Size: 400},
+		"src/util/util.go":                  {Hash: "d", Size: 600},
+		"README.md":                         {Hash: "e", Size: 300},
+		"go.mod":                            {Hash: "f", Size: 700},
+		"docs/guide.md":                     {Hash: "g"},
+		"empty/" + EmptyDirPlaceholder:      {Hash: "h", Mode: storage.EmptyDirMode},
+		"vendor/lib/" + EmptyDirPlaceholder: {Hash: "h", Mode: storage.EmptyDirMode},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := DiskUsageByDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []DirUsage{
+		{Dir: "assets", Files: 2, Bytes: 8000},
+		{Dir: RootUsageDir, Files: 2, Bytes: 1000},
+		{Dir: "src", Files: 2, Bytes: 1000},
+		{Dir: "docs", Files: 1, Bytes: 0},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DiskUsageByDir() = %+v, want %+v", got, want)
+	}
+}
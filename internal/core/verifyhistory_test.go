@@ -0,0 +1,107 @@
+package core
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/LeeFred3042U/kitcat/internal/models"
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+func TestVerifyHistory(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetConfig("user.name", "Test", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetConfig("user.email", "test@example.com", false); err != nil {
+		t.Fatal(err)
+	}
+
+	var root, head models.Commit
+	for i, content := range []string{"one", "second", "the third"} {
+		if err := os.WriteFile("a.txt", []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := AddFile("a.txt"); err != nil {
+			t.Fatal(err)
+		}
+		if head, _, err = Commit(content); err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			root = head
+		}
+	}
+	if n, err := VerifyHistory("main"); err != nil || n != 3 {
+		t.Fatalf("VerifyHistory(main) = %d, %v; want 3, nil", n, err)
+	}
+	if n, err := VerifyHistory(root.ID[:8]); err != nil || n != 1 {
+		t.Fatalf("VerifyHistory(root) = %d, %v; want 1, nil", n, err)
+	}
+
+	appendCommit := func(c models.Commit) models.Commit {
+		t.Helper()
+		if c.ID == "" {
+			c.ID = hashCommit(c)
+		}
+		if err := storage.AppendCommit(c); err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	tests := []struct {
+		name   string
+		tip    models.Commit
+		commit string
+		want   HistoryError
+	}{
+		{
+			name: "missing parent",
+			tip:  appendCommit(models.Commit{Parent: "feedface", TreeHash: head.TreeHash, Message: "orphan", Timestamp: time.Now()}),
+			want: HistoryError{Kind: "parent", Object: "feedface", Reason: "is missing from the commit log"},
+		},
+		{
+			name: "tampered record",
+			tip:  appendCommit(models.Commit{ID: "0123456789abcdef", Parent: head.ID, TreeHash: head.TreeHash, Message: "forged"}),
+			want: HistoryError{Kind: "commit", Object: "0123456789abcdef", Reason: "does not match its hash"},
+		},
+	}
+	for _, tt := range tests {
+		n, err := VerifyHistory(tt.tip.ID)
+		var got *HistoryError
+		if !errors.As(err, &got) {
+			t.Fatalf("%s: VerifyHistory = %d, %v; want a HistoryError", tt.name, n, err)
+		}
+		if tt.want.Kind == "parent" {
+			tt.want.Commit = tt.tip.ID
+		}
+		if *got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, *got, tt.want)
+		}
+	}
+
+	// A lost tree breaks every commit that uses it; the first of them is reported.
+	if err := os.Remove(filepath.Join(RepoDir(), "objects", root.TreeHash)); err != nil {
+		t.Fatal(err)
+	}
+	n, err := VerifyHistory("HEAD")
+	var got *HistoryError
+	if !errors.As(err, &got) || n != 2 || got.Commit != root.ID || got.Kind != "tree" {
+		t.Errorf("VerifyHistory after losing the root tree = %d, %v", n, err)
+	}
+}
@@ -0,0 +1,77 @@
+package core
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+func TestVerifyIndex_ReportsMetadataDiscrepancies(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, content := range map[string]string{"ok.txt": "fine", "grown.txt": "short", "gone.txt": "bye", "legacy.txt": "old"} {
+		if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := AddAll(); err != nil {
+		t.Fatal(err)
+	}
+	report, err := VerifyIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Clean() || report.Entries != 4 {
+		t.Fatalf("fresh index report = %+v", report)
+	}
+
+	if err := os.WriteFile("grown.txt", []byte("much longer now"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove("gone.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.UpdateIndexWithMeta(func(index map[string]storage.IndexEntry) error {
+		index["legacy.txt"] = storage.IndexEntry{Hash: index["legacy.txt"].Hash}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err = VerifyIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.StaleSize) != 1 || report.StaleSize[0] != (IndexSizeMismatch{Path: "grown.txt", Recorded: 5, OnDisk: 15}) {
+		t.Errorf("StaleSize = %+v", report.StaleSize)
+	}
+	if len(report.Missing) != 1 || report.Missing[0] != "gone.txt" {
+		t.Errorf("Missing = %v", report.Missing)
+	}
+	if len(report.NoMetadata) != 1 || report.NoMetadata[0] != "legacy.txt" {
+		t.Errorf("NoMetadata = %v", report.NoMetadata)
+	}
+
+	var out bytes.Buffer
+	WriteIndexReport(&out, report)
+	for _, want := range []string{"Stale metadata", "grown.txt (index 5 bytes, disk 15 bytes)", "Missing from working tree", "No recorded metadata"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("report missing %q:\n%s", want, out.String())
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strconv"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+// verifyWorkersKey sets how many objects VerifyObjects re-hashes at once. It defaults to
+// the number of CPUs.
+const verifyWorkersKey = "core.verifyWorkers"
+
+// VerifyObjects re-hashes every stored object, loose and packed, and returns the number
+// checked and the objects whose content does not match their name, sorted by hash. The
+// work is spread over core.verifyWorkers goroutines. Nothing is modified.
+func VerifyObjects(ctx context.Context) (int, []storage.CorruptObject, error) {
+	if _, err := enterRepoRoot(); err != nil {
+		return 0, nil, err
+	}
+	workers := runtime.NumCPU()
+	if value, found, _ := GetConfig(verifyWorkersKey); found {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return 0, nil, fmt.Errorf("invalid %s: %q is not a positive number", verifyWorkersKey, value)
+		}
+		workers = n
+	}
+	return storage.VerifyObjects(ctx, workers)
+}
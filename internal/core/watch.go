@@ -0,0 +1,210 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+// WatchEventKind says how a watched file changed.
+type WatchEventKind string
+
+const (
+	WatchCreated  WatchEventKind = "created"
+	WatchModified WatchEventKind = "modified"
+	WatchDeleted  WatchEventKind = "deleted"
+)
+
+// WatchEvent is a change to one working-tree file, by its repo-relative path in index form.
+type WatchEvent struct {
+	Path string
+	Kind WatchEventKind
+}
+
+// Defaults for WatchOptions.
+const (
+	defaultWatchInterval = 250 * time.Millisecond
+	defaultWatchDebounce = 500 * time.Millisecond
+)
+
+// WatchOptions tunes Watch. Zero values use the defaults.
+type WatchOptions struct {
+	// Interval is how often the working tree is scanned (default 250ms).
+	Interval time.Duration
+	// Debounce is how long a file must stay unchanged before its event is sent
+	// (default 500ms).
+	Debounce time.Duration
+	// OnError, if not nil, receives the errors of scans that failed; such a scan is
+	// skipped and the next one reports what it missed.
+	OnError func(error)
+}
+
+// watchState is what a scan records of a file: enough to tell that it changed without
+// reading it.
+type watchState struct {
+	size    int64
+	modTime int64
+	mode    os.FileMode
+}
+
+// Watch reports changes to the working tree on the returned channel until ctx is done,
+// when the channel is closed. It sees the files status sees: tracked files, and untracked
+// ones that are not ignored, never anything in .kitcat, nested repositories or unsafe
+// paths. Files that exist when it starts are not reported.
+//
+// The tree is scanned every Interval, by metadata only, and a file's event is held back
+// until the file has been left alone for Debounce; what it is sent as compares the file
+// then with what was last reported for it. Bursts of writes are thus one event, and an
+// editor's atomic save, which writes a temporary file and renames it over the original,
+// or deletes the original and writes it anew, is one "modified" event for the original
+// while the temporary file, gone again, is not reported at all. Changes to .kitignore
+// apply from the scan that sees them.
+//
+// Watch moves to the repository root, like the other commands, and expects to stay
+// there.
+func Watch(ctx context.Context, opts WatchOptions) (<-chan WatchEvent, error) {
+	if _, err := enterRepoRoot(); err != nil {
+		return nil, err
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = defaultWatchInterval
+	}
+	if opts.Debounce <= 0 {
+		opts.Debounce = defaultWatchDebounce
+	}
+	reported, err := scanWatched()
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan WatchEvent)
+	go func() {
+		defer close(events)
+		ticker := time.NewTicker(opts.Interval)
+		defer ticker.Stop()
+
+		last := reported
+		changedAt := make(map[string]time.Time) // paths not yet reported, by last change
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			current, err := scanWatched()
+			if err != nil {
+				if opts.OnError != nil {
+					opts.OnError(err)
+				}
+				continue
+			}
+			now := time.Now()
+			for path := range changedWatchPaths(last, current) {
+				changedAt[path] = now
+				if path == ".kitignore" {
+					ClearIgnoreCache()
+				}
+			}
+			last = current
+
+			var due []string
+			for path, at := range changedAt {
+				if now.Sub(at) >= opts.Debounce {
+					due = append(due, path)
+				}
+			}
+			sort.Strings(due)
+			for _, path := range due {
+				delete(changedAt, path)
+				before, had := reported[path]
+				after, has := current[path]
+				var kind WatchEventKind
+				switch {
+				case !had && has:
+					kind = WatchCreated
+				case had && !has:
+					kind = WatchDeleted
+				case had && has && before != after:
+					kind = WatchModified
+				}
+				if has {
+					reported[path] = after
+				} else {
+					delete(reported, path)
+				}
+				if kind == "" {
+					continue // back to what was reported, e.g. a temporary file gone again
+				}
+				select {
+				case events <- WatchEvent{Path: path, Kind: kind}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return events, nil
+}
+
+// changedWatchPaths returns the paths whose state differs between two scans.
+func changedWatchPaths(a, b map[string]watchState) map[string]bool {
+	changed := make(map[string]bool)
+	for path, s := range a {
+		if t, ok := b[path]; !ok || t != s {
+			changed[path] = true
+		}
+	}
+	for path := range b {
+		if _, ok := a[path]; !ok {
+			changed[path] = true
+		}
+	}
+	return changed
+}
+
+// scanWatched records the state of every file Watch reports on, walking the working tree
+// as status does. Files that vanish during the walk are left out rather than failing it.
+func scanWatched() (map[string]watchState, error) {
+	index, err := storage.LoadIndex()
+	if err != nil {
+		return nil, err
+	}
+	ignorePatterns, err := LoadIgnorePatterns()
+	if err != nil {
+		return nil, err
+	}
+	trackedDirs := trackedDirectories(index)
+
+	states := make(map[string]watchState)
+	err = walkTree(".", GetConfigBool(followSymlinksKey, false), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		cleanPath := storage.IndexKey(path)
+		if cleanPath == "." {
+			return nil
+		}
+		if info.IsDir() {
+			if inRepoDir(cleanPath) || isNestedRepo(path) || ignoredDirectory(cleanPath, ignorePatterns, trackedDirs) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !IsSafePath(cleanPath) || ShouldIgnoreInfo(cleanPath, info, ignorePatterns, index) {
+			return nil
+		}
+		states[cleanPath] = watchState{size: info.Size(), modTime: info.ModTime().UnixNano(), mode: info.Mode()}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return states, nil
+}
@@ -0,0 +1,95 @@
+package core
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestWatch_ReportsDebouncedChanges(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(cwd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	ClearIgnoreCache()
+	defer ClearIgnoreCache()
+
+	for name, content := range map[string]string{".kitignore": "*.log\n", "a.txt": "a\n", "b.txt": "b\n"} {
+		if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := AddAll(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := Watch(ctx, WatchOptions{Interval: 10 * time.Millisecond, Debounce: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An atomic save of a.txt: write a temporary file, delete the original, rename.
+	if err := os.WriteFile("a.txt.tmp", []byte("a, saved\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove("a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename("a.txt.tmp", "a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove("b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("new.txt", []byte("new\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("debug.log", []byte("ignored\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(".kitcat/scratch", []byte("internal\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]WatchEventKind{"a.txt": WatchModified, "b.txt": WatchDeleted, "new.txt": WatchCreated}
+	got := make(map[string]WatchEventKind)
+	timeout := time.After(5 * time.Second)
+	for len(got) < len(want) {
+		select {
+		case e := <-events:
+			if _, dup := got[e.Path]; dup {
+				t.Errorf("second event for %s: %s", e.Path, e.Kind)
+			}
+			got[e.Path] = e.Kind
+		case <-timeout:
+			t.Fatalf("events = %v, want %v", got, want)
+		}
+	}
+	for path, kind := range want {
+		if got[path] != kind {
+			t.Errorf("%s: %s, want %s", path, got[path], kind)
+		}
+	}
+	// Nothing else comes: not the temporary file, the ignored file or .kitcat.
+	select {
+	case e := <-events:
+		t.Errorf("unexpected event %+v", e)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	cancel()
+	for range events {
+	}
+}
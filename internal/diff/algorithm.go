@@ -0,0 +1,243 @@
+package diff
+
+import "fmt"
+
+// Algorithm selects how Compute finds the differences between two sequences.
+type Algorithm string
+
+const (
+	// Myers finds a shortest edit script. It is the default.
+	Myers Algorithm = "myers"
+	// Patience anchors the diff on elements that occur exactly once in both sequences,
+	// which keeps moved or rewritten blocks of code together instead of matching up
+	// their braces and blank lines.
+	Patience Algorithm = "patience"
+	// Histogram extends patience to elements that are rare rather than unique, so it
+	// still finds good anchors in sequences with many repeated elements.
+	Histogram Algorithm = "histogram"
+)
+
+// ParseAlgorithm returns the algorithm with the given name; "" is Myers.
+func ParseAlgorithm(name string) (Algorithm, error) {
+	switch alg := Algorithm(name); alg {
+	case "":
+		return Myers, nil
+	case Myers, Patience, Histogram:
+		return alg, nil
+	}
+	return "", fmt.Errorf("unknown diff algorithm %q (want myers, patience or histogram)", name)
+}
+
+// Compute returns the differences between text1 and text2 as found by alg, with
+// consecutive operations of the same kind merged. An unknown alg is treated as Myers.
+func Compute[T comparable](alg Algorithm, text1, text2 []T) []Diff[T] {
+	var s script[T]
+	switch alg {
+	case Patience:
+		s.patience(text1, text2)
+	case Histogram:
+		s.histogram(text1, text2)
+	default:
+		return NewMyersDiff(text1, text2).Diffs()
+	}
+	return s.diffs
+}
+
+// script accumulates an edit script, merging consecutive operations of the same kind.
+type script[T comparable] struct {
+	diffs []Diff[T]
+}
+
+func (s *script[T]) add(op Operation, text []T) {
+	if len(text) == 0 {
+		return
+	}
+	if n := len(s.diffs); n > 0 && s.diffs[n-1].Operation == op {
+		last := s.diffs[n-1].Text
+		// The full slice expression makes append copy instead of writing into the input.
+		s.diffs[n-1].Text = append(last[:len(last):len(last)], text...)
+		return
+	}
+	s.diffs = append(s.diffs, Diff[T]{Operation: op, Text: text})
+}
+
+// myers appends the Myers diff of a and b.
+func (s *script[T]) myers(a, b []T) {
+	for _, d := range NewMyersDiff(a, b).Diffs() {
+		s.add(d.Operation, d.Text)
+	}
+}
+
+// trim appends the common prefix of a and b and returns what is left of both, along
+// with their common suffix, which the caller appends after diffing the middle.
+func (s *script[T]) trim(a, b []T) (midA, midB, suffix []T) {
+	var md MyersDiff[T]
+	p := md.diffCommonPrefix(a, b)
+	s.add(EQUAL, a[:p])
+	a, b = a[p:], b[p:]
+	q := md.diffCommonSuffix(a, b)
+	return a[:len(a)-q], b[:len(b)-q], a[len(a)-q:]
+}
+
+// patience appends the patience diff of a and b: the longest increasing run of elements
+// unique to both sides is matched first, then the gaps between them are diffed the same
+// way. A gap without unique elements falls back to Myers.
+func (s *script[T]) patience(a, b []T) {
+	a, b, suffix := s.trim(a, b)
+	switch {
+	case len(a) == 0 || len(b) == 0:
+		s.add(DELETE, a)
+		s.add(INSERT, b)
+	default:
+		anchors := uniqueAnchors(a, b)
+		if len(anchors) == 0 {
+			s.myers(a, b)
+			break
+		}
+		i, j := 0, 0
+		for _, m := range anchors {
+			s.patience(a[i:m.a], b[j:m.b])
+			s.add(EQUAL, a[m.a:m.a+1])
+			i, j = m.a+1, m.b+1
+		}
+		s.patience(a[i:], b[j:])
+	}
+	s.add(EQUAL, suffix)
+}
+
+// match pairs position a of the old sequence with position b of the new one.
+type match struct{ a, b int }
+
+// uniqueAnchors returns the elements that occur exactly once in each of a and b, paired
+// up, restricted to the longest subset whose positions increase on both sides.
+func uniqueAnchors[T comparable](a, b []T) []match {
+	type count struct{ a, b, posB int }
+	counts := make(map[T]*count)
+	for _, x := range a {
+		c := counts[x]
+		if c == nil {
+			c = &count{}
+			counts[x] = c
+		}
+		c.a++
+	}
+	for j, x := range b {
+		if c := counts[x]; c != nil {
+			c.b++
+			c.posB = j
+		}
+	}
+	var candidates []match
+	for i, x := range a {
+		if c := counts[x]; c.a == 1 && c.b == 1 {
+			candidates = append(candidates, match{i, c.posB})
+		}
+	}
+	return longestIncreasing(candidates)
+}
+
+// longestIncreasing returns the longest subsequence of ms (ordered by a) whose b also
+// increases, found by patience sorting.
+func longestIncreasing(ms []match) []match {
+	if len(ms) == 0 {
+		return nil
+	}
+	var tops []int               // index into ms of the top card of each pile
+	prev := make([]int, len(ms)) // the card below on the previous pile
+	for i, m := range ms {
+		lo, hi := 0, len(tops)
+		for lo < hi {
+			mid := (lo + hi) / 2
+			if ms[tops[mid]].b < m.b {
+				lo = mid + 1
+			} else {
+				hi = mid
+			}
+		}
+		prev[i] = -1
+		if lo > 0 {
+			prev[i] = tops[lo-1]
+		}
+		if lo == len(tops) {
+			tops = append(tops, i)
+		} else {
+			tops[lo] = i
+		}
+	}
+	out := make([]match, len(tops))
+	for i, k := len(tops)-1, tops[len(tops)-1]; i >= 0; i, k = i-1, prev[k] {
+		out[i] = ms[k]
+	}
+	return out
+}
+
+// maxChainLength is how often an element may occur in the old sequence and still be
+// considered as an anchor by the histogram diff.
+const maxChainLength = 64
+
+// histogram appends the histogram diff of a and b: the common region containing the
+// element that is rarest in a is matched first, then the text on either side of it is
+// diffed the same way. Text without such a region falls back to Myers.
+func (s *script[T]) histogram(a, b []T) {
+	a, b, suffix := s.trim(a, b)
+	switch {
+	case len(a) == 0 || len(b) == 0:
+		s.add(DELETE, a)
+		s.add(INSERT, b)
+	default:
+		r, ok := rarestRegion(a, b)
+		if !ok {
+			s.myers(a, b)
+			break
+		}
+		s.histogram(a[:r.a], b[:r.b])
+		s.add(EQUAL, a[r.a:r.a+r.n])
+		s.histogram(a[r.a+r.n:], b[r.b+r.n:])
+	}
+	s.add(EQUAL, suffix)
+}
+
+// region is a run of n equal elements starting at a in the old sequence and b in the new.
+type region struct{ a, b, n int }
+
+// rarestRegion finds the common region whose rarest element occurs least often in a,
+// preferring the longer region on ties. Elements occurring more than maxChainLength
+// times never start a region.
+func rarestRegion[T comparable](a, b []T) (region, bool) {
+	occurrences := make(map[T][]int)
+	for i, x := range a {
+		occurrences[x] = append(occurrences[x], i)
+	}
+
+	best, bestCount := region{}, maxChainLength+1
+	for j := 0; j < len(b); {
+		occ := occurrences[b[j]]
+		if len(occ) == 0 || len(occ) > maxChainLength {
+			j++
+			continue
+		}
+		next := j + 1
+		for _, i := range occ {
+			as, bs := i, j
+			for as > 0 && bs > 0 && a[as-1] == b[bs-1] {
+				as--
+				bs--
+			}
+			ae, be := i+1, j+1
+			for ae < len(a) && be < len(b) && a[ae] == b[be] {
+				ae++
+				be++
+			}
+			count := maxChainLength + 1
+			for _, x := range a[as:ae] {
+				count = min(count, len(occurrences[x]))
+			}
+			if count < bestCount || (count == bestCount && ae-as > best.n) {
+				best, bestCount = region{as, bs, ae - as}, count
+			}
+			next = max(next, be)
+		}
+		j = next
+	}
+	return best, best.n > 0
+}
@@ -1,7 +1,8 @@
 // Package diff provides an implementation of the Myers diff algorithm.
 // It is designed to find the shortest edit script (a sequence of insertions
 // and deletions) to transform one sequence into another. This implementation
-// is generic and can work with slices of any comparable type.
+// is generic and can work with slices of any comparable type. The patience and
+// histogram algorithms, which build on it, are selected through Compute.
 package diff
 
 import (
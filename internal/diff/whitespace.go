@@ -0,0 +1,100 @@
+package diff
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Whitespace selects the whitespace differences Lines ignores when comparing lines.
+type Whitespace struct {
+	// IgnoreTrailing compares lines without their trailing whitespace, carriage returns
+	// included.
+	IgnoreTrailing bool
+	// IgnoreAll compares lines with all whitespace removed, so indentation with tabs
+	// equals indentation with spaces and "f(a, b)" equals "f(a,b)".
+	IgnoreAll bool
+	// IgnoreBlankLines ignores inserted and deleted lines that are empty or whitespace only.
+	IgnoreBlankLines bool
+}
+
+// Any reports whether any whitespace difference is ignored.
+func (w Whitespace) Any() bool {
+	return w.IgnoreTrailing || w.IgnoreAll || w.IgnoreBlankLines
+}
+
+// normalize returns the form of line that is compared.
+func (w Whitespace) normalize(line string) string {
+	if w.IgnoreAll {
+		return strings.Map(func(r rune) rune {
+			if unicode.IsSpace(r) {
+				return -1
+			}
+			return r
+		}, line)
+	}
+	if w.IgnoreTrailing {
+		return strings.TrimRightFunc(line, unicode.IsSpace)
+	}
+	return line
+}
+
+// Lines diffs two sequences of lines with alg, comparing them as ws says. The result holds
+// the original lines: lines that compare equal are taken from newLines, so the equal and
+// inserted lines still spell newLines. Ignored blank-line insertions are reported as
+// equal lines and ignored blank-line deletions are left out.
+func Lines(alg Algorithm, ws Whitespace, oldLines, newLines []string) []Diff[string] {
+	if !ws.Any() {
+		return Compute(alg, oldLines, newLines)
+	}
+
+	// Diff the normalized lines as small integers, then map the script back.
+	ids := make(map[string]int)
+	keys := func(lines []string) []int {
+		out := make([]int, len(lines))
+		for i, line := range lines {
+			key := ws.normalize(line)
+			id, ok := ids[key]
+			if !ok {
+				id = len(ids)
+				ids[key] = id
+			}
+			out[i] = id
+		}
+		return out
+	}
+	oldKeys, newKeys := keys(oldLines), keys(newLines)
+
+	var s script[string]
+	i, j := 0, 0
+	for _, d := range Compute(alg, oldKeys, newKeys) {
+		n := len(d.Text)
+		switch d.Operation {
+		case EQUAL:
+			s.add(EQUAL, newLines[j:j+n])
+			i, j = i+n, j+n
+		case DELETE:
+			if text := oldLines[i : i+n]; !ws.IgnoreBlankLines || !allBlank(text) {
+				s.add(DELETE, text)
+			}
+			i += n
+		case INSERT:
+			op := INSERT
+			if ws.IgnoreBlankLines && allBlank(newLines[j:j+n]) {
+				op = EQUAL
+			}
+			s.add(op, newLines[j:j+n])
+			j += n
+		}
+	}
+	return s.diffs
+}
+
+// allBlank reports whether every line is empty or whitespace only.
+func allBlank(lines []string) bool {
+	for _, line := range lines {
+		if strings.TrimSpace(line) != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -3,11 +3,20 @@ package models
 import "time"
 
 type Commit struct {
-	ID          string
-	Parent      string
-	Message     string
+	ID      string
+	Parent  string
+	Message string
+	// Timestamp is stored in UTC; see TimeZone for the author's local time.
 	Timestamp   time.Time
 	TreeHash    string
 	AuthorName  string
 	AuthorEmail string
+	// Signature is "ed25519 <public key> <signature>" for a signed commit, empty
+	// otherwise. It is not part of the ID.
+	Signature string `json:",omitempty"`
+	// TimeZone is the author's UTC offset when the commit was made, as "+0100", empty for
+	// commits that predate it. Like Signature, it is not part of the ID, so the same
+	// content committed at the same instant gets the same ID in every zone; a signature
+	// does cover it.
+	TimeZone string `json:",omitempty"`
 }
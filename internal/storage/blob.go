@@ -3,45 +3,80 @@ package storage
 import (
 	"crypto/sha1"
 	"encoding/hex"
+	"errors"
 	"io"
 	"os"
 	"path/filepath"
+	"runtime"
 )
 
-const (
-	objectsDir = ".kitcat/objects"
-)
+// MmapThreshold, when set, returns the size from which HashFile and HashAndStoreFile hash
+// a file through a read-only memory map instead of streaming it through a buffer, which
+// is faster for very large files on machines with memory to spare. 0 or less always
+// streams. The core package wires it to the core.mmapThreshold config key. Files smaller
+// than minMmapSize are always streamed, so it is only consulted for large files; so are
+// files that cannot be mapped, and every file on platforms without mmap.
+var MmapThreshold func() int64
+
+// minMmapSize is the smallest file worth mapping; below it the map setup costs more than
+// the copy it saves.
+const minMmapSize = 1 << 20
 
 // computeFileHash computes the SHA-1 hash of a file at the given path.
-// Returns the hash as a hexadecimal string and any error encountered.
-func computeFileHash(path string) (string, error) {
+// Returns the hash as a hexadecimal string, the number of bytes hashed and any error encountered.
+func computeFileHash(path string) (string, int64, error) {
 	f, err := os.Open(path)
 	if err != nil {
-		return "", err
+		return "", 0, err
 	}
 	defer f.Close()
 
+	if MmapThreshold != nil {
+		if info, err := f.Stat(); err == nil && info.Mode().IsRegular() && info.Size() >= minMmapSize {
+			if threshold := MmapThreshold(); threshold > 0 && info.Size() >= threshold {
+				if hash, ok := hashMapped(f, info.Size()); ok {
+					return hash, info.Size(), nil
+				}
+			}
+		}
+	}
+
 	h := sha1.New()
-	if _, err := io.Copy(h, f); err != nil {
-		return "", err
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
 	}
 
-	return hex.EncodeToString(h.Sum(nil)), nil
+	return hex.EncodeToString(h.Sum(nil)), n, nil
 }
 
+// HashAndStoreFile hashes the file at path and stores it as an object. Content that is
+// already stored is not written again: a loose object of the same size, or a packed one,
+// counts as present. A loose object of the wrong size (e.g. truncated by a crash) is rewritten.
+// New objects are synced to disk as ObjectDurability says.
 func HashAndStoreFile(path string) (string, error) {
-	hash, err := computeFileHash(path)
+	// The objects directory is written by streaming; other stores take the content whole.
+	if _, onDisk := objects.(DiskStore); !onDisk {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		return objects.Write(data)
+	}
+
+	hash, size, err := computeFileHash(path)
 	if err != nil {
 		return "", err
 	}
 
-	objPath := filepath.Join(objectsDir, hash)
+	dir := objectsDir()
+	objPath, _ := looseObjectPath(hash)
 	// ensure objects dir exists
-	if err := os.MkdirAll(objectsDir, 0o755); err != nil {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
 		return "", err
 	}
 
-	if _, err := os.Stat(objPath); os.IsNotExist(err) {
+	if !hasStoredObject(objPath, hash, size) {
 		// write via tmp file — read file again for storage
 		tmp := objPath + ".tmp"
 		f, err := os.Open(path)
@@ -60,23 +95,164 @@ func HashAndStoreFile(path string) (string, error) {
 			return "", err
 		}
 		f.Close()
-		out.Close()
-		if err := os.Rename(tmp, objPath); err != nil {
-			os.Remove(tmp)
+		if err := finishObjectFile(out, objPath); err != nil {
 			return "", err
 		}
 	}
 	return hash, nil
 }
 
-// Reads an object from the objects directory
+// WriteObject stores in-memory content as an object and returns its hash.
+// Existing objects are left untouched.
+func WriteObject(data []byte) (string, error) {
+	return objects.Write(data)
+}
+
+// ReadObject reads an object from the object store.
 func ReadObject(hash string) ([]byte, error) {
-	objectPath := filepath.Join(objectsDir, hash)
-	return os.ReadFile(objectPath)
+	return objects.Read(hash)
+}
+
+// ObjectSize returns the length of an object's content. Loose objects are only stat'ed,
+// so this is cheap for large blobs; stores that cannot tell the size otherwise read the
+// object.
+func ObjectSize(hash string) (int64, error) {
+	if s, ok := objects.(objectSizer); ok {
+		return s.Size(hash)
+	}
+	data, err := objects.Read(hash)
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(data)), nil
+}
+
+// ErrNotLinkable is returned by LinkObject for an object that has no loose copy to link to.
+var ErrNotLinkable = errors.New("object has no loose copy to link")
+
+// LinkObject makes dst a hard link to the loose object for hash, instead of a copy of its
+// content: loose objects hold the raw content, so the two are identical and share their
+// disk space. The object is made read-only first, and dst with it, so that the shared
+// content is not changed by accident; kitcat itself only ever replaces working-tree files.
+// Editing dst in place still needs write permission, which root has anyway.
+//
+// Objects that are packed or live in another ObjectStore, and Windows, where read-only
+// files cannot be replaced, yield ErrNotLinkable; a failed link (e.g. across filesystems)
+// returns its error. Either way dst is left as it was and the caller writes it instead.
+func LinkObject(hash, dst string) error {
+	if _, onDisk := objects.(DiskStore); !onDisk || runtime.GOOS == "windows" {
+		return ErrNotLinkable
+	}
+	objPath, _ := looseObjectPath(hash)
+	info, err := os.Lstat(objPath)
+	if err != nil || !info.Mode().IsRegular() {
+		return ErrNotLinkable
+	}
+	if dstInfo, err := os.Lstat(dst); err == nil && os.SameFile(info, dstInfo) {
+		return nil // already linked
+	}
+	if info.Mode().Perm()&0o222 != 0 {
+		if err := os.Chmod(objPath, 0o444); err != nil {
+			return err
+		}
+	}
+	// Link under a temporary name and rename, so an existing dst is replaced atomically.
+	tmp := dst + ".link.tmp"
+	os.Remove(tmp)
+	if err := os.Link(objPath, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// HasObject reports whether an object is stored.
+func HasObject(hash string) bool {
+	return objects.Has(hash)
+}
+
+// writeDiskObject stores data as a loose object. A loose object of the same size is reused;
+// one of the wrong size (e.g. truncated by a crash) is rewritten.
+func writeDiskObject(data []byte) (string, error) {
+	sum := sha1.Sum(data)
+	hash := hex.EncodeToString(sum[:])
+	objPath, _ := looseObjectPath(hash)
+	if hasStoredObject(objPath, hash, int64(len(data))) {
+		return hash, nil
+	}
+	if err := os.MkdirAll(objectsDir(), 0o755); err != nil {
+		return "", err
+	}
+	out, err := os.Create(objPath + ".tmp")
+	if err != nil {
+		return "", err
+	}
+	if _, err := out.Write(data); err != nil {
+		out.Close()
+		os.Remove(out.Name())
+		return "", err
+	}
+	if err := finishObjectFile(out, objPath); err != nil {
+		return "", err
+	}
+	return hash, nil
+}
+
+// Reads an object from the objects directory, falling back to packs
+// when no loose copy exists. Truncated names (see ObjectNameLength) are searched last, as
+// the search reads the config and hashes the candidates.
+func readDiskObject(hash string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(objectsDir(), hash))
+	if err == nil || !os.IsNotExist(err) {
+		return data, err
+	}
+	if packed, packErr := readPackedObject(hash); packErr == nil {
+		return packed, nil
+	} else if !errors.Is(packErr, os.ErrNotExist) {
+		return nil, packErr
+	}
+	if path, ok := looseObjectPath(hash); ok {
+		return os.ReadFile(path)
+	}
+	return nil, err
+}
+
+// hasStoredObject reports whether the object for hash, loose at objPath, can be reused as is. Loose objects
+// hold the raw content, so their size must match.
+func hasStoredObject(objPath, hash string, size int64) bool {
+	info, err := os.Stat(objPath)
+	if err == nil {
+		return info.Size() == size
+	}
+	return hasDiskObject(hash)
+}
+
+// hasDiskObject reports whether an object is stored in the objects directory, either loose or in a pack
+func hasDiskObject(hash string) bool {
+	if _, err := os.Stat(filepath.Join(objectsDir(), hash)); err == nil {
+		return true
+	}
+	raw, err := hex.DecodeString(hash)
+	if err != nil || len(raw) != 20 {
+		return false
+	}
+	if indexes, err := loadPackIndexes(); err == nil {
+		for _, idx := range indexes {
+			if _, ok := idx.find(raw); ok {
+				return true
+			}
+		}
+	}
+	_, ok := looseObjectPath(hash)
+	return ok
 }
 
 // Computes the SHA-1 hash of a file's content
 // does not store the file in the object database
 func HashFile(path string) (string, error) {
-	return computeFileHash(path)
+	hash, _, err := computeFileHash(path)
+	return hash, err
 }
@@ -0,0 +1,38 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// benchmarkHashFile hashes a 256 MiB file, through a memory map when mmap is set.
+func benchmarkHashFile(b *testing.B, mmap bool) {
+	defer func(prev func() int64) { MmapThreshold = prev }(MmapThreshold)
+	MmapThreshold = func() int64 {
+		if mmap {
+			return minMmapSize
+		}
+		return 0
+	}
+
+	path := filepath.Join(b.TempDir(), "large.bin")
+	data := make([]byte, 256<<20)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		b.Fatal(err)
+	}
+
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := HashFile(path); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkHashFile_Streaming(b *testing.B) { benchmarkHashFile(b, false) }
+func BenchmarkHashFile_Mmap(b *testing.B)      { benchmarkHashFile(b, true) }
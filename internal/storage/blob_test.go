@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHashAndStoreFile_SkipsExistingObject(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalWd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(originalWd)
+	}()
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatal(err)
+	}
+
+	content := []byte("shared content\n")
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := os.WriteFile(name, content, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hash, err := HashAndStoreFile("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	objPath := filepath.Join(objectsDir(), hash)
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(objPath, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	// Identical content: same hash, object left untouched.
+	again, err := HashAndStoreFile("b.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != hash {
+		t.Fatalf("hash = %s, want %s", again, hash)
+	}
+	if info, err := os.Stat(objPath); err != nil || !info.ModTime().Equal(old) {
+		t.Errorf("existing object was rewritten (info=%v, err=%v)", info, err)
+	}
+
+	// A truncated loose object has the wrong size and is replaced.
+	if err := os.WriteFile(objPath, content[:4], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := HashAndStoreFile("b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ReadObject(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != string(content) {
+		t.Errorf("object content = %q, want %q", data, content)
+	}
+}
+
+func TestLinkObject_NeedsLooseObject(t *testing.T) {
+	originalWd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(originalWd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := LinkObject("0123456789012345678901234567890123456789", "missing.txt"); !errors.Is(err, ErrNotLinkable) {
+		t.Errorf("LinkObject(missing) = %v, want ErrNotLinkable", err)
+	}
+	restore := UseObjectStore(NewMemStore())
+	defer restore()
+	hash, err := WriteObject([]byte("in memory"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := LinkObject(hash, "mem.txt"); !errors.Is(err, ErrNotLinkable) {
+		t.Errorf("LinkObject(MemStore) = %v, want ErrNotLinkable", err)
+	}
+	if _, err := os.Stat("mem.txt"); !os.IsNotExist(err) {
+		t.Errorf("destination was created: %v", err)
+	}
+}
+
+func TestHashFile_MmapMatchesStreaming(t *testing.T) {
+	defer func(prev func() int64) { MmapThreshold = prev }(MmapThreshold)
+	path := filepath.Join(t.TempDir(), "large.bin")
+	data := make([]byte, 3*minMmapSize+17)
+	for i := range data {
+		data[i] = byte(i * 31)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	MmapThreshold = nil
+	streamed, size, err := computeFileHash(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	MmapThreshold = func() int64 { return minMmapSize }
+	mapped, mappedSize, err := computeFileHash(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mapped != streamed || mappedSize != size || size != int64(len(data)) {
+		t.Errorf("mmap hash = %s (%d bytes), streamed = %s (%d bytes)", mapped, mappedSize, streamed, size)
+	}
+	if _, ok := hashMapped(nil, 0); ok {
+		t.Error("an empty file was mapped")
+	}
+}
@@ -13,15 +13,26 @@ import (
 
 var ErrNoCommits = errors.New("no commits yet")
 
-const commitsPath = ".kitcat/commits.log"
-
-// Appends commit as NDJSON
+// Appends commit as NDJSON and brings the commit graph up to date.
+// The graph is only a cache, so failing to update it does not fail the commit.
 func AppendCommit(commit models.Commit) error {
-	if err := os.MkdirAll(".kitcat", 0o755); err != nil {
+	if err := appendCommitRecord(commit); err != nil {
+		return err
+	}
+	_ = UpdateCommitGraph()
+	return nil
+}
+
+func appendCommitRecord(commit models.Commit) error {
+	// The commit's tree must be durable before the commit is
+	if err := SyncObjects(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(RepoDir(), 0o755); err != nil {
 		return err
 	}
 
-	f, err := os.OpenFile(commitsPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	f, err := os.OpenFile(commitsPath(), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
 	if err != nil {
 		return err
 	}
@@ -43,11 +54,11 @@ func AppendCommit(commit models.Commit) error {
 // Reads commits (NDJSON)
 func ReadCommits() ([]models.Commit, error) {
 	var commits []models.Commit
-	if _, err := os.Stat(commitsPath); os.IsNotExist(err) {
+	if _, err := os.Stat(commitsPath()); os.IsNotExist(err) {
 		return commits, nil
 	}
 
-	f, err := os.Open(commitsPath)
+	f, err := os.Open(commitsPath())
 	if err != nil {
 		return nil, err
 	}
@@ -79,7 +90,7 @@ func GetLastCommit() (models.Commit, error) {
 // Search the commit log for a commit with a matching hash
 // Supports both full hashes and short hashes (prefix matching)
 func FindCommit(hash string) (models.Commit, error) {
-	file, err := os.Open(commitsPath)
+	file, err := os.Open(commitsPath())
 	if err != nil {
 		if os.IsNotExist(err) {
 			return models.Commit{}, ErrNoCommits
@@ -126,7 +137,8 @@ func FindCommit(hash string) (models.Commit, error) {
 	return models.Commit{}, fmt.Errorf("commit with hash %s not found", hash)
 }
 
-// IsAncestor returns true if ancestorHash is equal to or is an ancestor of descendantHash
+// IsAncestor returns true if ancestorHash is equal to or is an ancestor of descendantHash.
+// With a commit graph, branches whose generation drops below the ancestor's are pruned.
 func IsAncestor(ancestorHash, descendantHash string) (bool, error) {
 	if ancestorHash == "" || descendantHash == "" {
 		return false, nil
@@ -136,52 +148,51 @@ func IsAncestor(ancestorHash, descendantHash string) (bool, error) {
 		return true, nil
 	}
 
-	current := descendantHash
-	for current != "" {
-		c, err := FindCommit(current)
-		if err != nil {
-			return false, err
+	graph, err := LoadCommitGraph()
+	if err != nil {
+		return false, err
+	}
+	var minGen uint32
+	if graph != nil {
+		if n, ok := graph.Node(ancestorHash); ok {
+			minGen = n.Generation
 		}
-		if c.ID == ancestorHash {
+	}
+
+	seen := make(map[string]bool)
+	queue := []string{descendantHash}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		if current == ancestorHash {
 			return true, nil
 		}
+		if seen[current] {
+			continue
+		}
+		seen[current] = true
+		if graph != nil && minGen > 0 {
+			if n, ok := graph.Node(current); ok && n.Generation <= minGen {
+				continue
+			}
+		}
 		// walk up
-		current = c.Parent
+		parents, err := commitParents(graph, current)
+		if err != nil {
+			return false, err
+		}
+		queue = append(queue, parents...)
 	}
 	return false, nil
 }
 
 // FindMergeBase calculates the best common ancestor between two commits.
-// Uses a simple ancestry path intersection (assumes linear/simple branching for now).
+// When history has several equally good bases (criss-cross merges) the one with the
+// highest generation is returned; use MergeBase to get all of them.
 func FindMergeBase(hash1, hash2 string) (string, error) {
-	if hash1 == hash2 {
-		return hash1, nil
-	}
-
-	// Trace ancestry of hash1
-	ancestors1 := make(map[string]bool)
-	current := hash1
-	for current != "" {
-		ancestors1[current] = true
-		c, err := FindCommit(current)
-		if err != nil {
-			return "", err
-		}
-		current = c.Parent
-	}
-
-	// Trace ancestry of hash2 and find first match
-	current = hash2
-	for current != "" {
-		if ancestors1[current] {
-			return current, nil
-		}
-		c, err := FindCommit(current)
-		if err != nil {
-			return "", err
-		}
-		current = c.Parent
+	bases, err := MergeBase(hash1, hash2)
+	if err != nil {
+		return "", err
 	}
-
-	return "", fmt.Errorf("no common ancestor found")
+	return bases[0], nil
 }
@@ -0,0 +1,293 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/LeeFred3042U/kitcat/internal/models"
+)
+
+const (
+	commitGraphHeader  = "kitcat-commit-graph"
+	commitGraphVersion = 1
+)
+
+// GraphNode is the cached ancestry information for a single commit.
+type GraphNode struct {
+	Parents []string
+	// Generation is 1 for root commits and 1 + the maximum parent generation otherwise,
+	// so a commit can never be an ancestor of one with a lower generation.
+	Generation uint32
+	// Offset is the byte offset of the commit's record in commits.log.
+	Offset int64
+}
+
+// CommitGraph caches parents and generation numbers for every commit in commits.log,
+// letting history walks skip scanning the log for each step.
+type CommitGraph struct {
+	// logSize is the length of commits.log covered by the graph; a different size means stale.
+	logSize int64
+	nodes   map[string]GraphNode
+}
+
+// Node returns the cached entry for a full commit hash.
+func (g *CommitGraph) Node(id string) (GraphNode, bool) {
+	n, ok := g.nodes[id]
+	return n, ok
+}
+
+// Len returns the number of commits in the graph.
+func (g *CommitGraph) Len() int {
+	return len(g.nodes)
+}
+
+// Cache of the parsed graph, keyed by absolute path and invalidated on size/mtime change.
+var (
+	graphCacheMu sync.Mutex
+	graphCache   = make(map[string]cachedCommitGraph)
+)
+
+type cachedCommitGraph struct {
+	size    int64
+	modTime int64
+	graph   *CommitGraph
+}
+
+// LoadCommitGraph returns the commit graph if it exists and covers the whole commit log.
+// It returns nil (and no error) when the graph is missing or stale, so callers fall back
+// to reading commits directly.
+func LoadCommitGraph() (*CommitGraph, error) {
+	logInfo, err := os.Stat(commitsPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	g, err := readCommitGraphCached()
+	if err != nil || g == nil || g.logSize != logInfo.Size() {
+		return nil, nil
+	}
+	return g, nil
+}
+
+func readCommitGraphCached() (*CommitGraph, error) {
+	absPath, err := filepath.Abs(commitGraphPath())
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(absPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	graphCacheMu.Lock()
+	defer graphCacheMu.Unlock()
+
+	if cached, ok := graphCache[absPath]; ok &&
+		cached.size == info.Size() && cached.modTime == info.ModTime().UnixNano() {
+		return cached.graph, nil
+	}
+	g, err := readCommitGraph(absPath)
+	if err != nil {
+		return nil, err
+	}
+	graphCache[absPath] = cachedCommitGraph{size: info.Size(), modTime: info.ModTime().UnixNano(), graph: g}
+	return g, nil
+}
+
+// readCommitGraph parses the text graph file: a header line followed by one
+// "<id> <generation> <offset> <parent,parent|->" line per commit.
+func readCommitGraph(path string) (*CommitGraph, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	if !scanner.Scan() {
+		return nil, fmt.Errorf("corrupt commit graph: missing header")
+	}
+	header := strings.Fields(scanner.Text())
+	if len(header) != 3 || header[0] != commitGraphHeader || header[1] != strconv.Itoa(commitGraphVersion) {
+		return nil, fmt.Errorf("corrupt commit graph: bad header")
+	}
+	logSize, err := strconv.ParseInt(header[2], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("corrupt commit graph: %w", err)
+	}
+
+	g := &CommitGraph{logSize: logSize, nodes: make(map[string]GraphNode)}
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("corrupt commit graph line: %q", scanner.Text())
+		}
+		gen, err := strconv.ParseUint(fields[1], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("corrupt commit graph: %w", err)
+		}
+		offset, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("corrupt commit graph: %w", err)
+		}
+		var parents []string
+		if fields[3] != "-" {
+			parents = strings.Split(fields[3], ",")
+		}
+		g.nodes[fields[0]] = GraphNode{Parents: parents, Generation: uint32(gen), Offset: offset}
+	}
+	return g, scanner.Err()
+}
+
+// UpdateCommitGraph brings the commit graph up to date with commits.log. Because the log
+// is append-only, only records past the previously covered size are read; a graph that is
+// corrupt or claims more than the log holds is rebuilt from scratch.
+func UpdateCommitGraph() error {
+	logInfo, err := os.Stat(commitsPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	g, err := readCommitGraphCached()
+	if err != nil || g == nil || g.logSize > logInfo.Size() {
+		g = &CommitGraph{nodes: make(map[string]GraphNode)}
+	}
+	if g.logSize == logInfo.Size() {
+		return nil
+	}
+
+	f, err := os.Open(commitsPath())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Seek(g.logSize, io.SeekStart); err != nil {
+		return err
+	}
+
+	// Copy so a concurrently cached graph is never mutated in place.
+	updated := &CommitGraph{logSize: g.logSize, nodes: make(map[string]GraphNode, len(g.nodes))}
+	for id, n := range g.nodes {
+		updated.nodes[id] = n
+	}
+
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// A trailing partial record is still being written; cover it next time.
+			break
+		}
+		if err != nil {
+			return err
+		}
+		offset := updated.logSize
+		updated.logSize += int64(len(line))
+
+		var c models.Commit
+		if json.Unmarshal(line, &c) != nil || c.ID == "" {
+			continue
+		}
+		node := GraphNode{Generation: 1, Offset: offset}
+		if c.Parent != "" {
+			node.Parents = []string{c.Parent}
+			if parent, ok := updated.nodes[c.Parent]; ok {
+				node.Generation = parent.Generation + 1
+			}
+		}
+		updated.nodes[c.ID] = node
+	}
+
+	return writeCommitGraph(updated)
+}
+
+func writeCommitGraph(g *CommitGraph) error {
+	// Parents always precede children in the log, so emitting in offset order lets a
+	// reader verify generations in one pass.
+	ids := make([]string, 0, len(g.nodes))
+	for id := range g.nodes {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return g.nodes[ids[i]].Offset < g.nodes[ids[j]].Offset })
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %d %d\n", commitGraphHeader, commitGraphVersion, g.logSize)
+	for _, id := range ids {
+		n := g.nodes[id]
+		parents := "-"
+		if len(n.Parents) > 0 {
+			parents = strings.Join(n.Parents, ",")
+		}
+		fmt.Fprintf(&b, "%s %d %d %s\n", id, n.Generation, n.Offset, parents)
+	}
+	return SafeWriteFile(commitGraphPath(), []byte(b.String()), 0o644)
+}
+
+// readCommitAt decodes the single commits.log record starting at offset.
+func readCommitAt(offset int64) (models.Commit, error) {
+	f, err := os.Open(commitsPath())
+	if err != nil {
+		return models.Commit{}, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return models.Commit{}, err
+	}
+	line, err := bufio.NewReader(f).ReadBytes('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return models.Commit{}, err
+	}
+	var c models.Commit
+	if err := json.Unmarshal(line, &c); err != nil {
+		return models.Commit{}, err
+	}
+	return c, nil
+}
+
+// LookupCommit returns the commit with the given full hash, reading its record directly
+// through the commit graph when one is available and falling back to FindCommit otherwise.
+func LookupCommit(id string) (models.Commit, error) {
+	if g, _ := LoadCommitGraph(); g != nil {
+		if n, ok := g.nodes[id]; ok {
+			if c, err := readCommitAt(n.Offset); err == nil && c.ID == id {
+				return c, nil
+			}
+		}
+	}
+	return FindCommit(id)
+}
+
+// commitParents returns the parents of a full commit hash, preferring the graph.
+func commitParents(g *CommitGraph, id string) ([]string, error) {
+	if g != nil {
+		if n, ok := g.nodes[id]; ok {
+			return n.Parents, nil
+		}
+	}
+	c, err := FindCommit(id)
+	if err != nil {
+		return nil, err
+	}
+	if c.Parent == "" {
+		return nil, nil
+	}
+	return []string{c.Parent}, nil
+}
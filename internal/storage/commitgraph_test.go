@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/LeeFred3042U/kitcat/internal/models"
+)
+
+func TestCommitGraph_IncrementalAndStale(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalWd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(originalWd)
+	}()
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatal(err)
+	}
+
+	ids := []string{"a1", "b2", "c3"}
+	parent := ""
+	for i, id := range ids {
+		c := models.Commit{ID: id, Parent: parent, Message: id, Timestamp: time.Unix(int64(i), 0).UTC()}
+		if err := AppendCommit(c); err != nil {
+			t.Fatal(err)
+		}
+		parent = id
+	}
+
+	graph, err := LoadCommitGraph()
+	if err != nil || graph == nil {
+		t.Fatalf("expected a fresh graph, got %v, %v", graph, err)
+	}
+	for i, id := range ids {
+		n, ok := graph.Node(id)
+		if !ok || n.Generation != uint32(i+1) {
+			t.Errorf("node %s = %+v, want generation %d", id, n, i+1)
+		}
+	}
+
+	c, err := LookupCommit("b2")
+	if err != nil || c.Parent != "a1" {
+		t.Errorf("LookupCommit(b2) = %+v, %v", c, err)
+	}
+	if ok, err := IsAncestor("a1", "c3"); err != nil || !ok {
+		t.Errorf("IsAncestor(a1, c3) = %v, %v", ok, err)
+	}
+	if ok, err := IsAncestor("c3", "a1"); err != nil || ok {
+		t.Errorf("IsAncestor(c3, a1) = %v, %v", ok, err)
+	}
+
+	// Appending behind the graph's back makes it stale; lookups still work.
+	if err := appendCommitRecord(models.Commit{ID: "d4", Parent: "c3"}); err != nil {
+		t.Fatal(err)
+	}
+	if graph, _ := LoadCommitGraph(); graph != nil {
+		t.Error("expected stale graph to be ignored")
+	}
+	if ok, err := IsAncestor("a1", "d4"); err != nil || !ok {
+		t.Errorf("IsAncestor(a1, d4) with stale graph = %v, %v", ok, err)
+	}
+
+	if err := UpdateCommitGraph(); err != nil {
+		t.Fatal(err)
+	}
+	graph, _ = LoadCommitGraph()
+	if graph == nil || graph.Len() != 4 {
+		t.Fatalf("expected graph with 4 commits after update, got %v", graph)
+	}
+	if n, _ := graph.Node("d4"); n.Generation != 4 {
+		t.Errorf("d4 generation = %d, want 4", n.Generation)
+	}
+}
+
+func TestMergeBase_ForkWithAndWithoutGraph(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalWd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(originalWd)
+	}()
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatal(err)
+	}
+
+	// root <- base <- left1 <- left2
+	//              \- right1
+	for _, c := range []models.Commit{
+		{ID: "root"},
+		{ID: "base", Parent: "root"},
+		{ID: "left1", Parent: "base"},
+		{ID: "right1", Parent: "base"},
+		{ID: "left2", Parent: "left1"},
+	} {
+		if err := AppendCommit(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	check := func(label string) {
+		t.Helper()
+		bases, err := MergeBase("left2", "right1")
+		if err != nil {
+			t.Fatalf("%s: MergeBase failed: %v", label, err)
+		}
+		if len(bases) != 1 || bases[0] != "base" {
+			t.Errorf("%s: MergeBase = %v, want [base]", label, bases)
+		}
+	}
+	check("with graph")
+
+	if err := os.Remove(commitGraphPath()); err != nil {
+		t.Fatal(err)
+	}
+	check("without graph")
+}
+
+func TestMergeBaseByGeneration_CrissCross(t *testing.T) {
+	// Two branches that merged each other: both x and y are best common ancestors of a and b.
+	//   r <- x <- a(x,y)
+	//   r <- y <- b(y,x)
+	g := &CommitGraph{nodes: map[string]GraphNode{
+		"r": {Generation: 1},
+		"x": {Parents: []string{"r"}, Generation: 2},
+		"y": {Parents: []string{"r"}, Generation: 2},
+		"a": {Parents: []string{"x", "y"}, Generation: 3},
+		"b": {Parents: []string{"y", "x"}, Generation: 3},
+	}}
+
+	bases := mergeBaseByGeneration(g, "a", "b")
+	got := map[string]bool{}
+	for _, id := range bases {
+		got[id] = true
+	}
+	if len(bases) != 2 || !got["x"] || !got["y"] {
+		t.Errorf("criss-cross merge bases = %v, want x and y", bases)
+	}
+}
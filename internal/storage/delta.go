@@ -0,0 +1,168 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// deltaBlockSize is the window used to find matching regions between a base
+// object and its target. Smaller windows find more matches but cost more memory.
+const deltaBlockSize = 16
+
+// Limits imposed by the copy instruction encoding (4 offset bytes, 3 size bytes).
+const (
+	maxCopySize   = 0xffffff
+	maxInsertSize = 0x7f
+)
+
+var errBadDelta = errors.New("corrupt delta")
+
+// computeDelta encodes target as a sequence of copy/insert instructions against base.
+// The format mirrors git's: a header with both sizes as uvarints, followed by
+// instructions. A copy instruction starts with a byte whose high bit is set and
+// whose low 7 bits flag which offset/size bytes follow; an insert instruction is a
+// length byte (1..127) followed by that many literal bytes.
+func computeDelta(base, target []byte) []byte {
+	var out bytes.Buffer
+	out.Write(binary.AppendUvarint(nil, uint64(len(base))))
+	out.Write(binary.AppendUvarint(nil, uint64(len(target))))
+
+	// Index every block-aligned window of the base by content.
+	blocks := make(map[string][]int)
+	for i := 0; i+deltaBlockSize <= len(base); i += deltaBlockSize {
+		key := string(base[i : i+deltaBlockSize])
+		blocks[key] = append(blocks[key], i)
+	}
+
+	var pending []byte
+	flushInsert := func() {
+		for len(pending) > 0 {
+			n := min(len(pending), maxInsertSize)
+			out.WriteByte(byte(n))
+			out.Write(pending[:n])
+			pending = pending[n:]
+		}
+		pending = nil
+	}
+
+	pos := 0
+	for pos < len(target) {
+		bestOff, bestLen := 0, 0
+		if pos+deltaBlockSize <= len(target) {
+			for _, off := range blocks[string(target[pos:pos+deltaBlockSize])] {
+				n := 0
+				for off+n < len(base) && pos+n < len(target) && base[off+n] == target[pos+n] {
+					n++
+				}
+				if n > bestLen {
+					bestOff, bestLen = off, n
+				}
+			}
+		}
+
+		if bestLen < deltaBlockSize {
+			pending = append(pending, target[pos])
+			pos++
+			continue
+		}
+
+		flushInsert()
+		for remaining, off := bestLen, bestOff; remaining > 0; {
+			n := min(remaining, maxCopySize)
+			writeCopy(&out, off, n)
+			off += n
+			remaining -= n
+		}
+		pos += bestLen
+	}
+	flushInsert()
+
+	return out.Bytes()
+}
+
+// writeCopy emits a single copy instruction, omitting zero bytes of offset and size.
+func writeCopy(out *bytes.Buffer, offset, size int) {
+	var args []byte
+	cmd := byte(0x80)
+	for i := 0; i < 4; i++ {
+		if b := byte(offset >> (8 * i)); b != 0 {
+			cmd |= 1 << i
+			args = append(args, b)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if b := byte(size >> (8 * i)); b != 0 {
+			cmd |= 1 << (4 + i)
+			args = append(args, b)
+		}
+	}
+	out.WriteByte(cmd)
+	out.Write(args)
+}
+
+// applyDelta reconstructs the target content from base and a delta produced by computeDelta.
+func applyDelta(base, delta []byte) ([]byte, error) {
+	baseSize, n := binary.Uvarint(delta)
+	if n <= 0 {
+		return nil, errBadDelta
+	}
+	delta = delta[n:]
+	targetSize, n := binary.Uvarint(delta)
+	if n <= 0 {
+		return nil, errBadDelta
+	}
+	delta = delta[n:]
+
+	if baseSize != uint64(len(base)) {
+		return nil, fmt.Errorf("%w: base size %d, expected %d", errBadDelta, len(base), baseSize)
+	}
+
+	out := make([]byte, 0, targetSize)
+	for len(delta) > 0 {
+		cmd := delta[0]
+		delta = delta[1:]
+
+		if cmd&0x80 == 0 {
+			// Insert literal bytes.
+			size := int(cmd)
+			if size == 0 || size > len(delta) {
+				return nil, errBadDelta
+			}
+			out = append(out, delta[:size]...)
+			delta = delta[size:]
+			continue
+		}
+
+		// Copy from base.
+		var offset, size int
+		for i := 0; i < 4; i++ {
+			if cmd&(1<<i) != 0 {
+				if len(delta) == 0 {
+					return nil, errBadDelta
+				}
+				offset |= int(delta[0]) << (8 * i)
+				delta = delta[1:]
+			}
+		}
+		for i := 0; i < 3; i++ {
+			if cmd&(1<<(4+i)) != 0 {
+				if len(delta) == 0 {
+					return nil, errBadDelta
+				}
+				size |= int(delta[0]) << (8 * i)
+				delta = delta[1:]
+			}
+		}
+		if size == 0 || offset+size > len(base) {
+			return nil, errBadDelta
+		}
+		out = append(out, base[offset:offset+size]...)
+	}
+
+	if uint64(len(out)) != targetSize {
+		return nil, fmt.Errorf("%w: produced %d bytes, expected %d", errBadDelta, len(out), targetSize)
+	}
+	return out, nil
+}
@@ -0,0 +1,19 @@
+//go:build !linux && !darwin && !freebsd
+
+package storage
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// fileDevice identifies the filesystem path is on. Without a device number in stat, the
+// volume name stands in for it: a drive letter or UNC share on Windows. Volumes mounted
+// into a directory are not told apart; the rename itself catches those.
+func fileDevice(path string) (dev string, ok bool) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", false
+	}
+	return strings.ToLower(filepath.VolumeName(abs)), true
+}
@@ -0,0 +1,23 @@
+//go:build linux || darwin || freebsd
+
+package storage
+
+import (
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// fileDevice identifies the filesystem path is on: the device number from stat. ok is
+// false when path cannot be examined.
+func fileDevice(path string) (dev string, ok bool) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", false
+	}
+	st, isStat := info.Sys().(*syscall.Stat_t)
+	if !isStat {
+		return "", false
+	}
+	return strconv.FormatUint(uint64(st.Dev), 10), true
+}
@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// DirCache remembers directory mtimes from the last `add --all` so directories that have
+// not changed since need not be read again. It is only a cache: a missing or unreadable
+// file simply means every directory is read.
+type DirCache struct {
+	// Key identifies the state the cache was built for (ignore rules, add options and the
+	// set of indexed paths); a cache with a different key must not be used.
+	Key  string                   `json:"key"`
+	Dirs map[string]DirCacheEntry `json:"dirs"`
+}
+
+// DirCacheEntry is one directory, keyed by its repo-relative forward-slash path.
+type DirCacheEntry struct {
+	ModTime int64    `json:"m,omitempty"` // UnixNano; 0 when the directory must always be read
+	Subdirs []string `json:"d,omitempty"` // names of the directory's subdirectories
+}
+
+// LoadDirCache reads the directory cache. A missing or corrupt file yields an empty cache.
+func LoadDirCache() DirCache {
+	cache := DirCache{Dirs: map[string]DirCacheEntry{}}
+	data, err := os.ReadFile(dirCachePath())
+	if err != nil {
+		return cache
+	}
+	var loaded DirCache
+	if err := json.Unmarshal(data, &loaded); err != nil || loaded.Dirs == nil {
+		return cache
+	}
+	return loaded
+}
+
+// WriteDirCache replaces the directory cache atomically.
+func WriteDirCache(cache DirCache) error {
+	data, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+	return SafeWriteFile(dirCachePath(), data, 0o644)
+}
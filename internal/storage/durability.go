@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Object durability modes; see ObjectDurability.
+const (
+	// DurabilityFull syncs every object to disk as it is written, and the objects directory
+	// after its rename. A crash never loses an object that was reported written, at the
+	// cost of one or two fsyncs per object, which dominates a large add.
+	DurabilityFull = "full"
+	// DurabilityBatched writes objects without syncing them and syncs them all at once
+	// before the next index write or commit that can refer to them. A crash can lose or
+	// truncate objects written since the last sync, but nothing on disk refers to them
+	// yet: the index and the commit log are only written after the sync. Truncated objects
+	// are rewritten by the next add of the same content, since a loose object of the wrong
+	// size counts as missing. This is the default.
+	DurabilityBatched = "batched"
+	// DurabilityNone never syncs objects and leaves flushing them to the operating system,
+	// the fastest mode. A crash, or power loss, shortly after an add or commit can leave
+	// the index or a commit referring to objects that are lost or empty on disk, which
+	// kitcat verify-objects reports; use it only for scratch repositories or on storage
+	// that survives crashes, such as a battery-backed disk.
+	DurabilityNone = "none"
+)
+
+// ObjectDurability, when set, returns how loose objects are synced to disk: DurabilityFull,
+// DurabilityBatched or DurabilityNone; anything else, or a nil hook, means batched. It is
+// consulted once per operation holding a RepoLock (see objectSettings), otherwise once per
+// object actually written. The core package wires it to the core.objectDurability config
+// key. Index, commit log and ref writes are always synced.
+var ObjectDurability func() string
+
+// resolveObjectDurability returns the configured durability mode.
+func resolveObjectDurability() string {
+	if ObjectDurability == nil {
+		return DurabilityBatched
+	}
+	switch mode := ObjectDurability(); mode {
+	case DurabilityFull, DurabilityNone:
+		return mode
+	}
+	return DurabilityBatched
+}
+
+// unsyncedObjects are the loose objects written in batched mode and not synced yet.
+var unsyncedObjects struct {
+	sync.Mutex
+	paths []string
+}
+
+// maxUnsyncedObjects bounds unsyncedObjects: objects written without an index write or
+// commit following, as by a long-running watch whose adds keep failing, are synced once
+// this many are queued rather than piling up.
+var maxUnsyncedObjects = 4096
+
+// finishObjectFile completes writing a loose object: out, an open temporary file holding the
+// content, is synced as the durability mode says, closed and renamed to objPath. The
+// temporary file is removed on failure.
+func finishObjectFile(out *os.File, objPath string) error {
+	tmp := out.Name()
+	mode := currentObjectSettings().durabilityMode()
+	var syncErr error
+	if mode == DurabilityFull {
+		syncErr = out.Sync()
+	}
+	if err := errors.Join(syncErr, out.Close()); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, objPath); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	switch mode {
+	case DurabilityFull:
+		_ = syncDir(filepath.Dir(objPath))
+	case DurabilityBatched:
+		unsyncedObjects.Lock()
+		unsyncedObjects.paths = append(unsyncedObjects.paths, objPath)
+		full := len(unsyncedObjects.paths) >= maxUnsyncedObjects
+		unsyncedObjects.Unlock()
+		if full {
+			return SyncObjects()
+		}
+	}
+	return nil
+}
+
+// SyncObjects syncs the objects written in batched mode since the last call, and their
+// directory, so that they are durable before anything refers to them. Index writes and
+// commits call it first; others that store objects and then publish them by other means
+// should too. Objects that have since been removed, e.g. pruned, are skipped.
+func SyncObjects() error {
+	unsyncedObjects.Lock()
+	paths := unsyncedObjects.paths
+	unsyncedObjects.paths = nil
+	unsyncedObjects.Unlock()
+
+	dirs := make(map[string]bool)
+	for i, path := range paths {
+		// Writable, as Windows cannot flush a file opened read-only
+		f, err := os.OpenFile(path, os.O_RDWR, 0)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err == nil {
+			err = errors.Join(f.Sync(), f.Close())
+		}
+		if err != nil {
+			// Keep the rest for the next call rather than dropping them unsynced
+			unsyncedObjects.Lock()
+			unsyncedObjects.paths = append(unsyncedObjects.paths, paths[i:]...)
+			unsyncedObjects.Unlock()
+			return err
+		}
+		dirs[filepath.Dir(path)] = true
+	}
+	for dir := range dirs {
+		_ = syncDir(dir)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestObjectDurability_BatchedSyncsBeforeIndexWrite(t *testing.T) {
+	originalWd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(originalWd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := SyncObjects(); err != nil {
+		t.Fatal(err)
+	}
+
+	prev := ObjectDurability
+	defer func() { ObjectDurability = prev }()
+	unsynced := func() int {
+		unsyncedObjects.Lock()
+		defer unsyncedObjects.Unlock()
+		return len(unsyncedObjects.paths)
+	}
+
+	for i, mode := range []string{DurabilityFull, DurabilityNone, DurabilityBatched, "bogus"} {
+		ObjectDurability = func() string { return mode }
+		if _, err := WriteObject([]byte(fmt.Sprintf("object %d\n", i))); err != nil {
+			t.Fatal(err)
+		}
+		want := 0
+		if mode == DurabilityBatched || mode == "bogus" {
+			want = 1
+		}
+		if got := unsynced(); got != want {
+			t.Errorf("%s: %d objects awaiting sync, want %d", mode, got, want)
+		}
+		if err := SyncObjects(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Staging an object in batched mode syncs it when the index is written.
+	ObjectDurability = func() string { return DurabilityBatched }
+	if err := os.WriteFile("a.txt", []byte("staged\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := HashAndStoreFile("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unsynced() != 1 {
+		t.Fatalf("HashAndStoreFile left %d objects awaiting sync, want 1", unsynced())
+	}
+	err = UpdateIndexWithMeta(func(index map[string]IndexEntry) error {
+		index["a.txt"] = IndexEntry{Hash: hash}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unsynced() != 0 {
+		t.Errorf("%d objects still awaiting sync after the index write", unsynced())
+	}
+}
+
+func TestObjectDurability_ResolvedOncePerLockAndQueueBounded(t *testing.T) {
+	originalWd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(originalWd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(DefaultRepoDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := SyncObjects(); err != nil {
+		t.Fatal(err)
+	}
+
+	prev, prevMax := ObjectDurability, maxUnsyncedObjects
+	defer func() { ObjectDurability, maxUnsyncedObjects = prev, prevMax }()
+	calls := 0
+	ObjectDurability = func() string {
+		calls++
+		return DurabilityBatched
+	}
+	maxUnsyncedObjects = 8
+
+	lock, err := LockRepoShared()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 20 {
+		if _, err := WriteObject([]byte(fmt.Sprintf("object %d\n", i))); err != nil {
+			t.Fatal(err)
+		}
+		unsyncedObjects.Lock()
+		queued := len(unsyncedObjects.paths)
+		unsyncedObjects.Unlock()
+		if queued >= maxUnsyncedObjects {
+			t.Fatalf("%d objects awaiting sync after %d writes, want fewer than %d", queued, i+1, maxUnsyncedObjects)
+		}
+	}
+	lock.Unlock()
+	if calls != 1 {
+		t.Errorf("ObjectDurability consulted %d times under one lock, want 1", calls)
+	}
+}
@@ -2,13 +2,37 @@ package storage
 
 import (
 	"bytes"
+	"compress/gzip"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 )
 
-const indexPath = ".kitcat/index"
+// gzipMagic is the two-byte header that marks a gzip-compressed index.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// IndexCompression, when set, is consulted on every index write; returning true stores the
+// index gzip-compressed. The core package wires it to the index.compress config key.
+// Reads detect the format themselves, so compressed and plain indexes can be mixed freely.
+var IndexCompression func() bool
+
+// IndexPretty, when set, is consulted on every index write; returning true indents the JSON
+// for people reading the file, at the cost of a larger index and slower writes. The core
+// package wires it to the index.pretty config key. Reads accept either form.
+var IndexPretty func() bool
+
+// Index entry flags, stored as a bitmask in IndexEntry.Flags.
+const (
+	// FlagAssumeUnchanged marks an entry whose working-tree file should be trusted as unchanged.
+	FlagAssumeUnchanged uint8 = 1 << iota
+	// FlagSkipWorktree marks an entry that is tracked but not materialized in the working tree.
+	FlagSkipWorktree
+)
 
 // IndexEntry holds the hash and metadata.
 // Short JSON keys keep on-disk index compact.
@@ -16,6 +40,18 @@ type IndexEntry struct {
 	Hash    string `json:"h"`
 	ModTime int64  `json:"m,omitempty"` // Unix timestamp
 	Size    int64  `json:"s,omitempty"` // File size in bytes
+	Flags   uint8  `json:"f,omitempty"` // Bitmask of Flag* values
+	Mode    uint32 `json:"p,omitempty"` // Permission bits; only recorded with core.preservePermissions
+	// DisplayPath is the file's name on disk when it differs from the key only in case, on a
+	// case-insensitive filesystem; checkout recreates the file with this spelling.
+	DisplayPath string `json:"d,omitempty"`
+}
+
+// IndexKey converts a repo-relative OS path to the form used for index keys: cleaned and
+// with forward slashes on every platform, so indexes and trees are identical whichever OS
+// wrote them. Use filepath.FromSlash to turn a key back into an OS path.
+func IndexKey(path string) string {
+	return filepath.ToSlash(filepath.Clean(path))
 }
 
 // LoadIndex returns the legacy map[path]hash view.
@@ -35,17 +71,96 @@ func LoadIndex() (map[string]string, error) {
 
 // LoadIndexWithMeta reads the index file and safely detects old vs new formats.
 // Uses json.RawMessage + head-byte sniffing to avoid relying on json.Unmarshal's weak typing.
+//
+// Readers share the index's reader/writer gate: any number may load concurrently, including
+// while an UpdateIndexWithMeta callback is running, and they only wait while the new index is
+// being written. If the gate cannot be taken (e.g. a read-only repository) the index is read
+// anyway, which is still safe because writes replace the file atomically.
 func LoadIndexWithMeta() (map[string]IndexEntry, error) {
-	index := make(map[string]IndexEntry)
+	if l, err := rlock(indexPath()); err == nil {
+		defer unlock(l)
+	}
+	return readIndexFile()
+}
 
-	content, err := os.ReadFile(indexPath)
+// readIndexFile parses the index without touching any lock.
+func readIndexFile() (map[string]IndexEntry, error) {
+	content, err := os.ReadFile(indexPath())
 	if os.IsNotExist(err) {
 		// No index yet — empty repository state.
-		return index, nil
+		return make(map[string]IndexEntry), nil
 	}
 	if err != nil {
 		return nil, fmt.Errorf("could not read index file: %w", err)
 	}
+	return decodeIndex(content)
+}
+
+// maxOptimisticReads bounds how often LoadIndexOptimistic retries before falling back
+// to a locked read.
+const maxOptimisticReads = 5
+
+// LoadIndexOptimistic reads the index without taking any lock, for read-heavy callers such
+// as editors polling status. Every write replaces the index file atomically, so the file's
+// identity (inode, size and mtime) serves as its generation: the read is retried when the
+// generation at the path changed while it was being read, i.e. a writer committed meanwhile.
+// After maxOptimisticReads attempts it falls back to LoadIndexWithMeta.
+//
+// Use LoadIndexWithMeta (or UpdateIndexWithMeta) when the snapshot must stay consistent
+// with a blocked writer.
+func LoadIndexOptimistic() (map[string]IndexEntry, error) {
+	for attempt := 0; attempt < maxOptimisticReads; attempt++ {
+		index, ok, err := readIndexIfStable()
+		if err != nil || ok {
+			return index, err
+		}
+	}
+	return LoadIndexWithMeta()
+}
+
+// readIndexIfStable reads and decodes the index once, reporting ok=false when the file at
+// the index path is no longer the one that was read.
+func readIndexIfStable() (map[string]IndexEntry, bool, error) {
+	f, err := os.Open(indexPath())
+	if os.IsNotExist(err) {
+		return make(map[string]IndexEntry), true, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("could not read index file: %w", err)
+	}
+	defer f.Close()
+
+	before, err := f.Stat()
+	if err != nil {
+		return nil, false, err
+	}
+	content, err := io.ReadAll(f)
+	if err != nil {
+		return nil, false, fmt.Errorf("could not read index file: %w", err)
+	}
+	after, err := os.Stat(indexPath())
+	if err != nil || !sameGeneration(before, after) {
+		return nil, false, nil
+	}
+
+	index, err := decodeIndex(content)
+	return index, err == nil, err
+}
+
+// sameGeneration reports whether two stats describe the same version of the index file.
+func sameGeneration(a, b os.FileInfo) bool {
+	return os.SameFile(a, b) && a.Size() == b.Size() && a.ModTime().Equal(b.ModTime())
+}
+
+// decodeIndex parses raw index file content, compressed or not, in any supported format.
+func decodeIndex(content []byte) (map[string]IndexEntry, error) {
+	index := make(map[string]IndexEntry)
+	var err error
+	if bytes.HasPrefix(content, gzipMagic) {
+		if content, err = gunzip(content); err != nil {
+			return nil, fmt.Errorf("index file corruption: %w", err)
+		}
+	}
 	if len(content) == 0 {
 		return index, nil
 	}
@@ -57,65 +172,143 @@ func LoadIndexWithMeta() (map[string]IndexEntry, error) {
 	}
 
 	for path, rawValue := range rawMap {
-		rawValue = bytes.TrimSpace(rawValue)
-		if len(rawValue) == 0 {
-			continue
+		entry, ok, err := decodeIndexValue(path, rawValue)
+		if err != nil {
+			return nil, err
 		}
-
-		switch rawValue[0] {
-		case '"':
-			// Legacy format: value is a JSON string containing the hash.
-			var hash string
-			if err := json.Unmarshal(rawValue, &hash); err != nil {
-				return nil, fmt.Errorf("failed to decode legacy entry for %s: %w", path, err)
-			}
-			// Migrate into new struct form (empty metadata means 're-check later').
-			index[path] = IndexEntry{Hash: hash}
-		case '{':
-			// New format: value is an object matching IndexEntry.
-			var entry IndexEntry
-			if err := json.Unmarshal(rawValue, &entry); err != nil {
-				return nil, fmt.Errorf("failed to decode entry for %s: %w", path, err)
-			}
+		if ok {
 			index[path] = entry
-		default:
-			// Unknown/garbage entry — warn and skip instead of crashing repo.
-			fmt.Printf("warning: unknown index format for %s, skipping\n", path)
 		}
 	}
 
+	migrateBackslashKeys(index)
 	return index, nil
 }
 
-// UpdateIndexWithMeta is the atomic update helper.
-// It creates the .kitcat directory, obtains a file lock, loads the index,
-// invokes the callback to mutate it, then writes it back atomically.
-func UpdateIndexWithMeta(fn func(index map[string]IndexEntry) error) error {
-	if err := os.MkdirAll(filepath.Dir(indexPath), 0o755); err != nil {
-		return err
+// decodeIndexValue decodes one index value in either format. It reports ok=false for
+// values that should be skipped.
+func decodeIndexValue(path string, rawValue json.RawMessage) (IndexEntry, bool, error) {
+	rawValue = bytes.TrimSpace(rawValue)
+	if len(rawValue) == 0 {
+		return IndexEntry{}, false, nil
+	}
+
+	switch rawValue[0] {
+	case '"':
+		// Legacy format: value is a JSON string containing the hash.
+		var hash string
+		if err := json.Unmarshal(rawValue, &hash); err != nil {
+			return IndexEntry{}, false, fmt.Errorf("failed to decode legacy entry for %s: %w", path, err)
+		}
+		// Migrate into new struct form (empty metadata means 're-check later').
+		return IndexEntry{Hash: hash}, true, nil
+	case '{':
+		// New format: value is an object matching IndexEntry.
+		var entry IndexEntry
+		if err := json.Unmarshal(rawValue, &entry); err != nil {
+			return IndexEntry{}, false, fmt.Errorf("failed to decode entry for %s: %w", path, err)
+		}
+		return entry, true, nil
+	default:
+		// Unknown/garbage entry — warn and skip instead of crashing repo.
+		fmt.Printf("warning: unknown index format for %s, skipping\n", path)
+		return IndexEntry{}, false, nil
 	}
+}
 
-	l, err := lock(indexPath)
+// WalkIndex calls fn for every index entry, decoding the index file incrementally instead
+// of building the whole map, so very large indexes can be processed in constant memory.
+// Entries come in file order (sorted by path for indexes kitcat wrote), in either on-disk
+// format, compressed or not, with keys in forward-slash form as LoadIndexWithMeta returns them.
+//
+// The file is opened under the reader gate and then read without it: writes replace the
+// index atomically, so the walk sees one consistent snapshot even if fn is slow.
+// An error returned by fn stops the walk and is returned as is.
+func WalkIndex(fn func(path string, e IndexEntry) error) error {
+	l, lockErr := rlock(indexPath())
+	cur, err := openIndexCursor(false)
+	if lockErr == nil {
+		unlock(l)
+	}
 	if err != nil {
 		return err
 	}
-	defer unlock(l)
+	defer cur.Close()
 
-	index, err := LoadIndexWithMeta()
+	for {
+		path, entry, ok, err := cur.Next()
+		if err != nil || !ok {
+			return err
+		}
+		if err := fn(path, entry); err != nil {
+			return err
+		}
+	}
+}
+
+// LoadIndexPrefix returns the index entries at or below prefix, e.g. one package of a
+// monorepo, without materializing the rest of the index: entries are streamed through
+// WalkIndex and only matching ones are kept. prefix is normalized like index keys, so
+// `pkg/`, `./pkg` and `pkg` are the same; it matches whole path components (`pkg` selects
+// `pkg/a.go` and `pkg/sub/b.go` but not `pkgs/c.go`), and a file path selects that file.
+// An empty prefix or `.` selects the whole index.
+func LoadIndexPrefix(prefix string) (map[string]IndexEntry, error) {
+	key := ""
+	if prefix != "" {
+		if key = IndexKey(prefix); key == "." {
+			key = ""
+		}
+	}
+	index := make(map[string]IndexEntry)
+	err := WalkIndex(func(path string, e IndexEntry) error {
+		if key == "" || path == key || strings.HasPrefix(path, key+"/") {
+			index[path] = e
+		}
+		return nil
+	})
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return index, nil
+}
 
-	if err := fn(index); err != nil {
-		return err
+// migrateBackslashKeys rewrites keys stored with Windows separators (`src\main.go`) by older
+// versions into forward-slash form. If both spellings exist the forward-slash entry wins.
+// The migrated form is persisted by the next index write.
+func migrateBackslashKeys(index map[string]IndexEntry) {
+	for path, entry := range index {
+		if !strings.Contains(path, `\`) {
+			continue
+		}
+		delete(index, path)
+		key := strings.ReplaceAll(path, `\`, "/")
+		if _, exists := index[key]; !exists {
+			index[key] = entry
+		}
 	}
+}
 
-	data, err := json.MarshalIndent(index, "", "  ")
+// UpdateIndexWithMeta is the atomic update helper.
+// It creates the .kitcat directory, obtains a file lock, loads the index,
+// invokes the callback to mutate it, then writes it back atomically.
+// The lock only serializes writers; readers are held off just for the final write.
+// It is an IndexUpdate that runs fn between BeginIndexUpdate and Commit.
+// If fn fails nothing is written; ErrAbortIndexUpdate does the same without being an
+// error, and IndexSavepoint undoes part of fn's changes.
+func UpdateIndexWithMeta(fn func(index map[string]IndexEntry) error) error {
+	u, err := BeginIndexUpdate()
 	if err != nil {
-		return fmt.Errorf("failed to marshal index: %w", err)
+		return err
 	}
+	defer u.Close()
 
-	return SafeWriteFile(indexPath, data, 0644)
+	if err := fn(u.Index()); err != nil {
+		if errors.Is(err, ErrAbortIndexUpdate) {
+			return nil
+		}
+		return err
+	}
+	return u.Commit()
 }
 
 // UpdateIndex adapts legacy callers that expect map[string]string.
@@ -151,6 +344,8 @@ func UpdateIndex(fn func(index map[string]string) error) error {
 					Hash:    newHash,
 					ModTime: 0,
 					Size:    0,
+					Flags:   existing.Flags,
+					Mode:    existing.Mode,
 				}
 			}
 		}
@@ -170,21 +365,260 @@ func WriteIndex(simpleIndex map[string]string) error {
 			Size:    0,
 		}
 	}
+	return WriteIndexWithMeta(richIndex)
+}
+
+// WriteIndexWithMeta replaces the index with the given entries, keeping their metadata.
+// Used when the caller knows the on-disk state matches (e.g. right after checkout).
+func WriteIndexWithMeta(richIndex map[string]IndexEntry) error {
+	if err := os.MkdirAll(filepath.Dir(indexPath()), 0o755); err != nil {
+		return err
+	}
+
+	l, err := lock(indexPath())
+	if err != nil {
+		return err
+	}
+	defer unlock(l)
+
+	data, err := encodeIndex(richIndex, indexPretty())
+	if err != nil {
+		return err
+	}
+
+	return writeIndexFile("write", data)
+}
+
+// CompactIndex rewrites the index in its smallest canonical form: entries without a hash
+// (tombstones left behind by interrupted or partial operations) are dropped, zero-value
+// metadata is omitted and the JSON is written without indentation. Keys come out sorted
+// because encoding/json orders map keys. Returns the number of entries removed.
+func CompactIndex() (int, error) {
+	l, err := lock(indexPath())
+	if err != nil {
+		return 0, err
+	}
+	defer unlock(l)
+
+	index, err := readIndexFile()
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for path, entry := range index {
+		if entry.Hash == "" || path == "" {
+			delete(index, path)
+			removed++
+		}
+	}
+
+	data, err := encodeIndex(index, false)
+	if err != nil {
+		return 0, err
+	}
+
+	return removed, writeIndexFile("compact", data)
+}
+
+// IndexDowngrade reports what DowngradeIndex discarded.
+type IndexDowngrade struct {
+	// Entries is the number of entries written.
+	Entries int
+	// Metadata is the number of entries whose size and mtime were dropped.
+	Metadata int
+	// Extras lists, sorted, the entries whose flags, mode or display path were dropped.
+	Extras []string
+}
+
+// DowngradeIndex rewrites the index in the legacy format of older kitcat versions, a plain
+// JSON object of "path": "hash" pairs that is never compressed, so that they can read a
+// repository this version has used. Everything but the hash is discarded. This version
+// still reads the result, and writes its own format again on the next index update.
+func DowngradeIndex() (IndexDowngrade, error) {
+	var report IndexDowngrade
+	l, err := lock(indexPath())
+	if err != nil {
+		return report, err
+	}
+	defer unlock(l)
+
+	index, err := readIndexFile()
+	if err != nil {
+		return report, err
+	}
+
+	legacy := make(map[string]string, len(index))
+	for path, entry := range index {
+		if entry.Hash == "" || path == "" {
+			continue
+		}
+		legacy[path] = entry.Hash
+		if entry.ModTime != 0 || entry.Size != 0 {
+			report.Metadata++
+		}
+		if entry.Flags != 0 || entry.Mode != 0 || entry.DisplayPath != "" {
+			report.Extras = append(report.Extras, path)
+		}
+	}
+	sort.Strings(report.Extras)
+	report.Entries = len(legacy)
+
+	data, err := json.MarshalIndent(legacy, "", "  ")
+	if err != nil {
+		return report, fmt.Errorf("failed to marshal index: %w", err)
+	}
+	return report, writeIndexFile("downgrade", data)
+}
+
+// IndexNormalization reports what NormalizeIndexFormat upgraded.
+type IndexNormalization struct {
+	// Legacy is the number of entries stored in the legacy "path": "hash" form.
+	Legacy int
+	// BackslashKeys is the number of keys stored with Windows separators.
+	BackslashKeys int
+	// Dropped is the number of values in no known format, which reads already skip.
+	Dropped int
+}
+
+// Changed reports whether anything was upgraded, i.e. whether the index was rewritten.
+func (n IndexNormalization) Changed() bool {
+	return n.Legacy+n.BackslashKeys+n.Dropped > 0
+}
+
+// NormalizeIndexFormat persists the migrations every read applies to an older index:
+// legacy entries become IndexEntry objects, keys get forward slashes and undecodable
+// values are dropped. Reads only migrate in memory, so without a write an index can stay
+// mixed-format indefinitely. The index is rewritten once, atomically, and only when there
+// was something to upgrade, which makes running it again a no-op.
+func NormalizeIndexFormat() (IndexNormalization, error) {
+	var report IndexNormalization
+	if err := os.MkdirAll(filepath.Dir(indexPath()), 0o755); err != nil {
+		return report, err
+	}
+	l, err := lock(indexPath())
+	if err != nil {
+		return report, err
+	}
+	defer unlock(l)
+
+	content, err := os.ReadFile(indexPath())
+	if os.IsNotExist(err) {
+		return report, nil
+	}
+	if err != nil {
+		return report, fmt.Errorf("could not read index file: %w", err)
+	}
+	index, err := decodeIndex(content)
+	if err != nil {
+		return report, err
+	}
+
+	if bytes.HasPrefix(content, gzipMagic) {
+		if content, err = gunzip(content); err != nil {
+			return report, fmt.Errorf("index file corruption: %w", err)
+		}
+	}
+	var rawMap map[string]json.RawMessage
+	if len(content) > 0 {
+		if err := json.Unmarshal(content, &rawMap); err != nil {
+			return report, fmt.Errorf("index file corruption: %w", err)
+		}
+	}
+	for path, rawValue := range rawMap {
+		if strings.Contains(path, `\`) {
+			report.BackslashKeys++
+		}
+		switch rawValue = bytes.TrimSpace(rawValue); {
+		case len(rawValue) == 0:
+			report.Dropped++
+		case rawValue[0] == '"':
+			report.Legacy++
+		case rawValue[0] != '{':
+			report.Dropped++
+		}
+	}
+	if !report.Changed() {
+		return report, nil
+	}
 
-	if err := os.MkdirAll(filepath.Dir(indexPath), 0o755); err != nil {
+	data, err := encodeIndex(index, indexPretty())
+	if err != nil {
+		return report, err
+	}
+	return report, writeIndexFile("normalize", data)
+}
+
+// writeIndexFile replaces the index on disk while holding the exclusive side of the
+// reader/writer gate, after syncing the objects it may refer to (see SyncObjects). Callers
+// must already hold the index lock. When index operations are being recorded, the write is
+// recorded as op.
+func writeIndexFile(op string, data []byte) error {
+	if err := SyncObjects(); err != nil {
 		return err
 	}
+	var before map[string]IndexEntry
+	recording := recordingIndexOps()
+	if recording {
+		// Unreadable content is recorded as an empty index rather than blocking the write
+		before, _ = readIndexFile()
+	}
 
-	l, err := lock(indexPath)
+	l, err := wlock(indexPath())
 	if err != nil {
 		return err
 	}
 	defer unlock(l)
+	if err := SafeWriteFile(indexPath(), data, 0644); err != nil {
+		return err
+	}
+	if recording {
+		after, err := decodeIndex(data)
+		if err == nil {
+			recordIndexOp(op, before, after)
+		}
+	}
+	return nil
+}
+
+// indexPretty reports whether IndexPretty asks for an indented index.
+func indexPretty() bool {
+	return IndexPretty != nil && IndexPretty()
+}
 
-	data, err := json.MarshalIndent(richIndex, "", "  ")
+// encodeIndex serializes the index as JSON (indented when pretty is set) and gzips the
+// result when IndexCompression asks for it.
+func encodeIndex(index map[string]IndexEntry, pretty bool) ([]byte, error) {
+	var data []byte
+	var err error
+	if pretty {
+		data, err = json.MarshalIndent(index, "", "  ")
+	} else {
+		data, err = json.Marshal(index)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to marshal index: %w", err)
+		return nil, fmt.Errorf("failed to marshal index: %w", err)
+	}
+	if IndexCompression == nil || !IndexCompression() {
+		return data, nil
 	}
 
-	return SafeWriteFile(indexPath, data, 0644)
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func gunzip(data []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
 }
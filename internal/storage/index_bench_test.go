@@ -0,0 +1,164 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+)
+
+// benchmarkLoadIndex writes a 10k-entry index (optionally gzipped) and measures LoadIndexWithMeta.
+func benchmarkLoadIndex(b *testing.B, compress bool) {
+	originalWd, err := os.Getwd()
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(originalWd)
+	}()
+	if err := os.Chdir(b.TempDir()); err != nil {
+		b.Fatal(err)
+	}
+
+	defer func(prev func() bool) { IndexCompression = prev }(IndexCompression)
+	IndexCompression = func() bool { return compress }
+
+	index := make(map[string]IndexEntry, 10000)
+	for i := 0; i < 10000; i++ {
+		index[fmt.Sprintf("src/pkg%03d/file%05d.go", i%100, i)] = IndexEntry{
+			Hash:    fmt.Sprintf("%040x", i),
+			ModTime: 1700000000 + int64(i),
+			Size:    int64(i * 7),
+		}
+	}
+	if err := WriteIndexWithMeta(index); err != nil {
+		b.Fatal(err)
+	}
+	info, err := os.Stat(indexPath())
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := LoadIndexWithMeta(); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(info.Size()), "index-bytes")
+}
+
+func BenchmarkLoadIndex_Plain(b *testing.B) { benchmarkLoadIndex(b, false) }
+func BenchmarkLoadIndex_Gzip(b *testing.B)  { benchmarkLoadIndex(b, true) }
+
+// benchmarkWriteIndex measures WriteIndexWithMeta on a 50k-entry index, compact or indented.
+func benchmarkWriteIndex(b *testing.B, pretty bool) {
+	originalWd, err := os.Getwd()
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(originalWd)
+	}()
+	if err := os.Chdir(b.TempDir()); err != nil {
+		b.Fatal(err)
+	}
+
+	defer func(prev func() bool) { IndexPretty = prev }(IndexPretty)
+	IndexPretty = func() bool { return pretty }
+
+	index := make(map[string]IndexEntry, 50000)
+	for i := 0; i < 50000; i++ {
+		index[fmt.Sprintf("src/pkg%03d/file%05d.go", i%100, i)] = IndexEntry{
+			Hash:    fmt.Sprintf("%040x", i),
+			ModTime: 1700000000 + int64(i),
+			Size:    int64(i * 7),
+		}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := WriteIndexWithMeta(index); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.StopTimer()
+	info, err := os.Stat(indexPath())
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportMetric(float64(info.Size()), "index-bytes")
+}
+
+func BenchmarkWriteIndex_Compact(b *testing.B) { benchmarkWriteIndex(b, false) }
+func BenchmarkWriteIndex_Pretty(b *testing.B)  { benchmarkWriteIndex(b, true) }
+
+func TestWriteIndex_PrettyIsOptIn(t *testing.T) {
+	originalWd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(originalWd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer func(prev func() bool) { IndexPretty = prev }(IndexPretty)
+
+	for _, pretty := range []bool{false, true} {
+		IndexPretty = func() bool { return pretty }
+		if err := WriteIndex(map[string]string{"a.txt": "da39a3ee5e6b4b0d3255bfef95601890afd80709"}); err != nil {
+			t.Fatal(err)
+		}
+		raw, err := os.ReadFile(indexPath())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if indented := bytes.Contains(raw, []byte("\n  ")); indented != pretty {
+			t.Errorf("pretty=%v but index indented=%v: %s", pretty, indented, raw)
+		}
+		index, err := LoadIndex()
+		if err != nil {
+			t.Fatalf("pretty=%v: LoadIndex failed: %v", pretty, err)
+		}
+		if index["a.txt"] != "da39a3ee5e6b4b0d3255bfef95601890afd80709" {
+			t.Errorf("pretty=%v: unexpected index %v", pretty, index)
+		}
+	}
+}
+
+func TestLoadIndex_ReadsGzipAndPlain(t *testing.T) {
+	originalWd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(originalWd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer func(prev func() bool) { IndexCompression = prev }(IndexCompression)
+
+	for _, compress := range []bool{true, false} {
+		IndexCompression = func() bool { return compress }
+		if err := WriteIndex(map[string]string{"a.txt": "da39a3ee5e6b4b0d3255bfef95601890afd80709"}); err != nil {
+			t.Fatal(err)
+		}
+		raw, err := os.ReadFile(indexPath())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if isGzip := len(raw) > 1 && raw[0] == 0x1f && raw[1] == 0x8b; isGzip != compress {
+			t.Errorf("compress=%v but gzip header present=%v", compress, isGzip)
+		}
+		index, err := LoadIndex()
+		if err != nil {
+			t.Fatalf("compress=%v: LoadIndex failed: %v", compress, err)
+		}
+		if index["a.txt"] != "da39a3ee5e6b4b0d3255bfef95601890afd80709" {
+			t.Errorf("compress=%v: unexpected index %v", compress, index)
+		}
+	}
+}
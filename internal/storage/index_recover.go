@@ -0,0 +1,157 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// IndexRecovery reports the outcome of LoadIndexBestEffort.
+type IndexRecovery struct {
+	// Damaged is set when the index failed the strict parse and was scanned instead.
+	Damaged bool
+	// Recovered counts the entries returned.
+	Recovered int
+	// Lost counts the entries whose path was found but whose value could not be decoded.
+	// Damage that destroyed a path as well cannot be counted.
+	Lost int
+}
+
+// LoadIndexBestEffort is a last-resort reader for a partially corrupted index. It first
+// tries the strict parse of LoadIndexWithMeta; when that fails it scans the content for
+// well-formed "path": value pairs and returns every entry it can decode, together with a
+// report of what was recovered and lost. A compressed index that is truncated is scanned
+// as far as it can be decompressed. Recovered entries are not written back; that is up to
+// the caller, after which the lost paths can be re-added.
+func LoadIndexBestEffort() (map[string]IndexEntry, IndexRecovery, error) {
+	if l, err := rlock(indexPath()); err == nil {
+		defer unlock(l)
+	}
+	content, err := os.ReadFile(indexPath())
+	if os.IsNotExist(err) {
+		return make(map[string]IndexEntry), IndexRecovery{}, nil
+	}
+	if err != nil {
+		return nil, IndexRecovery{}, fmt.Errorf("could not read index file: %w", err)
+	}
+
+	if index, err := decodeIndex(content); err == nil {
+		return index, IndexRecovery{Recovered: len(index)}, nil
+	}
+	if bytes.HasPrefix(content, gzipMagic) {
+		// Whatever decompressed before the damage is still worth scanning
+		content, _ = gunzip(content)
+	}
+	index, lost := scanIndexEntries(content)
+	migrateBackslashKeys(index)
+	return index, IndexRecovery{Damaged: true, Recovered: len(index), Lost: lost}, nil
+}
+
+// scanIndexEntries collects the decodable "path": value pairs of damaged index content and
+// counts the paths whose value is unusable. A value is either a legacy hash string or an
+// entry object; an object that fails to decode is skipped up to its closing brace so that
+// its fields are not mistaken for paths.
+func scanIndexEntries(content []byte) (map[string]IndexEntry, int) {
+	index := make(map[string]IndexEntry)
+	lost := 0
+	for i := 0; i < len(content); {
+		start := bytes.IndexByte(content[i:], '"')
+		if start < 0 {
+			break
+		}
+		start += i
+		key, next, ok := scanJSONString(content, start)
+		colon := skipSpace(content, next)
+		if !ok || key == "" || colon >= len(content) || content[colon] != ':' {
+			// Not a key; the next quote may start one
+			i = start + 1
+			continue
+		}
+		valueStart := skipSpace(content, colon+1)
+		if valueStart >= len(content) {
+			lost++
+			break
+		}
+
+		var raw []byte
+		switch content[valueStart] {
+		case '"':
+			_, end, ok := scanJSONString(content, valueStart)
+			if !ok {
+				lost++
+				i = valueStart + 1
+				continue
+			}
+			raw, i = content[valueStart:end], end
+		case '{':
+			end := bytes.IndexByte(content[valueStart:], '}')
+			if end < 0 {
+				lost++ // truncated inside the last entry
+				i = len(content)
+				continue
+			}
+			raw, i = content[valueStart:valueStart+end+1], valueStart+end+1
+		default:
+			lost++
+			i = valueStart
+			continue
+		}
+
+		entry, ok := recoverIndexValue(key, raw)
+		if !ok {
+			lost++
+			continue
+		}
+		index[key] = entry
+	}
+	return index, lost
+}
+
+// recoverIndexValue decodes one scanned value, accepting it only if it carries a plausible
+// object hash.
+func recoverIndexValue(path string, raw []byte) (IndexEntry, bool) {
+	if raw[0] == '{' {
+		var entry IndexEntry
+		if err := json.Unmarshal(raw, &entry); err != nil {
+			return IndexEntry{}, false
+		}
+		return entry, isHexHash(entry.Hash)
+	}
+	entry, ok, err := decodeIndexValue(path, raw)
+	return entry, ok && err == nil && isHexHash(entry.Hash)
+}
+
+// scanJSONString returns the JSON string starting with the quote at content[start] and the
+// offset just past its closing quote. ok is false when the string is unterminated or invalid.
+func scanJSONString(content []byte, start int) (string, int, bool) {
+	for i := start + 1; i < len(content); i++ {
+		switch content[i] {
+		case '\\':
+			i++
+		case '\n':
+			return "", 0, false // index strings never span lines
+		case '"':
+			var s string
+			if err := json.Unmarshal(content[start:i+1], &s); err != nil {
+				return "", 0, false
+			}
+			return s, i + 1, true
+		}
+	}
+	return "", 0, false
+}
+
+// skipSpace returns the offset of the first non-whitespace byte at or after i.
+func skipSpace(content []byte, i int) int {
+	for i < len(content) && strings.IndexByte(" \t\r\n", content[i]) >= 0 {
+		i++
+	}
+	return i
+}
+
+// isHexHash reports whether s looks like an object hash.
+func isHexHash(s string) bool {
+	return s != "" && strings.Trim(s, "0123456789abcdef") == ""
+}
@@ -0,0 +1,294 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrIndexUnsorted is returned when streamed index entries are not in strictly increasing
+// path order, which RewriteIndex merges depend on. Indexes kitcat wrote are always sorted;
+// hand-edited or legacy ones may not be, and must then be rewritten through the map-based
+// UpdateIndexWithMeta.
+var ErrIndexUnsorted = errors.New("index entries are not sorted by path")
+
+// IndexCursor reads index entries one at a time, in file order, decoding the file
+// incrementally so that only the current entry is held in memory.
+type IndexCursor struct {
+	f          *os.File
+	zr         *gzip.Reader
+	dec        *json.Decoder
+	checkOrder bool
+	last       string
+	started    bool
+	done       bool
+}
+
+// openIndexCursor opens the index file for streaming. A missing or empty index yields a
+// cursor without entries. With checkOrder, Next fails with ErrIndexUnsorted on an entry that
+// does not sort after the previous one.
+func openIndexCursor(checkOrder bool) (*IndexCursor, error) {
+	c := &IndexCursor{checkOrder: checkOrder}
+	f, err := os.Open(indexPath())
+	if os.IsNotExist(err) {
+		c.done = true
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read index file: %w", err)
+	}
+	c.f = f
+
+	br := bufio.NewReader(f)
+	var r io.Reader = br
+	if head, _ := br.Peek(len(gzipMagic)); bytes.Equal(head, gzipMagic) {
+		if c.zr, err = gzip.NewReader(br); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("index file corruption: %w", err)
+		}
+		r = c.zr
+	}
+
+	c.dec = json.NewDecoder(r)
+	tok, err := c.dec.Token()
+	if err == io.EOF {
+		c.done = true // empty index file
+		return c, nil
+	}
+	if err != nil {
+		c.Close()
+		return nil, fmt.Errorf("index file corruption: %w", err)
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '{' {
+		c.Close()
+		return nil, fmt.Errorf("index file corruption: expected an object, got %v", tok)
+	}
+	return c, nil
+}
+
+// Next returns the next entry, with its key in forward-slash form. ok is false once the
+// index is exhausted.
+func (c *IndexCursor) Next() (path string, entry IndexEntry, ok bool, err error) {
+	for !c.done {
+		if !c.dec.More() {
+			c.done = true
+			if _, err := c.dec.Token(); err != nil {
+				return "", IndexEntry{}, false, fmt.Errorf("index file corruption: %w", err)
+			}
+			break
+		}
+		tok, err := c.dec.Token()
+		if err != nil {
+			return "", IndexEntry{}, false, fmt.Errorf("index file corruption: %w", err)
+		}
+		key, isKey := tok.(string)
+		if !isKey {
+			return "", IndexEntry{}, false, fmt.Errorf("index file corruption: unexpected key %v", tok)
+		}
+		var rawValue json.RawMessage
+		if err := c.dec.Decode(&rawValue); err != nil {
+			return "", IndexEntry{}, false, fmt.Errorf("index file corruption: %w", err)
+		}
+		entry, ok, err := decodeIndexValue(key, rawValue)
+		if err != nil {
+			return "", IndexEntry{}, false, err
+		}
+		if !ok {
+			continue
+		}
+		path = strings.ReplaceAll(key, `\`, "/")
+		if c.checkOrder && c.started && path <= c.last {
+			return "", IndexEntry{}, false, fmt.Errorf("%w: %q after %q", ErrIndexUnsorted, path, c.last)
+		}
+		c.last, c.started = path, true
+		return path, entry, true, nil
+	}
+	return "", IndexEntry{}, false, nil
+}
+
+// Close releases the index file. Calling it again does nothing.
+func (c *IndexCursor) Close() error {
+	if c.zr != nil {
+		c.zr.Close()
+		c.zr = nil
+	}
+	if c.f == nil {
+		return nil
+	}
+	err := c.f.Close()
+	c.f = nil
+	return err
+}
+
+// IndexStreamWriter writes a new index file entry by entry, in the same JSON object format
+// (compressed when IndexCompression asks for it) that LoadIndexWithMeta reads. Entries must
+// be written in strictly increasing path order, so the result is as sorted as an index
+// written from a map.
+type IndexStreamWriter struct {
+	f    *os.File
+	bw   *bufio.Writer
+	zw   *gzip.Writer
+	w    io.Writer
+	last string
+	n    int
+}
+
+func newIndexStreamWriter(path string) (*IndexStreamWriter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	sw := &IndexStreamWriter{f: f, bw: bufio.NewWriter(f)}
+	sw.w = sw.bw
+	if IndexCompression != nil && IndexCompression() {
+		sw.zw = gzip.NewWriter(sw.bw)
+		sw.w = sw.zw
+	}
+	if _, err := io.WriteString(sw.w, "{"); err != nil {
+		sw.abort()
+		return nil, err
+	}
+	return sw, nil
+}
+
+// Write appends one entry. path must sort after the previously written one.
+func (sw *IndexStreamWriter) Write(path string, entry IndexEntry) error {
+	if sw.n > 0 && path <= sw.last {
+		return fmt.Errorf("%w: %q written after %q", ErrIndexUnsorted, path, sw.last)
+	}
+	key, err := json.Marshal(path)
+	if err != nil {
+		return err
+	}
+	value, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal index entry for %s: %w", path, err)
+	}
+	sep := ",\n  "
+	if sw.n == 0 {
+		sep = "\n  "
+	}
+	if _, err := io.WriteString(sw.w, sep); err != nil {
+		return err
+	}
+	if _, err := sw.w.Write(key); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(sw.w, ": "); err != nil {
+		return err
+	}
+	if _, err := sw.w.Write(value); err != nil {
+		return err
+	}
+	sw.last = path
+	sw.n++
+	return nil
+}
+
+// finish closes the object and flushes and syncs the file.
+func (sw *IndexStreamWriter) finish() error {
+	end := "}"
+	if sw.n > 0 {
+		end = "\n}"
+	}
+	if _, err := io.WriteString(sw.w, end); err != nil {
+		return err
+	}
+	if sw.zw != nil {
+		if err := sw.zw.Close(); err != nil {
+			return err
+		}
+	}
+	if err := sw.bw.Flush(); err != nil {
+		return err
+	}
+	if err := sw.f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync temp file: %w", err)
+	}
+	return sw.f.Close()
+}
+
+// abort discards the partially written file.
+func (sw *IndexStreamWriter) abort() {
+	sw.f.Close()
+	os.Remove(sw.f.Name())
+}
+
+// RewriteIndex replaces the index with the entries fn writes to w, typically while merging
+// them with the current entries it reads from cur. Neither side is ever held in memory as a
+// whole: cur streams the current index file (failing with ErrIndexUnsorted if it is not
+// sorted), and w streams the new one to a temporary file that is swapped in atomically once
+// fn returns nil. If fn fails, the index is left untouched.
+//
+// RewriteIndex holds the index's writer lock throughout, like UpdateIndexWithMeta; readers
+// keep seeing the old index until the swap.
+func RewriteIndex(fn func(cur *IndexCursor, w *IndexStreamWriter) error) error {
+	if err := os.MkdirAll(filepath.Dir(indexPath()), 0o755); err != nil {
+		return err
+	}
+	l, err := lock(indexPath())
+	if err != nil {
+		return err
+	}
+	defer unlock(l)
+
+	// Recording needs the old index in memory, which the streaming rewrite otherwise avoids
+	var before map[string]IndexEntry
+	recording := recordingIndexOps()
+	if recording {
+		if before, err = readIndexFile(); err != nil {
+			return err
+		}
+	}
+
+	cur, err := openIndexCursor(true)
+	if err != nil {
+		return err
+	}
+	defer cur.Close()
+
+	tmpPath := indexPath() + ".tmp"
+	w, err := newIndexStreamWriter(tmpPath)
+	if err != nil {
+		return err
+	}
+	if err := fn(cur, w); err != nil {
+		w.abort()
+		return err
+	}
+	if err := w.finish(); err != nil {
+		w.abort()
+		return err
+	}
+	if err := SyncObjects(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	// Release the old file before it is replaced; Windows cannot rename over an open file.
+	cur.Close()
+
+	wl, err := wlock(indexPath())
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	defer unlock(wl)
+	if err := os.Rename(tmpPath, indexPath()); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to rename temp file: %w", err)
+	}
+	_ = syncDir(filepath.Dir(indexPath()))
+	if recording {
+		if after, err := readIndexFile(); err == nil {
+			recordIndexOp("rewrite", before, after)
+		}
+	}
+	return nil
+}
@@ -2,7 +2,11 @@ package storage
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
+	"sort"
+	"strings"
 	"testing"
 )
 
@@ -59,3 +63,504 @@ func TestIndexWriteSanity(t *testing.T) {
 		t.Errorf("Index content mismatch for test_file.txt")
 	}
 }
+
+func TestCompactIndex_DropsTombstones(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalWd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(originalWd)
+	}()
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := WriteIndexWithMeta(map[string]IndexEntry{
+		"keep.txt": {Hash: "da39a3ee5e6b4b0d3255bfef95601890afd80709", Size: 3},
+		"gone.txt": {},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := CompactIndex()
+	if err != nil {
+		t.Fatalf("CompactIndex failed: %v", err)
+	}
+	if removed != 1 {
+		t.Errorf("expected 1 entry removed, got %d", removed)
+	}
+
+	content, err := os.ReadFile(indexPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"keep.txt":{"h":"da39a3ee5e6b4b0d3255bfef95601890afd80709","s":3}}`
+	if string(content) != want {
+		t.Errorf("compacted index = %s, want %s", content, want)
+	}
+}
+
+func TestDowngradeIndex_WritesLegacyFormat(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalWd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(originalWd)
+	}()
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatal(err)
+	}
+	IndexCompression = func() bool { return true }
+	defer func() { IndexCompression = nil }()
+
+	const hash = "da39a3ee5e6b4b0d3255bfef95601890afd80709"
+	if err := WriteIndexWithMeta(map[string]IndexEntry{
+		"a.txt":   {Hash: hash, ModTime: 1700000000, Size: 3},
+		"bin/run": {Hash: hash, Mode: 0o755},
+		"old.txt": {Hash: hash},
+		"gone":    {},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := DowngradeIndex()
+	if err != nil {
+		t.Fatalf("DowngradeIndex failed: %v", err)
+	}
+	if report.Entries != 3 || report.Metadata != 1 || strings.Join(report.Extras, ",") != "bin/run" {
+		t.Errorf("report = %+v", report)
+	}
+
+	// Plain JSON even with compression on, with string values only.
+	content, err := os.ReadFile(indexPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var legacy map[string]string
+	if err := json.Unmarshal(content, &legacy); err != nil {
+		t.Fatalf("downgraded index is not legacy JSON: %v\n%s", err, content)
+	}
+	want := map[string]string{"a.txt": hash, "bin/run": hash, "old.txt": hash}
+	if fmt.Sprint(legacy) != fmt.Sprint(want) {
+		t.Errorf("downgraded index = %v, want %v", legacy, want)
+	}
+
+	// This version still reads it.
+	index, err := LoadIndexWithMeta()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(index) != 3 || index["a.txt"] != (IndexEntry{Hash: hash}) {
+		t.Errorf("reloaded index = %v", index)
+	}
+}
+
+func TestNormalizeIndexFormat_UpgradesMixedIndex(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalWd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(originalWd)
+	}()
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(".kitcat", 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	const hash = "da39a3ee5e6b4b0d3255bfef95601890afd80709"
+	mixed := `{"a.txt": "` + hash + `", "b.txt": {"h": "` + hash + `", "s": 3}, "src\\main.go": "` + hash + `", "junk": 5}`
+	if err := os.WriteFile(indexPath(), []byte(mixed), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	want, err := LoadIndexWithMeta()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := NormalizeIndexFormat()
+	if err != nil {
+		t.Fatalf("NormalizeIndexFormat failed: %v", err)
+	}
+	if report != (IndexNormalization{Legacy: 2, BackslashKeys: 1, Dropped: 1}) {
+		t.Errorf("report = %+v", report)
+	}
+	content, err := os.ReadFile(indexPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raw map[string]IndexEntry
+	if err := json.Unmarshal(content, &raw); err != nil {
+		t.Fatalf("normalized index has non-object entries: %v\n%s", err, content)
+	}
+	if fmt.Sprint(raw) != fmt.Sprint(want) {
+		t.Errorf("normalized index = %v, want %v", raw, want)
+	}
+
+	// Idempotent: nothing left to upgrade, and the file is not rewritten.
+	before, err := os.Stat(indexPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err = NormalizeIndexFormat()
+	if err != nil || report.Changed() {
+		t.Errorf("second run = %+v, %v", report, err)
+	}
+	if after, err := os.Stat(indexPath()); err != nil || !sameGeneration(before, after) {
+		t.Errorf("second run rewrote the index (%v)", err)
+	}
+}
+
+func TestLoadIndex_MigratesBackslashKeys(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalWd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(originalWd)
+	}()
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.MkdirAll(RepoDir(), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	legacy := `{"src\\main.go":{"h":"aaaa"},"docs/a.md":{"h":"bbbb"},"docs\\a.md":{"h":"cccc"}}`
+	if err := os.WriteFile(indexPath(), []byte(legacy), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	index, err := LoadIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"src/main.go": "aaaa", "docs/a.md": "bbbb"}
+	if len(index) != len(want) {
+		t.Fatalf("migrated index = %v, want %v", index, want)
+	}
+	for path, hash := range want {
+		if index[path] != hash {
+			t.Errorf("index[%q] = %q, want %q", path, index[path], hash)
+		}
+	}
+
+	if got := IndexKey("./src//main.go"); got != "src/main.go" {
+		t.Errorf("IndexKey = %q, want src/main.go", got)
+	}
+}
+
+func TestLoadIndexOptimistic_TracksGeneration(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalWd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(originalWd)
+	}()
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatal(err)
+	}
+
+	// No index yet reads as empty.
+	index, err := LoadIndexOptimistic()
+	if err != nil || len(index) != 0 {
+		t.Fatalf("empty repo: got %v, %v", index, err)
+	}
+
+	if err := WriteIndex(map[string]string{"a.txt": "aaaa"}); err != nil {
+		t.Fatal(err)
+	}
+	first, err := os.Stat(indexPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteIndex(map[string]string{"a.txt": "aaaa"}); err != nil {
+		t.Fatal(err)
+	}
+	second, err := os.Stat(indexPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Even a byte-identical rewrite is a new generation, because it replaces the file.
+	if sameGeneration(first, second) {
+		t.Error("rewritten index reported the same generation")
+	}
+	if !sameGeneration(second, second) {
+		t.Error("unchanged index reported a new generation")
+	}
+
+	index, err = LoadIndexOptimistic()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if index["a.txt"].Hash != "aaaa" {
+		t.Errorf("optimistic read = %v", index)
+	}
+}
+
+func TestWalkIndex_StreamsEntries(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalWd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(originalWd)
+	}()
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatal(err)
+	}
+
+	collect := func() map[string]IndexEntry {
+		t.Helper()
+		got := map[string]IndexEntry{}
+		if err := WalkIndex(func(path string, e IndexEntry) error {
+			got[path] = e
+			return nil
+		}); err != nil {
+			t.Fatalf("WalkIndex failed: %v", err)
+		}
+		return got
+	}
+
+	if got := collect(); len(got) != 0 {
+		t.Fatalf("walk without an index = %v", got)
+	}
+
+	if err := os.MkdirAll(RepoDir(), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	mixed := `{"old.txt":"aaaa","src\\main.go":{"h":"bbbb","m":5,"s":7}}`
+	if err := os.WriteFile(indexPath(), []byte(mixed), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	got := collect()
+	if got["old.txt"] != (IndexEntry{Hash: "aaaa"}) || got["src/main.go"] != (IndexEntry{Hash: "bbbb", ModTime: 5, Size: 7}) || len(got) != 2 {
+		t.Errorf("walk of mixed-format index = %v", got)
+	}
+
+	defer func(prev func() bool) { IndexCompression = prev }(IndexCompression)
+	IndexCompression = func() bool { return true }
+	want := map[string]IndexEntry{
+		"a.txt":     {Hash: "1111", Size: 1},
+		"b/c.txt":   {Hash: "2222", Flags: FlagSkipWorktree},
+		"b/d/e.txt": {Hash: "3333"},
+	}
+	if err := WriteIndexWithMeta(want); err != nil {
+		t.Fatal(err)
+	}
+	got = collect()
+	if len(got) != len(want) {
+		t.Fatalf("walk of compressed index = %v, want %v", got, want)
+	}
+	for path, e := range want {
+		if got[path] != e {
+			t.Errorf("entry %s = %+v, want %+v", path, got[path], e)
+		}
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err = WalkIndex(func(string, IndexEntry) error {
+		calls++
+		return stop
+	})
+	if err != stop || calls != 1 {
+		t.Errorf("callback error: err=%v after %d calls, want stop after 1", err, calls)
+	}
+}
+
+func TestLoadIndexPrefix_SelectsSubtree(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalWd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(originalWd)
+	}()
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(RepoDir(), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := WriteIndexWithMeta(map[string]IndexEntry{
+		"pkg/a.go":     {Hash: "1111"},
+		"pkg/sub/b.go": {Hash: "2222"},
+		"pkgs/c.go":    {Hash: "3333"},
+		"pkg.go":       {Hash: "4444"},
+		"root.txt":     {Hash: "5555"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	for prefix, want := range map[string][]string{
+		"pkg":         {"pkg/a.go", "pkg/sub/b.go"},
+		"./pkg/":      {"pkg/a.go", "pkg/sub/b.go"},
+		"pkg/sub":     {"pkg/sub/b.go"},
+		"pkg/a.go":    {"pkg/a.go"},
+		"missing":     {},
+		".":           {"pkg.go", "pkg/a.go", "pkg/sub/b.go", "pkgs/c.go", "root.txt"},
+		"":            {"pkg.go", "pkg/a.go", "pkg/sub/b.go", "pkgs/c.go", "root.txt"},
+		"pkg/../pkgs": {"pkgs/c.go"},
+	} {
+		got, err := LoadIndexPrefix(prefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths := make([]string, 0, len(got))
+		for path := range got {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		if strings.Join(paths, ",") != strings.Join(want, ",") {
+			t.Errorf("LoadIndexPrefix(%q) = %v, want %v", prefix, paths, want)
+		}
+	}
+}
+
+func TestLoadIndexBestEffort_RecoversIntactEntries(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalWd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(originalWd)
+	}()
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(RepoDir(), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := WriteIndexWithMeta(map[string]IndexEntry{"a.txt": {Hash: "aaaa"}}); err != nil {
+		t.Fatal(err)
+	}
+	index, report, err := LoadIndexBestEffort()
+	if err != nil || report != (IndexRecovery{Recovered: 1}) || index["a.txt"].Hash != "aaaa" {
+		t.Fatalf("intact index: %v, %+v, %v", index, report, err)
+	}
+
+	damaged := `{"a.txt":{"h":"aaaa","m":1,"s":2},"b.txt":{"h":"bb` + "\x00\x00\x00\x00" + `},` +
+		`"c\\d.txt":"cccc","d.txt":{"h":12},"e.txt":{"h":"eeee","s":3},"f.txt":{"h":"ff`
+	if err := os.WriteFile(indexPath(), []byte(damaged), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadIndexWithMeta(); err == nil {
+		t.Fatal("strict load accepted a damaged index")
+	}
+	index, report, err = LoadIndexBestEffort()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]IndexEntry{
+		"a.txt":   {Hash: "aaaa", ModTime: 1, Size: 2},
+		"c/d.txt": {Hash: "cccc"},
+		"e.txt":   {Hash: "eeee", Size: 3},
+	}
+	if report != (IndexRecovery{Damaged: true, Recovered: 3, Lost: 3}) {
+		t.Errorf("report = %+v, want 3 recovered and 3 lost", report)
+	}
+	if len(index) != len(want) {
+		t.Errorf("recovered %v, want %v", index, want)
+	}
+	for path, e := range want {
+		if index[path] != e {
+			t.Errorf("entry %s = %+v, want %+v", path, index[path], e)
+		}
+	}
+
+	// A truncated compressed index is recovered up to the point of damage.
+	defer func(prev func() bool) { IndexCompression = prev }(IndexCompression)
+	IndexCompression = func() bool { return true }
+	full := make(map[string]IndexEntry)
+	for i := 0; i < 500; i++ {
+		full[fmt.Sprintf("dir/file%03d.txt", i)] = IndexEntry{Hash: fmt.Sprintf("%040x", i), Size: int64(i)}
+	}
+	if err := WriteIndexWithMeta(full); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(indexPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(indexPath(), content[:len(content)*3/4], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	index, report, err = LoadIndexBestEffort()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Damaged || report.Recovered == 0 || report.Recovered >= len(full) || report.Recovered != len(index) {
+		t.Fatalf("truncated compressed index: %+v", report)
+	}
+	for path, e := range index {
+		if full[path] != e {
+			t.Errorf("recovered %s = %+v, want %+v", path, e, full[path])
+		}
+	}
+}
+
+func TestUpdateIndexWithMeta_SavepointAndAbort(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalWd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(originalWd)
+	}()
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatal(err)
+	}
+	const hash = "da39a3ee5e6b4b0d3255bfef95601890afd80709"
+	if err := WriteIndex(map[string]string{"a.txt": hash}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A failed step is rolled back; the steps before it are written.
+	err = UpdateIndexWithMeta(func(index map[string]IndexEntry) error {
+		index["b.txt"] = IndexEntry{Hash: hash}
+		sp := NewIndexSavepoint(index)
+		index["c.txt"] = IndexEntry{Hash: hash}
+		delete(index, "a.txt")
+		sp.RollbackTo(index)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err := LoadIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(index) != fmt.Sprint(map[string]string{"a.txt": hash, "b.txt": hash}) {
+		t.Errorf("index after rollback = %v", index)
+	}
+
+	// Aborting writes nothing and is not an error.
+	err = UpdateIndexWithMeta(func(index map[string]IndexEntry) error {
+		delete(index, "a.txt")
+		return fmt.Errorf("nothing to do: %w", ErrAbortIndexUpdate)
+	})
+	if err != nil {
+		t.Fatalf("aborted update returned %v", err)
+	}
+	if index, err = LoadIndex(); err != nil || len(index) != 2 {
+		t.Errorf("index after abort = %v, %v", index, err)
+	}
+}
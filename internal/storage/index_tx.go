@@ -0,0 +1,295 @@
+package storage
+
+import (
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+)
+
+// ErrIndexUpdateDone is returned when an IndexUpdate is used after Commit or Close.
+var ErrIndexUpdateDone = errors.New("index update already finished")
+
+// ErrAbortIndexUpdate can be returned by an UpdateIndexWithMeta callback to end the update
+// without writing anything, as any error does, but without UpdateIndexWithMeta failing:
+// it then returns nil. It suits callbacks that find there is nothing to do.
+var ErrAbortIndexUpdate = errors.New("index update aborted")
+
+// IndexSavepoint is a copy of an index map taken in the middle of a transaction, so that a
+// multi-step change can undo its later steps when one of them fails and still commit the
+// earlier ones. Entries are values, so the copy is independent of the map.
+type IndexSavepoint struct {
+	entries map[string]IndexEntry
+}
+
+// NewIndexSavepoint records the current content of index.
+func NewIndexSavepoint(index map[string]IndexEntry) IndexSavepoint {
+	return IndexSavepoint{entries: maps.Clone(index)}
+}
+
+// RollbackTo puts index back to what it held when sp was taken. index is changed in place,
+// so it can be the map an UpdateIndexWithMeta callback or IndexUpdate.Index was given. sp can
+// be rolled back to again later.
+func (sp IndexSavepoint) RollbackTo(index map[string]IndexEntry) {
+	clear(index)
+	maps.Copy(index, sp.entries)
+}
+
+// IndexUpdate is a read-modify-write of the index under an update-intent lock: the index
+// is read with the intent to write it, so no other writer can change it between what the
+// update read and what it writes, whether or not it ends up writing anything.
+//
+// Locking: BeginIndexUpdate takes the index's writer lock (the same one UpdateIndexWithMeta
+// and IndexLock use) exclusively and holds it until Commit or Close. There is no shared
+// phase to upgrade from, so two updates can never each wait for the other to stop reading;
+// the second simply waits for the first to finish, and then reads what it wrote. Plain
+// readers (LoadIndexWithMeta, LoadIndexOptimistic, WalkIndex) do not take the lock and keep
+// running during the whole update; they are only held off while Commit writes the file.
+// A caller that only reads should use one of those instead, as it holds no writer off, and
+// one that may not write at all can start with an IndexTx.
+//
+// Because the writer lock is per open file, a process holding an IndexUpdate must not call
+// UpdateIndexWithMeta or begin another IndexUpdate until it has finished the first one;
+// doing so blocks forever.
+type IndexUpdate struct {
+	lockFile *os.File
+	index    map[string]IndexEntry
+	done     bool
+}
+
+// BeginIndexUpdate takes the index's writer lock, waiting for any running writer to finish,
+// and reads the index. The caller must end the update with Commit or Close; deferring Close
+// is always safe.
+func BeginIndexUpdate() (*IndexUpdate, error) {
+	if err := os.MkdirAll(filepath.Dir(indexPath()), 0o755); err != nil {
+		return nil, err
+	}
+
+	l, err := lock(indexPath())
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := readIndexFile()
+	if err != nil {
+		unlock(l)
+		return nil, err
+	}
+	return &IndexUpdate{lockFile: l, index: index}, nil
+}
+
+// Index returns the index as read by BeginIndexUpdate. Changes made to it are written by
+// Commit.
+func (u *IndexUpdate) Index() map[string]IndexEntry {
+	return u.index
+}
+
+// Commit writes the index atomically and ends the update.
+func (u *IndexUpdate) Commit() error {
+	if u.done {
+		return ErrIndexUpdateDone
+	}
+	defer u.Close()
+
+	data, err := encodeIndex(u.index, indexPretty())
+	if err != nil {
+		return err
+	}
+	return writeIndexFile("update", data)
+}
+
+// Close ends the update without writing anything. Calling it again, or after Commit, does
+// nothing.
+func (u *IndexUpdate) Close() {
+	if u.done {
+		return
+	}
+	u.done = true
+	unlock(u.lockFile)
+}
+
+// errLockBusy is returned by tryLock when another holder has the lock.
+var errLockBusy = errors.New("lock is held")
+
+var (
+	// ErrIndexTxReadOnly is returned by IndexTx.Commit when the transaction was never upgraded.
+	ErrIndexTxReadOnly = errors.New("index transaction is read-only; call Upgrade before Commit")
+	// ErrIndexTxBusy is returned by IndexTx.Upgrade when another writer holds the index.
+	// Waiting could deadlock, as that writer may be waiting for this transaction to stop
+	// reading, so the transaction should be closed and started again.
+	ErrIndexTxBusy = errors.New("index is being updated by another writer; close the transaction and retry")
+	// ErrIndexTxDone is returned when an IndexTx is used after Commit or Close.
+	ErrIndexTxDone = errors.New("index transaction already finished")
+)
+
+// IndexTx is a read transaction on the index that can be promoted to a write without
+// releasing anything in between, for a caller that only finds out from what it reads
+// whether it has anything to write. Unlike an IndexUpdate it holds no other reader or
+// transaction off until it is upgraded.
+//
+// Locking: BeginIndexTx takes the shared side of the index's reader/writer gate, as
+// LoadIndexWithMeta does for the length of a read, and keeps it. Any number of
+// transactions and readers run together; writers wait for all of them before they write,
+// so the index stays as each transaction read it. Upgrade then takes the index's writer
+// lock, the upgrade slot, and only once it holds that lets go of the shared side: from then
+// on no other writer can start, so nothing can change the index between the read and
+// Commit. Two transactions upgrading at once would each wait for the other to stop
+// reading, and a writer holding the slot waits for this transaction before it writes, so
+// Upgrade never waits for the slot: only one upgrader proceeds, and any other gets
+// ErrIndexTxBusy. Without shared locks (see rlock) BeginIndexTx takes the writer lock at
+// once and Upgrade has nothing left to do.
+//
+// While a process holds an IndexTx it must not write the index any other way, such as
+// UpdateIndexWithMeta: the write would wait for the transaction's own shared lock or, after
+// Upgrade, for its writer lock, forever. Reading the index is fine.
+type IndexTx struct {
+	readLock  *os.File // shared side of the reader/writer gate, until Upgrade
+	writeLock *os.File // the writer lock, from Upgrade on
+	index     map[string]IndexEntry
+	writable  bool
+	done      bool
+}
+
+// BeginIndexTx starts a read-only transaction, waiting for any write in progress to finish.
+// The caller must end it with Commit or Close; deferring Close is always safe.
+func BeginIndexTx() (*IndexTx, error) {
+	if err := os.MkdirAll(filepath.Dir(indexPath()), 0o755); err != nil {
+		return nil, err
+	}
+	r, err := rlock(indexPath())
+	if err != nil {
+		return nil, err
+	}
+	tx := &IndexTx{readLock: r}
+	if r == nil {
+		if tx.writeLock, err = lock(indexPath()); err != nil {
+			return nil, err
+		}
+	}
+	if tx.index, err = readIndexFile(); err != nil {
+		tx.Close()
+		return nil, err
+	}
+	return tx, nil
+}
+
+// Index returns the transaction's view of the index. It must not be modified before
+// Upgrade; changes made after Upgrade are written by Commit.
+func (tx *IndexTx) Index() map[string]IndexEntry {
+	return tx.index
+}
+
+// Upgrade promotes the transaction to a writer, or fails with ErrIndexTxBusy if another
+// writer holds the index. The index is unchanged since BeginIndexTx, so decisions taken
+// while reading remain valid. Upgrading again does nothing.
+func (tx *IndexTx) Upgrade() error {
+	if tx.done {
+		return ErrIndexTxDone
+	}
+	if tx.writable {
+		return nil
+	}
+	if tx.writeLock == nil {
+		w, err := tryLock(indexPath())
+		if errors.Is(err, errLockBusy) {
+			return ErrIndexTxBusy
+		}
+		if err != nil {
+			return err
+		}
+		tx.writeLock = w
+	}
+	// The writer lock keeps every other writer out from here on. The shared side has to go,
+	// or Commit's own write would wait for it.
+	unlock(tx.readLock)
+	tx.readLock = nil
+	tx.writable = true
+	return nil
+}
+
+// Commit writes the index atomically and ends the transaction. It fails with
+// ErrIndexTxReadOnly, leaving the transaction open, unless Upgrade was called.
+func (tx *IndexTx) Commit() error {
+	if tx.done {
+		return ErrIndexTxDone
+	}
+	if !tx.writable {
+		return ErrIndexTxReadOnly
+	}
+	defer tx.Close()
+
+	data, err := encodeIndex(tx.index, indexPretty())
+	if err != nil {
+		return err
+	}
+	return writeIndexFile("update", data)
+}
+
+// Close ends the transaction without writing anything. Calling it again, or after Commit,
+// does nothing.
+func (tx *IndexTx) Close() {
+	if tx.done {
+		return
+	}
+	tx.done = true
+	unlock(tx.readLock)
+	unlock(tx.writeLock)
+}
+
+// ErrIndexLockReleased is returned by IndexLock.Update after Unlock.
+var ErrIndexLockReleased = errors.New("index lock already released")
+
+// IndexLock is the index's writer lock held across several updates, for a caller that must
+// keep other writers out between them, not only during each one. It is the same lock
+// UpdateIndexWithMeta and IndexUpdate take, so the re-entrancy rule of IndexUpdate applies:
+// while a process holds an IndexLock it must make its index changes through Update, never
+// through UpdateIndexWithMeta, RewriteIndex or an IndexUpdate, which would wait for the
+// lock forever.
+type IndexLock struct {
+	f *os.File
+}
+
+// LockIndex takes the index's writer lock, waiting for any running writer to finish.
+func LockIndex() (*IndexLock, error) {
+	if err := os.MkdirAll(filepath.Dir(indexPath()), 0o755); err != nil {
+		return nil, err
+	}
+	f, err := lock(indexPath())
+	if err != nil {
+		return nil, err
+	}
+	return &IndexLock{f: f}, nil
+}
+
+// Update is UpdateIndexWithMeta under the held lock: it loads the index, runs fn and writes
+// the result, keeping the lock afterwards. As there, nothing is written when fn fails, and
+// ErrAbortIndexUpdate is not an error.
+func (l *IndexLock) Update(fn func(index map[string]IndexEntry) error) error {
+	if l == nil || l.f == nil {
+		return ErrIndexLockReleased
+	}
+	index, err := readIndexFile()
+	if err != nil {
+		return err
+	}
+	if err := fn(index); err != nil {
+		if errors.Is(err, ErrAbortIndexUpdate) {
+			return nil
+		}
+		return err
+	}
+	data, err := encodeIndex(index, indexPretty())
+	if err != nil {
+		return err
+	}
+	return writeIndexFile("update", data)
+}
+
+// Unlock releases the lock. It is safe to call more than once, and on a nil *IndexLock.
+func (l *IndexLock) Unlock() {
+	if l == nil || l.f == nil {
+		return
+	}
+	unlock(l.f)
+	l.f = nil
+}
@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// EnvRecordIndexOps turns recording of index operations on or off ("1" or "0") for one
+// process, whatever RecordIndexOps says.
+const EnvRecordIndexOps = "KITCAT_RECORD_INDEX_OPS"
+
+// RecordIndexOps, when set, is consulted on every index write; returning true appends the
+// write's effect to the index operation log (see IndexOp). $KITCAT_RECORD_INDEX_OPS, when
+// set, takes precedence. The core package wires it to the index.recordOps config key.
+var RecordIndexOps func() bool
+
+// IndexOp is one record of the index operation log: an index write, the command that made
+// it, and the entries it changed. Recording is off by default; it is meant for reproducing
+// index bugs, by replaying a log captured in one repository into a fresh one with
+// ReplayIndexOps.
+type IndexOp struct {
+	Time time.Time `json:"time"`
+	// Op is the kind of write: "update", "write", "compact", "downgrade", "normalize" or
+	// "rewrite".
+	Op string `json:"op"`
+	// Args is the command line of the process that made the write.
+	Args    []string      `json:"args,omitempty"`
+	Changes []IndexChange `json:"changes"`
+}
+
+// IndexChange is the effect of an IndexOp on one path. Before is nil for an entry the
+// write added and After is nil for one it removed.
+type IndexChange struct {
+	Path   string      `json:"path"`
+	Before *IndexEntry `json:"before,omitempty"`
+	After  *IndexEntry `json:"after,omitempty"`
+}
+
+// recordingIndexOps reports whether index writes are being recorded.
+func recordingIndexOps() bool {
+	if value := os.Getenv(EnvRecordIndexOps); value != "" {
+		on, err := strconv.ParseBool(value)
+		return err == nil && on
+	}
+	return RecordIndexOps != nil && RecordIndexOps()
+}
+
+// diffIndexEntries returns the changes that turn before into after, sorted by path.
+func diffIndexEntries(before, after map[string]IndexEntry) []IndexChange {
+	var changes []IndexChange
+	for path, old := range before {
+		if cur, ok := after[path]; !ok {
+			changes = append(changes, IndexChange{Path: path, Before: &old})
+		} else if cur != old {
+			changes = append(changes, IndexChange{Path: path, Before: &old, After: &cur})
+		}
+	}
+	for path, cur := range after {
+		if _, ok := before[path]; !ok {
+			changes = append(changes, IndexChange{Path: path, After: &cur})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+// recordIndexOp appends op to the index operation log with the changes from before to
+// after; a write that changed nothing is not recorded. Recording is best effort and never
+// fails the write it describes, which has already happened.
+func recordIndexOp(op string, before, after map[string]IndexEntry) {
+	changes := diffIndexEntries(before, after)
+	if len(changes) == 0 {
+		return
+	}
+	entry := IndexOp{Time: time.Now().UTC(), Op: op, Args: os.Args[1:], Changes: changes}
+	if err := appendIndexOp(entry); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: could not record index operation: %v\n", err)
+	}
+}
+
+// appendIndexOp adds entry to the end of the index operation log, as one JSON line.
+func appendIndexOp(entry IndexOp) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	// Lock the file so concurrent entries are never interleaved
+	lockFile, err := lock(indexOpsPath())
+	if err != nil {
+		return err
+	}
+	defer unlock(lockFile)
+
+	f, err := os.OpenFile(indexOpsPath(), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := f.Write(line); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// ReadIndexOps parses an index operation log, oldest first. As with the operation log, a
+// final line without a newline is an entry whose write was interrupted and is ignored.
+func ReadIndexOps(r io.Reader) ([]IndexOp, error) {
+	ops := []IndexOp{}
+	br := bufio.NewReader(r)
+	for lineNo := 1; ; lineNo++ {
+		line, err := br.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			return ops, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		var op IndexOp
+		if err := json.Unmarshal(line, &op); err != nil {
+			return nil, fmt.Errorf("corrupt index operation log at line %d: %w", lineNo, err)
+		}
+		ops = append(ops, op)
+	}
+}
+
+// ReplayIndexOps applies the operations of an index operation log to the current index,
+// each in its own update, and returns how many it applied. Only the after side of each
+// change is applied: entries are set or removed, and the before side is not checked, so a
+// log whose recording started in the middle of a repository's life still replays. Replayed
+// entries name objects the repository may not have; the index is all that is reproduced.
+func ReplayIndexOps(r io.Reader) (int, error) {
+	ops, err := ReadIndexOps(r)
+	if err != nil {
+		return 0, err
+	}
+	for i, op := range ops {
+		err := UpdateIndexWithMeta(func(index map[string]IndexEntry) error {
+			for _, change := range op.Changes {
+				if change.After == nil {
+					delete(index, change.Path)
+				} else {
+					index[change.Path] = *change.After
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return i, fmt.Errorf("replaying operation %d (%s): %w", i+1, op.Op, err)
+		}
+	}
+	return len(ops), nil
+}
@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"bytes"
+	"maps"
+	"os"
+	"testing"
+)
+
+func TestReplayIndexOps_ReproducesRecordedIndex(t *testing.T) {
+	originalWd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(originalWd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(EnvRecordIndexOps, "1")
+
+	const hash1 = "da39a3ee5e6b4b0d3255bfef95601890afd80709"
+	const hash2 = "a94a8fe5ccb19ba61c4c0873d391e987982fbbd3"
+	if err := WriteIndex(map[string]string{"a.txt": hash1, "b.txt": hash1}); err != nil {
+		t.Fatal(err)
+	}
+	err = UpdateIndexWithMeta(func(index map[string]IndexEntry) error {
+		index["a.txt"] = IndexEntry{Hash: hash2, Size: 4, ModTime: 1700000000}
+		delete(index, "b.txt")
+		index["c.txt"] = IndexEntry{Hash: "", Flags: FlagSkipWorktree}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A write that changes nothing is not recorded.
+	if err := UpdateIndexWithMeta(func(map[string]IndexEntry) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CompactIndex(); err != nil {
+		t.Fatal(err)
+	}
+	want, err := LoadIndexWithMeta()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log, err := os.ReadFile(indexOpsPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ops, err := ReadIndexOps(bytes.NewReader(log))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kinds []string
+	for _, op := range ops {
+		kinds = append(kinds, op.Op)
+	}
+	if len(kinds) != 3 || kinds[0] != "write" || kinds[1] != "update" || kinds[2] != "compact" {
+		t.Fatalf("recorded ops = %v, want [write update compact]", kinds)
+	}
+	if c := ops[1].Changes[0]; c.Path != "a.txt" || c.Before.Hash != hash1 || c.After.Hash != hash2 {
+		t.Errorf("first change of update = %+v", c)
+	}
+
+	// Replaying into a fresh repository, with recording off, rebuilds the same index.
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(EnvRecordIndexOps, "0")
+	applied, err := ReplayIndexOps(bytes.NewReader(log))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if applied != 3 {
+		t.Errorf("applied %d operations, want 3", applied)
+	}
+	got, err := LoadIndexWithMeta()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !maps.Equal(got, want) {
+		t.Errorf("replayed index = %v, want %v", got, want)
+	}
+	if _, err := os.Stat(indexOpsPath()); !os.IsNotExist(err) {
+		t.Errorf("replay with recording off wrote a log: %v", err)
+	}
+}
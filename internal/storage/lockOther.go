@@ -8,13 +8,52 @@ import (
 	"time"
 )
 
+// lockTimeout bounds how long lock, rlock and wlock wait before giving up.
+const lockTimeout = 5 * time.Second
+
 // lock implements a spin-lock using atomic file creation.
 // On Windows/non-Unix, we can't easily use syscall.Flock, so we use the existence
 // of the lock file as the lock itself.
 func lock(path string) (*os.File, error) {
-	lockFile := path + ".lock"
+	return createLockFile(path + ".lock")
+}
+
+// tryLock is lock without waiting: it fails with errLockBusy when the lock file exists.
+func tryLock(path string) (*os.File, error) {
+	f, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if os.IsExist(err) {
+		return nil, errLockBusy
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire lock: %w", err)
+	}
+	return f, nil
+}
 
-	timeout := time.After(5 * time.Second)
+// rlock waits until no writer holds path's reader/writer gate. Without flock there is
+// no shared lock to take, so readers only wait and rely on SafeWriteFile's atomic rename
+// for the rest; the returned file is always nil.
+func rlock(path string) (*os.File, error) {
+	gate := path + ".rwlock"
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		if _, err := os.Stat(gate); os.IsNotExist(err) {
+			return nil, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for writer on %s", path)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// wlock takes the exclusive side of path's reader/writer gate.
+func wlock(path string) (*os.File, error) {
+	return createLockFile(path + ".rwlock")
+}
+
+func createLockFile(lockFile string) (*os.File, error) {
+	timeout := time.After(lockTimeout)
 	ticker := time.NewTicker(10 * time.Millisecond)
 	defer ticker.Stop()
 
@@ -32,7 +71,7 @@ func lock(path string) (*os.File, error) {
 		// File exists, wait and retry
 		select {
 		case <-timeout:
-			return nil, fmt.Errorf("timed out acquiring lock for %s", path)
+			return nil, fmt.Errorf("timed out acquiring lock %s", lockFile)
 		case <-ticker.C:
 			continue
 		}
@@ -45,6 +84,9 @@ func LockFile(f *os.File) error {
 }
 
 func unlock(f *os.File) {
+	if f == nil {
+		return
+	}
 	// Close and remove the lock file to release the lock
 	name := f.Name()
 	f.Close()
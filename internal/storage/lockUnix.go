@@ -3,18 +3,43 @@
 package storage
 
 import (
+	"errors"
 	"os"
 	"syscall"
 )
 
 // lock uses a real file lock (flock) on Unix systems
 func lock(path string) (*os.File, error) {
-	lockFile := path + ".lock"
-	f, err := os.OpenFile(lockFile, os.O_CREATE|os.O_RDWR, 0600)
+	return flockFile(path+".lock", os.O_RDWR, syscall.LOCK_EX)
+}
+
+// tryLock is lock without waiting: it fails with errLockBusy when the lock is held.
+func tryLock(path string) (*os.File, error) {
+	f, err := flockFile(path+".lock", os.O_RDWR, syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return nil, errLockBusy
+	}
+	return f, err
+}
+
+// rlock takes a shared lock on path's reader/writer gate (path + ".rwlock").
+// Any number of readers may hold it at once; wlock waits for all of them and
+// keeps new readers out until it is released.
+func rlock(path string) (*os.File, error) {
+	return flockFile(path+".rwlock", os.O_RDONLY, syscall.LOCK_SH)
+}
+
+// wlock takes the exclusive side of path's reader/writer gate.
+func wlock(path string) (*os.File, error) {
+	return flockFile(path+".rwlock", os.O_RDWR, syscall.LOCK_EX)
+}
+
+func flockFile(lockFile string, flag, how int) (*os.File, error) {
+	f, err := os.OpenFile(lockFile, os.O_CREATE|flag, 0600)
 	if err != nil {
 		return nil, err
 	}
-	if err := LockFile(f); err != nil {
+	if err := syscall.Flock(int(f.Fd()), how); err != nil {
 		f.Close()
 		return nil, err
 	}
@@ -28,6 +53,9 @@ func LockFile(f *os.File) error {
 
 // unlock releases the file lock on Unix systems
 func unlock(f *os.File) {
+	if f == nil {
+		return
+	}
 	_ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
 	f.Close()
 }
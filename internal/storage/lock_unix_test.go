@@ -0,0 +1,333 @@
+//go:build linux || darwin || freebsd
+
+package storage
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestIndexGate_ReadersShareWritersExclude(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalWd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(originalWd)
+	}()
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteIndex(map[string]string{"a.txt": "da39a3ee5e6b4b0d3255bfef95601890afd80709"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A held read lock does not stop other readers.
+	r, err := rlock(indexPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := LoadIndexWithMeta()
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("concurrent reader blocked on a shared lock")
+	}
+	unlock(r)
+
+	// An update whose callback is still running does not block readers either.
+	inCallback, release := make(chan struct{}), make(chan struct{})
+	updateDone := make(chan error, 1)
+	go func() {
+		updateDone <- UpdateIndexWithMeta(func(index map[string]IndexEntry) error {
+			close(inCallback)
+			<-release
+			index["b.txt"] = IndexEntry{Hash: "8843d7f92416211de9ebb963ff4ce28125932878"}
+			return nil
+		})
+	}()
+	<-inCallback
+	go func() {
+		_, err := LoadIndexWithMeta()
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("reader blocked while an update callback was running")
+	}
+	close(release)
+	if err := <-updateDone; err != nil {
+		t.Fatal(err)
+	}
+
+	// The write portion excludes readers until it finishes.
+	w, err := wlock(indexPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		_, err := LoadIndexWithMeta()
+		done <- err
+	}()
+	select {
+	case <-done:
+		t.Fatal("reader proceeded while the index was being written")
+	case <-time.After(100 * time.Millisecond):
+	}
+	unlock(w)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIndexUpdate_ExcludesOtherWriters(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalWd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(originalWd)
+	}()
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteIndex(map[string]string{"a.txt": "da39a3ee5e6b4b0d3255bfef95601890afd80709"}); err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := BeginIndexUpdate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer u.Close()
+
+	// Readers are not held off by an open update.
+	if _, err := LoadIndexWithMeta(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A competing writer waits for the update instead of slipping in between its read and
+	// its write.
+	updateDone := make(chan error, 1)
+	go func() {
+		updateDone <- UpdateIndexWithMeta(func(index map[string]IndexEntry) error {
+			if _, ok := index["b.txt"]; !ok {
+				t.Error("competing update did not see the first update's write")
+			}
+			index["c.txt"] = IndexEntry{Hash: "3333"}
+			return nil
+		})
+	}()
+	select {
+	case err := <-updateDone:
+		t.Fatalf("update ran during an open update (err=%v)", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	u.Index()["b.txt"] = IndexEntry{Hash: "2222"}
+	if err := u.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.Commit(); err != ErrIndexUpdateDone {
+		t.Errorf("second Commit = %v, want ErrIndexUpdateDone", err)
+	}
+	if err := <-updateDone; err != nil {
+		t.Fatal(err)
+	}
+
+	index, err := LoadIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if index["a.txt"] == "" || index["b.txt"] != "2222" || index["c.txt"] != "3333" {
+		t.Errorf("final index = %v, want a.txt, b.txt and c.txt", index)
+	}
+}
+
+func TestIndexTx_UpgradesWithOneUpgraderAtATime(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalWd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(originalWd)
+	}()
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteIndex(map[string]string{"a.txt": "da39a3ee5e6b4b0d3255bfef95601890afd80709"}); err != nil {
+		t.Fatal(err)
+	}
+	waiting := func(done <-chan error, what string) {
+		t.Helper()
+		select {
+		case err := <-done:
+			t.Fatalf("%s did not wait (err=%v)", what, err)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+
+	// A read-only transaction holds writers off until it ends
+	tx, err := BeginIndexTx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	updateDone := make(chan error, 1)
+	go func() {
+		updateDone <- UpdateIndexWithMeta(func(index map[string]IndexEntry) error {
+			index["b.txt"] = IndexEntry{Hash: "2222"}
+			return nil
+		})
+	}()
+	waiting(updateDone, "a write during a read transaction")
+	if err := tx.Commit(); err != ErrIndexTxReadOnly {
+		t.Errorf("Commit before Upgrade = %v, want ErrIndexTxReadOnly", err)
+	}
+	tx.Close()
+	if err := <-updateDone; err != nil {
+		t.Fatal(err)
+	}
+
+	// Transactions read side by side; the first to upgrade gets the slot and the other is
+	// turned away rather than left waiting for it
+	first, err := BeginIndexTx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	second, err := BeginIndexTx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+	if err := first.Upgrade(); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Upgrade(); err != ErrIndexTxBusy {
+		t.Fatalf("second Upgrade = %v, want ErrIndexTxBusy", err)
+	}
+	second.Close()
+
+	// Once upgraded, other writers wait for the commit and then see it
+	go func() {
+		updateDone <- UpdateIndexWithMeta(func(index map[string]IndexEntry) error {
+			if _, ok := index["c.txt"]; !ok {
+				t.Error("update did not see the transaction's write")
+			}
+			index["d.txt"] = IndexEntry{Hash: "4444"}
+			return nil
+		})
+	}()
+	waiting(updateDone, "a write during an upgraded transaction")
+	if _, ok := first.Index()["b.txt"]; !ok {
+		t.Error("transaction did not read the earlier update")
+	}
+	first.Index()["c.txt"] = IndexEntry{Hash: "3333"}
+	if err := first.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Upgrade(); err != ErrIndexTxDone {
+		t.Errorf("Upgrade after Commit = %v, want ErrIndexTxDone", err)
+	}
+	if err := <-updateDone; err != nil {
+		t.Fatal(err)
+	}
+
+	index, err := LoadIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"a.txt", "b.txt", "c.txt", "d.txt"} {
+		if index[path] == "" {
+			t.Errorf("final index = %v, missing %s", index, path)
+		}
+	}
+}
+
+func TestRepoLock_ExclusiveWaitsForSharedHolders(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalWd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(originalWd)
+	}()
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteIndex(map[string]string{"a.txt": "da39a3ee5e6b4b0d3255bfef95601890afd80709"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Two writers of objects share the lock, and each can still update the index.
+	first, err := LockRepoShared()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := LockRepoShared()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := UpdateIndexWithMeta(func(index map[string]IndexEntry) error {
+		index["b.txt"] = IndexEntry{Hash: "2222"}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	acquired := make(chan *RepoLock, 1)
+	go func() {
+		l, err := LockRepoExclusive()
+		if err != nil {
+			t.Error(err)
+		}
+		acquired <- l
+	}()
+	first.Unlock()
+	select {
+	case <-acquired:
+		t.Fatal("exclusive lock granted while a shared holder remained")
+	case <-time.After(100 * time.Millisecond):
+	}
+	second.Unlock()
+	var exclusive *RepoLock
+	select {
+	case exclusive = <-acquired:
+	case <-time.After(2 * time.Second):
+		t.Fatal("exclusive lock not granted after every shared holder left")
+	}
+
+	// Now shared requests wait in turn.
+	shared := make(chan *RepoLock, 1)
+	go func() {
+		l, err := LockRepoShared()
+		if err != nil {
+			t.Error(err)
+		}
+		shared <- l
+	}()
+	select {
+	case <-shared:
+		t.Fatal("shared lock granted during an exclusive hold")
+	case <-time.After(100 * time.Millisecond):
+	}
+	exclusive.Unlock()
+	(<-shared).Unlock()
+	exclusive.Unlock() // a second Unlock is harmless
+}
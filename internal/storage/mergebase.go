@@ -0,0 +1,258 @@
+package storage
+
+import (
+	"container/heap"
+	"fmt"
+	"sort"
+)
+
+// Paint flags used by the merge-base walk.
+const (
+	reachFromA uint8 = 1 << iota
+	reachFromB
+	staleBase
+)
+
+// MergeBase returns the lowest common ancestors of a and b: common ancestors that are not
+// themselves ancestors of another common ancestor. Linear history yields one base; criss-cross
+// merges can yield several, ordered by descending generation.
+//
+// With an up-to-date commit graph the walk visits commits in generation order and stops as
+// soon as every remaining candidate is known to be below a found base. Without one it falls
+// back to intersecting the full ancestries.
+func MergeBase(a, b string) ([]string, error) {
+	if a == b {
+		return []string{a}, nil
+	}
+
+	graph, err := LoadCommitGraph()
+	if err != nil {
+		return nil, err
+	}
+	var bases []string
+	if graph != nil && graphCovers(graph, a, b) {
+		bases = mergeBaseByGeneration(graph, a, b)
+	} else {
+		bases, err = mergeBaseNaive(a, b)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	bases, err = removeRedundantBases(graph, bases)
+	if err != nil {
+		return nil, err
+	}
+	if len(bases) == 0 {
+		return nil, fmt.Errorf("no common ancestor found")
+	}
+	return bases, nil
+}
+
+func graphCovers(g *CommitGraph, ids ...string) bool {
+	for _, id := range ids {
+		if _, ok := g.nodes[id]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// generationQueue is a max-heap of commits keyed by generation number.
+type generationQueue struct {
+	ids   []string
+	graph *CommitGraph
+}
+
+func (q generationQueue) Len() int { return len(q.ids) }
+func (q generationQueue) Less(i, j int) bool {
+	return q.graph.nodes[q.ids[i]].Generation > q.graph.nodes[q.ids[j]].Generation
+}
+func (q generationQueue) Swap(i, j int) { q.ids[i], q.ids[j] = q.ids[j], q.ids[i] }
+func (q *generationQueue) Push(x any)   { q.ids = append(q.ids, x.(string)) }
+func (q *generationQueue) Pop() any {
+	last := q.ids[len(q.ids)-1]
+	q.ids = q.ids[:len(q.ids)-1]
+	return last
+}
+
+// mergeBaseByGeneration paints ancestors of a and b, highest generation first. A commit
+// reached from both sides is a candidate base; its ancestors are marked stale so they are
+// never reported, and the walk ends once only stale commits remain queued.
+func mergeBaseByGeneration(g *CommitGraph, a, b string) []string {
+	flags := map[string]uint8{a: reachFromA, b: reachFromB}
+	queue := &generationQueue{ids: []string{a, b}, graph: g}
+	heap.Init(queue)
+
+	var bases []string
+	for hasLiveEntries(queue, flags) {
+		id := heap.Pop(queue).(string)
+		f := flags[id]
+		if f&(reachFromA|reachFromB) == reachFromA|reachFromB {
+			if f&staleBase == 0 {
+				bases = append(bases, id)
+			}
+			f |= staleBase
+			flags[id] = f
+		}
+		for _, parent := range g.nodes[id].Parents {
+			if _, ok := g.nodes[parent]; !ok {
+				continue
+			}
+			if flags[parent]&f == f {
+				continue
+			}
+			flags[parent] |= f
+			heap.Push(queue, parent)
+		}
+	}
+	return bases
+}
+
+func hasLiveEntries(q *generationQueue, flags map[string]uint8) bool {
+	for _, id := range q.ids {
+		if flags[id]&staleBase == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeBaseNaive intersects the complete ancestries of a and b, read from the commit log.
+// Every ancestor of a common ancestor is itself common, so the lowest common ancestors
+// are exactly the common commits that are not a parent of another common commit.
+func mergeBaseNaive(a, b string) ([]string, error) {
+	parents, err := logParents(a, b)
+	if err != nil {
+		return nil, err
+	}
+
+	ancestorsA := ancestry(parents, a)
+	ancestorsB := ancestry(parents, b)
+	common := make(map[string]bool)
+	for id := range ancestorsA {
+		if ancestorsB[id] {
+			common[id] = true
+		}
+	}
+
+	shadowed := make(map[string]bool)
+	for id := range common {
+		for _, p := range parents[id] {
+			shadowed[p] = true
+		}
+	}
+	var bases []string
+	for id := range common {
+		if !shadowed[id] {
+			bases = append(bases, id)
+		}
+	}
+	return bases, nil
+}
+
+// logParents maps every commit in the commit log to its parents, after checking that each
+// of ids is there.
+func logParents(ids ...string) (map[string][]string, error) {
+	commits, err := ReadCommits()
+	if err != nil {
+		return nil, err
+	}
+	parents := make(map[string][]string, len(commits))
+	for _, c := range commits {
+		if c.Parent != "" {
+			parents[c.ID] = []string{c.Parent}
+		} else {
+			parents[c.ID] = nil
+		}
+	}
+	for _, id := range ids {
+		if _, ok := parents[id]; !ok {
+			return nil, fmt.Errorf("commit with hash %s not found", id)
+		}
+	}
+	return parents, nil
+}
+
+// AheadBehind counts the commits reachable from a but not from b (ahead) and those
+// reachable from b but not from a (behind), like `git rev-list --left-right --count a...b`.
+// related is false when the two histories share no commit at all. Parents come from the
+// commit graph when it covers both commits, otherwise from one read of the commit log.
+func AheadBehind(a, b string) (ahead, behind int, related bool, err error) {
+	if a == b {
+		return 0, 0, true, nil
+	}
+	var parents map[string][]string
+	if g, _ := LoadCommitGraph(); g != nil && graphCovers(g, a, b) {
+		parents = make(map[string][]string, len(g.nodes))
+		for id, n := range g.nodes {
+			parents[id] = n.Parents
+		}
+	} else if parents, err = logParents(a, b); err != nil {
+		return 0, 0, false, err
+	}
+
+	ancestorsA := ancestry(parents, a)
+	ancestorsB := ancestry(parents, b)
+	for id := range ancestorsA {
+		if ancestorsB[id] {
+			related = true
+		} else {
+			ahead++
+		}
+	}
+	behind = len(ancestorsB) - (len(ancestorsA) - ahead)
+	return ahead, behind, related, nil
+}
+
+// ancestry returns id and every commit reachable from it.
+func ancestry(parents map[string][]string, id string) map[string]bool {
+	seen := make(map[string]bool)
+	stack := []string{id}
+	for len(stack) > 0 {
+		current := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if seen[current] {
+			continue
+		}
+		seen[current] = true
+		stack = append(stack, parents[current]...)
+	}
+	return seen
+}
+
+// removeRedundantBases drops every candidate that is an ancestor of another candidate and
+// orders the rest by descending generation (or by hash when generations are unknown).
+func removeRedundantBases(g *CommitGraph, candidates []string) ([]string, error) {
+	var result []string
+	for i, c := range candidates {
+		redundant := false
+		for j, other := range candidates {
+			if i == j {
+				continue
+			}
+			isAnc, err := IsAncestor(c, other)
+			if err != nil {
+				return nil, err
+			}
+			if isAnc {
+				redundant = true
+				break
+			}
+		}
+		if !redundant {
+			result = append(result, c)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if g != nil {
+			gi, gj := g.nodes[result[i]].Generation, g.nodes[result[j]].Generation
+			if gi != gj {
+				return gi > gj
+			}
+		}
+		return result[i] < result[j]
+	})
+	return result, nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd
+
+package storage
+
+import "os"
+
+// hashMapped is unavailable without mmap; files are always streamed.
+func hashMapped(f *os.File, size int64) (hash string, ok bool) {
+	return "", false
+}
@@ -0,0 +1,34 @@
+//go:build linux || darwin || freebsd
+
+package storage
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"runtime/debug"
+	"syscall"
+)
+
+// hashMapped hashes the first size bytes of f through a read-only memory map. ok is false
+// when the file cannot be mapped or shrinks while it is read, which would otherwise crash
+// the process with SIGBUS; the caller then streams it instead.
+func hashMapped(f *os.File, size int64) (hash string, ok bool) {
+	if size <= 0 || int64(int(size)) != size {
+		return "", false
+	}
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return "", false
+	}
+	defer syscall.Munmap(data)
+
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	defer func() {
+		if recover() != nil {
+			hash, ok = "", false
+		}
+	}()
+	sum := sha1.Sum(data)
+	return hex.EncodeToString(sum[:]), true
+}
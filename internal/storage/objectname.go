@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ObjectNameLength, when set, returns how many hex digits of its hash a new loose object is
+// named with, to keep object paths short where the full 40 would exceed a path limit, as in
+// deeply nested Windows checkouts. Values outside MinObjectNameLength..40 mean the full
+// hash, the default. The core package wires it to the core.objectNameLength config key.
+// It is consulted once per operation holding a RepoLock (see objectSettings), otherwise
+// once per lookup of an object that has no full-length file.
+//
+// Two objects whose hashes share the truncated name are told apart by a disambiguator:
+// the second is stored as name-1, the next as name-2 and so on. Finding a loose object then
+// means hashing the candidates, so truncated names cost a read per lookup; objects with
+// full names, e.g. written before the setting was made, are still found first. Objects
+// written under one length are not found under another, so the length must not be changed
+// once objects have been written with it.
+var ObjectNameLength func() int
+
+// MinObjectNameLength is the shortest truncated object name accepted, 48 bits of the hash,
+// which makes a disambiguator a rarity even in large repositories.
+const MinObjectNameLength = 12
+
+// resolveObjectNameLength returns the configured length of loose object names.
+func resolveObjectNameLength() int {
+	if ObjectNameLength == nil {
+		return sha1.Size * 2
+	}
+	if n := ObjectNameLength(); n >= MinObjectNameLength && n < sha1.Size*2 {
+		return n
+	}
+	return sha1.Size * 2
+}
+
+// looseObjectPath returns the path of the loose object for hash and whether it exists.
+// When it does not, the path is the one the object is to be written to. See
+// ObjectNameLength for how truncated names are searched.
+func looseObjectPath(hash string) (string, bool) {
+	settings := currentObjectSettings()
+	full := filepath.Join(settings.dir, hash)
+	if _, err := os.Stat(full); err == nil {
+		return full, true
+	}
+	// Full-length names, the default, leave nothing else to search
+	n := settings.nameLength()
+	if n >= len(hash) {
+		return full, false
+	}
+	for i := 0; ; i++ {
+		name := hash[:n]
+		if i > 0 {
+			name += "-" + strconv.Itoa(i)
+		}
+		path := filepath.Join(settings.dir, name)
+		got, err := hashLooseFile(path)
+		if os.IsNotExist(err) {
+			return path, false
+		}
+		if err == nil && got == hash {
+			return path, true
+		}
+	}
+}
+
+// isTruncatedObjectName reports whether name, a file in the objects directory, is the name
+// of a loose object stored under a truncated hash, with or without a disambiguator.
+func isTruncatedObjectName(name string) bool {
+	prefix, suffix, disambiguated := strings.Cut(name, "-")
+	if len(prefix) < MinObjectNameLength || len(prefix) >= sha1.Size*2 ||
+		strings.Trim(prefix, "0123456789abcdef") != "" {
+		return false
+	}
+	if disambiguated {
+		if n, err := strconv.Atoi(suffix); err != nil || n < 1 {
+			return false
+		}
+	}
+	return true
+}
+
+// hashLooseFile returns the hex SHA-1 of the content of the file at path.
+func hashLooseFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha1.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
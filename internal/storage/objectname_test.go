@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestObjectNameLength_TruncatesAndDisambiguates(t *testing.T) {
+	originalWd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(originalWd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Written before the setting: keeps its full name and is still found.
+	old, err := WriteObject([]byte("old\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prev := ObjectNameLength
+	ObjectNameLength = func() int { return 12 }
+	defer func() { ObjectNameLength = prev }()
+
+	const hello = "f572d396fae9206628714fb2ce00f72e94f2258f"
+	// Another object already holds hello's truncated name, as on a collision.
+	if err := os.WriteFile(filepath.Join(objectsDir(), hello[:12]), []byte("other\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := WriteObject([]byte("hello\n"))
+	if err != nil || hash != hello {
+		t.Fatalf("WriteObject = %s, %v", hash, err)
+	}
+	if _, err := os.Stat(filepath.Join(objectsDir(), hello[:12]+"-1")); err != nil {
+		t.Fatalf("object not stored under its disambiguated name: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(objectsDir(), hello)); !os.IsNotExist(err) {
+		t.Errorf("object also stored under its full name: %v", err)
+	}
+	if again, err := WriteObject([]byte("hello\n")); err != nil || again != hello {
+		t.Errorf("rewriting = %s, %v", again, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(path, []byte("from a file\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fileHash, err := HashAndStoreFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(objectsDir(), fileHash[:12])); err != nil {
+		t.Errorf("HashAndStoreFile did not use the truncated name: %v", err)
+	}
+
+	for hash, want := range map[string]string{hello: "hello\n", old: "old\n", fileHash: "from a file\n"} {
+		data, err := ReadObject(hash)
+		if err != nil || string(data) != want {
+			t.Errorf("ReadObject(%s) = %q, %v, want %q", hash, data, err, want)
+		}
+		if !HasObject(hash) {
+			t.Errorf("HasObject(%s) = false", hash)
+		}
+	}
+	if HasObject("0123456789abcdef0123456789abcdef01234567") {
+		t.Error("HasObject reports a missing object")
+	}
+
+	list, err := DiskStore{}.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, hash := range []string{hello, old, fileHash} {
+		if !slices.Contains(list, hash) {
+			t.Errorf("List() = %v, missing %s", list, hash)
+		}
+	}
+	if resolved, err := ResolveHash(hello[:8]); err != nil || resolved != hello {
+		t.Errorf("ResolveHash(%s) = %s, %v", hello[:8], resolved, err)
+	}
+	if n, bad, err := VerifyObjects(t.Context(), 1); err != nil || len(bad) != 0 || n != len(list) {
+		t.Errorf("VerifyObjects = %d, %v, %v", n, bad, err)
+	}
+}
+
+func TestObjectNameLength_ResolvedOncePerLockAndSkippedWhenFull(t *testing.T) {
+	originalWd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(originalWd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(objectsDir(), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	const hello = "f572d396fae9206628714fb2ce00f72e94f2258f"
+	// hello stored under a truncated name is only found when truncated names are in use
+	if err := os.WriteFile(filepath.Join(objectsDir(), hello[:12]), []byte("hello\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	prev := ObjectNameLength
+	defer func() { ObjectNameLength = prev }()
+	for _, n := range []int{0, 40} {
+		ObjectNameLength = func() int { return n }
+		if path, ok := looseObjectPath(hello); ok || path != filepath.Join(objectsDir(), hello) {
+			t.Errorf("length %d: looseObjectPath = %s, %v, want the full name and no search", n, path, ok)
+		}
+	}
+
+	calls := 0
+	ObjectNameLength = func() int {
+		calls++
+		return 12
+	}
+	lock, err := LockRepoShared()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, content := range []string{"a\n", "b\n", "c\n"} {
+		if _, err := WriteObject([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok := looseObjectPath(hello); !ok {
+		t.Error("hello not found under its truncated name")
+	}
+	lock.Unlock()
+	if calls != 1 {
+		t.Errorf("ObjectNameLength consulted %d times under one lock, want 1", calls)
+	}
+}
@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestObjectStore_BackendsBehaveAlike(t *testing.T) {
+	originalWd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(originalWd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, store := range map[string]ObjectStore{"disk": DiskStore{}, "mem": NewMemStore()} {
+		t.Run(name, func(t *testing.T) {
+			const missing = "0123456789abcdef0123456789abcdef01234567"
+			if store.Has(missing) {
+				t.Error("empty store has an object")
+			}
+			if _, err := store.Read(missing); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("Read(missing) error = %v, want os.ErrNotExist", err)
+			}
+
+			hello, err := store.Write([]byte("hello\n"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hello != "f572d396fae9206628714fb2ce00f72e94f2258f" {
+				t.Errorf("hash = %s, want the SHA-1 of the content", hello)
+			}
+			again, err := store.Write([]byte("hello\n"))
+			if err != nil || again != hello {
+				t.Errorf("rewrite = %s, %v", again, err)
+			}
+			empty, err := store.Write(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !store.Has(hello) || !store.Has(empty) {
+				t.Error("written objects not found")
+			}
+			if data, err := store.Read(hello); err != nil || string(data) != "hello\n" {
+				t.Errorf("Read = %q, %v", data, err)
+			}
+			if data, err := store.Read(empty); err != nil || len(data) != 0 {
+				t.Errorf("Read(empty) = %q, %v", data, err)
+			}
+			if size, err := store.(objectSizer).Size(hello); err != nil || size != 6 {
+				t.Errorf("Size = %d, %v", size, err)
+			}
+			if _, err := store.(objectSizer).Size(missing); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("Size(missing) error = %v, want os.ErrNotExist", err)
+			}
+			listed, err := store.List()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := []string{empty, hello}; !reflect.DeepEqual(listed, want) {
+				t.Errorf("List = %v, want %v", listed, want)
+			}
+		})
+	}
+}
+
+func TestUseObjectStore_RoutesObjectsToMemory(t *testing.T) {
+	originalWd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(originalWd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	mem := NewMemStore()
+	restore := UseObjectStore(mem)
+	defer restore()
+
+	if err := os.WriteFile("a.txt", []byte("content\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	blob, err := HashAndStoreFile("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	treeHash, err := WriteTree(map[string]string{"a.txt": blob})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := ParseTree(treeHash)
+	if err != nil || tree["a.txt"] != blob {
+		t.Errorf("ParseTree = %v, %v", tree, err)
+	}
+	if full, err := ResolveHash(treeHash[:6]); err != nil || full != treeHash {
+		t.Errorf("ResolveHash = %s, %v", full, err)
+	}
+	if !mem.Has(blob) || !mem.Has(treeHash) {
+		t.Error("objects did not reach the memory store")
+	}
+	if _, err := os.Stat(objectsDir()); !os.IsNotExist(err) {
+		t.Errorf("objects directory touched: %v", err)
+	}
+
+	restore()
+	if HasObject(blob) {
+		t.Error("disk store sees objects written to memory")
+	}
+}
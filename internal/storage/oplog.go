@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// OpLogEntry is one record of the operation log: a mutating command that completed,
+// when it ran, and the refs and paths it affected.
+type OpLogEntry struct {
+	Time  time.Time `json:"time"`
+	Op    string    `json:"op"`
+	Refs  []string  `json:"refs,omitempty"`
+	Paths []string  `json:"paths,omitempty"`
+}
+
+// AppendOpLog adds an entry to the end of the operation log. The log is JSON lines and is
+// only ever appended to, one line per entry.
+func AppendOpLog(entry OpLogEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	if err := os.MkdirAll(RepoDir(), 0o755); err != nil {
+		return err
+	}
+
+	// Lock the file so concurrent entries are never interleaved
+	lockFile, err := lock(opLogPath())
+	if err != nil {
+		return err
+	}
+	defer unlock(lockFile)
+
+	f, err := os.OpenFile(opLogPath(), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := f.Write(line); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// ReadOpLog returns every entry of the operation log, oldest first. A missing log is
+// empty. A final line without a newline is an entry whose write was interrupted and is
+// ignored; any other line that does not parse is an error.
+func ReadOpLog() ([]OpLogEntry, error) {
+	f, err := os.Open(opLogPath())
+	if os.IsNotExist(err) {
+		return []OpLogEntry{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	entries := []OpLogEntry{}
+	r := bufio.NewReader(f)
+	for lineNo := 1; ; lineNo++ {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		var entry OpLogEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return nil, fmt.Errorf("corrupt operation log at line %d: %w", lineNo, err)
+		}
+		entries = append(entries, entry)
+	}
+}
+
+// RewriteOpLog keeps the entries for which keep returns true, in order, and returns how
+// many were dropped. It holds the lock AppendOpLog takes, so no entry is appended in the
+// meantime, and replaces the log atomically; a log that does not parse is left alone.
+func RewriteOpLog(keep func(OpLogEntry) bool) (int, error) {
+	lockFile, err := lock(opLogPath())
+	if err != nil {
+		return 0, err
+	}
+	defer unlock(lockFile)
+
+	entries, err := ReadOpLog()
+	if err != nil {
+		return 0, err
+	}
+	var buf bytes.Buffer
+	dropped := 0
+	for _, entry := range entries {
+		if !keep(entry) {
+			dropped++
+			continue
+		}
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return 0, err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	if dropped == 0 {
+		return 0, nil
+	}
+	if err := SafeWriteFile(opLogPath(), buf.Bytes(), 0o644); err != nil {
+		return 0, err
+	}
+	return dropped, nil
+}
@@ -0,0 +1,460 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"context"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	packMagic = "KPAK"
+	idxMagic  = "KIDX"
+	// packVersion is bumped whenever the on-disk pack layout changes.
+	packVersion = 1
+
+	packEntryFull  = 1
+	packEntryDelta = 2
+
+	// maxDeltaDepth bounds delta chains so reads never recurse unboundedly.
+	maxDeltaDepth = 50
+)
+
+// packDir returns the directory holding pack and pack index files.
+func packDir() string {
+	return filepath.Join(objectsDir(), "pack")
+}
+
+// PackCandidate is an object to be written into a pack.
+// Path is the repository path the object was found at (empty for trees);
+// objects sharing a Path are delta-compressed against each other.
+type PackCandidate struct {
+	Hash string
+	Path string
+}
+
+// PackStats summarizes a pack that was written.
+type PackStats struct {
+	Name    string
+	Objects int
+	Deltas  int
+	Size    int64
+}
+
+// packIndexEntry locates an object inside a pack file.
+type packIndexEntry struct {
+	hash   [20]byte
+	offset uint64
+}
+
+// packIndex is the parsed contents of a .idx file.
+type packIndex struct {
+	packPath string
+	entries  []packIndexEntry // sorted by hash
+}
+
+// Cache of parsed pack indexes, keyed by .idx path and invalidated on size/mtime change.
+var (
+	packCacheMu sync.Mutex
+	packCache   = make(map[string]cachedPackIndex)
+)
+
+type cachedPackIndex struct {
+	size    int64
+	modTime int64
+	idx     *packIndex
+}
+
+// BuildPack writes the given objects into a new pack under .kitcat/objects/pack.
+// Candidates are expected in chronological order. For each path the newest version
+// is stored whole and older versions are stored as deltas against the next newer one,
+// which keeps recent content cheap to read. A delta is only kept when it is less than
+// half the size of the object it replaces. Nothing is written if ctx is cancelled.
+func BuildPack(ctx context.Context, candidates []PackCandidate) (PackStats, error) {
+	// Deduplicate by hash, keeping the first occurrence.
+	seen := make(map[string]bool, len(candidates))
+	var objects []PackCandidate
+	for _, c := range candidates {
+		if seen[c.Hash] {
+			continue
+		}
+		seen[c.Hash] = true
+		objects = append(objects, c)
+	}
+	if len(objects) == 0 {
+		return PackStats{}, errors.New("nothing to pack")
+	}
+
+	// Group same-path objects so each version can use the next newer one as its base.
+	byPath := make(map[string][]string)
+	for _, o := range objects {
+		if o.Path != "" {
+			byPath[o.Path] = append(byPath[o.Path], o.Hash)
+		}
+	}
+	deltaBase := make(map[string]string)
+	for _, versions := range byPath {
+		for i := 0; i < len(versions)-1; i++ {
+			deltaBase[versions[i]] = versions[i+1]
+		}
+	}
+
+	var pack bytes.Buffer
+	pack.WriteString(packMagic)
+	binary.Write(&pack, binary.BigEndian, uint32(packVersion))
+	binary.Write(&pack, binary.BigEndian, uint32(len(objects)))
+
+	contents := make(map[string][]byte, len(objects))
+	readContent := func(hash string) ([]byte, error) {
+		if data, ok := contents[hash]; ok {
+			return data, nil
+		}
+		data, err := ReadObject(hash)
+		if err != nil {
+			return nil, err
+		}
+		contents[hash] = data
+		return data, nil
+	}
+
+	depth := make(map[string]int, len(objects))
+	var chainDepth func(hash string) int
+	chainDepth = func(hash string) int {
+		if d, ok := depth[hash]; ok {
+			return d
+		}
+		d := 0
+		if base, ok := deltaBase[hash]; ok {
+			d = chainDepth(base) + 1
+		}
+		depth[hash] = d
+		return d
+	}
+
+	stats := PackStats{Objects: len(objects)}
+	entries := make([]packIndexEntry, 0, len(objects))
+	for _, o := range objects {
+		if err := ctx.Err(); err != nil {
+			return PackStats{}, err
+		}
+		raw, err := hex.DecodeString(o.Hash)
+		if err != nil || len(raw) != 20 {
+			return PackStats{}, fmt.Errorf("invalid object hash %q", o.Hash)
+		}
+		data, err := readContent(o.Hash)
+		if err != nil {
+			return PackStats{}, fmt.Errorf("failed to read object %s: %w", o.Hash, err)
+		}
+
+		entryType := byte(packEntryFull)
+		payload := data
+		var baseRaw []byte
+		if base, ok := deltaBase[o.Hash]; ok && chainDepth(o.Hash) <= maxDeltaDepth {
+			baseData, err := readContent(base)
+			if err != nil {
+				return PackStats{}, fmt.Errorf("failed to read delta base %s: %w", base, err)
+			}
+			if delta := computeDelta(baseData, data); len(delta) < len(data)/2 {
+				entryType = packEntryDelta
+				payload = delta
+				baseRaw, _ = hex.DecodeString(base)
+				stats.Deltas++
+			} else {
+				// Not worth it: store whole and start a fresh chain from here.
+				delete(deltaBase, o.Hash)
+				depth[o.Hash] = 0
+			}
+		} else {
+			delete(deltaBase, o.Hash)
+			depth[o.Hash] = 0
+		}
+
+		var entry packIndexEntry
+		copy(entry.hash[:], raw)
+		entry.offset = uint64(pack.Len())
+		entries = append(entries, entry)
+
+		compressed, err := deflate(payload)
+		if err != nil {
+			return PackStats{}, err
+		}
+		pack.WriteByte(entryType)
+		if entryType == packEntryDelta {
+			pack.Write(baseRaw)
+		}
+		pack.Write(binary.AppendUvarint(nil, uint64(len(compressed))))
+		pack.Write(compressed)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return bytes.Compare(entries[i].hash[:], entries[j].hash[:]) < 0
+	})
+
+	// The pack name is derived from its sorted object list, so it is deterministic.
+	h := sha1.New()
+	for _, e := range entries {
+		h.Write(e.hash[:])
+	}
+	stats.Name = "pack-" + hex.EncodeToString(h.Sum(nil))
+
+	var idx bytes.Buffer
+	idx.WriteString(idxMagic)
+	binary.Write(&idx, binary.BigEndian, uint32(packVersion))
+	binary.Write(&idx, binary.BigEndian, uint32(len(entries)))
+	for _, e := range entries {
+		idx.Write(e.hash[:])
+		binary.Write(&idx, binary.BigEndian, e.offset)
+	}
+
+	base := filepath.Join(packDir(), stats.Name)
+	// Write the pack before its index so readers never see an index without data.
+	if err := SafeWriteFile(base+".pack", pack.Bytes(), 0o644); err != nil {
+		return PackStats{}, err
+	}
+	if err := SafeWriteFile(base+".idx", idx.Bytes(), 0o644); err != nil {
+		return PackStats{}, err
+	}
+
+	stats.Size = int64(pack.Len())
+	return stats, nil
+}
+
+// deflate zlib-compresses a pack entry payload.
+func deflate(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// loadPackIndexes returns every readable pack index in the repository.
+func loadPackIndexes() ([]*packIndex, error) {
+	matches, err := filepath.Glob(filepath.Join(packDir(), "pack-*.idx"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(matches)
+
+	packCacheMu.Lock()
+	defer packCacheMu.Unlock()
+
+	var indexes []*packIndex
+	for _, idxPath := range matches {
+		info, err := os.Stat(idxPath)
+		if err != nil {
+			continue
+		}
+		if cached, ok := packCache[idxPath]; ok &&
+			cached.size == info.Size() && cached.modTime == info.ModTime().UnixNano() {
+			indexes = append(indexes, cached.idx)
+			continue
+		}
+		idx, err := readPackIndex(idxPath)
+		if err != nil {
+			return nil, err
+		}
+		packCache[idxPath] = cachedPackIndex{size: info.Size(), modTime: info.ModTime().UnixNano(), idx: idx}
+		indexes = append(indexes, idx)
+	}
+	return indexes, nil
+}
+
+// readPackIndex parses a .idx file.
+func readPackIndex(idxPath string) (*packIndex, error) {
+	data, err := os.ReadFile(idxPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 12 || string(data[:4]) != idxMagic {
+		return nil, fmt.Errorf("corrupt pack index %s", idxPath)
+	}
+	if v := binary.BigEndian.Uint32(data[4:8]); v != packVersion {
+		return nil, fmt.Errorf("unsupported pack index version %d in %s", v, idxPath)
+	}
+	count := int(binary.BigEndian.Uint32(data[8:12]))
+	body := data[12:]
+	if len(body) != count*28 {
+		return nil, fmt.Errorf("corrupt pack index %s", idxPath)
+	}
+
+	idx := &packIndex{
+		packPath: strings.TrimSuffix(idxPath, ".idx") + ".pack",
+		entries:  make([]packIndexEntry, count),
+	}
+	for i := range idx.entries {
+		rec := body[i*28 : (i+1)*28]
+		copy(idx.entries[i].hash[:], rec[:20])
+		idx.entries[i].offset = binary.BigEndian.Uint64(rec[20:])
+	}
+	return idx, nil
+}
+
+// find returns the pack offset of an object, if present.
+func (p *packIndex) find(raw []byte) (uint64, bool) {
+	i := sort.Search(len(p.entries), func(i int) bool {
+		return bytes.Compare(p.entries[i].hash[:], raw) >= 0
+	})
+	if i < len(p.entries) && bytes.Equal(p.entries[i].hash[:], raw) {
+		return p.entries[i].offset, true
+	}
+	return 0, false
+}
+
+// readPackedObject looks up an object in all packs and reconstructs its content.
+func readPackedObject(hash string) ([]byte, error) {
+	return readPackedObjectDepth(hash, 0)
+}
+
+func readPackedObjectDepth(hash string, depth int) ([]byte, error) {
+	if depth > maxDeltaDepth {
+		return nil, fmt.Errorf("delta chain too deep for object %s", hash)
+	}
+	raw, err := hex.DecodeString(hash)
+	if err != nil || len(raw) != 20 {
+		return nil, os.ErrNotExist
+	}
+
+	indexes, err := loadPackIndexes()
+	if err != nil {
+		return nil, err
+	}
+	for _, idx := range indexes {
+		offset, ok := idx.find(raw)
+		if !ok {
+			continue
+		}
+		entryType, base, payload, err := readPackEntry(idx.packPath, offset)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s from %s: %w", hash, filepath.Base(idx.packPath), err)
+		}
+		if entryType == packEntryFull {
+			return payload, nil
+		}
+		baseData, err := readPackedObjectDepth(base, depth+1)
+		if err != nil {
+			// A delta base may also live as a loose object.
+			basePath, _ := looseObjectPath(base)
+			baseData, err = os.ReadFile(basePath)
+			if err != nil {
+				return nil, fmt.Errorf("missing delta base %s for %s", base, hash)
+			}
+		}
+		return applyDelta(baseData, payload)
+	}
+	return nil, os.ErrNotExist
+}
+
+// readPackEntry reads and decompresses a single entry at offset.
+func readPackEntry(packPath string, offset uint64) (byte, string, []byte, error) {
+	f, err := os.Open(packPath)
+	if err != nil {
+		return 0, "", nil, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(io.NewSectionReader(f, int64(offset), 1<<62))
+	entryType, err := r.ReadByte()
+	if err != nil {
+		return 0, "", nil, err
+	}
+
+	var base string
+	switch entryType {
+	case packEntryFull:
+	case packEntryDelta:
+		var raw [20]byte
+		if _, err := io.ReadFull(r, raw[:]); err != nil {
+			return 0, "", nil, err
+		}
+		base = hex.EncodeToString(raw[:])
+	default:
+		return 0, "", nil, fmt.Errorf("unknown pack entry type %d", entryType)
+	}
+
+	length, err := binary.ReadUvarint(r)
+	if err != nil {
+		return 0, "", nil, err
+	}
+	zr, err := zlib.NewReader(io.LimitReader(r, int64(length)))
+	if err != nil {
+		return 0, "", nil, err
+	}
+	defer zr.Close()
+	payload, err := io.ReadAll(zr)
+	if err != nil {
+		return 0, "", nil, err
+	}
+	return entryType, base, payload, nil
+}
+
+// PackedObjects returns the hashes of every object stored in a pack.
+func PackedObjects() ([]string, error) {
+	indexes, err := loadPackIndexes()
+	if err != nil {
+		return nil, err
+	}
+	var hashes []string
+	for _, idx := range indexes {
+		for _, e := range idx.entries {
+			hashes = append(hashes, hex.EncodeToString(e.hash[:]))
+		}
+	}
+	return hashes, nil
+}
+
+// PruneRedundant removes every pack other than keep, along with loose objects
+// that keep already contains. Callers must ensure keep holds everything worth keeping.
+func PruneRedundant(keep string) error {
+	keepIdx, err := readPackIndex(filepath.Join(packDir(), keep+".idx"))
+	if err != nil {
+		return err
+	}
+
+	matches, err := filepath.Glob(filepath.Join(packDir(), "pack-*"))
+	if err != nil {
+		return err
+	}
+	for _, m := range matches {
+		name := filepath.Base(m)
+		if strings.TrimSuffix(strings.TrimSuffix(name, ".idx"), ".pack") == keep {
+			continue
+		}
+		// Remove the index first so no reader resolves into a missing pack.
+		if strings.HasSuffix(name, ".pack") {
+			continue
+		}
+		if err := os.Remove(m); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err := os.Remove(strings.TrimSuffix(m, ".idx") + ".pack"); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	for _, e := range keepIdx.entries {
+		loose, ok := looseObjectPath(hex.EncodeToString(e.hash[:]))
+		if !ok {
+			continue
+		}
+		if err := os.Remove(loose); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
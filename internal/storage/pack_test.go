@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDeltaRoundTrip(t *testing.T) {
+	base := []byte(strings.Repeat("line of shared content\n", 200))
+	target := append([]byte("new header\n"), base[:2000]...)
+	target = append(target, []byte("inserted in the middle\n")...)
+	target = append(target, base[2000:]...)
+
+	delta := computeDelta(base, target)
+	if len(delta) >= len(target)/2 {
+		t.Errorf("expected a compact delta, got %d bytes for %d byte target", len(delta), len(target))
+	}
+
+	got, err := applyDelta(base, delta)
+	if err != nil {
+		t.Fatalf("applyDelta failed: %v", err)
+	}
+	if !bytes.Equal(got, target) {
+		t.Fatal("delta round trip produced different content")
+	}
+
+	if _, err := applyDelta(base[:10], delta); err == nil {
+		t.Error("expected error when applying delta to the wrong base")
+	}
+}
+
+func TestBuildPack_ReadsBackAfterPruning(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalWd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(originalWd)
+	}()
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatal(err)
+	}
+
+	// Three versions of the same file, each a small edit of the previous one.
+	content := strings.Repeat("package main // filler line\n", 100)
+	var candidates []PackCandidate
+	var versions [][]byte
+	for i := 0; i < 3; i++ {
+		content += "func v" + string(rune('a'+i)) + "() {}\n"
+		if err := os.WriteFile("main.go", []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		hash, err := HashAndStoreFile("main.go")
+		if err != nil {
+			t.Fatal(err)
+		}
+		candidates = append(candidates, PackCandidate{Hash: hash, Path: "main.go"})
+		versions = append(versions, []byte(content))
+	}
+
+	stats, err := BuildPack(context.Background(), candidates)
+	if err != nil {
+		t.Fatalf("BuildPack failed: %v", err)
+	}
+	if stats.Objects != 3 || stats.Deltas != 2 {
+		t.Errorf("expected 3 objects with 2 deltas, got %+v", stats)
+	}
+
+	if err := PruneRedundant(stats.Name); err != nil {
+		t.Fatalf("PruneRedundant failed: %v", err)
+	}
+
+	for i, c := range candidates {
+		if _, err := os.Stat(filepath.Join(objectsDir(), c.Hash)); !os.IsNotExist(err) {
+			t.Errorf("loose object %s should have been pruned", c.Hash)
+		}
+		if !HasObject(c.Hash) {
+			t.Errorf("HasObject(%s) = false after packing", c.Hash)
+		}
+		data, err := ReadObject(c.Hash)
+		if err != nil {
+			t.Fatalf("ReadObject(%s) failed: %v", c.Hash, err)
+		}
+		if !bytes.Equal(data, versions[i]) {
+			t.Errorf("version %d content mismatch after reading from pack", i)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Environment variables that relocate repository data, for scripts and tests that cannot
+// chdir into the working tree. Everywhere a location is resolved the precedence is:
+// explicit function argument > environment variable > default.
+const (
+	// EnvRepoDir overrides the location of the .kitcat directory.
+	EnvRepoDir = "KITCAT_DIR"
+	// EnvIndexFile overrides the location of the index file.
+	EnvIndexFile = "KITCAT_INDEX_FILE"
+	// EnvObjectsDir overrides the location of the object store, e.g. to keep it on another disk.
+	EnvObjectsDir = "KITCAT_OBJECTS"
+	// DefaultRepoDir is the repository directory relative to the working-tree root.
+	DefaultRepoDir = ".kitcat"
+)
+
+// ResolveRepoDir returns explicit if set, otherwise $KITCAT_DIR, otherwise DefaultRepoDir.
+func ResolveRepoDir(explicit string) string {
+	if explicit != "" {
+		return explicit
+	}
+	if dir := os.Getenv(EnvRepoDir); dir != "" {
+		return dir
+	}
+	return DefaultRepoDir
+}
+
+// ResolveIndexFile returns explicit if set, otherwise $KITCAT_INDEX_FILE, otherwise the
+// index inside the resolved repository directory.
+func ResolveIndexFile(explicit string) string {
+	if explicit != "" {
+		return explicit
+	}
+	if file := os.Getenv(EnvIndexFile); file != "" {
+		return file
+	}
+	return filepath.Join(ResolveRepoDir(""), "index")
+}
+
+// ObjectsDirConfig, when set, supplies the configured object store location ("" if unset).
+// It is consulted after $KITCAT_OBJECTS; the core package wires it to the core.objectsDir
+// config key.
+var ObjectsDirConfig func() string
+
+// ResolveObjectsDir returns the object store directory: explicit if set, otherwise
+// $KITCAT_OBJECTS, otherwise ObjectsDirConfig, otherwise "objects" inside the repository
+// directory. Other than the default, the location is resolved by WorkTreePath.
+func ResolveObjectsDir(explicit string) string {
+	dir := explicit
+	if dir == "" {
+		dir = os.Getenv(EnvObjectsDir)
+	}
+	if dir == "" && ObjectsDirConfig != nil {
+		dir = ObjectsDirConfig()
+	}
+	if dir == "" {
+		return repoPath("objects")
+	}
+	return WorkTreePath(dir)
+}
+
+// WorkTreePath resolves a configured location. Absolute paths are used as-is; relative
+// ones are taken relative to the working-tree root. Commands run from that root, which is
+// the directory containing .kitcat, or the current directory when KITCAT_DIR moves the
+// repository directory elsewhere, so a relative path is kept relative rather than joined
+// to the repository directory's parent.
+func WorkTreePath(path string) string {
+	return filepath.Clean(path)
+}
+
+// RepoDir returns the repository directory after applying environment overrides.
+func RepoDir() string {
+	return ResolveRepoDir("")
+}
+
+// repoPath joins elem onto the resolved repository directory.
+func repoPath(elem ...string) string {
+	return filepath.Join(append([]string{RepoDir()}, elem...)...)
+}
+
+func objectsDir() string      { return currentObjectSettings().dir }
+func indexPath() string       { return ResolveIndexFile("") }
+func commitsPath() string     { return repoPath("commits.log") }
+func stashPath() string       { return repoPath("stash.log") }
+func commitGraphPath() string { return repoPath("commit-graph") }
+func dirCachePath() string    { return repoPath("dircache") }
+func opLogPath() string       { return repoPath("oplog") }
+func indexOpsPath() string    { return repoPath("index-ops") }
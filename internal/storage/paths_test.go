@@ -0,0 +1,175 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolvePaths_Precedence(t *testing.T) {
+	t.Setenv(EnvRepoDir, "")
+	t.Setenv(EnvIndexFile, "")
+	if got := ResolveRepoDir(""); got != DefaultRepoDir {
+		t.Errorf("default repo dir = %q, want %q", got, DefaultRepoDir)
+	}
+	if got, want := ResolveIndexFile(""), filepath.Join(DefaultRepoDir, "index"); got != want {
+		t.Errorf("default index = %q, want %q", got, want)
+	}
+
+	t.Setenv(EnvRepoDir, "/env/repo")
+	if got, want := ResolveIndexFile(""), filepath.Join("/env/repo", "index"); got != want {
+		t.Errorf("index under KITCAT_DIR = %q, want %q", got, want)
+	}
+	t.Setenv(EnvIndexFile, "/env/index")
+	if got := ResolveIndexFile(""); got != "/env/index" {
+		t.Errorf("KITCAT_INDEX_FILE ignored: got %q", got)
+	}
+	if got := ResolveRepoDir("/explicit"); got != "/explicit" {
+		t.Errorf("explicit repo dir = %q, want /explicit", got)
+	}
+	if got := ResolveIndexFile("/explicit/index"); got != "/explicit/index" {
+		t.Errorf("explicit index = %q, want /explicit/index", got)
+	}
+}
+
+func TestWriteIndex_HonorsIndexFileOverride(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalWd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(originalWd)
+	}()
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatal(err)
+	}
+
+	alt := filepath.Join(tmpDir, "alt-index")
+	t.Setenv(EnvIndexFile, alt)
+
+	if err := WriteIndex(map[string]string{"a.txt": "da39a3ee5e6b4b0d3255bfef95601890afd80709"}); err != nil {
+		t.Fatalf("WriteIndex failed: %v", err)
+	}
+	if _, err := os.Stat(alt); err != nil {
+		t.Fatalf("index not written to KITCAT_INDEX_FILE: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(DefaultRepoDir, "index")); !os.IsNotExist(err) {
+		t.Errorf("default index should not exist, stat err = %v", err)
+	}
+
+	index, err := LoadIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if index["a.txt"] != "da39a3ee5e6b4b0d3255bfef95601890afd80709" {
+		t.Errorf("LoadIndex did not read the override: %v", index)
+	}
+}
+
+func TestResolveObjectsDir(t *testing.T) {
+	t.Setenv(EnvRepoDir, "")
+	t.Setenv(EnvObjectsDir, "")
+	defer func(prev func() string) { ObjectsDirConfig = prev }(ObjectsDirConfig)
+	ObjectsDirConfig = nil
+
+	if got, want := ResolveObjectsDir(""), filepath.Join(DefaultRepoDir, "objects"); got != want {
+		t.Errorf("default objects dir = %q, want %q", got, want)
+	}
+	ObjectsDirConfig = func() string { return "store" }
+	if got := ResolveObjectsDir(""); got != "store" {
+		t.Errorf("configured relative dir = %q, want store", got)
+	}
+	t.Setenv(EnvObjectsDir, "/fast/objects")
+	if got := ResolveObjectsDir(""); got != "/fast/objects" {
+		t.Errorf("KITCAT_OBJECTS ignored: got %q", got)
+	}
+	if got := ResolveObjectsDir("/explicit"); got != "/explicit" {
+		t.Errorf("explicit objects dir = %q, want /explicit", got)
+	}
+
+	// Relative locations follow the working-tree root, which is the current directory
+	// when KITCAT_DIR puts the repository directory somewhere else.
+	t.Setenv(EnvRepoDir, "/meta/repo.kitcat")
+	t.Setenv(EnvObjectsDir, "../store")
+	if got, want := ResolveObjectsDir(""), filepath.Join("..", "store"); got != want {
+		t.Errorf("relative KITCAT_OBJECTS = %q, want %q", got, want)
+	}
+}
+
+func TestHashAndStoreFile_HonorsObjectsOverride(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalWd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(originalWd)
+	}()
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatal(err)
+	}
+
+	store := filepath.Join(t.TempDir(), "objects")
+	t.Setenv(EnvObjectsDir, store)
+	if err := os.WriteFile("a.txt", []byte("elsewhere"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := HashAndStoreFile("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(store, hash)); err != nil {
+		t.Fatalf("object not written to KITCAT_OBJECTS: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(DefaultRepoDir, "objects", hash)); !os.IsNotExist(err) {
+		t.Errorf("object should not be in the default store, stat err = %v", err)
+	}
+	data, err := ReadObject(hash)
+	if err != nil || string(data) != "elsewhere" {
+		t.Errorf("ReadObject = %q, %v", data, err)
+	}
+}
+
+func TestRepoLock_ResolvesObjectsDirOnce(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalWd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(originalWd)
+	}()
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(DefaultRepoDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(EnvObjectsDir, "")
+	calls, configured := 0, "store-a"
+	ObjectsDirConfig = func() string {
+		calls++
+		return configured
+	}
+	defer func() { ObjectsDirConfig = nil }()
+
+	lock, err := LockRepoShared()
+	if err != nil {
+		t.Fatal(err)
+	}
+	configured = "store-b"
+	for range 3 {
+		if got := objectsDir(); got != "store-a" {
+			t.Errorf("objectsDir() under the lock = %q, want store-a as resolved when it was taken", got)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("ObjectsDirConfig consulted %d times under one lock, want 1", calls)
+	}
+	lock.Unlock()
+	lock.Unlock()
+	if got := objectsDir(); got != "store-b" {
+		t.Errorf("objectsDir() after unlocking = %q, want store-b", got)
+	}
+}
@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"os"
+	"sync"
+)
+
+// RepoLock is a held repository-wide lock, the gate between commands that add objects
+// and those that delete them. Commands that write objects and then reference them (add,
+// commit) take it shared, so any number of them run together; repack, which removes
+// packs and loose objects, takes it exclusively and so never runs while an object is
+// written but not yet referenced.
+//
+// Lock order: the repository lock comes first. Take it before the index or oplog lock and
+// never while holding either, and do not take it twice in one call chain: an exclusive
+// request waits for every shared holder, the caller's own included.
+//
+// Without flock (see rlock) the shared side only waits for a running repack to finish;
+// it does not hold repack off.
+//
+// A RepoLock also scopes an operation's object settings: while any is held, the objects
+// directory, object name length and durability mode are the ones resolved when the first
+// was taken (see objectSettings).
+type RepoLock struct {
+	f *os.File
+}
+
+// repoLockPath is the base name of the repository lock; the gate is repoLockPath() + ".rwlock".
+func repoLockPath() string {
+	return repoPath("repo")
+}
+
+// LockRepoShared takes the repository lock in shared mode for a command that writes objects.
+func LockRepoShared() (*RepoLock, error) {
+	f, err := rlock(repoLockPath())
+	if err != nil {
+		return nil, err
+	}
+	pinObjectSettings()
+	return &RepoLock{f: f}, nil
+}
+
+// LockRepoExclusive takes the repository lock exclusively for a command that deletes
+// objects, waiting for every shared holder to finish.
+func LockRepoExclusive() (*RepoLock, error) {
+	f, err := wlock(repoLockPath())
+	if err != nil {
+		return nil, err
+	}
+	pinObjectSettings()
+	return &RepoLock{f: f}, nil
+}
+
+// Unlock releases the lock. It is safe to call on a nil *RepoLock.
+func (l *RepoLock) Unlock() {
+	if l == nil || l.f == nil {
+		return
+	}
+	unlock(l.f)
+	l.f = nil
+	unpinObjectSettings()
+}
+
+// objectSettings are the configured settings every object read or write consults. Resolving
+// them goes through the config hooks, which read the config files, so an operation holding a
+// RepoLock resolves them once, when the first lock is taken, instead of for every object.
+type objectSettings struct {
+	dir string
+	// nameLen is the loose object name length, 0 until resolved: it is only needed to look
+	// up objects that have no full-length file, and no hook is consulted for the common
+	// lookup of an object that does.
+	nameLen int
+	// durability is the object durability mode, "" until resolved.
+	durability string
+}
+
+// nameLength returns the loose object name length, see ObjectNameLength.
+func (s objectSettings) nameLength() int {
+	if s.nameLen != 0 {
+		return s.nameLen
+	}
+	return resolveObjectNameLength()
+}
+
+// durabilityMode returns the object durability mode, see ObjectDurability.
+func (s objectSettings) durabilityMode() string {
+	if s.durability != "" {
+		return s.durability
+	}
+	return resolveObjectDurability()
+}
+
+// pinnedSettings holds the settings resolved for the RepoLocks held in this process.
+var pinnedSettings struct {
+	sync.Mutex
+	holders  int
+	settings objectSettings
+}
+
+func pinObjectSettings() {
+	pinnedSettings.Lock()
+	defer pinnedSettings.Unlock()
+	if pinnedSettings.holders == 0 {
+		pinnedSettings.settings = objectSettings{
+			dir:        ResolveObjectsDir(""),
+			nameLen:    resolveObjectNameLength(),
+			durability: resolveObjectDurability(),
+		}
+	}
+	pinnedSettings.holders++
+}
+
+func unpinObjectSettings() {
+	pinnedSettings.Lock()
+	defer pinnedSettings.Unlock()
+	pinnedSettings.holders--
+}
+
+// currentObjectSettings returns the settings pinned by a held RepoLock, or resolves them
+// afresh when none is held.
+func currentObjectSettings() objectSettings {
+	pinnedSettings.Lock()
+	defer pinnedSettings.Unlock()
+	if pinnedSettings.holders > 0 {
+		return pinnedSettings.settings
+	}
+	return objectSettings{dir: ResolveObjectsDir("")}
+}
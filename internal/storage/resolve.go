@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrObjectNotFound is returned when no stored object matches a hash prefix.
+	ErrObjectNotFound = errors.New("object not found")
+	// ErrAmbiguousObject is returned when a hash prefix matches more than one object.
+	ErrAmbiguousObject = errors.New("ambiguous object name")
+)
+
+// minHashPrefix is the shortest prefix accepted by ResolveHash, matching git's default.
+const minHashPrefix = 4
+
+// IsHashPrefix reports whether s, once lowercased and trimmed, is something ResolveHash
+// would look up: between minHashPrefix and 40 hex digits.
+func IsHashPrefix(s string) bool {
+	s = strings.ToLower(strings.TrimSpace(s))
+	return len(s) >= minHashPrefix && len(s) <= 40 && strings.Trim(s, "0123456789abcdef") == ""
+}
+
+// ResolveHash expands an abbreviated object hash to the full hash of the unique loose or
+// packed object that starts with prefix.
+func ResolveHash(prefix string) (string, error) {
+	prefix = strings.ToLower(strings.TrimSpace(prefix))
+	if len(prefix) == 40 && HasObject(prefix) {
+		return prefix, nil
+	}
+	if !IsHashPrefix(prefix) {
+		return "", fmt.Errorf("%w: %q is not a valid hash prefix", ErrObjectNotFound, prefix)
+	}
+
+	stored, err := objects.List()
+	if err != nil {
+		return "", err
+	}
+	var candidates []string
+	for _, hash := range stored {
+		if strings.HasPrefix(hash, prefix) {
+			candidates = append(candidates, hash)
+		}
+	}
+
+	switch len(candidates) {
+	case 0:
+		return "", fmt.Errorf("%w: %s", ErrObjectNotFound, prefix)
+	case 1:
+		return candidates[0], nil
+	}
+	return "", fmt.Errorf("%w %s: candidates are %s", ErrAmbiguousObject, prefix, strings.Join(candidates, ", "))
+}
@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveHash(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalWd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(originalWd)
+	}()
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatal(err)
+	}
+
+	var hashes []string
+	for _, content := range []string{"a", "b", "c"} {
+		hash, err := WriteObject([]byte(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes = append(hashes, hash)
+	}
+
+	got, err := ResolveHash(hashes[1][:6])
+	if err != nil {
+		t.Fatalf("ResolveHash failed: %v", err)
+	}
+	if got != hashes[1] {
+		t.Errorf("ResolveHash = %s, want %s", got, hashes[1])
+	}
+
+	// Place a second object sharing the first prefix to force ambiguity.
+	twin := hashes[0][:4] + "000000000000000000000000000000000000"
+	if err := os.WriteFile(filepath.Join(objectsDir(), twin), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ResolveHash(hashes[0][:4]); !errors.Is(err, ErrAmbiguousObject) {
+		t.Errorf("expected ErrAmbiguousObject, got %v", err)
+	}
+
+	if _, err := ResolveHash("ffff"); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("expected ErrObjectNotFound, got %v", err)
+	}
+}
@@ -4,11 +4,54 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
 )
 
+// TempDirConfig, when set, supplies the directory SafeWriteFile stages its temporary files
+// in ("" if unset, meaning next to the target). The core package wires it to the
+// core.tempDir config key.
+var TempDirConfig func() string
+
+// RenameRetry, when set, supplies how often SafeWriteFile retries a rename that failed
+// with a transient error and how long it waits before the first retry; the wait doubles
+// on each further one. The core package wires it to the core.renameRetries and
+// core.renameBackoff config keys.
+var RenameRetry func() (retries int, backoff time.Duration)
+
+// Defaults for RenameRetry: up to 5 retries over about 300ms in all. A single wait never
+// exceeds maxRenameBackoff, however many retries are configured.
+const (
+	DefaultRenameRetries = 5
+	DefaultRenameBackoff = 10 * time.Millisecond
+	maxRenameBackoff     = time.Second
+)
+
+// renameFile is os.Rename; tests replace it to simulate a cross-filesystem rename.
+var renameFile = os.Rename
+
+// deviceOf is fileDevice; tests replace it to simulate a temp directory on another filesystem.
+var deviceOf = fileDevice
+
+// tempDirUse is the key of tempDirUsable: a temp directory and the device of a target.
+type tempDirUse struct {
+	tmpDir, dev string
+}
+
+// tempDirUsable remembers, per tempDirUse, whether temp files in the directory can be
+// renamed onto that device, so the devices are compared once and a temp directory found
+// unusable, by comparison or by a failed rename, is reported once and not tried again.
+var tempDirUsable sync.Map
+
 // SafeWriteFile writes data to a file atomically and durably.
 // It uses a temporary file, syncs it to disk, then atomically renames it.
 // The parent directory is also synced to ensure the rename is durable.
+//
+// The temporary file is created next to the target unless TempDirConfig names another
+// directory. A rename is only atomic within one filesystem, so that directory is only
+// used for targets on the same device; otherwise, or when the rename still fails as a
+// cross-device one, the temp file goes next to the target, with a warning the first time.
 func SafeWriteFile(filename string, data []byte, perm os.FileMode) error {
 	// Ensure the parent directory exists
 	dir := filepath.Dir(filename)
@@ -16,12 +59,85 @@ func SafeWriteFile(filename string, data []byte, perm os.FileMode) error {
 		return fmt.Errorf("failed to create parent directory: %w", err)
 	}
 
+	if tmpDir := configuredTempDir(); tmpDir != "" && tempDirUsableFor(tmpDir, dir) {
+		tmpFile, err := os.CreateTemp(tmpDir, filepath.Base(filename)+".*.tmp")
+		if err != nil {
+			return fmt.Errorf("failed to create temp file: %w", err)
+		}
+		// os.CreateTemp creates files 0600
+		if err := tmpFile.Chmod(perm); err != nil && runtime.GOOS != "windows" {
+			tmpFile.Close()
+			os.Remove(tmpFile.Name())
+			return fmt.Errorf("failed to set permissions: %w", err)
+		}
+		err = writeAndRename(tmpFile, filename, data)
+		if err == nil {
+			_ = syncDir(dir)
+			return nil
+		}
+		if !isCrossDeviceError(err) {
+			return err
+		}
+		// On the same device, yet not renamable, as across bind mounts
+		if dev, ok := deviceOf(dir); ok {
+			tempDirUsable.Store(tempDirUse{tmpDir, dev}, false)
+		}
+		warnTempDirUnusable(tmpDir, dir)
+	}
+
 	// Write to a temporary file in the same directory
-	tmpPath := filename + ".tmp"
-	tmpFile, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	tmpFile, err := os.OpenFile(filename+".tmp", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
 	if err != nil {
 		return fmt.Errorf("failed to create temp file: %w", err)
 	}
+	if err := writeAndRename(tmpFile, filename, data); err != nil {
+		return err
+	}
+
+	// Sync the parent directory to ensure the rename is durable
+	// This is best-effort; on some platforms (like Windows) it may fail
+	_ = syncDir(dir)
+
+	return nil
+}
+
+// tempDirUsableFor reports whether temp files staged in tmpDir can be renamed into dir,
+// comparing the devices of the two once per device dir is on. When a device cannot be
+// determined the temp directory is tried, and the rename has the last word.
+func tempDirUsableFor(tmpDir, dir string) bool {
+	dev, ok := deviceOf(dir)
+	if !ok {
+		return true
+	}
+	key := tempDirUse{tmpDir, dev}
+	if usable, found := tempDirUsable.Load(key); found {
+		return usable.(bool)
+	}
+	tmpDev, ok := deviceOf(tmpDir)
+	usable := !ok || tmpDev == dev
+	if _, found := tempDirUsable.LoadOrStore(key, usable); !found && !usable {
+		warnTempDirUnusable(tmpDir, dir)
+	}
+	return usable
+}
+
+// warnTempDirUnusable reports that tmpDir cannot hold temp files for dir.
+func warnTempDirUnusable(tmpDir, dir string) {
+	fmt.Fprintf(os.Stderr, "warning: temp directory %s is not on the same filesystem as %s; writing temp files next to their target instead\n", tmpDir, dir)
+}
+
+// configuredTempDir returns the configured temp directory, or "" to use the target's.
+func configuredTempDir() string {
+	if TempDirConfig == nil {
+		return ""
+	}
+	return TempDirConfig()
+}
+
+// writeAndRename fills the open temp file with data, syncs and closes it, and renames it to
+// filename. The temp file is removed on any failure.
+func writeAndRename(tmpFile *os.File, filename string, data []byte) error {
+	tmpPath := tmpFile.Name()
 
 	// Write data to temp file
 	_, writeErr := tmpFile.Write(data)
@@ -47,18 +163,31 @@ func SafeWriteFile(filename string, data []byte, perm os.FileMode) error {
 	}
 
 	// Atomically rename temp file to target file
-	if err := os.Rename(tmpPath, filename); err != nil {
+	if err := renameWithRetry(tmpPath, filename); err != nil {
 		os.Remove(tmpPath) // Clean up temp file
 		return fmt.Errorf("failed to rename temp file: %w", err)
 	}
-
-	// Sync the parent directory to ensure the rename is durable
-	// This is best-effort; on some platforms (like Windows) it may fail
-	_ = syncDir(dir)
-
 	return nil
 }
 
+// renameWithRetry renames from to to, retrying with backoff while the rename fails with
+// an error isTransientRenameError accepts, such as a Windows sharing violation caused by
+// antivirus scanning the new file. Any other error is returned at once.
+func renameWithRetry(from, to string) error {
+	retries, wait := DefaultRenameRetries, DefaultRenameBackoff
+	if RenameRetry != nil {
+		retries, wait = RenameRetry()
+	}
+	for attempt := 0; ; attempt++ {
+		err := renameFile(from, to)
+		if err == nil || attempt >= retries || !isTransientRenameError(err) {
+			return err
+		}
+		time.Sleep(wait)
+		wait = min(2*wait, maxRenameBackoff)
+	}
+}
+
 // syncDir syncs a directory to ensure metadata changes (like renames) are durable
 // This is best-effort and may not work on all platforms (e.g., Windows)
 func syncDir(dir string) error {
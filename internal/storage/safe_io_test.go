@@ -1,9 +1,13 @@
 package storage
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
+	"runtime"
+	"syscall"
 	"testing"
+	"time"
 )
 
 func TestSafeWriteFile_Success(t *testing.T) {
@@ -179,3 +183,157 @@ func TestSafeWriteFile_LargeData(t *testing.T) {
 		t.Errorf("Content length mismatch. Expected %d, got %d", len(testData), len(content))
 	}
 }
+
+func TestSafeWriteFile_ConfiguredTempDir(t *testing.T) {
+	tmpDir := t.TempDir()
+	targetFile := filepath.Join(t.TempDir(), "test.txt")
+	defer func(prev func() string) { TempDirConfig = prev }(TempDirConfig)
+	TempDirConfig = func() string { return tmpDir }
+
+	if err := SafeWriteFile(targetFile, []byte("staged elsewhere"), 0644); err != nil {
+		t.Fatalf("SafeWriteFile failed: %v", err)
+	}
+	if content, err := os.ReadFile(targetFile); err != nil || string(content) != "staged elsewhere" {
+		t.Fatalf("target = %q, %v", content, err)
+	}
+	if leftovers, _ := os.ReadDir(tmpDir); len(leftovers) != 0 {
+		t.Errorf("temp directory not cleaned up: %v", leftovers)
+	}
+	if _, err := os.Stat(targetFile + ".tmp"); !os.IsNotExist(err) {
+		t.Error("temp file created next to the target")
+	}
+}
+
+func TestSafeWriteFile_CrossFilesystemTempDirFallsBack(t *testing.T) {
+	tmpDir := t.TempDir()
+	targetFile := filepath.Join(t.TempDir(), "test.txt")
+	defer func(prev func() string) { TempDirConfig = prev }(TempDirConfig)
+	TempDirConfig = func() string { return tmpDir }
+	defer func(prev func(string, string) error) { renameFile = prev }(renameFile)
+	fromTmpDir := 0
+	renameFile = func(from, to string) error {
+		if filepath.Dir(from) == tmpDir {
+			fromTmpDir++
+			return &os.LinkError{Op: "rename", Old: from, New: to, Err: syscall.EXDEV}
+		}
+		return os.Rename(from, to)
+	}
+
+	// The rename fails although the devices match, as across bind mounts; only the first
+	// write finds out
+	for _, content := range []string{"fallback", "fallback again"} {
+		if err := SafeWriteFile(targetFile, []byte(content), 0644); err != nil {
+			t.Fatalf("SafeWriteFile failed: %v", err)
+		}
+		if got, err := os.ReadFile(targetFile); err != nil || string(got) != content {
+			t.Fatalf("target = %q, %v", got, err)
+		}
+	}
+	if fromTmpDir != 1 {
+		t.Errorf("renames from the temp directory = %d, want 1", fromTmpDir)
+	}
+	if leftovers, _ := os.ReadDir(tmpDir); len(leftovers) != 0 {
+		t.Errorf("temp directory not cleaned up: %v", leftovers)
+	}
+}
+
+func TestSafeWriteFile_TempDirOnAnotherDeviceIsNotUsed(t *testing.T) {
+	tmpDir := t.TempDir()
+	targetFile := filepath.Join(t.TempDir(), "test.txt")
+	defer func(prev func() string) { TempDirConfig = prev }(TempDirConfig)
+	TempDirConfig = func() string { return tmpDir }
+	defer func(prev func(string) (string, bool)) { deviceOf = prev }(deviceOf)
+	lookups := 0
+	deviceOf = func(path string) (string, bool) {
+		if path == tmpDir {
+			lookups++
+			return "other", true
+		}
+		return "target", true
+	}
+	defer func(prev func(string, string) error) { renameFile = prev }(renameFile)
+	renameFile = func(from, to string) error {
+		if filepath.Dir(from) == tmpDir {
+			t.Errorf("temp file staged in %s, on another device", tmpDir)
+		}
+		return os.Rename(from, to)
+	}
+
+	for _, content := range []string{"first", "second"} {
+		if err := SafeWriteFile(targetFile, []byte(content), 0644); err != nil {
+			t.Fatalf("SafeWriteFile failed: %v", err)
+		}
+		if got, err := os.ReadFile(targetFile); err != nil || string(got) != content {
+			t.Fatalf("target = %q, %v", got, err)
+		}
+	}
+	if lookups != 1 {
+		t.Errorf("temp directory device looked up %d times, want once", lookups)
+	}
+}
+
+func TestIsCrossDeviceError(t *testing.T) {
+	crossDevice := syscall.EXDEV
+	if runtime.GOOS == "windows" {
+		crossDevice = syscall.Errno(17) // ERROR_NOT_SAME_DEVICE
+	}
+	if !isCrossDeviceError(&os.LinkError{Op: "rename", Err: crossDevice}) {
+		t.Errorf("isCrossDeviceError(%v) = false", crossDevice)
+	}
+	if isCrossDeviceError(&os.LinkError{Op: "rename", Err: syscall.ENOENT}) {
+		t.Error("isCrossDeviceError(ENOENT) = true")
+	}
+}
+
+func TestSafeWriteFile_RetriesTransientRename(t *testing.T) {
+	targetFile := filepath.Join(t.TempDir(), "test.txt")
+	defer func(prev func() (int, time.Duration)) { RenameRetry = prev }(RenameRetry)
+	RenameRetry = func() (int, time.Duration) { return 3, time.Millisecond }
+	defer func(prev func(string, string) error) { renameFile = prev }(renameFile)
+
+	transient := syscall.EBUSY
+	if runtime.GOOS == "windows" {
+		transient = syscall.Errno(32) // ERROR_SHARING_VIOLATION
+	}
+	calls := 0
+	renameFile = func(from, to string) error {
+		calls++
+		if calls < 3 {
+			return &os.LinkError{Op: "rename", Old: from, New: to, Err: transient}
+		}
+		return os.Rename(from, to)
+	}
+	if err := SafeWriteFile(targetFile, []byte("retried"), 0644); err != nil {
+		t.Fatalf("SafeWriteFile failed: %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("rename attempts = %d, want 3", calls)
+	}
+	if content, err := os.ReadFile(targetFile); err != nil || string(content) != "retried" {
+		t.Fatalf("target = %q, %v", content, err)
+	}
+
+	// Retries are bounded, and other errors are not retried at all.
+	for _, tc := range []struct {
+		err  error
+		want int
+	}{
+		{transient, 4},
+		{syscall.ENOENT, 1},
+	} {
+		calls = 0
+		renameFile = func(from, to string) error {
+			calls++
+			return &os.LinkError{Op: "rename", Old: from, New: to, Err: tc.err}
+		}
+		if err := SafeWriteFile(targetFile, []byte("fails"), 0644); !errors.Is(err, tc.err) {
+			t.Errorf("SafeWriteFile error = %v, want %v", err, tc.err)
+		}
+		if calls != tc.want {
+			t.Errorf("rename attempts for %v = %d, want %d", tc.err, calls, tc.want)
+		}
+		if _, err := os.Stat(targetFile + ".tmp"); !os.IsNotExist(err) {
+			t.Error("temp file left behind after a failed rename")
+		}
+	}
+}
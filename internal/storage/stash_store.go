@@ -8,8 +8,6 @@ import (
 	"strings"
 )
 
-const stashPath = ".kitcat/stash.log"
-
 var ErrNoStash = errors.New("no stash entries found")
 
 // PushStash appends a commit ID to the stash stack (LIFO)
@@ -19,18 +17,18 @@ func PushStash(commitID string) error {
 		return fmt.Errorf("commit ID cannot be empty")
 	}
 
-	if err := os.MkdirAll(".kitcat", 0o755); err != nil {
+	if err := os.MkdirAll(RepoDir(), 0o755); err != nil {
 		return err
 	}
 
 	// Lock the file to prevent concurrent writes
-	lockFile, err := lock(stashPath)
+	lockFile, err := lock(stashPath())
 	if err != nil {
 		return err
 	}
 	defer unlock(lockFile)
 
-	f, err := os.OpenFile(stashPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	f, err := os.OpenFile(stashPath(), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
 	if err != nil {
 		return err
 	}
@@ -60,14 +58,14 @@ func PopStash() (string, error) {
 	topStash := stashes[0]
 
 	// Lock the file for writing
-	lockFile, err := lock(stashPath)
+	lockFile, err := lock(stashPath())
 	if err != nil {
 		return "", err
 	}
 	defer unlock(lockFile)
 
 	// Rewrite the file without the top stash
-	tmpPath := stashPath + ".tmp"
+	tmpPath := stashPath() + ".tmp"
 	tmpFile, err := os.Create(tmpPath)
 	if err != nil {
 		return "", err
@@ -88,7 +86,7 @@ func PopStash() (string, error) {
 	}
 
 	// Replace the original file
-	if err := os.Rename(tmpPath, stashPath); err != nil {
+	if err := os.Rename(tmpPath, stashPath()); err != nil {
 		return "", err
 	}
 
@@ -113,11 +111,11 @@ func PeekStash() (string, error) {
 // ListStashes returns all stash commit IDs in order (newest first)
 // Returns an empty slice if no stashes exist
 func ListStashes() ([]string, error) {
-	if _, err := os.Stat(stashPath); os.IsNotExist(err) {
+	if _, err := os.Stat(stashPath()); os.IsNotExist(err) {
 		return []string{}, nil
 	}
 
-	f, err := os.Open(stashPath)
+	f, err := os.Open(stashPath())
 	if err != nil {
 		return nil, err
 	}
@@ -147,17 +145,17 @@ func ListStashes() ([]string, error) {
 // ClearStash removes all stash entries by truncating the stash file to size 0.
 func ClearStash() error {
 	// If the file doesn't exist, nothing to clear
-	if _, err := os.Stat(stashPath); os.IsNotExist(err) {
+	if _, err := os.Stat(stashPath()); os.IsNotExist(err) {
 		return nil
 	}
 
 	// Lock the file to prevent concurrent writes
-	lockFile, err := lock(stashPath)
+	lockFile, err := lock(stashPath())
 	if err != nil {
 		return err
 	}
 	defer unlock(lockFile)
 
 	// Truncate the file to size 0
-	return os.Truncate(stashPath, 0)
+	return os.Truncate(stashPath(), 0)
 }
@@ -0,0 +1,21 @@
+//go:build !windows
+
+package storage
+
+import (
+	"errors"
+	"syscall"
+)
+
+// isTransientRenameError reports whether a failed rename is worth retrying: only EBUSY,
+// which network filesystems return while another client holds the file. A permission
+// error here is real and fails at once.
+func isTransientRenameError(err error) bool {
+	return errors.Is(err, syscall.EBUSY)
+}
+
+// isCrossDeviceError reports whether a rename failed because from and to are on different
+// filesystems.
+func isCrossDeviceError(err error) bool {
+	return errors.Is(err, syscall.EXDEV)
+}
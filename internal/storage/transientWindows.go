@@ -0,0 +1,39 @@
+//go:build windows
+
+package storage
+
+import (
+	"errors"
+	"syscall"
+)
+
+// Windows error codes for a file another process holds open without sharing, as
+// antivirus and indexing services briefly do with files that were just written.
+const (
+	errorSharingViolation syscall.Errno = 32
+	errorLockViolation    syscall.Errno = 33
+)
+
+// errorNotSameDevice is what MoveFileEx, behind os.Rename, fails with across volumes.
+const errorNotSameDevice syscall.Errno = 17
+
+// isTransientRenameError reports whether a failed rename is worth retrying. Access denied
+// is included because Windows reports it, rather than a sharing violation, for a target
+// that is open for deletion or being scanned.
+func isTransientRenameError(err error) bool {
+	var errno syscall.Errno
+	if !errors.As(err, &errno) {
+		return false
+	}
+	switch errno {
+	case errorSharingViolation, errorLockViolation, syscall.ERROR_ACCESS_DENIED:
+		return true
+	}
+	return false
+}
+
+// isCrossDeviceError reports whether a rename failed because from and to are on different
+// volumes.
+func isCrossDeviceError(err error) bool {
+	return errors.Is(err, errorNotSameDevice) || errors.Is(err, syscall.EXDEV)
+}
@@ -5,20 +5,81 @@ import (
 	"bytes"
 	"crypto/sha1"
 	"fmt"
-	"os"
-	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 )
 
+// SubmoduleMode is the index and tree mode of a submodule entry. Like a Git gitlink, its
+// hash names a commit of the nested repository, not an object of this one.
+const SubmoduleMode uint32 = 0o160000
+
+// EmptyDirMode is the index and tree mode of an empty-directory placeholder. The entry,
+// named after the directory it stands for, points at the empty blob and is never a file
+// in the working tree; the mode, not the name, is what marks it.
+const EmptyDirMode uint32 = 0o040000
+
 // CreateTree creates a tree object from the current index and stores it
 // It ensures the process is deterministic by sorting the file paths
 func CreateTree() (string, error) {
-	index, err := LoadIndex()
+	hashes, modes, err := indexTree()
+	if err != nil {
+		return "", err
+	}
+	return WriteTreeWithModes(hashes, modes)
+}
+
+// ComputeTreeHash returns the hash CreateTree would give the current index, without
+// writing anything. It depends only on paths, content hashes and recorded modes, so two
+// identical working trees produce the same hash whatever their mtimes.
+func ComputeTreeHash() (string, error) {
+	hashes, modes, err := indexTree()
+	if err != nil {
+		return "", err
+	}
+	_, treeHash := encodeTree(hashes, modes)
+	return treeHash, nil
+}
+
+// indexTree splits the current index into the path -> hash and path -> mode maps a tree is built from.
+func indexTree() (map[string]string, map[string]uint32, error) {
+	index, err := LoadIndexWithMeta()
 	if err != nil {
+		return nil, nil, err
+	}
+	hashes := make(map[string]string, len(index))
+	modes := make(map[string]uint32)
+	for path, entry := range index {
+		hashes[path] = entry.Hash
+		if entry.Mode != 0 {
+			modes[path] = entry.Mode
+		}
+	}
+	return hashes, modes, nil
+}
+
+// WriteTree stores a tree object for an arbitrary path -> hash map and returns its hash.
+// Equal maps always produce the same tree hash.
+func WriteTree(index map[string]string) (string, error) {
+	return WriteTreeWithModes(index, nil)
+}
+
+// WriteTreeWithModes is WriteTree that also records permission bits for the paths in modes.
+// A tree line is "hash path", followed by NUL and the octal mode when one is recorded
+// (core.preservePermissions); trees without modes are byte-for-byte what older versions wrote.
+func WriteTreeWithModes(index map[string]string, modes map[string]uint32) (string, error) {
+	treeContent, treeHash := encodeTree(index, modes)
+
+	// Store the tree object in the object store
+	if _, err := WriteObject(treeContent); err != nil {
 		return "", err
 	}
 
+	return treeHash, nil
+}
+
+// encodeTree renders the deterministic tree content and its hash.
+func encodeTree(index map[string]string, modes map[string]uint32) ([]byte, string) {
 	var treeContent bytes.Buffer
 
 	// Sort keys to ensure the tree content is always in the same order
@@ -31,43 +92,72 @@ func CreateTree() (string, error) {
 	// Iterate over the sorted keys to build the tree content
 	for _, path := range keys {
 		hash := index[path]
+		if mode := modes[path]; mode != 0 {
+			treeContent.WriteString(fmt.Sprintf("%s %s\x00%o\n", hash, path, mode))
+			continue
+		}
 		treeContent.WriteString(fmt.Sprintf("%s %s\n", hash, path))
 	}
 
 	// Hash the deterministic tree content to get the tree's hash
 	h := sha1.New()
 	h.Write(treeContent.Bytes())
-	treeHash := fmt.Sprintf("%x", h.Sum(nil))
-
-	// Store the tree object in the objects directory
-	objectPath := filepath.Join(objectsDir, treeHash)
-	if err := os.WriteFile(objectPath, treeContent.Bytes(), 0644); err != nil {
-		return "", err
-	}
-
-	return treeHash, nil
+	return treeContent.Bytes(), fmt.Sprintf("%x", h.Sum(nil))
 }
 
 // ParseTree reads a tree object from storage and returns it as a map of path -> hash
-// This is the function that was missing
 func ParseTree(hash string) (map[string]string, error) {
-	tree := make(map[string]string)
-	objectPath := filepath.Join(objectsDir, hash)
-	data, err := os.ReadFile(objectPath)
+	tree, _, err := parseTreeObject(hash)
+	return tree, err
+}
+
+// ParseTreeModes returns the permission bits recorded in a tree, keyed by path.
+// Paths stored without a mode are absent.
+func ParseTreeModes(hash string) (map[string]uint32, error) {
+	_, modes, err := parseTreeObject(hash)
+	return modes, err
+}
+
+// ParseTreeObjects is ParseTree without submodule entries, whose hashes are commits of
+// another repository: every hash it returns names an object of this one.
+func ParseTreeObjects(hash string) (map[string]string, error) {
+	tree, modes, err := parseTreeObject(hash)
 	if err != nil {
 		return nil, err
 	}
+	for path, mode := range modes {
+		if mode == SubmoduleMode {
+			delete(tree, path)
+		}
+	}
+	return tree, nil
+}
+
+func parseTreeObject(hash string) (map[string]string, map[string]uint32, error) {
+	tree := make(map[string]string)
+	modes := make(map[string]uint32)
+	data, err := ReadObject(hash)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	scanner := bufio.NewScanner(bytes.NewReader(data))
 	for scanner.Scan() {
 		line := scanner.Text()
 		// The format is "hash path", so we split on the first space
 		parts := strings.SplitN(line, " ", 2)
-		if len(parts) == 2 {
-			// The hash is parts[0], the path is parts[1]
-			tree[parts[1]] = parts[0]
+		if len(parts) != 2 {
+			continue
+		}
+		// The hash is parts[0], the path is parts[1], optionally followed by NUL and a mode
+		path, modeStr, hasMode := strings.Cut(parts[1], "\x00")
+		tree[path] = parts[0]
+		if hasMode {
+			if mode, err := strconv.ParseUint(modeStr, 8, 32); err == nil {
+				modes[path] = uint32(mode)
+			}
 		}
 	}
 
-	return tree, scanner.Err()
+	return tree, modes, scanner.Err()
 }
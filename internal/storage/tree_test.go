@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestComputeTreeHash_IgnoresMetadataAndWritesNothing(t *testing.T) {
+	originalWd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(originalWd)
+	}()
+
+	// Two repositories with the same content but different stat metadata.
+	hashIn := func(mtime int64) string {
+		t.Helper()
+		if err := os.Chdir(t.TempDir()); err != nil {
+			t.Fatal(err)
+		}
+		index := map[string]IndexEntry{
+			"a.txt":     {Hash: "da39a3ee5e6b4b0d3255bfef95601890afd80709", ModTime: mtime, Size: 3},
+			"dir/b.txt": {Hash: "8843d7f92416211de9ebb963ff4ce28125932878", ModTime: mtime + 7, Size: 9},
+		}
+		if err := WriteIndexWithMeta(index); err != nil {
+			t.Fatal(err)
+		}
+		treeHash, err := ComputeTreeHash()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(filepath.Join(objectsDir(), treeHash)); !os.IsNotExist(err) {
+			t.Errorf("ComputeTreeHash wrote the tree object (stat err = %v)", err)
+		}
+		if err := os.MkdirAll(objectsDir(), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		stored, err := CreateTree()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored != treeHash {
+			t.Errorf("CreateTree = %s, ComputeTreeHash = %s", stored, treeHash)
+		}
+		return treeHash
+	}
+
+	if first, second := hashIn(1700000000), hashIn(1800000000); first != second {
+		t.Errorf("tree hash depends on mtime: %s vs %s", first, second)
+	}
+}
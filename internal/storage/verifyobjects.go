@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"os"
+	"sort"
+	"sync"
+)
+
+// CorruptObject is a stored object whose content no longer hashes to its name, or that
+// could not be read at all.
+type CorruptObject struct {
+	Hash   string
+	Reason string
+}
+
+// VerifyObjects recomputes the hash of every object in the store with up to workers
+// goroutines (fewer than 1 means 1) and returns the number checked and the corrupt
+// objects, sorted by hash whatever order the workers finish in. Loose objects are hashed
+// as they are streamed from disk, so memory stays bounded by the workers rather than the
+// object sizes; packed objects and other stores are read whole. Cancelling ctx stops the
+// workers and returns its error.
+func VerifyObjects(ctx context.Context, workers int) (int, []CorruptObject, error) {
+	hashes, err := objects.List()
+	if err != nil {
+		return 0, nil, err
+	}
+	workers = max(1, min(workers, len(hashes)))
+
+	queue := make(chan string)
+	var (
+		mu      sync.Mutex
+		corrupt []CorruptObject
+		wg      sync.WaitGroup
+	)
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for hash := range queue {
+				if reason := verifyObject(hash); reason != "" {
+					mu.Lock()
+					corrupt = append(corrupt, CorruptObject{Hash: hash, Reason: reason})
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	checked := 0
+	for _, hash := range hashes {
+		if ctx.Err() != nil {
+			break
+		}
+		queue <- hash
+		checked++
+	}
+	close(queue)
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return checked, nil, err
+	}
+
+	sort.Slice(corrupt, func(i, j int) bool { return corrupt[i].Hash < corrupt[j].Hash })
+	return checked, corrupt, nil
+}
+
+// verifyObject returns why the object for hash is corrupt, or "" when it hashes correctly.
+func verifyObject(hash string) string {
+	h := sha1.New()
+	if err := copyObject(h, hash); err != nil {
+		return "unreadable: " + err.Error()
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != hash {
+		return "content hashes to " + got
+	}
+	return ""
+}
+
+// copyObject writes an object's content to w, streaming loose objects from disk.
+func copyObject(w io.Writer, hash string) error {
+	if _, onDisk := objects.(DiskStore); onDisk {
+		path, _ := looseObjectPath(hash)
+		f, err := os.Open(path)
+		if err == nil {
+			defer f.Close()
+			_, err = io.Copy(w, f)
+			return err
+		}
+		if !os.IsNotExist(err) {
+			return err
+		}
+	}
+	data, err := objects.Read(hash)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestVerifyObjects_ReportsCorruptionInOrder(t *testing.T) {
+	originalWd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Chdir(originalWd)
+	}()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	var hashes []string
+	for _, content := range []string{"alpha", "beta", "gamma", "delta", "epsilon"} {
+		hash, err := WriteObject([]byte(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes = append(hashes, hash)
+	}
+	for _, hash := range []string{hashes[3], hashes[1]} {
+		if err := os.WriteFile(filepath.Join(objectsDir(), hash), []byte("bit rot"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var first []CorruptObject
+	for _, workers := range []int{1, 3, 16} {
+		checked, corrupt, err := VerifyObjects(context.Background(), workers)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if checked != len(hashes) || len(corrupt) != 2 {
+			t.Fatalf("workers=%d: checked %d, corrupt %+v", workers, checked, corrupt)
+		}
+		if corrupt[0].Hash > corrupt[1].Hash {
+			t.Errorf("workers=%d: corrupt objects not sorted: %+v", workers, corrupt)
+		}
+		if first == nil {
+			first = corrupt
+		} else if !reflect.DeepEqual(corrupt, first) {
+			t.Errorf("workers=%d: %+v, want %+v", workers, corrupt, first)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := VerifyObjects(ctx, 2); err == nil {
+		t.Error("cancelled VerifyObjects returned no error")
+	}
+}
@@ -0,0 +1,137 @@
+package diff_test
+
+import (
+	"math/rand"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/LeeFred3042U/kitcat/internal/diff"
+)
+
+// A function is added above one that is edited: the classic case where Myers matches up
+// braces and blank lines across the two functions.
+const movedOld = `#include <stdio.h>
+
+// Frobs foo heartily
+int frobnitz(int foo)
+{
+    int i;
+    for(i = 0; i < 10; i++)
+    {
+        printf("Your answer is: ");
+        printf("%d\n", foo);
+    }
+}
+
+int fact(int n)
+{
+    if(n > 1)
+    {
+        return fact(n-1) * n;
+    }
+    return 1;
+}
+
+int main(int argc, char **argv)
+{
+    frobnitz(fact(10));
+}`
+
+const movedNew = `#include <stdio.h>
+
+int fib(int n)
+{
+    if(n > 2)
+    {
+        return fib(n-1) + fib(n-2);
+    }
+    return 1;
+}
+
+// Frobs foo heartily
+int frobnitz(int foo)
+{
+    int i;
+    for(i = 0; i < 10; i++)
+    {
+        printf("%d\n", foo);
+    }
+}
+
+int main(int argc, char **argv)
+{
+    frobnitz(fib(10));
+}`
+
+func TestCompute_MovedFunctionBlocks(t *testing.T) {
+	oldLines, newLines := strings.Split(movedOld, "\n"), strings.Split(movedNew, "\n")
+	fib := newLines[2:11]
+
+	for _, alg := range []diff.Algorithm{diff.Patience, diff.Histogram} {
+		diffs := diff.Compute(alg, oldLines, newLines)
+		// fib arrives in one piece, and frobnitz keeps its header.
+		if len(diffs) < 2 || diffs[1].Operation != diff.INSERT || !reflect.DeepEqual(diffs[1].Text, fib) {
+			t.Errorf("%s: second hunk = %v, want fib inserted whole", alg, diffs[1])
+		}
+		for _, d := range diffs {
+			if d.Operation != diff.EQUAL && strings.Contains(strings.Join(d.Text, "\n"), "frobnitz(int foo)") {
+				t.Errorf("%s: frobnitz header reported as changed: %v", alg, d)
+			}
+		}
+	}
+
+	// Myers finds an edit script of the same minimal size but splits fib up.
+	diffs := diff.Compute(diff.Myers, oldLines, newLines)
+	for _, d := range diffs {
+		if d.Operation == diff.INSERT && reflect.DeepEqual(d.Text, fib) {
+			t.Errorf("myers inserted fib whole; the test case no longer shows the difference")
+		}
+	}
+}
+
+// Every algorithm must produce a valid edit script: the equal and deleted text spell
+// the old sequence and the equal and inserted text the new one.
+func TestCompute_ReconstructsBothSides(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	randomLines := func() []string {
+		lines := make([]string, rng.Intn(40))
+		for i := range lines {
+			lines[i] = string(rune('a' + rng.Intn(6)))
+		}
+		return lines
+	}
+	for _, alg := range []diff.Algorithm{diff.Myers, diff.Patience, diff.Histogram} {
+		for i := 0; i < 300; i++ {
+			a, b := randomLines(), randomLines()
+			aCopy, bCopy := append([]string(nil), a...), append([]string(nil), b...)
+			var gotA, gotB []string
+			for _, d := range diff.Compute(alg, a, b) {
+				if d.Operation != diff.INSERT {
+					gotA = append(gotA, d.Text...)
+				}
+				if d.Operation != diff.DELETE {
+					gotB = append(gotB, d.Text...)
+				}
+			}
+			if !slices.Equal(gotA, a) || !slices.Equal(gotB, b) {
+				t.Fatalf("%s: script for %v -> %v rebuilds %v -> %v", alg, a, b, gotA, gotB)
+			}
+			if !slices.Equal(a, aCopy) || !slices.Equal(b, bCopy) {
+				t.Fatalf("%s: inputs modified", alg)
+			}
+		}
+	}
+}
+
+func TestParseAlgorithm(t *testing.T) {
+	for name, want := range map[string]diff.Algorithm{"": diff.Myers, "myers": diff.Myers, "patience": diff.Patience, "histogram": diff.Histogram} {
+		if got, err := diff.ParseAlgorithm(name); err != nil || got != want {
+			t.Errorf("ParseAlgorithm(%q) = %q, %v", name, got, err)
+		}
+	}
+	if _, err := diff.ParseAlgorithm("minimal"); err == nil {
+		t.Error("ParseAlgorithm accepted an unknown name")
+	}
+}
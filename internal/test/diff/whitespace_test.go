@@ -0,0 +1,77 @@
+package diff_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/LeeFred3042U/kitcat/internal/diff"
+)
+
+func TestLines_Whitespace(t *testing.T) {
+	oldLines := []string{"func f() {", "\treturn 1", "}", "", "// done"}
+	newLines := []string{"func f() {  ", "    return 1", "}", "", "", "// done", "x := 2"}
+
+	tests := []struct {
+		name string
+		ws   diff.Whitespace
+		want []diff.Diff[string]
+	}{
+		{
+			name: "trailing whitespace",
+			ws:   diff.Whitespace{IgnoreTrailing: true},
+			want: []diff.Diff[string]{
+				{Operation: diff.EQUAL, Text: []string{"func f() {  "}},
+				{Operation: diff.DELETE, Text: []string{"\treturn 1"}},
+				{Operation: diff.INSERT, Text: []string{"    return 1"}},
+				{Operation: diff.EQUAL, Text: []string{"}", ""}},
+				{Operation: diff.INSERT, Text: []string{""}},
+				{Operation: diff.EQUAL, Text: []string{"// done"}},
+				{Operation: diff.INSERT, Text: []string{"x := 2"}},
+			},
+		},
+		{
+			name: "tabs versus spaces",
+			ws:   diff.Whitespace{IgnoreAll: true},
+			want: []diff.Diff[string]{
+				{Operation: diff.EQUAL, Text: []string{"func f() {  ", "    return 1", "}", ""}},
+				{Operation: diff.INSERT, Text: []string{""}},
+				{Operation: diff.EQUAL, Text: []string{"// done"}},
+				{Operation: diff.INSERT, Text: []string{"x := 2"}},
+			},
+		},
+		{
+			name: "all whitespace and blank lines",
+			ws:   diff.Whitespace{IgnoreAll: true, IgnoreBlankLines: true},
+			want: []diff.Diff[string]{
+				{Operation: diff.EQUAL, Text: []string{"func f() {  ", "    return 1", "}", "", "", "// done"}},
+				{Operation: diff.INSERT, Text: []string{"x := 2"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := diff.Lines(diff.Myers, tt.ws, oldLines, newLines)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Lines() = %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLines_BlankLineDeletionsIgnored(t *testing.T) {
+	oldLines := []string{"a", "", "  ", "b"}
+	newLines := []string{"a", "b"}
+	got := diff.Lines(diff.Myers, diff.Whitespace{IgnoreBlankLines: true}, oldLines, newLines)
+	want := []diff.Diff[string]{{Operation: diff.EQUAL, Text: []string{"a", "b"}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Lines() = %q, want %q", got, want)
+	}
+}
+
+func TestLines_NoOptionsMatchesCompute(t *testing.T) {
+	a := []string{"x ", "y"}
+	b := []string{"x", "y"}
+	if got, want := diff.Lines(diff.Patience, diff.Whitespace{}, a, b), diff.Compute(diff.Patience, a, b); !reflect.DeepEqual(got, want) {
+		t.Errorf("Lines() = %q, want %q", got, want)
+	}
+}